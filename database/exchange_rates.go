@@ -0,0 +1,89 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrExchangeRatesNotFound is returned by exchange rate providers when they
+// don't have rates for the requested date or currency.
+var ErrExchangeRatesNotFound = errors.New("exchange rates not found")
+
+// ExchangeRateProvider gets exchange rates from an external source. Rates are
+// amounts of other currencies that can be bought with one unit of the base
+// currency on the specified date.
+type ExchangeRateProvider interface {
+	Rates(date time.Time, base string) (map[string]float64, error)
+}
+
+// ExchangeRateProviderOptions options for selecting an exchange rate provider
+type ExchangeRateProviderOptions struct {
+	// Type of the provider. Can be http or empty if rates are only imported.
+	Type string
+	// URL of the http provider. {date} and {base} are replaced with the date
+	// in YYYY-MM-DD format and the base currency code.
+	URL string
+}
+
+// NewExchangeRateProvider creates an exchange rate provider of the specified
+// type. If no type is specified, nil is returned.
+func (o ExchangeRateProviderOptions) NewExchangeRateProvider() (ExchangeRateProvider, error) {
+	switch o.Type {
+	case "":
+		return nil, nil
+	case "http":
+		if o.URL == "" {
+			return nil, errors.New("url of the http exchange rate provider is not specified")
+		}
+		return HTTPExchangeRateProvider{
+			URL:    o.URL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, errors.New("unknown exchange rate provider type " + o.Type)
+	}
+}
+
+// HTTPExchangeRateProvider gets exchange rates from an HTTP API that responds
+// with a JSON object with rates keyed by currency codes, like
+// {"base": "EUR", "rates": {"USD": 1.08}}. APIs like Frankfurter can be used
+// or a local stub for testing.
+type HTTPExchangeRateProvider struct {
+	URL    string
+	Client *http.Client
+}
+
+// Rates gets exchange rates for the base currency on the specified date
+func (p HTTPExchangeRateProvider) Rates(date time.Time, base string) (map[string]float64, error) {
+	url := strings.NewReplacer("{date}", date.Format("2006-01-02"), "{base}", base).Replace(p.URL)
+
+	response, err := p.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrExchangeRatesNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate provider responded with status %d", response.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if len(body.Rates) == 0 {
+		return nil, ErrExchangeRatesNotFound
+	}
+
+	return body.Rates, nil
+}
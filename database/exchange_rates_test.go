@@ -0,0 +1,70 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPExchangeRateProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-06-01/EUR":
+			w.Write([]byte(`{"base": "EUR", "rates": {"USD": 1.11, "RSD": 117.57}}`))
+		case "/2020-06-02/EUR":
+			w.Write([]byte(`{"base": "EUR", "rates": {}}`))
+		case "/2020-06-03/EUR":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/2020-06-04/EUR":
+			w.Write([]byte(`{"base": "EUR", "rates": `))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := HTTPExchangeRateProvider{
+		URL:    server.URL + "/{date}/{base}",
+		Client: server.Client(),
+	}
+	day := func(d int) time.Time {
+		return time.Date(2020, 6, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rates, err := provider.Rates(day(1), "EUR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rates) != 2 || rates["USD"] != 1.11 || rates["RSD"] != 117.57 {
+			t.Errorf("got rates %v", rates)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := provider.Rates(day(1), "USD"); err != ErrExchangeRatesNotFound {
+			t.Errorf("got error %v, want %v", err, ErrExchangeRatesNotFound)
+		}
+	})
+
+	t.Run("no rates", func(t *testing.T) {
+		if _, err := provider.Rates(day(2), "EUR"); err != ErrExchangeRatesNotFound {
+			t.Errorf("got error %v, want %v", err, ErrExchangeRatesNotFound)
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		_, err := provider.Rates(day(3), "EUR")
+		if err == nil || err == ErrExchangeRatesNotFound {
+			t.Errorf("got error %v, want a status error", err)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := provider.Rates(day(4), "EUR")
+		if err == nil || err == ErrExchangeRatesNotFound {
+			t.Errorf("got error %v, want a decoding error", err)
+		}
+	})
+}
@@ -1,6 +1,10 @@
 package database
 
-import "github.com/bradfitz/gomemcache/memcache"
+import (
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
 
 // MemcachedOptions options for memcached database
 type MemcachedOptions struct {
@@ -11,3 +15,42 @@ type MemcachedOptions struct {
 func (o MemcachedOptions) NewConnection() *memcache.Client {
 	return memcache.New(o.Addr)
 }
+
+// NewSessionStore creates a session store backed by memcached
+func (o MemcachedOptions) NewSessionStore() SessionStore {
+	return memcachedSessionStore{
+		client: o.NewConnection(),
+	}
+}
+
+type memcachedSessionStore struct {
+	client *memcache.Client
+}
+
+func (s memcachedSessionStore) Get(key string) (string, error) {
+	item, err := s.client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return "", ErrSessionNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(item.Value), nil
+}
+
+func (s memcachedSessionStore) Set(key, value string, expiration time.Duration) error {
+	return s.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      []byte(value),
+		Expiration: int32(expiration / time.Second),
+	})
+}
+
+func (s memcachedSessionStore) Delete(key string) error {
+	if err := s.client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+		return err
+	}
+
+	return nil
+}
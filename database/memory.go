@@ -0,0 +1,78 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+type memorySessionStoreItem struct {
+	value     string
+	expiresAt time.Time
+}
+
+// MemorySessionStore is an in-process session store. It's meant to be used for
+// local development so there is no need to run a separate database for
+// sessions. Sessions are lost when the process exits.
+type MemorySessionStore struct {
+	mutex sync.Mutex
+	items map[string]memorySessionStoreItem
+}
+
+// NewMemorySessionStore creates a new empty in-process session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		items: map[string]memorySessionStoreItem{},
+	}
+}
+
+// Get gets the value of a session that hasn't expired
+func (s *MemorySessionStore) Get(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		delete(s.items, key)
+		return "", ErrSessionNotFound
+	}
+
+	return item.value, nil
+}
+
+// Set stores the session. If expiration is zero, session never expires.
+func (s *MemorySessionStore) Set(key, value string, expiration time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Remove expired sessions so the map doesn't grow forever
+	now := time.Now()
+	for k, item := range s.items {
+		if !item.expiresAt.IsZero() && now.After(item.expiresAt) {
+			delete(s.items, k)
+		}
+	}
+
+	item := memorySessionStoreItem{
+		value: value,
+	}
+	if expiration > 0 {
+		item.expiresAt = now.Add(expiration)
+	}
+	s.items[key] = item
+
+	return nil
+}
+
+// Delete removes the session from the store
+func (s *MemorySessionStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.items, key)
+
+	return nil
+}
@@ -0,0 +1,813 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// migration changes the schema of an existing database. Migrations are
+// applied in order and the number of applied migrations is stored in the
+// user_version pragma of the database so each one is applied only once.
+type migration func(tx *sqlx.Tx) error
+
+var migrations = []migration{
+	migrateHouseholds,
+	migrateReceiptShares,
+	migrateUserRoles,
+	migrateHouseholdUniqueNames,
+	migrateDeleteActions,
+	migrateSoftDelete,
+	migrateMoneyMinorUnits,
+	migrateCurrencies,
+	migrateTaxes,
+	migrateDiscounts,
+	migratePaymentMethods,
+	migrateRefunds,
+	migratePurchaseDetails,
+	migrateFiscalImport,
+	migrateItemCategories,
+	migrateLedgerAccounts,
+	migrateReconciliation,
+	migrateBudgets,
+	migrateItemPackages,
+	migrateItemBarcodes,
+	migrateConfiguredAdmins,
+	migrateZeroPayments,
+	migrateProductMisses,
+}
+
+// Migrate applies all migrations that haven't been applied to the database.
+// Foreign keys are disabled while migrating so tables can be rebuilt and are
+// checked after all migrations are applied.
+func Migrate(db *sqlx.DB) error {
+	ctx := context.Background()
+
+	// Pragmas are set per connection so the same connection has to be used for
+	// the whole migration
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version == len(migrations) {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = off"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = on")
+
+	for ; version < len(migrations); version++ {
+		sqlTx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		tx := &sqlx.Tx{Tx: sqlTx, Mapper: db.Mapper}
+
+		if err := migrations[version](tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Pragma statements can't have bound parameters
+		if _, err := tx.Exec("PRAGMA user_version = " + strconv.Itoa(version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	violations, err := conn.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer violations.Close()
+
+	if violations.Next() {
+		var table string
+		var rowID, parent, foreignKey interface{}
+		if err := violations.Scan(&table, &rowID, &parent, &foreignKey); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("foreign key constraint violated in table %s (row %v references missing %v)", table, rowID, parent)
+	}
+
+	return violations.Err()
+}
+
+func execAll(tx *sqlx.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateHouseholds adds households and moves every location, item and
+// receipt into a personal household of the user that created it.
+func migrateHouseholds(tx *sqlx.Tx) error {
+	if err := execAll(tx, `
+	create table households (
+		id integer primary key autoincrement unique,
+		public_id text not null unique,
+		name text not null,
+		created_by integer not null,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		foreign key (created_by) references users(id)
+	);`, `
+	create table household_members (
+		id integer primary key autoincrement unique,
+		household_id integer not null,
+		user_id integer not null,
+		role text not null check (role in ('owner', 'member', 'viewer')),
+		created_at datetime default current_timestamp,
+
+		unique (household_id, user_id),
+		foreign key (household_id) references households(id),
+		foreign key (user_id) references users(id)
+	);`, `
+	create table household_invitations (
+		id integer primary key autoincrement unique,
+		household_id integer not null,
+		public_id text not null unique,
+		role text not null check (role in ('owner', 'member', 'viewer')),
+		invited_by integer not null,
+		accepted_by integer,
+		created_at datetime default current_timestamp,
+		expires_at datetime not null,
+		accepted_at datetime,
+
+		foreign key (household_id) references households(id),
+		foreign key (invited_by) references users(id),
+		foreign key (accepted_by) references users(id)
+	);`,
+		`alter table locations add column household_id integer references households(id);`,
+		`alter table items add column household_id integer references households(id);`,
+		`alter table receipts add column household_id integer references households(id);`,
+	); err != nil {
+		return err
+	}
+
+	type user struct {
+		ID       int    `db:"id"`
+		RealName string `db:"real_name"`
+	}
+	users := []user{}
+	if err := tx.Select(&users, "select id, real_name from users"); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		householdID, err := CreateHousehold(tx, u.ID, u.RealName)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range []string{"locations", "items", "receipts"} {
+			if _, err := tx.Exec("update "+table+" set household_id = ? where created_by = ?", householdID, u.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrateReceiptShares adds public share links for receipts
+func migrateReceiptShares(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table receipt_shares (
+		id integer primary key autoincrement unique,
+		receipt_id integer not null,
+		created_by integer not null,
+		public_id text not null unique,
+		created_at datetime default current_timestamp,
+		expires_at datetime,
+		revoked_at datetime,
+
+		foreign key (receipt_id) references receipts(id),
+		foreign key (created_by) references users(id)
+	);`)
+}
+
+// migrateUserRoles adds roles to users, an option to disable users and their
+// sessions and a log of actions done by administrators. Audit log stores
+// public ids so entries are kept after users are deleted.
+func migrateUserRoles(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table users add column role text not null default 'user' check (role in ('user', 'admin'));`,
+		`alter table users add column disabled_at datetime;`,
+		`alter table users add column sessions_revoked_at datetime;`, `
+	create table admin_audit_log (
+		id integer primary key autoincrement unique,
+		admin_id text not null,
+		action text not null,
+		target_id text,
+		details text,
+		created_at datetime default current_timestamp
+	);`)
+}
+
+// migrateHouseholdUniqueNames makes names of items and locations unique per
+// household instead of globally. SQLite can't drop constraints so both tables
+// are rebuilt and the data is copied over.
+func migrateHouseholdUniqueNames(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table locations_new (
+		id integer primary key autoincrement unique,
+		created_by integer not null,
+		household_id integer not null,
+		public_id text not null unique,
+		name text not null,
+		address text not null,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		unique (household_id, name),
+		foreign key (created_by) references users(id),
+		foreign key (household_id) references households(id)
+	);`,
+		`insert into locations_new (id, created_by, household_id, public_id, name, address, created_at, updated_at)
+		select id, created_by, household_id, public_id, name, address, created_at, updated_at from locations;`,
+		`drop table locations;`,
+		`alter table locations_new rename to locations;`, `
+	create table items_new (
+		id integer primary key autoincrement unique,
+		created_by integer not null,
+		household_id integer not null,
+		public_id text not null unique,
+		name text not null,
+		price real not null,
+		unit text not null,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		unique (household_id, name),
+		foreign key (created_by) references users(id),
+		foreign key (household_id) references households(id)
+	);`,
+		`insert into items_new (id, created_by, household_id, public_id, name, price, unit, created_at, updated_at)
+		select id, created_by, household_id, public_id, name, price, unit, created_at, updated_at from items;`,
+		`drop table items;`,
+		`alter table items_new rename to items;`,
+	)
+}
+
+// migrateDeleteActions rebuilds tables that reference receipts, locations and
+// items so their foreign keys have explicit delete actions. Lines and share
+// links are deleted with their receipt while receipts, locations and items
+// can't be deleted while something references them. Receipts of deleted
+// locations and lines of deleted items are kept by moving them to placeholder
+// records of their household. Lines and share links of deleted receipts don't
+// belong to any household anymore so they are logged and removed.
+func migrateDeleteActions(tx *sqlx.Tx) error {
+	var orphans struct {
+		Receipts int `db:"receipts"`
+		Lines    int `db:"lines"`
+		Items    int `db:"items"`
+		Shares   int `db:"shares"`
+	}
+	if err := tx.Get(&orphans, `select
+		(select count(*) from receipts where location_id not in (select id from locations)) as receipts,
+		(select count(*) from items_in_receipt where receipt_id not in (select id from receipts)) as lines,
+		(select count(*) from items_in_receipt where receipt_id in (select id from receipts) and item_id not in (select id from items)) as items,
+		(select count(*) from receipt_shares where receipt_id not in (select id from receipts)) as shares`); err != nil {
+		return err
+	}
+
+	if orphans.Receipts > 0 {
+		log.Printf("migration: moving %d receipts of deleted locations to %q", orphans.Receipts, unknownLocationName)
+	}
+	if orphans.Items > 0 {
+		log.Printf("migration: moving %d lines of deleted items to %q", orphans.Items, unknownItemName)
+	}
+	if orphans.Lines > 0 {
+		log.Printf("migration: removing %d lines of deleted receipts", orphans.Lines)
+	}
+	if orphans.Shares > 0 {
+		log.Printf("migration: removing %d share links of deleted receipts", orphans.Shares)
+	}
+
+	type owner struct {
+		HouseholdID int `db:"household_id"`
+		CreatedBy   int `db:"created_by"`
+	}
+
+	receiptOwners := []owner{}
+	if err := tx.Select(&receiptOwners, "select household_id, min(created_by) as created_by from receipts where location_id not in (select id from locations) group by household_id"); err != nil {
+		return err
+	}
+	for _, o := range receiptOwners {
+		locationID, err := placeholderID(tx, "locations", "insert into locations (created_by, household_id, public_id, name, address) values (?, ?, ?, ?, '')", o.CreatedBy, o.HouseholdID, unknownLocationName)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("update receipts set location_id = ? where household_id = ? and location_id not in (select id from locations)", locationID, o.HouseholdID); err != nil {
+			return err
+		}
+	}
+
+	lineOwners := []owner{}
+	if err := tx.Select(&lineOwners, "select receipts.household_id, min(receipts.created_by) as created_by from items_in_receipt join receipts on receipts.id = items_in_receipt.receipt_id where items_in_receipt.item_id not in (select id from items) group by receipts.household_id"); err != nil {
+		return err
+	}
+	for _, o := range lineOwners {
+		itemID, err := placeholderID(tx, "items", "insert into items (created_by, household_id, public_id, name, price, unit) values (?, ?, ?, ?, 0, 'kom')", o.CreatedBy, o.HouseholdID, unknownItemName)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("update items_in_receipt set item_id = ? where item_id not in (select id from items) and receipt_id in (select id from receipts where household_id = ?)", itemID, o.HouseholdID); err != nil {
+			return err
+		}
+	}
+
+	return execAll(tx,
+		`delete from items_in_receipt where receipt_id not in (select id from receipts);`,
+		`delete from receipt_shares where receipt_id not in (select id from receipts);`, `
+	create table receipts_new (
+		id integer primary key autoincrement unique,
+		location_id integer not null,
+		household_id integer not null,
+		created_by integer not null,
+		public_id text not null unique,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		foreign key (location_id) references locations(id) on delete restrict,
+		foreign key (household_id) references households(id),
+		foreign key (created_by) references users(id)
+	);`,
+		`insert into receipts_new (id, location_id, household_id, created_by, public_id, created_at, updated_at)
+		select id, location_id, household_id, created_by, public_id, created_at, updated_at from receipts;`,
+		`drop table receipts;`,
+		`alter table receipts_new rename to receipts;`, `
+	create table items_in_receipt_new (
+		id integer primary key autoincrement unique,
+		receipt_id integer not null,
+		item_id integer not null,
+		public_id text not null unique,
+		amount real default 1.0,
+
+		foreign key (receipt_id) references receipts(id) on delete cascade,
+		foreign key (item_id) references items(id) on delete restrict
+	);`,
+		`insert into items_in_receipt_new (id, receipt_id, item_id, public_id, amount)
+		select id, receipt_id, item_id, public_id, amount from items_in_receipt;`,
+		`drop table items_in_receipt;`,
+		`alter table items_in_receipt_new rename to items_in_receipt;`, `
+	create table receipt_shares_new (
+		id integer primary key autoincrement unique,
+		receipt_id integer not null,
+		created_by integer not null,
+		public_id text not null unique,
+		created_at datetime default current_timestamp,
+		expires_at datetime,
+		revoked_at datetime,
+
+		foreign key (receipt_id) references receipts(id) on delete cascade,
+		foreign key (created_by) references users(id)
+	);`,
+		`insert into receipt_shares_new (id, receipt_id, created_by, public_id, created_at, expires_at, revoked_at)
+		select id, receipt_id, created_by, public_id, created_at, expires_at, revoked_at from receipt_shares;`,
+		`drop table receipt_shares;`,
+		`alter table receipt_shares_new rename to receipt_shares;`,
+	)
+}
+
+// Names of placeholder records that records referencing deleted locations and
+// items are moved to
+const (
+	unknownLocationName = "Unknown location"
+	unknownItemName     = "Unknown item"
+)
+
+// placeholderID gets the id of the record of the household with the name in
+// the table. If there is no such record, it's created with the insert
+// statement which gets the creator, household, a new public id and the name.
+func placeholderID(tx *sqlx.Tx, table, insert string, createdBy, householdID int, name string) (int64, error) {
+	var id int64
+	err := tx.Get(&id, "select id from "+table+" where household_id = ? and name = ?", householdID, name)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	uuid, err := nanoid.Nanoid()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(insert, createdBy, householdID, uuid, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// migrateSoftDelete adds a time of deletion to records that can be restored
+// from the trash and an id of the deletion so receipts deleted with their
+// location are restored with it
+func migrateSoftDelete(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table locations add column deleted_at datetime;`,
+		`alter table items add column deleted_at datetime;`,
+		`alter table receipts add column deleted_at datetime;`,
+		`alter table locations add column delete_batch text;`,
+		`alter table items add column delete_batch text;`,
+		`alter table receipts add column delete_batch text;`,
+		`create index receipts_delete_batch on receipts (delete_batch);`,
+	)
+}
+
+// migrateMoneyMinorUnits stores prices of items as integer minor units
+// (cents) instead of floating point numbers. Existing prices are rounded to
+// the nearest minor unit.
+func migrateMoneyMinorUnits(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table items_new (
+		id integer primary key autoincrement unique,
+		created_by integer not null,
+		household_id integer not null,
+		public_id text not null unique,
+		name text not null,
+		price integer not null,
+		unit text not null,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+		deleted_at datetime,
+		delete_batch text,
+
+		unique (household_id, name),
+		foreign key (created_by) references users(id),
+		foreign key (household_id) references households(id)
+	);`,
+		`insert into items_new (id, created_by, household_id, public_id, name, price, unit, created_at, updated_at, deleted_at, delete_batch)
+		select id, created_by, household_id, public_id, name, cast(round(price * 100) as integer), unit, created_at, updated_at, deleted_at, delete_batch from items;`,
+		`drop table items;`,
+		`alter table items_new rename to items;`,
+	)
+}
+
+// migrateCurrencies adds currencies to receipts, a default currency of users
+// and exchange rates between currencies. Existing receipts get the default
+// currency of the user that created them.
+func migrateCurrencies(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table users add column currency text not null default 'RSD';`,
+		`alter table receipts add column currency text not null default 'RSD';`,
+		`update receipts set currency = (select currency from users where users.id = receipts.created_by);`, `
+	create table exchange_rates (
+		id integer primary key autoincrement unique,
+		date text not null,
+		base text not null,
+		quote text not null,
+		rate real not null check (rate > 0),
+		created_at datetime default current_timestamp,
+
+		unique (date, base, quote)
+	);`,
+	)
+}
+
+// migrateTaxes adds tax rates that can be defined by users or for a country
+// and tax labels on receipt lines. Rates are stored in hundredths of a
+// percent. Lines keep the rate they were added with so later changes of rates
+// don't change old receipts. Serbian VAT rates are added for users in Serbia.
+func migrateTaxes(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table users add column country text not null default 'RS';`, `
+	create table tax_rates (
+		id integer primary key autoincrement unique,
+		public_id text not null unique,
+		user_id integer,
+		country text,
+		label text not null,
+		name text not null default '',
+		rate integer not null check (rate >= 0),
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		check ((user_id is null) != (country is null)),
+		unique (user_id, label),
+		unique (country, label),
+		foreign key (user_id) references users(id)
+	);`,
+		`insert into tax_rates (public_id, country, label, name, rate) values
+		('rs-vat-general', 'RS', 'Ђ', 'Општа стопа ПДВ', 2000),
+		('rs-vat-special', 'RS', 'Е', 'Посебна стопа ПДВ', 1000),
+		('rs-vat-exempt', 'RS', 'А', 'Ослобођено ПДВ', 0);`,
+		`alter table items_in_receipt add column tax_label text;`,
+		`alter table items_in_receipt add column tax_rate integer;`,
+	)
+}
+
+// migrateDiscounts adds discounts on receipt lines and on whole receipts.
+// Percent discounts are stored in hundredths of a percent and fixed discounts
+// in minor units.
+func migrateDiscounts(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table items_in_receipt add column discount_type text check (discount_type in ('percent', 'fixed'));`,
+		`alter table items_in_receipt add column discount_value integer check (discount_value >= 0);`,
+		`alter table receipts add column discount_type text check (discount_type in ('percent', 'fixed'));`,
+		`alter table receipts add column discount_value integer check (discount_value >= 0);`,
+	)
+}
+
+// migratePaymentMethods adds payment methods of households and payments of
+// receipts. A receipt can be paid with more than one payment method.
+func migratePaymentMethods(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table payment_methods (
+		id integer primary key autoincrement unique,
+		public_id text not null unique,
+		household_id integer not null,
+		created_by integer not null,
+		name text not null,
+		type text not null default 'other' check (type in ('cash', 'card', 'voucher', 'other')),
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		unique (household_id, name),
+		foreign key (household_id) references households(id),
+		foreign key (created_by) references users(id)
+	);`, `
+	create table receipt_payments (
+		id integer primary key autoincrement unique,
+		receipt_id integer not null,
+		payment_method_id integer not null,
+		amount integer not null check (amount > 0),
+
+		foreign key (receipt_id) references receipts(id) on delete cascade,
+		foreign key (payment_method_id) references payment_methods(id) on delete restrict
+	);`,
+	)
+}
+
+// migrateRefunds adds references of refund receipts to original receipts and
+// of refunded lines to original lines. Refunds are deleted with the original.
+func migrateRefunds(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table receipts add column refund_of integer references receipts(id) on delete cascade;`,
+		`alter table items_in_receipt add column refund_of integer references items_in_receipt(id) on delete cascade;`,
+	)
+}
+
+// migratePurchaseDetails adds the time of purchase with its time zone, notes
+// and fiscal ids to receipts and a default time zone of users. Receipts were
+// dated by created_at until now so it's used as the time of purchase.
+func migratePurchaseDetails(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table users add column time_zone text not null default 'Europe/Belgrade';`,
+		`alter table receipts add column purchased_at datetime;`,
+		`alter table receipts add column time_zone text;`,
+		`alter table receipts add column notes text;`,
+		`alter table receipts add column fiscal_id text;`,
+		`update receipts set purchased_at = created_at, time_zone = (select time_zone from users where users.id = receipts.created_by);`,
+	)
+}
+
+// migrateFiscalImport adds tax ids of companies to locations and prices to
+// lines. Imported receipts keep the price of each line even when the item has
+// a different price. Lines without a price use the price of the item.
+func migrateFiscalImport(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table locations add column tax_id text;`,
+		`alter table items_in_receipt add column price integer;`,
+	)
+}
+
+// migrateItemCategories adds a category and tags to items
+func migrateItemCategories(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table items add column category text;`, `
+	create table item_tags (
+		id integer primary key autoincrement unique,
+		item_id integer not null,
+		household_id integer not null,
+		tag text not null,
+		created_at datetime default current_timestamp,
+
+		unique (item_id, tag),
+		foreign key (item_id) references items(id) on delete cascade,
+		foreign key (household_id) references households(id)
+	);`,
+		`create index item_tags_household_id_tag on item_tags (household_id, tag);`,
+	)
+}
+
+// migrateLedgerAccounts adds accounts of users for exports to plain text
+// accounting. Each row maps an item, a category or a tag of items, a location,
+// a payment method or a type of payment methods by name to an account, default
+// accounts have the kind default and the name expense or asset.
+func migrateLedgerAccounts(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table ledger_accounts (
+		id integer primary key autoincrement unique,
+		user_id integer not null,
+		kind text not null check (kind in ('default', 'item', 'category', 'tag', 'location', 'payment_method', 'payment_type')),
+		name text not null,
+		account text not null,
+
+		unique (user_id, kind, name),
+		foreign key (user_id) references users(id)
+	);`,
+	)
+}
+
+// migrateReconciliation adds transactions of bank statements to receipts.
+// Transactions are stored when a match of a statement and a receipt is
+// confirmed.
+func migrateReconciliation(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table receipts add column statement_date text;`,
+		`alter table receipts add column statement_amount integer;`,
+		`alter table receipts add column statement_currency text;`,
+		`alter table receipts add column statement_reference text;`,
+		`alter table receipts add column statement_description text;`,
+		`alter table receipts add column reconciled_at datetime;`,
+	)
+}
+
+// migrateBudgets adds weekly and monthly budgets of households, locations,
+// items, categories and tags of items and alerts that are created when
+// spending in a period of a budget reaches a threshold. Periods of a budget
+// start at midnight in its time zone and each threshold alerts once per period.
+func migrateBudgets(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table budgets (
+		id integer primary key autoincrement unique,
+		public_id text not null unique,
+		household_id integer not null,
+		created_by integer not null,
+		name text not null,
+		period text not null check (period in ('week', 'month')),
+		scope text not null check (scope in ('total', 'location', 'item', 'category', 'tag')),
+		location_id integer,
+		item_id integer,
+		category text,
+		tag text,
+		amount integer not null check (amount > 0),
+		currency text not null,
+		time_zone text not null,
+		created_at datetime default current_timestamp,
+		updated_at datetime default current_timestamp,
+
+		check ((scope = 'location') = (location_id is not null)),
+		check ((scope = 'item') = (item_id is not null)),
+		check ((scope = 'category') = (category is not null)),
+		check ((scope = 'tag') = (tag is not null)),
+		foreign key (household_id) references households(id),
+		foreign key (created_by) references users(id),
+		foreign key (location_id) references locations(id) on delete cascade,
+		foreign key (item_id) references items(id) on delete cascade
+	);`, `
+	create table budget_alerts (
+		id integer primary key autoincrement unique,
+		public_id text not null unique,
+		budget_id integer not null,
+		receipt_id integer,
+		period text not null,
+		threshold integer not null,
+		spent integer not null,
+		created_at datetime default current_timestamp,
+		read_at datetime,
+
+		unique (budget_id, period, threshold),
+		foreign key (budget_id) references budgets(id) on delete cascade,
+		foreign key (receipt_id) references receipts(id) on delete set null
+	);`,
+	)
+}
+
+// migrateItemPackages adds an optional package size to items so prices of
+// items counted in pieces can be normalized to a price per kg or l. Units of
+// package sizes are checked against the unit registry by handlers.
+func migrateItemPackages(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table items add column package_size real check (package_size > 0);`,
+		`alter table items add column package_unit text check ((package_size is null) = (package_unit is null));`,
+	)
+}
+
+// migrateItemBarcodes adds barcodes of items and products found by the
+// product lookup. A barcode belongs to one item of a household and is deleted
+// with the item, products are shared by all households so a barcode is looked
+// up only once.
+func migrateItemBarcodes(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table item_barcodes (
+		id integer primary key autoincrement unique,
+		item_id integer not null,
+		household_id integer not null,
+		code text not null,
+		created_at datetime default current_timestamp,
+
+		unique (household_id, code),
+		foreign key (item_id) references items(id) on delete cascade,
+		foreign key (household_id) references households(id)
+	);`,
+		`create index item_barcodes_item_id on item_barcodes (item_id);`, `
+	create table products (
+		code text primary key,
+		name text not null,
+		brand text not null default '',
+		quantity real not null default 0,
+		unit text not null default '',
+		created_at datetime default current_timestamp
+	);`,
+	)
+}
+
+// migrateConfiguredAdmins marks administrators that got their role from the
+// configuration so they are demoted when they are removed from it. Existing
+// administrators are assumed to come from the configuration since there is no
+// way to tell.
+func migrateConfiguredAdmins(tx *sqlx.Tx) error {
+	return execAll(tx,
+		`alter table users add column admin_from_config boolean not null default 0;`,
+		`update users set admin_from_config = 1 where role = 'admin';`,
+	)
+}
+
+// migrateZeroPayments rebuilds payments of receipts so a receipt with a zero
+// total, e.g. one that was fully discounted, can be paid with a single payment
+// method. Split payments are still checked to be positive by handlers.
+func migrateZeroPayments(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table receipt_payments_new (
+		id integer primary key autoincrement unique,
+		receipt_id integer not null,
+		payment_method_id integer not null,
+		amount integer not null check (amount >= 0),
+
+		foreign key (receipt_id) references receipts(id) on delete cascade,
+		foreign key (payment_method_id) references payment_methods(id) on delete restrict
+	);`,
+		`insert into receipt_payments_new (id, receipt_id, payment_method_id, amount)
+		select id, receipt_id, payment_method_id, amount from receipt_payments;`,
+		`drop table receipt_payments;`,
+		`alter table receipt_payments_new rename to receipt_payments;`,
+	)
+}
+
+// migrateProductMisses adds barcodes that the product database didn't know so
+// they are not looked up again on every scan. Handlers look them up again
+// after some time in case the product was added.
+func migrateProductMisses(tx *sqlx.Tx) error {
+	return execAll(tx, `
+	create table product_misses (
+		code text primary key,
+		checked_at datetime not null
+	);`,
+	)
+}
+
+// CreateHousehold creates a household with the user as its owner and returns
+// id of the household. Every user gets one when signing up so there is always
+// a household to store records in.
+func CreateHousehold(tx *sqlx.Tx, userID int, name string) (int64, error) {
+	uuid, err := nanoid.Nanoid()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("insert into households (public_id, name, created_by) values (?, ?, ?)", uuid, name, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	householdID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("insert into household_members (household_id, user_id, role) values (?, ?, 'owner')", householdID, userID); err != nil {
+		return 0, err
+	}
+
+	return householdID, nil
+}
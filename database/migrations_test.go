@@ -0,0 +1,262 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newBaselineDB creates a database with the schema of the first version in a
+// temporary directory that is removed when the test ends
+func newBaselineDB(t *testing.T) *sqlx.DB {
+	dir, err := ioutil.TempDir("", "receipts-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	db, err := sqlx.Connect("sqlite3", filepath.Join(dir, "database.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	for _, statement := range baselineSchema {
+		db.MustExec(statement)
+	}
+
+	return db
+}
+
+func TestMigrateSoftDelete(t *testing.T) {
+	db := newBaselineDB(t)
+	db.MustExec("INSERT INTO users (public_id, real_name) VALUES ('user', 'User')")
+	db.MustExec("INSERT INTO locations (created_by, public_id, name, address) VALUES (1, 'location', 'Maxi', 'Bulevar 1')")
+	db.MustExec("INSERT INTO items (created_by, public_id, name, price, unit) VALUES (1, 'item', 'Milk', 1.5, 'l')")
+	db.MustExec("INSERT INTO receipts (location_id, created_by, public_id) VALUES (1, 1, 'receipt')")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	// Migrating a database that is up to date doesn't change it
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var version int
+	if err := db.Get(&version, "PRAGMA user_version"); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("version is %d, want %d", version, len(migrations))
+	}
+
+	// Records that existed before the trash are not in it
+	var deleted int
+	if err := db.Get(&deleted, "SELECT (SELECT COUNT(*) FROM locations WHERE deleted_at IS NOT NULL OR delete_batch IS NOT NULL) + (SELECT COUNT(*) FROM items WHERE deleted_at IS NOT NULL OR delete_batch IS NOT NULL) + (SELECT COUNT(*) FROM receipts WHERE deleted_at IS NOT NULL OR delete_batch IS NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Errorf("%d records are deleted after migrating, want 0", deleted)
+	}
+}
+
+func TestMigrateMoneyMinorUnits(t *testing.T) {
+	db := newBaselineDB(t)
+	db.MustExec("insert into users (public_id, real_name) values ('user', 'User')")
+
+	prices := []struct {
+		name  string
+		price float64
+		want  int64
+	}{
+		{"rounded up", 1.299, 130},
+		{"rounded down", 1.294, 129},
+		{"whole", 12, 1200},
+		{"two decimals", 0.99, 99},
+		{"one decimal", 2.5, 250},
+	}
+	for _, p := range prices {
+		db.MustExec("insert into items (created_by, public_id, name, price, unit) values (1, ?, ?, ?, 'kom')", p.name, p.name, p.price)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range prices {
+		var price int64
+		if err := db.Get(&price, "select price from items where public_id = ?", p.name); err != nil {
+			t.Fatal(err)
+		}
+		if price != p.want {
+			t.Errorf("%s: price %v migrated to %d, want %d", p.name, p.price, price, p.want)
+		}
+	}
+}
+
+func TestMigrateDeleteActions(t *testing.T) {
+	db := newBaselineDB(t)
+	// Orphans can only be inserted with foreign keys disabled which is set
+	// per connection
+	db.SetMaxOpenConns(1)
+	db.MustExec("PRAGMA foreign_keys = off")
+	db.MustExec("INSERT INTO users (public_id, real_name) VALUES ('user', 'User')")
+	db.MustExec("INSERT INTO locations (created_by, public_id, name, address) VALUES (1, 'location', 'Maxi', 'Bulevar 1')")
+	db.MustExec("INSERT INTO items (created_by, public_id, name, price, unit) VALUES (1, 'item', 'Milk', 1.5, 'l')")
+	db.MustExec("INSERT INTO receipts (id, location_id, created_by, public_id) VALUES (1, 1, 1, 'receipt'), (2, 99, 1, 'deleted-location')")
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (1, 1, 'line', 1), (1, 99, 'deleted-item', 1), (99, 1, 'deleted-receipt', 1)")
+	db.MustExec("PRAGMA foreign_keys = on")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Receipts of deleted locations and lines of deleted items are kept
+	var location string
+	if err := db.Get(&location, "SELECT locations.name FROM receipts JOIN locations ON locations.id = receipts.location_id WHERE receipts.public_id = 'deleted-location'"); err != nil {
+		t.Fatal(err)
+	}
+	if location != unknownLocationName {
+		t.Errorf("receipt of a deleted location is at %q, want %q", location, unknownLocationName)
+	}
+
+	var item string
+	if err := db.Get(&item, "SELECT items.name FROM items_in_receipt JOIN items ON items.id = items_in_receipt.item_id WHERE items_in_receipt.public_id = 'deleted-item'"); err != nil {
+		t.Fatal(err)
+	}
+	if item != unknownItemName {
+		t.Errorf("line of a deleted item has item %q, want %q", item, unknownItemName)
+	}
+
+	// Lines of deleted receipts don't belong to anyone
+	lines := []string{}
+	if err := db.Select(&lines, "SELECT public_id FROM items_in_receipt ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "line" || lines[1] != "deleted-item" {
+		t.Errorf("lines after migrating are %v, want [line deleted-item]", lines)
+	}
+
+	// Items and locations in use can't be deleted while lines are deleted
+	// with their receipt
+	if _, err := db.Exec("DELETE FROM items WHERE public_id = 'item'"); err == nil {
+		t.Error("item used by a line was deleted")
+	}
+	if _, err := db.Exec("DELETE FROM locations WHERE public_id = 'location'"); err == nil {
+		t.Error("location used by a receipt was deleted")
+	}
+	db.MustExec("DELETE FROM receipts WHERE public_id = 'receipt'")
+	var receiptLines int
+	if err := db.Get(&receiptLines, "SELECT COUNT(*) FROM items_in_receipt WHERE public_id IN ('line', 'deleted-item')"); err != nil {
+		t.Fatal(err)
+	}
+	if receiptLines != 0 {
+		t.Errorf("%d lines are left after deleting their receipt, want 0", receiptLines)
+	}
+}
+
+// migrateTo applies migrations up to the version the same way Migrate does
+func migrateTo(t *testing.T, db *sqlx.DB, version int) {
+	for i, m := range migrations[:version] {
+		tx := db.MustBegin()
+		if err := m(tx); err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		tx.MustExec("PRAGMA user_version = " + strconv.Itoa(i+1))
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateHouseholdUniqueNames(t *testing.T) {
+	db := newBaselineDB(t)
+	db.MustExec("INSERT INTO users (public_id, real_name) VALUES ('user', 'User'), ('other', 'Other')")
+
+	// Households are added by the first migration and names are unique per
+	// household from the fourth one
+	migrateTo(t, db, 3)
+	db.MustExec("INSERT INTO locations (id, created_by, household_id, public_id, name, address) VALUES (5, 1, 1, 'maxi', 'Maxi', 'Bulevar 1'), (7, 2, 2, 'idea', 'Idea', 'Bulevar 2')")
+	db.MustExec("INSERT INTO items (id, created_by, household_id, public_id, name, price, unit) VALUES (3, 1, 1, 'milk', 'Milk', 1.5, 'l'), (8, 2, 2, 'bread', 'Bread', 0.65, 'kom')")
+	db.MustExec("INSERT INTO receipts (id, location_id, created_by, household_id, public_id) VALUES (4, 7, 2, 2, 'receipt')")
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (4, 8, 'line', 1)")
+	db.MustExec("INSERT INTO receipt_shares (receipt_id, created_by, public_id) VALUES (4, 2, 'share')")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	type record struct {
+		ID          int    `db:"id"`
+		PublicID    string `db:"public_id"`
+		HouseholdID int    `db:"household_id"`
+		Name        string `db:"name"`
+	}
+	tables := map[string][]record{
+		"locations": {{5, "maxi", 1, "Maxi"}, {7, "idea", 2, "Idea"}},
+		"items":     {{3, "milk", 1, "Milk"}, {8, "bread", 2, "Bread"}},
+	}
+	for table, want := range tables {
+		got := []record{}
+		if err := db.Select(&got, "SELECT id, public_id, household_id, name FROM "+table+" WHERE public_id IN ('maxi', 'idea', 'milk', 'bread') ORDER BY id"); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s after migrating are %+v, want %+v", table, got, want)
+		}
+	}
+
+	var references struct {
+		Location string `db:"location"`
+		Item     string `db:"item"`
+		Share    string `db:"share"`
+	}
+	if err := db.Get(&references, "SELECT locations.public_id AS location, items.public_id AS item, receipt_shares.public_id AS share FROM receipts JOIN locations ON locations.id = receipts.location_id JOIN items_in_receipt ON items_in_receipt.receipt_id = receipts.id JOIN items ON items.id = items_in_receipt.item_id JOIN receipt_shares ON receipt_shares.receipt_id = receipts.id WHERE receipts.public_id = 'receipt'"); err != nil {
+		t.Fatal(err)
+	}
+	if references.Location != "idea" || references.Item != "bread" || references.Share != "share" {
+		t.Errorf("receipt references %+v after migrating, want idea, bread and share", references)
+	}
+
+	violations := []struct {
+		Table      string      `db:"table"`
+		RowID      interface{} `db:"rowid"`
+		Parent     string      `db:"parent"`
+		ForeignKey int         `db:"fkid"`
+	}{}
+	if err := db.Select(&violations, "PRAGMA foreign_key_check"); err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("foreign keys are violated after migrating: %+v", violations)
+	}
+
+	// Names can repeat in other households but not in the same one
+	inserts := []struct {
+		table string
+		query string
+	}{
+		{"locations", "INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (?, ?, ?, 'Maxi', 'Bulevar 3')"},
+		{"items", "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, ?, 'Milk', 150, 'l')"},
+	}
+	for _, insert := range inserts {
+		if _, err := db.Exec(insert.query, 2, 2, insert.table+"-other"); err != nil {
+			t.Errorf("%s: name of another household can't be used: %v", insert.table, err)
+		}
+		if _, err := db.Exec(insert.query, 1, 1, insert.table+"-same"); err == nil {
+			t.Errorf("%s: name is used twice in the same household", insert.table)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrProductNotFound is returned by product lookups when they don't know
+// a product with the barcode.
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrInvalidBarcode is returned when a barcode is not an EAN-8, EAN-13 or
+// UPC-A code or its check digit is wrong
+var ErrInvalidBarcode = errors.New("barcode must be an EAN-8, EAN-13 or UPC-A code with a valid check digit")
+
+// Product is a product from a product database. Quantity and unit are the
+// size of a package of the product, like 500 g, and are empty if unknown.
+type Product struct {
+	Code     string  `db:"code" json:"code"`
+	Name     string  `db:"name" json:"name"`
+	Brand    string  `db:"brand" json:"brand,omitempty"`
+	Quantity float64 `db:"quantity" json:"quantity,omitempty"`
+	Unit     string  `db:"unit" json:"unit,omitempty"`
+}
+
+// NormalizeBarcode checks the check digit of an EAN-8, EAN-13 or UPC-A
+// barcode. UPC-A codes are converted to EAN-13 by adding a leading zero so
+// both forms of a code match.
+func NormalizeBarcode(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	switch len(code) {
+	case 8, 13:
+	case 12:
+		code = "0" + code
+	default:
+		return "", ErrInvalidBarcode
+	}
+
+	// Digits are weighted 3 and 1 from the right starting with the digit
+	// before the check digit
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		if code[i] < '0' || code[i] > '9' {
+			return "", ErrInvalidBarcode
+		}
+		digit := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	check := code[len(code)-1]
+	if check < '0' || check > '9' || int(check-'0') != (10-sum%10)%10 {
+		return "", ErrInvalidBarcode
+	}
+
+	return code, nil
+}
+
+// ProductLookup finds products by their barcodes in an external product
+// database. Barcodes are EAN-8 or EAN-13 codes with valid check digits.
+type ProductLookup interface {
+	Product(code string) (Product, error)
+}
+
+// ProductLookupOptions options for selecting a product lookup
+type ProductLookupOptions struct {
+	// Type of the lookup. Can be http, file or empty if products are not
+	// looked up.
+	Type string
+	// URL of the http lookup or path of the file. {code} in the URL is
+	// replaced with the barcode.
+	URL string
+}
+
+// NewProductLookup creates a product lookup of the specified type. If no type
+// is specified, nil is returned.
+func (o ProductLookupOptions) NewProductLookup() (ProductLookup, error) {
+	switch o.Type {
+	case "":
+		return nil, nil
+	case "http":
+		if o.URL == "" {
+			return nil, errors.New("url of the http product lookup is not specified")
+		}
+		return HTTPProductLookup{
+			URL:    o.URL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "file":
+		if o.URL == "" {
+			return nil, errors.New("path of the product file is not specified")
+		}
+		return NewFileProductLookup(o.URL)
+	default:
+		return nil, errors.New("unknown product lookup type " + o.Type)
+	}
+}
+
+// HTTPProductLookup gets products from an HTTP API that responds with a JSON
+// object of the product, like {"name": "Coffee", "brand": "Doncafe",
+// "quantity": 500, "unit": "g"}, and with 404 if it doesn't know the product.
+type HTTPProductLookup struct {
+	URL    string
+	Client *http.Client
+}
+
+// Product gets the product with the barcode
+func (l HTTPProductLookup) Product(code string) (Product, error) {
+	response, err := l.Client.Get(strings.Replace(l.URL, "{code}", url.PathEscape(code), -1))
+	if err != nil {
+		return Product{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return Product{}, ErrProductNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return Product{}, fmt.Errorf("product lookup responded with status %d", response.StatusCode)
+	}
+
+	var product Product
+	if err := json.NewDecoder(response.Body).Decode(&product); err != nil {
+		return Product{}, err
+	}
+
+	if product.Name == "" {
+		return Product{}, ErrProductNotFound
+	}
+
+	product.Code = code
+	return product, nil
+}
+
+// FileProductLookup finds products in a JSON file with a list of products. It
+// can be used as a local product database or as a stub for testing. Barcodes
+// in the file are normalized like barcodes that are looked up.
+type FileProductLookup struct {
+	products map[string]Product
+}
+
+// NewFileProductLookup reads products from the JSON file
+func NewFileProductLookup(path string) (FileProductLookup, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileProductLookup{}, err
+	}
+	defer file.Close()
+
+	products := []Product{}
+	if err := json.NewDecoder(file).Decode(&products); err != nil {
+		return FileProductLookup{}, err
+	}
+
+	lookup := FileProductLookup{
+		products: map[string]Product{},
+	}
+	for i, product := range products {
+		code, err := NormalizeBarcode(product.Code)
+		if err != nil {
+			return FileProductLookup{}, fmt.Errorf("product %d with barcode %q: %w", i+1, product.Code, err)
+		}
+
+		product.Code = code
+		lookup.products[code] = product
+	}
+
+	return lookup, nil
+}
+
+// Product gets the product with the barcode
+func (l FileProductLookup) Product(code string) (Product, error) {
+	product, ok := l.products[code]
+	if !ok {
+		return Product{}, ErrProductNotFound
+	}
+	return product, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeBarcode(t *testing.T) {
+	valid := []struct {
+		in   string
+		want string
+	}{
+		{"4006381333931", "4006381333931"},
+		{"96385074", "96385074"},
+		// UPC-A is stored as EAN-13
+		{"036000291452", "0036000291452"},
+		{" 5901234123457 ", "5901234123457"},
+	}
+	for _, test := range valid {
+		if got, err := NormalizeBarcode(test.in); err != nil || got != test.want {
+			t.Errorf("NormalizeBarcode(%q) = %q, %v, want %q", test.in, got, err, test.want)
+		}
+	}
+
+	invalid := []string{"", "4006381333932", "96385075", "036000291453", "400638133393", "40063813339310", "400638133393a", "a006381333931"}
+	for _, in := range invalid {
+		if _, err := NormalizeBarcode(in); err != ErrInvalidBarcode {
+			t.Errorf("NormalizeBarcode(%q) error is %v, want %v", in, err, ErrInvalidBarcode)
+		}
+	}
+}
+
+func TestNewFileProductLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "receipts-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	write := func(products string) string {
+		path := filepath.Join(dir, "products.json")
+		if err := ioutil.WriteFile(path, []byte(products), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Barcodes in the file are found by their normalized form
+	lookup, err := NewFileProductLookup(write(`[{"code": "036000291452", "name": "Tissues"}, {"code": " 96385074 ", "name": "Gum"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"0036000291452", "96385074"} {
+		if product, err := lookup.Product(code); err != nil || product.Code != code {
+			t.Errorf("Product(%q) = %+v, %v, want the product with the code", code, product, err)
+		}
+	}
+	if _, err := lookup.Product("036000291452"); err != ErrProductNotFound {
+		t.Errorf("Product of a code that is not normalized got error %v, want %v", err, ErrProductNotFound)
+	}
+
+	if _, err := NewFileProductLookup(write(`[{"code": "4006381333931", "name": "Pen"}, {"code": "4006381333932", "name": "Pencil"}]`)); err == nil {
+		t.Error("file with a wrong check digit was read")
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisOptions options for redis database
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// NewConnection creates a new connection to redis database
+func (o RedisOptions) NewConnection() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     o.Addr,
+		Password: o.Password,
+		DB:       o.DB,
+	})
+}
+
+// NewSessionStore creates a session store backed by redis
+func (o RedisOptions) NewSessionStore() SessionStore {
+	return redisSessionStore{
+		client: o.NewConnection(),
+	}
+}
+
+type redisSessionStore struct {
+	client *redis.Client
+}
+
+func (s redisSessionStore) Get(key string) (string, error) {
+	value, err := s.client.Get(context.Background(), key).Result()
+	if err == redis.Nil {
+		return "", ErrSessionNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (s redisSessionStore) Set(key, value string, expiration time.Duration) error {
+	return s.client.Set(context.Background(), key, value, expiration).Err()
+}
+
+func (s redisSessionStore) Delete(key string) error {
+	return s.client.Del(context.Background(), key).Err()
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSessionNotFound is returned by session stores when a session with the
+// specified key does not exist or has expired.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore is a key-value store that keeps track of active login sessions.
+// Session ids are used as keys and user public ids as values.
+type SessionStore interface {
+	Get(key string) (string, error)
+	Set(key, value string, expiration time.Duration) error
+	Delete(key string) error
+}
+
+// SessionStoreOptions options for selecting and connecting to a session store
+type SessionStoreOptions struct {
+	// Type of the session store. Can be memcached, redis or memory. If it's not
+	// specified, memcached is used.
+	Type     string
+	Addr     string
+	Password string
+}
+
+// NewSessionStore creates a session store of the specified type
+func (o SessionStoreOptions) NewSessionStore() (SessionStore, error) {
+	switch o.Type {
+	case "", "memcached":
+		return MemcachedOptions{
+			Addr: o.Addr,
+		}.NewSessionStore(), nil
+	case "redis":
+		return RedisOptions{
+			Addr:     o.Addr,
+			Password: o.Password,
+		}.NewSessionStore(), nil
+	case "memory":
+		return NewMemorySessionStore(), nil
+	default:
+		return nil, errors.New("unknown session store type " + o.Type)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testSessionStore checks that a session store behaves like the session
+// stores that come with the backend. Sessions are set with the expiration and
+// wait is called with it when they should expire.
+func testSessionStore(t *testing.T, store SessionStore, expiration time.Duration, wait func(time.Duration)) {
+	t.Run("round trip", func(t *testing.T) {
+		if err := store.Set("round-trip", "user-1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		value, err := store.Get("round-trip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "user-1" {
+			t.Errorf("got %q, want %q", value, "user-1")
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		if err := store.Set("overwrite", "user-1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Set("overwrite", "user-2", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		value, err := store.Get("overwrite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "user-2" {
+			t.Errorf("got %q, want %q", value, "user-2")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Set("delete", "user-1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete("delete"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get("delete"); err != ErrSessionNotFound {
+			t.Errorf("got error %v, want %v", err, ErrSessionNotFound)
+		}
+		// Deleting a session that doesn't exist is not an error
+		if err := store.Delete("delete"); err != nil {
+			t.Errorf("deleting a missing session failed: %v", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		if err := store.Set("expiry", "user-1", expiration); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get("expiry"); err != nil {
+			t.Fatalf("session expired too early: %v", err)
+		}
+		wait(expiration)
+		if _, err := store.Get("expiry"); err != ErrSessionNotFound {
+			t.Errorf("got error %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := store.Get("missing"); err != ErrSessionNotFound {
+			t.Errorf("got error %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+}
+
+// sleep waits a bit longer than the duration so stores with second
+// resolution expire sessions
+func sleep(d time.Duration) {
+	time.Sleep(d + time.Second)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore(), 50*time.Millisecond, func(d time.Duration) {
+		time.Sleep(2 * d)
+	})
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	store := RedisOptions{
+		Addr: server.Addr(),
+	}.NewSessionStore()
+	testSessionStore(t, store, time.Minute, func(d time.Duration) {
+		server.FastForward(d)
+	})
+}
+
+func TestMemcachedSessionStore(t *testing.T) {
+	addr := os.Getenv("MEMCACHED_ADDR")
+	if addr == "" {
+		addr = "localhost:11211"
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Skipf("memcached is not reachable at %s: %v", addr, err)
+	}
+	conn.Close()
+
+	store := MemcachedOptions{
+		Addr: addr,
+	}.NewSessionStore()
+	testSessionStore(t, store, time.Second, sleep)
+}
@@ -11,14 +11,14 @@ type SQLOptions struct {
 	DatabasePath string
 }
 
-func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
-	userTableSchema := `
+// baselineSchema creates tables of the first version of the database. Later
+// changes to the schema are made by migrations.
+var baselineSchema = []string{`
 	create table users (
 		id integer primary key autoincrement unique,
 		public_id text not null unique,
 		real_name text not null
-	);`
-	locationsTableSchema := `
+	);`, `
 	create table locations (
 		id integer primary key autoincrement unique,
 		created_by integer not null,
@@ -29,8 +29,7 @@ func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
 		updated_at datetime default current_timestamp,
 	
 		foreign key (created_by) references users(id)
-	);`
-	receiptsTableSchema := `
+	);`, `
 	create table receipts (
 		id integer primary key autoincrement unique,
 		location_id integer not null,
@@ -41,8 +40,7 @@ func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
 
 		foreign key (location_id) references locations(id),
 		foreign key (created_by) references users(id)
-	);`
-	itemsTableSchema := `
+	);`, `
 	create table items (
 		id integer primary key autoincrement unique,
 		created_by integer not null,
@@ -54,8 +52,7 @@ func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
 		updated_at datetime default current_timestamp,
 
 		foreign key (created_by) references users(id)
-	);`
-	itemsInReceiptTableSchema := `
+	);`, `
 	create table items_in_receipt (
 		id integer primary key autoincrement unique,
 		receipt_id integer not null,
@@ -65,39 +62,43 @@ func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
 
 		foreign key (receipt_id) references receipts(id),
 		foreign key (item_id) references items(id)
-	);`
+	);`,
+}
+
+func (o SQLOptions) GenerateDatabase() (*sqlx.DB, error) {
+	// Foreign keys are disabled in SQLite by default and have to be enabled
+	// for every connection
+	dataSourceName := o.DatabasePath + "?_foreign_keys=on"
 
 	if _, err := os.Stat(o.DatabasePath); err != nil {
 		os.Create(o.DatabasePath)
 
-		db, err := sqlx.Connect("sqlite3", o.DatabasePath)
+		db, err := sqlx.Connect("sqlite3", dataSourceName)
 		if err != nil {
 			return nil, err
 		}
 
-		if _, err := db.Exec(userTableSchema); err != nil {
-			return nil, err
-		}
-		if _, err := db.Exec(locationsTableSchema); err != nil {
-			return nil, err
+		for _, statement := range baselineSchema {
+			if _, err := db.Exec(statement); err != nil {
+				return nil, err
+			}
 		}
-		if _, err := db.Exec(receiptsTableSchema); err != nil {
-			return nil, err
-		}
-		if _, err := db.Exec(itemsTableSchema); err != nil {
-			return nil, err
-		}
-		if _, err := db.Exec(itemsInReceiptTableSchema); err != nil {
+
+		if err := Migrate(db); err != nil {
 			return nil, err
 		}
 
 		return db, nil
 	}
 
-	db, err := sqlx.Connect("sqlite3", o.DatabasePath)
+	db, err := sqlx.Connect("sqlite3", dataSourceName)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
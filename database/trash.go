@@ -0,0 +1,67 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TrashOptions stores options for purging deleted records
+type TrashOptions struct {
+	// Retention is how long deleted records are kept before they are purged
+	Retention time.Duration
+	// Interval is how often the trash is checked for records to purge
+	Interval time.Duration
+}
+
+// Purge permanently deletes locations, items and receipts that have been in
+// the trash longer than the retention period. Receipts of purged locations are
+// deleted with them. Items that are still on receipts are kept in the trash
+// until their receipts are purged so trashing an item never changes receipts.
+func (o TrashOptions) Purge(db *sqlx.DB) error {
+	// Deletion times are stored by SQLite as UTC text
+	before := time.Now().UTC().Add(-o.Retention).Format("2006-01-02 15:04:05")
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := execAllArgs(tx, []interface{}{before},
+		"DELETE FROM receipts WHERE location_id IN (SELECT id FROM locations WHERE deleted_at < ?)",
+		"DELETE FROM receipts WHERE deleted_at < ?",
+		"DELETE FROM items WHERE deleted_at < ? AND id NOT IN (SELECT item_id FROM items_in_receipt)",
+		"DELETE FROM locations WHERE deleted_at < ?",
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StartPurging purges the trash on every interval until the program exits.
+// It should be started in its own goroutine.
+func (o TrashOptions) StartPurging(db *sqlx.DB) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.Purge(db); err != nil {
+			log.Println("purging the trash failed:", err)
+		}
+
+		<-ticker.C
+	}
+}
+
+func execAllArgs(tx *sqlx.Tx, args []interface{}, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurge(t *testing.T) {
+	db := newBaselineDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec("INSERT INTO users (public_id, real_name) VALUES ('user', 'User')")
+	tx := db.MustBegin()
+	householdID, err := CreateHousehold(tx, 1, "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().UTC().Add(-48 * time.Hour).Format("2006-01-02 15:04:05")
+	db.MustExec("INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (1, ?, 'location', 'Maxi', 'Bulevar 1')", householdID)
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit, deleted_at) VALUES (1, ?, 'bought', 'Milk', 150, 'l', ?), (1, ?, 'unused', 'Bread', 100, 'kom', ?), (1, ?, 'trashed-receipt', 'Coffee', 900, 'kom', ?)", householdID, old, householdID, old, householdID, old)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (1, ?, 1, 'receipt')", householdID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, deleted_at) VALUES (1, ?, 1, 'deleted', ?)", householdID, old)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (1, 1, 'line', 2), (2, 3, 'deleted-line', 1)")
+
+	if err := (TrashOptions{Retention: 24 * time.Hour}).Purge(db); err != nil {
+		t.Fatal(err)
+	}
+
+	items := []string{}
+	if err := db.Select(&items, "SELECT public_id FROM items ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	// Item on a receipt is kept, items that are not on receipts anymore are
+	// purged
+	if len(items) != 1 || items[0] != "bought" {
+		t.Errorf("items after purging are %v, want [bought]", items)
+	}
+
+	var lines int
+	if err := db.Get(&lines, "SELECT COUNT(*) FROM items_in_receipt WHERE public_id = 'line'"); err != nil {
+		t.Fatal(err)
+	}
+	if lines != 1 {
+		t.Error("line of a trashed item was purged")
+	}
+}
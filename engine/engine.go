@@ -3,16 +3,15 @@ package engine
 import (
 	"fmt"
 
-	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/dusansimic/receipts-archive-backend/database"
 	"github.com/dusansimic/receipts-archive-backend/handlers"
 	"github.com/dusansimic/receipts-archive-backend/handlers/resolvers"
+	"github.com/dusansimic/receipts-archive-backend/handlers/stores"
 	"github.com/friendsofgo/graphiql"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
-	"github.com/gin-contrib/sessions/memcached"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator"
 	"github.com/jmoiron/sqlx"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
@@ -30,9 +29,12 @@ type GoogleOAuthOptions struct {
 type Options struct {
 	AllowOrigins       []string
 	Database           *sqlx.DB
-	SessionStore       *memcache.Client
+	SessionStore       database.SessionStore
 	SessionStoreSecret []byte
 	GothicCookieSecret []byte
+	AdminUsers         []string
+	RateProvider       database.ExchangeRateProvider
+	ProductLookup      database.ProductLookup
 	GoogleOAuthOptions
 }
 
@@ -45,12 +47,16 @@ func (o Options) NewEngine() *gin.Engine {
 	corsConfig.AllowCredentials = true
 	router.Use(cors.New(corsConfig))
 
-	sessionStore := memcached.NewStore(o.SessionStore, "", o.SessionStoreSecret)
-	sessionStore.Options(sessions.Options{
-		MaxAge:   3600,
-		Path:     "/",
-		HttpOnly: true,
-	})
+	// Session cookie only holds the session id and the user id. Session is
+	// validated against the session store on every request.
+	sessionStore := stores.Session{
+		SessionOptions: sessions.Options{
+			MaxAge:   3600,
+			Path:     "/",
+			HttpOnly: true,
+		},
+		Secret: o.SessionStoreSecret,
+	}.NewSessionStore()
 	router.Use(sessions.Sessions("auth_session", sessionStore))
 
 	// Setup OAuth provider (Google)
@@ -58,7 +64,7 @@ func (o Options) NewEngine() *gin.Engine {
 	goth.UseProviders(google.New(o.GoogleOAuthOptions.ClientKey, o.GoogleOAuthOptions.ClientSecret, o.GoogleOAuthOptions.CallbackURL))
 
 	// Request data validator
-	v := validator.New()
+	v := handlers.NewValidator()
 
 	// If in debug mode, enable GraphiQL
 	if gin.Mode() == gin.DebugMode {
@@ -71,12 +77,16 @@ func (o Options) NewEngine() *gin.Engine {
 	}
 
 	handlers := handlers.Options{
-		DB:           o.Database,
-		SessionStore: o.SessionStore,
-		V:            v,
+		DB:            o.Database,
+		SessionStore:  o.SessionStore,
+		V:             v,
+		AdminUsers:    o.AdminUsers,
+		RateProvider:  o.RateProvider,
+		ProductLookup: o.ProductLookup,
 	}
 	resolvers := resolvers.Options{
-		DB: o.Database,
+		DB:           o.Database,
+		RateProvider: o.RateProvider,
 	}
 
 	auth := router.Group("/auth")
@@ -91,11 +101,50 @@ func (o Options) NewEngine() *gin.Engine {
 	}
 
 	graphql := router.Group("/graphql")
+	graphql.Use(handlers.AuthRequired())
 	{
 		// GraphQL request handler
 		graphql.POST("", resolvers.GraphQLHandler())
 	}
 
+	households := router.Group("/households")
+	households.Use(handlers.AuthRequired())
+	{
+		// Get list of households user is a member of
+		households.GET("", handlers.GetHouseholds())
+
+		// Add new household
+		households.POST("", handlers.PostHouseholds())
+
+		// Update household
+		households.PUT("", handlers.PutHouseholds())
+
+		// Delete household
+		households.DELETE("", handlers.DeleteHouseholds())
+
+		// Get list of household members
+		households.GET("/:id/members", handlers.GetHouseholdMembers())
+
+		// Change role of a household member
+		households.PUT("/:id/members", handlers.PutHouseholdMembers())
+
+		// Remove member from a household
+		households.DELETE("/:id/members", handlers.DeleteHouseholdMembers())
+
+		// Get list of invitations to a household
+		households.GET("/:id/invitations", handlers.GetHouseholdInvitations())
+
+		// Invite user to a household
+		households.POST("/:id/invitations", handlers.PostHouseholdInvitations())
+	}
+
+	invitations := router.Group("/invitations")
+	invitations.Use(handlers.AuthRequired())
+	{
+		// Join a household using an invitation
+		invitations.POST("/:id/accept", handlers.AcceptHouseholdInvitation())
+	}
+
 	locations := router.Group("/locations")
 	locations.Use(handlers.AuthRequired())
 	{
@@ -118,8 +167,10 @@ func (o Options) NewEngine() *gin.Engine {
 		// Get list of items (query available)
 		items.GET("", handlers.GetItems())
 
-		// Get list of items from a specific receipt
-		items.GET("/inreceipt/:id", handlers.GetItemsInReceipt())
+		// Get list of items from a specific receipt (/items/inreceipt/:id), get
+		// item by one of its barcodes (/items/by-barcode/:code) or compare
+		// prices of an item at locations (/items/:id/compare, query available)
+		items.GET("/:id/*action", handlers.GetItemActions())
 
 		// Add new item
 		items.POST("", handlers.PostItems())
@@ -127,6 +178,9 @@ func (o Options) NewEngine() *gin.Engine {
 		// Add item to receipts
 		items.POST("/inreceipt", handlers.PostItemsInReceipt())
 
+		// Compare totals of a basket of items at locations
+		items.POST("/compare", handlers.PostBasketComparison())
+
 		// Update item
 		items.PUT("", handlers.PutItems())
 
@@ -154,7 +208,213 @@ func (o Options) NewEngine() *gin.Engine {
 
 		// Delete receipt
 		receipts.DELETE("", handlers.DeleteReceipts())
+
+		// Get list of public share links of a receipt
+		receipts.GET("/:id/shares", handlers.GetShares())
+
+		// Revoke a public share link
+		receipts.DELETE("/:id/share", handlers.DeleteShares())
+
+		// Replace payments of a receipt
+		receipts.PUT("/:id/payments", handlers.PutPayments())
+
+		// Create a public share link for a receipt (/receipts/:id/share), refund
+		// lines of a receipt (/receipts/:id/refunds) or import a fiscal receipt
+		// from its verification url or journal (/receipts/import/fiscal)
+		receipts.POST("/:id/*action", handlers.PostReceiptActions())
+
+		// Get a receipt as a printable PDF document (/receipts/:id.pdf)
+		receipts.GET("/:id", handlers.GetReceiptPDF())
+	}
+
+	imports := router.Group("/import")
+	imports.Use(handlers.AuthRequired())
+	{
+		// Import receipts from csv or json (dry run available)
+		imports.POST("/receipts", handlers.PostBulkImport())
+	}
+
+	reconciliation := router.Group("/reconciliation")
+	reconciliation.Use(handlers.AuthRequired())
+	{
+		// Match transactions of a bank statement to receipts
+		reconciliation.POST("", handlers.PostReconciliation())
+
+		// Confirm or override matches of transactions and receipts
+		reconciliation.PUT("", handlers.PutReconciliation())
+
+		// Remove the confirmed transaction of a receipt
+		reconciliation.DELETE("", handlers.DeleteReconciliation())
+	}
+
+	export := router.Group("/export")
+	export.Use(handlers.AuthRequired())
+	{
+		// Export receipts as csv, xlsx or json (query available)
+		export.GET("/receipts", handlers.GetReceiptsExport())
+
+		// Export receipts as a ledger, hledger or beancount journal (query
+		// available)
+		export.GET("/ledger", handlers.GetLedgerExport())
+	}
+
+	budgets := router.Group("/budgets")
+	budgets.Use(handlers.AuthRequired())
+	{
+		// Get list of budgets (query available)
+		budgets.GET("", handlers.GetBudgets())
+
+		// Add new budget
+		budgets.POST("", handlers.PostBudgets())
+
+		// Update budget
+		budgets.PUT("", handlers.PutBudgets())
+
+		// Delete budget
+		budgets.DELETE("", handlers.DeleteBudgets())
+
+		// Get budgets with spending in their current period (query available)
+		budgets.GET("/status", handlers.GetBudgetsStatus())
+
+		// Get spending of a budget in past periods (query available)
+		budgets.GET("/history", handlers.GetBudgetHistory())
+
+		// Get alerts of budgets (query available)
+		budgets.GET("/alerts", handlers.GetBudgetAlerts())
+
+		// Mark alerts of budgets as read
+		budgets.PUT("/alerts", handlers.PutBudgetAlerts())
+	}
+
+	reports := router.Group("/reports")
+	reports.Use(handlers.AuthRequired())
+	{
+		// Get a printable PDF report of spending in a month (query available)
+		reports.GET("/monthly.pdf", handlers.GetMonthlyReportPDF())
 	}
 
+	stats := router.Group("/stats")
+	stats.Use(handlers.AuthRequired())
+	{
+		// Get spending statistics (query available)
+		stats.GET("", handlers.GetStats())
+
+		// Get net, tax and gross amounts grouped by tax rate (query available)
+		stats.GET("/taxes", handlers.GetTaxReport())
+
+		// Get spending statistics grouped by payment method (query available)
+		stats.GET("/payment-methods", handlers.GetPaymentStats())
+	}
+
+	paymentMethods := router.Group("/payment-methods")
+	paymentMethods.Use(handlers.AuthRequired())
+	{
+		// Get list of payment methods (query available)
+		paymentMethods.GET("", handlers.GetPaymentMethods())
+
+		// Create a new payment method
+		paymentMethods.POST("", handlers.PostPaymentMethods())
+
+		// Update a payment method
+		paymentMethods.PUT("", handlers.PutPaymentMethods())
+
+		// Delete a payment method
+		paymentMethods.DELETE("", handlers.DeletePaymentMethods())
+	}
+
+	taxRates := router.Group("/tax-rates")
+	taxRates.Use(handlers.AuthRequired())
+	{
+		// Get list of tax rates of the user and the user's country or of a
+		// household (query available)
+		taxRates.GET("", handlers.GetTaxRates())
+
+		// Create a new tax rate
+		taxRates.POST("", handlers.PostTaxRates())
+
+		// Update a tax rate
+		taxRates.PUT("", handlers.PutTaxRates())
+
+		// Delete a tax rate
+		taxRates.DELETE("", handlers.DeleteTaxRates())
+	}
+
+	units := router.Group("/units")
+	units.Use(handlers.AuthRequired())
+	{
+		// Get list of units that items can be measured in
+		units.GET("", handlers.GetUnits())
+	}
+
+	exchangeRates := router.Group("/exchange-rates")
+	exchangeRates.Use(handlers.AuthRequired())
+	{
+		// Get list of exchange rates (query available)
+		exchangeRates.GET("", handlers.GetExchangeRates())
+	}
+
+	trash := router.Group("/trash")
+	trash.Use(handlers.AuthRequired())
+	{
+		// Get list of deleted locations, items and receipts (query available)
+		trash.GET("", handlers.GetTrash())
+
+		// Restore a deleted location, item or receipt
+		trash.POST("/:type/:id/restore", handlers.RestoreTrash())
+	}
+
+	me := router.Group("/me")
+	me.Use(handlers.AuthRequired())
+	{
+		// Get account information of the user
+		me.GET("", handlers.GetAccountInfo())
+
+		// Update account settings
+		me.PUT("", handlers.PutAccount())
+
+		// Download all data of the user
+		me.GET("/export", handlers.GetAccountExport())
+
+		// Get accounts used in plain text accounting exports
+		me.GET("/ledger-accounts", handlers.GetLedgerAccounts())
+
+		// Replace accounts used in plain text accounting exports
+		me.PUT("/ledger-accounts", handlers.PutLedgerAccounts())
+
+		// Start deletion of the account
+		me.POST("/delete", handlers.PostAccountDeletion())
+
+		// Confirm deletion of the account
+		me.DELETE("", handlers.DeleteAccount())
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(handlers.AuthRequired(), handlers.AdminRequired())
+	{
+		// Get list of users (query available)
+		admin.GET("/users", handlers.GetAdminUsers())
+
+		// Change role of a user or disable their account
+		admin.PUT("/users", handlers.PutAdminUsers())
+
+		// Delete account of a user
+		admin.DELETE("/users", handlers.DeleteAdminUsers())
+
+		// End all sessions of a user
+		admin.POST("/users/:id/logout", handlers.PostAdminLogout())
+
+		// Get storage usage per user and system totals
+		admin.GET("/usage", handlers.GetAdminUsage())
+
+		// Get list of actions done by administrators
+		admin.GET("/audit", handlers.GetAdminAudit())
+
+		// Import exchange rates from a CSV file
+		admin.POST("/exchange-rates/import", handlers.PostExchangeRatesImport())
+	}
+
+	// View a shared receipt (no authentication required)
+	router.GET("/shared/:token", handlers.GetSharedReceipt())
+
 	return router
 }
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// AccountPutBody : Structure that should be used for getting json from body of a put request for the account
+type AccountPutBody struct {
+	Currency string `json:"currency" validate:"omitempty,currency"`
+	// Country is an ISO 3166 code of the country whose tax rates are used
+	Country string `json:"country" validate:"omitempty,len=2,alpha"`
+	// TimeZone is a name from the IANA time zone database that is used for
+	// new receipts and for dates in statistics
+	TimeZone string `json:"timeZone"`
+}
+
+// AccountDeleteBody : Structure that should be used for getting json data from body of a delete request for the account
+type AccountDeleteBody struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// accountDeletionExpiration is the time in which account deletion has to be
+// confirmed
+const accountDeletionExpiration = 10 * time.Minute
+
+// exportTables are tables included in the account data export. Queries select
+// records the user created and records that belong to them. Records other
+// members created in shared households are their personal data so they are
+// left out even though the user can see them.
+var exportTables = []struct {
+	name  string
+	query func(userID int) sq.SelectBuilder
+}{
+	{"account", func(userID int) sq.SelectBuilder {
+		return sq.Select("public_id AS id, real_name AS realName, role, currency, country, time_zone AS timeZone").From("users").Where(sq.Eq{"id": userID})
+	}},
+	{"households", func(userID int) sq.SelectBuilder {
+		return sq.Select("households.public_id AS id, households.name, household_members.role, households.created_at AS createdAt, households.updated_at AS updatedAt").From("households").Join("household_members ON household_members.household_id = households.id").Where(sq.Eq{"household_members.user_id": userID})
+	}},
+	{"locations", func(userID int) sq.SelectBuilder {
+		return sq.Select("locations.public_id AS id, households.public_id AS householdId, users.public_id AS createdBy, locations.name, locations.address, locations.tax_id AS taxId, locations.created_at AS createdAt, locations.updated_at AS updatedAt").From("locations").Join("households ON households.id = locations.household_id").Join("users ON users.id = locations.created_by").Where(sq.Eq{"locations.created_by": userID})
+	}},
+	{"items", func(userID int) sq.SelectBuilder {
+		return sq.Select("items.public_id AS id, households.public_id AS householdId, users.public_id AS createdBy, items.name, printf('%.2f', items.price / 100.0) AS price, items.unit, items.package_size AS packageSize, items.package_unit AS packageUnit, items.category, items.created_at AS createdAt, items.updated_at AS updatedAt").From("items").Join("households ON households.id = items.household_id").Join("users ON users.id = items.created_by").Where(sq.Eq{"items.created_by": userID})
+	}},
+	{"receipts", func(userID int) sq.SelectBuilder {
+		return sq.Select("receipts.public_id AS id, households.public_id AS householdId, locations.public_id AS locationId, users.public_id AS createdBy, receipts.currency, receipts.discount_type AS discountType, CASE WHEN receipts.discount_value IS NOT NULL THEN printf('%.2f', receipts.discount_value / 100.0) END AS discountValue, originals.public_id AS refundOf, receipts.purchased_at AS purchasedAt, receipts.time_zone AS timeZone, receipts.notes, receipts.fiscal_id AS fiscalId, receipts.statement_date AS statementDate, CASE WHEN receipts.statement_amount IS NOT NULL THEN printf('%.2f', receipts.statement_amount / 100.0) END AS statementAmount, receipts.statement_currency AS statementCurrency, receipts.statement_reference AS statementReference, receipts.statement_description AS statementDescription, receipts.created_at AS createdAt, receipts.updated_at AS updatedAt").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("receipts originals ON originals.id = receipts.refund_of").Where(sq.Eq{"receipts.created_by": userID})
+	}},
+	{"items_in_receipt", func(userID int) sq.SelectBuilder {
+		return sq.Select("items_in_receipt.public_id AS id, receipts.public_id AS receiptId, items.public_id AS itemId, items.name, printf('%.2f', " + linePriceSQL + " / 100.0) AS price, items.unit, items_in_receipt.amount, items_in_receipt.tax_label AS taxLabel, CASE WHEN items_in_receipt.tax_rate IS NOT NULL THEN printf('%.2f', items_in_receipt.tax_rate / 100.0) END AS taxRate, items_in_receipt.discount_type AS discountType, CASE WHEN items_in_receipt.discount_value IS NOT NULL THEN printf('%.2f', items_in_receipt.discount_value / 100.0) END AS discountValue, originals.public_id AS refundOf").From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("items ON items.id = items_in_receipt.item_id").LeftJoin("items_in_receipt originals ON originals.id = items_in_receipt.refund_of").Where(sq.Eq{"receipts.created_by": userID})
+	}},
+	{"payment_methods", func(userID int) sq.SelectBuilder {
+		return sq.Select("payment_methods.public_id AS id, households.public_id AS householdId, users.public_id AS createdBy, payment_methods.name, payment_methods.type, payment_methods.created_at AS createdAt, payment_methods.updated_at AS updatedAt").From("payment_methods").Join("households ON households.id = payment_methods.household_id").Join("users ON users.id = payment_methods.created_by").Where(sq.Eq{"payment_methods.created_by": userID})
+	}},
+	{"receipt_payments", func(userID int) sq.SelectBuilder {
+		return sq.Select("receipts.public_id AS receiptId, payment_methods.public_id AS paymentMethodId, printf('%.2f', receipt_payments.amount / 100.0) AS amount").From("receipt_payments").Join("receipts ON receipts.id = receipt_payments.receipt_id").Join("payment_methods ON payment_methods.id = receipt_payments.payment_method_id").Where(sq.Eq{"receipts.created_by": userID})
+	}},
+	{"tax_rates", func(userID int) sq.SelectBuilder {
+		return sq.Select("public_id AS id, label, name, printf('%.2f', rate / 100.0) AS rate, created_at AS createdAt, updated_at AS updatedAt").From("tax_rates").Where(sq.Eq{"user_id": userID})
+	}},
+	{"ledger_accounts", func(userID int) sq.SelectBuilder {
+		return sq.Select("kind, name, account").From("ledger_accounts").Where(sq.Eq{"user_id": userID})
+	}},
+	{"item_barcodes", func(userID int) sq.SelectBuilder {
+		return sq.Select("items.public_id AS itemId, item_barcodes.code, item_barcodes.created_at AS createdAt").From("item_barcodes").Join("items ON items.id = item_barcodes.item_id").Where(sq.Eq{"items.created_by": userID})
+	}},
+	{"item_tags", func(userID int) sq.SelectBuilder {
+		return sq.Select("items.public_id AS itemId, item_tags.tag, item_tags.created_at AS createdAt").From("item_tags").Join("items ON items.id = item_tags.item_id").Where(sq.Eq{"items.created_by": userID})
+	}},
+	{"budgets", func(userID int) sq.SelectBuilder {
+		return sq.Select("budgets.public_id AS id, households.public_id AS householdId, users.public_id AS createdBy, budgets.name, budgets.period, budgets.scope, locations.public_id AS locationId, items.public_id AS itemId, budgets.category, budgets.tag, printf('%.2f', budgets.amount / 100.0) AS amount, budgets.currency, budgets.time_zone AS timeZone, budgets.created_at AS createdAt, budgets.updated_at AS updatedAt").From("budgets").Join("households ON households.id = budgets.household_id").Join("users ON users.id = budgets.created_by").LeftJoin("locations ON locations.id = budgets.location_id").LeftJoin("items ON items.id = budgets.item_id").Where(sq.Eq{"budgets.created_by": userID})
+	}},
+	{"budget_alerts", func(userID int) sq.SelectBuilder {
+		return sq.Select("budget_alerts.public_id AS id, budgets.public_id AS budgetId, receipts.public_id AS receiptId, budget_alerts.period, budget_alerts.threshold, printf('%.2f', budget_alerts.spent / 100.0) AS spent, budget_alerts.created_at AS createdAt, budget_alerts.read_at AS readAt").From("budget_alerts").Join("budgets ON budgets.id = budget_alerts.budget_id").LeftJoin("receipts ON receipts.id = budget_alerts.receipt_id").Where(sq.Eq{"budgets.created_by": userID})
+	}},
+}
+
+// anonymousHouseholdName is the name of shared households that were named
+// after a deleted user
+const anonymousHouseholdName = "Household"
+
+// deleteAccount removes a user and every row that references the user. Data
+// of households the user is the only member of is deleted. Records the user
+// created in households shared with others are kept and handed over to an
+// owner of the household so other members don't lose them.
+func deleteAccount(tx *sqlx.Tx, userID int) error {
+	// Households that would be left without members
+	soloHouseholds := []int{}
+	if err := tx.Select(&soloHouseholds, "SELECT household_id FROM household_members WHERE user_id = ? AND household_id NOT IN (SELECT household_id FROM household_members WHERE user_id != ?)", userID, userID); err != nil {
+		return err
+	}
+
+	for _, householdID := range soloHouseholds {
+		if err := deleteHousehold(tx, householdID); err != nil {
+			return err
+		}
+	}
+
+	// If the user is the only owner of a shared household, the member who
+	// joined first becomes an owner
+	if _, err := tx.Exec(`UPDATE household_members SET role = 'owner' WHERE id IN (
+		SELECT MIN(others.id) FROM household_members others
+		JOIN household_members own ON own.household_id = others.household_id AND own.user_id = ? AND own.role = 'owner'
+		WHERE others.user_id != ?
+		AND NOT EXISTS (SELECT 1 FROM household_members owners WHERE owners.household_id = others.household_id AND owners.role = 'owner' AND owners.user_id != ?)
+		GROUP BY others.household_id
+	)`, userID, userID, userID); err != nil {
+		return err
+	}
+
+	// Households are named after the user when signing up so shared ones
+	// that are left get a name that doesn't identify the user
+	if _, err := tx.Exec("UPDATE households SET name = ? WHERE created_by = ? AND name = (SELECT real_name FROM users WHERE id = ?)", anonymousHouseholdName, userID, userID); err != nil {
+		return err
+	}
+
+	if err := execAllArgs(tx, []interface{}{userID},
+		"DELETE FROM household_members WHERE user_id = ?",
+		"DELETE FROM household_invitations WHERE invited_by = ?",
+		"UPDATE household_invitations SET accepted_by = NULL WHERE accepted_by = ?",
+		"DELETE FROM receipt_shares WHERE created_by = ?",
+		"DELETE FROM tax_rates WHERE user_id = ?",
+		"DELETE FROM ledger_accounts WHERE user_id = ?",
+		"UPDATE households SET created_by = (SELECT user_id FROM household_members WHERE household_id = households.id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"UPDATE locations SET created_by = (SELECT user_id FROM household_members WHERE household_id = locations.household_id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"UPDATE items SET created_by = (SELECT user_id FROM household_members WHERE household_id = items.household_id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"UPDATE receipts SET created_by = (SELECT user_id FROM household_members WHERE household_id = receipts.household_id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"UPDATE payment_methods SET created_by = (SELECT user_id FROM household_members WHERE household_id = payment_methods.household_id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"UPDATE budgets SET created_by = (SELECT user_id FROM household_members WHERE household_id = budgets.household_id AND role = 'owner' ORDER BY id LIMIT 1) WHERE created_by = ?",
+		"DELETE FROM users WHERE id = ?",
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteHousehold removes a household with all of its records.
+func deleteHousehold(tx *sqlx.Tx, householdID int) error {
+	return execAllArgs(tx, []interface{}{householdID},
+		"DELETE FROM items_in_receipt WHERE receipt_id IN (SELECT id FROM receipts WHERE household_id = ?)",
+		"DELETE FROM receipt_shares WHERE receipt_id IN (SELECT id FROM receipts WHERE household_id = ?)",
+		"DELETE FROM receipt_payments WHERE receipt_id IN (SELECT id FROM receipts WHERE household_id = ?)",
+		"DELETE FROM budget_alerts WHERE budget_id IN (SELECT id FROM budgets WHERE household_id = ?)",
+		"DELETE FROM budgets WHERE household_id = ?",
+		"DELETE FROM receipts WHERE household_id = ?",
+		"DELETE FROM payment_methods WHERE household_id = ?",
+		"DELETE FROM item_barcodes WHERE household_id = ?",
+		"DELETE FROM item_tags WHERE household_id = ?",
+		"DELETE FROM items WHERE household_id = ?",
+		"DELETE FROM locations WHERE household_id = ?",
+		"DELETE FROM household_invitations WHERE household_id = ?",
+		"DELETE FROM household_members WHERE household_id = ?",
+		"DELETE FROM households WHERE id = ?",
+	)
+}
+
+// execAllArgs executes statements in a transaction with the same arguments
+func execAllArgs(tx *sqlx.Tx, args []interface{}, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeExportTable writes the result of a query into the zip archive as a JSON
+// file and as a CSV file.
+func writeExportTable(db *sqlx.DB, archive *zip.Writer, name string, query sq.SelectBuilder) error {
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Queryx(queryString, queryStringArgs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	records := [][]interface{}{}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+
+		for i, value := range values {
+			switch v := value.(type) {
+			case []byte:
+				values[i] = string(v)
+			case time.Time:
+				values[i] = v.Format(time.RFC3339)
+			}
+		}
+
+		records = append(records, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	jsonFile, err := archive.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+
+	objects := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		object := map[string]interface{}{}
+		for i, column := range columns {
+			object[column] = record[i]
+		}
+		objects = append(objects, object)
+	}
+
+	encoder := json.NewEncoder(jsonFile)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(objects); err != nil {
+		return err
+	}
+
+	csvFile, err := archive.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(csvFile)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		line := make([]string, len(record))
+		for i, value := range record {
+			if value != nil {
+				line[i] = fmt.Sprint(value)
+			}
+		}
+
+		if err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// GetAccountInfo is a Gin handler function for getting account information of
+// the user.
+func (o Options) GetAccountInfo() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, account)
+	}
+}
+
+// PutAccount is a Gin handler function for updating settings of the account.
+// Default currency is used for new receipts and for statistics and tax rates of
+// the country are available for receipt lines. Time zone is used for new
+// receipts and for dates in statistics.
+func (o Options) PutAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var accountData AccountPutBody
+		if err := ctx.ShouldBindJSON(&accountData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(accountData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if accountData.Currency == "" && accountData.Country == "" && accountData.TimeZone == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "No settings specified!",
+			})
+			return
+		}
+
+		query := sq.Update("users").Where(sq.Eq{"public_id": createdBy.PublicID})
+
+		if accountData.Currency != "" {
+			query = query.Set("currency", normalizeCurrency(accountData.Currency))
+		}
+		if accountData.Country != "" {
+			query = query.Set("country", strings.ToUpper(accountData.Country))
+		}
+		if accountData.TimeZone != "" {
+			if _, err := loadTimeZone(accountData.TimeZone); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			query = query.Set("time_zone", accountData.TimeZone)
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// GetAccountExport is a Gin handler function for downloading all data of the
+// user as a zip archive with JSON and CSV files.
+func (o Options) GetAccountExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Archive is built in memory so an error can still be reported with a
+		// proper status code
+		var buffer bytes.Buffer
+		archive := zip.NewWriter(&buffer)
+
+		for _, table := range exportTables {
+			if err := writeExportTable(o.DB, archive, table.name, table.query(user.ID)); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Header("Content-Disposition", "attachment; filename=\"receipts-archive-export.zip\"")
+		ctx.Data(http.StatusOK, "application/zip", buffer.Bytes())
+	}
+}
+
+// PostAccountDeletion is a Gin handler function for starting the deletion of
+// the account. It responds with a token that has to be sent to DeleteAccount
+// to confirm the deletion.
+func (o Options) PostAccountDeletion() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		token, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.SessionStore.Set("account_deletion:"+token, createdBy.PublicID, accountDeletionExpiration); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"token":     token,
+			"expiresAt": time.Now().Add(accountDeletionExpiration),
+		})
+	}
+}
+
+// DeleteAccount is a Gin handler function for deleting the account of the user
+// and all of the user's data. Deletion has to be confirmed with a token from
+// PostAccountDeletion.
+func (o Options) DeleteAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var accountData AccountDeleteBody
+		if err := ctx.ShouldBindJSON(&accountData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(accountData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tokenKey := "account_deletion:" + accountData.Token
+		tokenUserID, err := o.SessionStore.Get(tokenKey)
+		if err != nil || tokenUserID != createdBy.PublicID {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "deletion token is invalid or has expired",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := deleteAccount(tx, user.ID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Other sessions of the user are rejected since the user doesn't exist
+		// anymore, but this one can be removed right away
+		session := sessions.Default(ctx)
+		o.SessionStore.Delete(tokenKey)
+		if sessionID, ok := session.Get("session_id").(string); ok {
+			o.SessionStore.Delete(sessionID)
+		}
+
+		session.Clear()
+		if err := session.Save(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+)
+
+func TestDeleteAccountRenamesSharedHouseholds(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "leaving")
+	other := newTestHousehold(t, db, "staying")
+	db.MustExec("INSERT INTO household_members (household_id, user_id, role) VALUES (?, ?, 'member')", household.HouseholdID, other.UserID)
+	db.MustExec("UPDATE households SET name = 'leaving' WHERE id = ?", household.HouseholdID)
+
+	tx := db.MustBegin()
+	if err := deleteAccount(tx, household.UserID); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := db.Get(&name, "SELECT name FROM households WHERE id = ?", household.HouseholdID); err != nil {
+		t.Fatal(err)
+	}
+	if name != anonymousHouseholdName {
+		t.Errorf("shared household is named %q after deleting the user, want %q", name, anonymousHouseholdName)
+	}
+}
+
+func TestAccountExport(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	other := newTestHousehold(t, db, "member")
+	db.MustExec("INSERT INTO household_members (household_id, user_id, role) VALUES (?, ?, 'member')", household.HouseholdID, other.UserID)
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	itemID := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 150, 'l')", household.UserID, household.HouseholdID)
+	own := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'own', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	others := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'others', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, other.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'own-line', 2), (?, ?, 'others-line', 1)", own, itemID, others, itemID)
+
+	recorder := serve(options.GetAccountExport(), "/me/export", "user", http.MethodGet, "/me/export", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("content type is %q, want application/zip", contentType)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	for _, table := range exportTables {
+		for _, name := range []string{table.name + ".json", table.name + ".csv"} {
+			if files[name] == nil {
+				t.Errorf("archive doesn't contain %s", name)
+			}
+		}
+	}
+
+	ids := func(name string) []string {
+		file, err := files[name].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		records := []map[string]interface{}{}
+		if err := json.NewDecoder(file).Decode(&records); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		return ids
+	}
+
+	// Records of other members of the household are their personal data
+	if got := ids("receipts.json"); !reflect.DeepEqual(got, []string{"own"}) {
+		t.Errorf("exported receipts are %v, want [own]", got)
+	}
+	if got := ids("items_in_receipt.json"); !reflect.DeepEqual(got, []string{"own-line"}) {
+		t.Errorf("exported lines are %v, want [own-line]", got)
+	}
+	if got := ids("account.json"); !reflect.DeepEqual(got, []string{"user"}) {
+		t.Errorf("exported accounts are %v, want [user]", got)
+	}
+
+	file, err := files["receipts.csv"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][0] != "id" || rows[1][0] != "own" {
+		t.Errorf("exported receipts csv is %v", rows)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "user")
+	newTestHousehold(t, db, "other")
+	store := database.NewMemorySessionStore()
+	options := Options{
+		DB:           db,
+		SessionStore: store,
+		V:            NewValidator(),
+	}
+
+	router := newSessionRouter(options)
+	router.handle(http.MethodGet, "/me", options.GetAccountInfo())
+	router.handle(http.MethodPost, "/me/deletion", options.PostAccountDeletion())
+	router.handle(http.MethodDelete, "/me", options.DeleteAccount())
+
+	session := router.login(t, "user")
+	token := func(session []*http.Cookie) string {
+		recorder := router.serve(http.MethodPost, "/me/deletion", "", session)
+		var response struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Token
+	}
+
+	store.Set("account_deletion:expired", "user", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	invalid := map[string]string{
+		"wrong token":           "wrong",
+		"expired token":         "expired",
+		"token of another user": token(router.login(t, "other")),
+		"empty token":           "",
+	}
+	for name, invalidToken := range invalid {
+		if recorder := router.serve(http.MethodDelete, "/me", `{"token": "`+invalidToken+`"}`, session); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want %d", name, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+
+	if recorder := router.serve(http.MethodDelete, "/me", `{"token": "`+token(session)+`"}`, session); recorder.Code != http.StatusOK {
+		t.Fatalf("deleting the account: got %d %s", recorder.Code, recorder.Body)
+	}
+
+	var users int
+	if err := db.Get(&users, "SELECT COUNT(*) FROM users WHERE public_id = 'user'"); err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Error("user exists after deleting the account")
+	}
+
+	// Session is removed from the store so the old cookie doesn't work even
+	// if a user with the same id signs up again
+	newTestHousehold(t, db, "user")
+	if recorder := router.serve(http.MethodGet, "/me", "", session); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("request with the session of the deleted account: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+}
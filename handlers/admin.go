@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// AdminUsersGetQuery : Structure that should be used for getting query data on get request for users by administrators
+type AdminUsersGetQuery struct {
+	Search   string `form:"search" json:"search"`
+	Role     string `form:"role" json:"role"`
+	Disabled *bool  `form:"disabled" json:"disabled"`
+}
+
+// AdminUsersPutBody : Structure that should be used for getting json from body of a put request for users by administrators
+type AdminUsersPutBody struct {
+	PublicID string `json:"id" validate:"required"`
+	Role     string `json:"role" validate:"omitempty,oneof=user admin"`
+	Disabled *bool  `json:"disabled"`
+}
+
+// AdminUsersDeleteBody : Structure that should be used for getting json data from body of a delete request for users by administrators
+type AdminUsersDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// AdminAuditGetQuery : Structure that should be used for getting query data on get request for the audit log
+type AdminAuditGetQuery struct {
+	AdminID  string `form:"adminId"`
+	TargetID string `form:"targetId"`
+	Limit    uint64 `form:"limit"`
+}
+
+// Usage : Structure that should be used for getting storage usage of a user from database
+type Usage struct {
+	PublicID       string `db:"public_id" json:"id"`
+	RealName       string `db:"real_name" json:"realName"`
+	Locations      int    `db:"locations" json:"locations"`
+	Items          int    `db:"items" json:"items"`
+	Receipts       int    `db:"receipts" json:"receipts"`
+	ItemsInReceipt int    `db:"items_in_receipt" json:"itemsInReceipt"`
+	EstimatedBytes int64  `db:"estimated_bytes" json:"estimatedBytes"`
+}
+
+// AuditLogEntry : Structure that should be used for getting audit log entries from database
+type AuditLogEntry struct {
+	AdminID   string    `db:"admin_id" json:"adminId"`
+	Action    string    `db:"action" json:"action"`
+	TargetID  *string   `db:"target_id" json:"targetId"`
+	Details   *string   `db:"details" json:"details"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// ErrLastAdmin is returned when a change would leave no enabled
+// administrators
+var ErrLastAdmin = errors.New("the last administrator can't be demoted, disabled or deleted")
+
+// ErrAdminSelf is returned when administrators try to demote, disable or
+// delete themselves
+var ErrAdminSelf = errors.New("administrators can't demote, disable or delete themselves")
+
+// defaultAuditLimit is the number of audit log entries returned if limit is
+// not specified
+const defaultAuditLimit = 100
+
+// AdminRequired checks if the authenticated user is an administrator. It has
+// to be used after AuthRequired.
+func (o Options) AdminRequired() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString("userRole") != UserRoleAdmin {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"message": "administrator role is required",
+			})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// audit records an action of an administrator in the audit log. Actions that
+// change data should be recorded in the same transaction as the change so
+// there are no changes without audit entries.
+func audit(db sqlx.Execer, ctx *gin.Context, action string, targetID string, details interface{}) error {
+	admin, _ := GetUserID(ctx)
+
+	var target, detailsJSON interface{}
+	if targetID != "" {
+		target = targetID
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		detailsJSON = string(data)
+	}
+
+	query := sq.Insert("admin_audit_log").Columns("admin_id", "action", "target_id", "details", "created_at").Values(admin.PublicID, action, target, detailsJSON, time.Now().UTC())
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(queryString, queryStringArgs...)
+	return err
+}
+
+// checkAdminsLeft checks that there is an enabled administrator after
+// changes made in the transaction.
+func checkAdminsLeft(tx *sqlx.Tx) error {
+	var admins int
+	if err := tx.Get(&admins, "SELECT COUNT(*) FROM users WHERE role = ? AND disabled_at IS NULL", UserRoleAdmin); err != nil {
+		return err
+	}
+
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// adminErrorStatus gets the status of a response for an error of checking
+// administrators
+func adminErrorStatus(err error) int {
+	if err == ErrLastAdmin {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// GetAdminUsers is a Gin handler function for listing and searching users.
+func (o Options) GetAdminUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var searchQuery AdminUsersGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("id, public_id, real_name, role, currency, country, time_zone, disabled_at, sessions_revoked_at").From("users").OrderBy("id")
+
+		if searchQuery.Search != "" {
+			search := fmt.Sprint("%", searchQuery.Search, "%")
+			query = query.Where("(public_id LIKE ? OR real_name LIKE ?)", search, search)
+		}
+		if searchQuery.Role != "" {
+			query = query.Where(sq.Eq{"role": searchQuery.Role})
+		}
+		if searchQuery.Disabled != nil {
+			if *searchQuery.Disabled {
+				query = query.Where(sq.NotEq{"disabled_at": nil})
+			} else {
+				query = query.Where(sq.Eq{"disabled_at": nil})
+			}
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		users := []Account{}
+		if err := o.DB.Select(&users, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := audit(o.DB, ctx, "list_users", "", searchQuery); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, users)
+	}
+}
+
+// PutAdminUsers is a Gin handler function for changing the role of a user and
+// disabling or enabling accounts. Disabling an account also ends all of its
+// sessions. Administrators can't demote or disable themselves or the last
+// enabled administrator.
+func (o Options) PutAdminUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var userData AdminUsersPutBody
+		if err := ctx.ShouldBindJSON(&userData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(userData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if userData.Role == "" && userData.Disabled == nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "nothing to update",
+			})
+			return
+		}
+
+		demotes := userData.Role == UserRoleUser || (userData.Disabled != nil && *userData.Disabled)
+		if admin, _ := GetUserID(ctx); demotes && admin.PublicID == userData.PublicID {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": ErrAdminSelf.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("users")
+
+		// Roles given by administrators are kept when the configuration
+		// changes
+		if userData.Role != "" {
+			query = query.Set("role", userData.Role).Set("admin_from_config", false)
+		}
+		if userData.Disabled != nil {
+			if *userData.Disabled {
+				now := time.Now().UTC()
+				query = query.Set("disabled_at", now).Set("sessions_revoked_at", now)
+			} else {
+				query = query.Set("disabled_at", nil)
+			}
+		}
+
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": userData.PublicID}).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := tx.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			tx.Rollback()
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "user does not exist",
+			})
+			return
+		}
+
+		if demotes {
+			if err := checkAdminsLeft(tx); err != nil {
+				tx.Rollback()
+				ctx.JSON(adminErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := audit(tx, ctx, "update_user", userData.PublicID, userData); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteAdminUsers is a Gin handler function for deleting accounts of users.
+// Administrators can't delete themselves or the last enabled administrator.
+func (o Options) DeleteAdminUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var userData AdminUsersDeleteBody
+		if err := ctx.ShouldBindJSON(&userData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(userData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if admin, _ := GetUserID(ctx); admin.PublicID == userData.PublicID {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": ErrAdminSelf.Error(),
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, userData.PublicID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"message": "user does not exist",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := deleteAccount(tx, account.ID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := checkAdminsLeft(tx); err != nil {
+			tx.Rollback()
+			ctx.JSON(adminErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := audit(tx, ctx, "delete_user", account.PublicID, nil); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// PostAdminLogout is a Gin handler function for ending all sessions of a user.
+func (o Options) PostAdminLogout() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := sq.Update("users").Set("sessions_revoked_at", time.Now().UTC()).Where(sq.Eq{"public_id": ctx.Param("id")})
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := tx.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			tx.Rollback()
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "user does not exist",
+			})
+			return
+		}
+
+		if err := audit(tx, ctx, "logout_user", ctx.Param("id"), nil); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// GetAdminUsage is a Gin handler function for getting storage usage of every
+// user and totals for the whole system.
+func (o Options) GetAdminUsage() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// Estimated bytes is the length of all text columns of records the user
+		// created. It's not exact but it's good enough to compare users.
+		query := sq.Select(
+			"users.public_id",
+			"users.real_name",
+			"(SELECT COUNT(*) FROM locations WHERE created_by = users.id) AS locations",
+			"(SELECT COUNT(*) FROM items WHERE created_by = users.id) AS items",
+			"(SELECT COUNT(*) FROM receipts WHERE created_by = users.id) AS receipts",
+			"(SELECT COUNT(*) FROM items_in_receipt JOIN receipts ON receipts.id = items_in_receipt.receipt_id WHERE receipts.created_by = users.id) AS items_in_receipt",
+			`(SELECT COALESCE(SUM(LENGTH(public_id) + LENGTH(name) + LENGTH(address)), 0) FROM locations WHERE created_by = users.id) +
+			(SELECT COALESCE(SUM(LENGTH(public_id) + LENGTH(name) + LENGTH(unit)), 0) FROM items WHERE created_by = users.id) +
+			(SELECT COALESCE(SUM(LENGTH(public_id)), 0) FROM receipts WHERE created_by = users.id) AS estimated_bytes`,
+		).From("users").OrderBy("estimated_bytes DESC")
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		usage := []Usage{}
+		if err := o.DB.Select(&usage, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var totals struct {
+			Users          int   `db:"users" json:"users"`
+			Households     int   `db:"households" json:"households"`
+			Locations      int   `db:"locations" json:"locations"`
+			Items          int   `db:"items" json:"items"`
+			Receipts       int   `db:"receipts" json:"receipts"`
+			ItemsInReceipt int   `db:"items_in_receipt" json:"itemsInReceipt"`
+			DatabaseBytes  int64 `db:"database_bytes" json:"databaseBytes"`
+		}
+		if err := o.DB.Get(&totals, `SELECT
+			(SELECT COUNT(*) FROM users) AS users,
+			(SELECT COUNT(*) FROM households) AS households,
+			(SELECT COUNT(*) FROM locations) AS locations,
+			(SELECT COUNT(*) FROM items) AS items,
+			(SELECT COUNT(*) FROM receipts) AS receipts,
+			(SELECT COUNT(*) FROM items_in_receipt) AS items_in_receipt,
+			(SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()) AS database_bytes`); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := audit(o.DB, ctx, "view_usage", "", nil); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"users":  usage,
+			"totals": totals,
+		})
+	}
+}
+
+// GetAdminAudit is a Gin handler function for reading the audit log. Newest
+// entries are returned first.
+func (o Options) GetAdminAudit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var searchQuery AdminAuditGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if searchQuery.Limit == 0 {
+			searchQuery.Limit = defaultAuditLimit
+		}
+
+		query := sq.Select("admin_id, action, target_id, details, created_at").From("admin_audit_log").OrderBy("id DESC").Limit(searchQuery.Limit)
+
+		if searchQuery.AdminID != "" {
+			query = query.Where(sq.Eq{"admin_id": searchQuery.AdminID})
+		}
+		if searchQuery.TargetID != "" {
+			query = query.Where(sq.Eq{"target_id": searchQuery.TargetID})
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		entries := []AuditLogEntry{}
+		if err := o.DB.Select(&entries, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/markbates/goth"
+)
+
+func TestAdminTimesUTC(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "admin")
+	newTestHousehold(t, db, "user")
+	db.MustExec("UPDATE users SET role = 'admin' WHERE public_id = 'admin'")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	// Times have to be stored in UTC whatever the time zone of the server
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() {
+		time.Local = local
+	}()
+
+	if recorder := serve(options.PutAdminUsers(), "/admin/users", "admin", http.MethodPut, "/admin/users", `{"id": "user", "disabled": true}`); recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(options.PostAdminLogout(), "/admin/users/:id/logout", "admin", http.MethodPost, "/admin/users/user/logout", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+
+	times := []string{}
+	if err := db.Select(&times, "SELECT disabled_at FROM users WHERE public_id = 'user' UNION ALL SELECT sessions_revoked_at FROM users WHERE public_id = 'user' UNION ALL SELECT created_at FROM admin_audit_log"); err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 4 {
+		t.Fatalf("got times %v, want disabling, logout and 2 audit entries", times)
+	}
+	for _, stored := range times {
+		if !strings.HasSuffix(stored, "+00:00") && !strings.HasSuffix(stored, "Z") {
+			t.Errorf("got time %s, want a time in UTC", stored)
+		}
+	}
+}
+
+func TestAdminRequired(t *testing.T) {
+	options := Options{}
+	gin.SetMode(gin.TestMode)
+
+	for role, status := range map[string]int{
+		UserRoleUser:  http.StatusForbidden,
+		UserRoleAdmin: http.StatusOK,
+	} {
+		router := gin.New()
+		router.GET("/admin", func(ctx *gin.Context) {
+			ctx.Set("userRole", role)
+		}, options.AdminRequired(), func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin", nil))
+		if recorder.Code != status {
+			t.Errorf("%s: got %d, want %d", role, recorder.Code, status)
+		}
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	db := newTestDB(t)
+	for _, user := range []string{"admin", "second", "alice", "bob"} {
+		newTestHousehold(t, db, user)
+	}
+	db.MustExec("UPDATE users SET role = 'admin' WHERE public_id IN ('admin', 'second')")
+	db.MustExec("UPDATE users SET disabled_at = current_timestamp WHERE public_id = 'bob'")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	searches := []struct {
+		query string
+		want  []string
+	}{
+		{"search=ali", []string{"alice"}},
+		{"role=admin", []string{"admin", "second"}},
+		{"disabled=true", []string{"bob"}},
+		{"disabled=false&role=user", []string{"alice"}},
+	}
+	for _, search := range searches {
+		recorder := serve(options.GetAdminUsers(), "/admin/users", "admin", http.MethodGet, "/admin/users?"+search.query, "")
+		users := []Account{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &users); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, user := range users {
+			got = append(got, user.PublicID)
+		}
+		if !reflect.DeepEqual(got, search.want) {
+			t.Errorf("%s: got users %v, want %v", search.query, got, search.want)
+		}
+	}
+
+	updates := []struct {
+		name   string
+		admin  string
+		body   string
+		status int
+	}{
+		{"demote themselves", "admin", `{"id": "admin", "role": "user"}`, http.StatusConflict},
+		{"disable themselves", "admin", `{"id": "admin", "disabled": true}`, http.StatusConflict},
+		{"demote another administrator", "admin", `{"id": "second", "role": "user"}`, http.StatusOK},
+		// Administrator that has just been demoted still has a valid session
+		{"demote the last administrator", "second", `{"id": "admin", "role": "user"}`, http.StatusConflict},
+		{"disable the last administrator", "second", `{"id": "admin", "disabled": true}`, http.StatusConflict},
+		{"promote a user", "admin", `{"id": "alice", "role": "admin"}`, http.StatusOK},
+	}
+	for _, update := range updates {
+		if recorder := serve(options.PutAdminUsers(), "/admin/users", update.admin, http.MethodPut, "/admin/users", update.body); recorder.Code != update.status {
+			t.Errorf("%s: got %d %s, want %d", update.name, recorder.Code, recorder.Body, update.status)
+		}
+	}
+	if recorder := serve(options.DeleteAdminUsers(), "/admin/users", "admin", http.MethodDelete, "/admin/users", `{"id": "admin"}`); recorder.Code != http.StatusConflict {
+		t.Errorf("delete themselves: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusConflict)
+	}
+
+	roles := []string{}
+	if err := db.Select(&roles, "SELECT role FROM users WHERE public_id IN ('admin', 'second', 'alice') ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{UserRoleAdmin, UserRoleUser, UserRoleAdmin}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("roles are %v, want %v", roles, want)
+	}
+
+	// Only changes that were made are audited
+	recorder := serve(options.GetAdminAudit(), "/admin/audit", "admin", http.MethodGet, "/admin/audit?adminId=admin&targetId=second", "")
+	entries := []AuditLogEntry{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "update_user" || entries[0].Details == nil || *entries[0].Details != `{"id":"second","role":"user","disabled":null}` {
+		t.Errorf("audit entries of the demoted administrator are %+v", entries)
+	}
+
+	var listings int
+	if err := db.Get(&listings, "SELECT COUNT(*) FROM admin_audit_log WHERE action = 'list_users'"); err != nil {
+		t.Fatal(err)
+	}
+	if listings != len(searches) {
+		t.Errorf("got %d audited searches, want %d", listings, len(searches))
+	}
+}
+
+func TestSyncAdminRole(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "configured")
+	newTestHousehold(t, db, "promoted")
+	db.MustExec("UPDATE users SET role = 'admin' WHERE public_id = 'promoted'")
+
+	role := func(publicID string) string {
+		account, err := GetAccount(db, publicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account.Role
+	}
+
+	options := Options{
+		DB:         db,
+		AdminUsers: []string{"configured@example.com"},
+	}
+	configured := goth.User{UserID: "configured", Email: "configured@example.com"}
+	if err := options.syncAdminRole(configured); err != nil {
+		t.Fatal(err)
+	}
+	if got := role("configured"); got != UserRoleAdmin {
+		t.Errorf("user in the configuration has role %s", got)
+	}
+
+	// Roles given by administrators don't depend on the configuration
+	options.AdminUsers = nil
+	for _, user := range []goth.User{configured, {UserID: "promoted"}} {
+		if err := options.syncAdminRole(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := role("configured"); got != UserRoleUser {
+		t.Errorf("user removed from the configuration has role %s", got)
+	}
+	if got := role("promoted"); got != UserRoleAdmin {
+		t.Errorf("user promoted by an administrator has role %s", got)
+	}
+}
+
+func TestAdminLogout(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "admin")
+	newTestHousehold(t, db, "user")
+	db.MustExec("UPDATE users SET role = 'admin' WHERE public_id = 'admin'")
+	options := Options{
+		DB:           db,
+		SessionStore: database.NewMemorySessionStore(),
+		V:            NewValidator(),
+	}
+
+	router := newSessionRouter(options)
+	router.handle(http.MethodGet, "/me", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	session := router.login(t, "user")
+	if recorder := router.serve(http.MethodGet, "/me", "", session); recorder.Code != http.StatusOK {
+		t.Fatalf("request before logging out: got %d %s", recorder.Code, recorder.Body)
+	}
+
+	if recorder := serve(options.PostAdminLogout(), "/admin/users/:id/logout", "admin", http.MethodPost, "/admin/users/user/logout", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("logging out: got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := router.serve(http.MethodGet, "/me", "", session); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("request after logging out: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+
+	// User can log in again
+	session = router.login(t, "user")
+	if recorder := router.serve(http.MethodGet, "/me", "", session); recorder.Code != http.StatusOK {
+		t.Errorf("request after logging in again: got %d %s", recorder.Code, recorder.Body)
+	}
+}
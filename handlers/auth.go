@@ -5,9 +5,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
-	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/dusansimic/receipts-archive-backend/database"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/jkomyno/nanoid"
@@ -22,6 +23,25 @@ type User struct {
 	RealName string `db:"real_name"`
 }
 
+// Roles of users. Administrators can manage accounts of other users.
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
+// Account : Structure that should be used for getting account information of a user from database
+type Account struct {
+	ID                int        `db:"id" json:"-"`
+	PublicID          string     `db:"public_id" json:"id"`
+	RealName          string     `db:"real_name" json:"realName"`
+	Role              string     `db:"role" json:"role"`
+	Currency          string     `db:"currency" json:"currency"`
+	Country           string     `db:"country" json:"country"`
+	TimeZone          string     `db:"time_zone" json:"timeZone"`
+	DisabledAt        *time.Time `db:"disabled_at" json:"disabledAt"`
+	SessionsRevokedAt *time.Time `db:"sessions_revoked_at" json:"sessionsRevokedAt"`
+}
+
 // StructPublicID is a struct for storing only public id
 type StructPublicID struct {
 	PublicID string `db:"public_id"`
@@ -30,11 +50,13 @@ type StructPublicID struct {
 type key string
 
 const (
-	userIDContextKey = key("userID")
+	// UserIDContextKey is the key of user public id in the http request context
+	UserIDContextKey = key("userID")
 )
 
 // PrivateID gets the database entry id of a user from database that
-// corresponds to a specific public id.
+// corresponds to a specific public id. Users that were deleted while their
+// token is still valid are not found.
 func (s *StructPublicID) PrivateID(db *sqlx.DB) (StructID, error) {
 	userIDQuery := sq.Select("id").From("users").Where(sq.Eq{"public_id": s.PublicID})
 	userIDQueryString, userIDQueryStringArgs, err := userIDQuery.ToSql()
@@ -44,7 +66,7 @@ func (s *StructPublicID) PrivateID(db *sqlx.DB) (StructID, error) {
 
 	user := StructID{}
 	if err := db.Get(&user, userIDQueryString, userIDQueryStringArgs...); err != nil {
-		log.Fatalln(err.Error())
+		return StructID{}, err
 	}
 
 	return user, nil
@@ -74,7 +96,7 @@ func (o Options) AuthRequired() gin.HandlerFunc {
 			ctx.Abort()
 			return
 		}
-		item, err := o.SessionStore.Get(sessionID.(string))
+		sessionUserID, err := o.SessionStore.Get(sessionID.(string))
 		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
 				"message": "session has expired or is invalid",
@@ -92,7 +114,16 @@ func (o Options) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		if userID != string(item.Value) {
+		if userID != sessionUserID {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "session is invalid",
+			})
+			ctx.Abort()
+			return
+		}
+
+		account, err := GetAccount(o.DB, sessionUserID)
+		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
 				"message": "session is invalid",
 			})
@@ -100,13 +131,34 @@ func (o Options) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		if account.DisabledAt != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "account is disabled",
+			})
+			ctx.Abort()
+			return
+		}
+
+		// Sessions created before they were revoked by an administrator are no
+		// longer valid
+		createdAt, _ := session.Get("created_at").(int64)
+		if account.SessionsRevokedAt != nil && !time.Unix(0, createdAt).After(*account.SessionsRevokedAt) {
+			o.SessionStore.Delete(sessionID.(string))
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "session has been revoked",
+			})
+			ctx.Abort()
+			return
+		}
+
 		// See how to extend the session so it won't expire after an hour if used
 		// for an hour but will expire if not used for an hour.
 
 		// Passing userID inside http request context since GraphQL resolver can only read that one and not the gin context.
-		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), userIDContextKey, userID))
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), UserIDContextKey, userID))
 
 		ctx.Set("userID", userID)
+		ctx.Set("userRole", account.Role)
 		ctx.Next()
 	}
 }
@@ -120,17 +172,13 @@ func (o Options) CreateSessionID(ctx *gin.Context, user StructPublicID) error {
 		return err
 	}
 
-	sessionStoreItem := &memcache.Item{
-		Key:        uuid,
-		Value:      []byte(user.PublicID),
-		Expiration: 60 * 60, // In seconds (60 seconds is one minute and 60 minutes is one hour)
-	}
-	if err := o.SessionStore.Set(sessionStoreItem); err != nil {
+	if err := o.SessionStore.Set(uuid, user.PublicID, time.Hour); err != nil {
 		return err
 	}
 
 	session.Set("session_id", uuid)
 	session.Set("user_id", user.PublicID)
+	session.Set("created_at", time.Now().UnixNano())
 	if err := session.Save(); err != nil {
 		return err
 	}
@@ -138,6 +186,40 @@ func (o Options) CreateSessionID(ctx *gin.Context, user StructPublicID) error {
 	return nil
 }
 
+// GetAccount gets account information of a user with specified public id.
+func GetAccount(db *sqlx.DB, publicID string) (Account, error) {
+	query := sq.Select("id, public_id, real_name, role, currency, country, time_zone, disabled_at, sessions_revoked_at").From("users").Where(sq.Eq{"public_id": publicID})
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return Account{}, err
+	}
+
+	account := Account{}
+	if err := db.Get(&account, queryString, queryStringArgs...); err != nil {
+		return Account{}, err
+	}
+
+	return account, nil
+}
+
+// syncAdminRole gives the admin role to a user if user's id or email is in the
+// list of administrators from the configuration and takes it away from users
+// that got it from the configuration but are no longer in the list. Roles
+// given by other administrators are kept.
+func (o Options) syncAdminRole(user goth.User) error {
+	for _, admin := range o.AdminUsers {
+		if admin == "" || (admin != user.UserID && admin != user.Email) {
+			continue
+		}
+
+		_, err := o.DB.Exec("UPDATE users SET role = ?, admin_from_config = 1 WHERE public_id = ?", UserRoleAdmin, user.UserID)
+		return err
+	}
+
+	_, err := o.DB.Exec("UPDATE users SET role = ?, admin_from_config = 0 WHERE public_id = ? AND admin_from_config = 1", UserRoleUser, user.UserID)
+	return err
+}
+
 // UserCheck checks if there is a specified user in the database. If there is,
 // does nothing. If there is not, inserts the data in database.
 func UserCheck(user goth.User, db *sqlx.DB) (StructPublicID, error) {
@@ -155,12 +237,26 @@ func UserCheck(user goth.User, db *sqlx.DB) (StructPublicID, error) {
 			return userID, err
 		}
 
-		tx, err := db.Begin()
+		tx, err := db.Beginx()
+		if err != nil {
+			return userID, err
+		}
+
+		result, err := tx.Exec(insertQueryString, insertArgs...)
 		if err != nil {
+			tx.Rollback()
 			return userID, err
 		}
 
-		if _, err := tx.Exec(insertQueryString, insertArgs...); err != nil {
+		privateID, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return userID, err
+		}
+
+		// Every user gets a personal household for storing records
+		if _, err := database.CreateHousehold(tx, int(privateID), user.Email); err != nil {
+			tx.Rollback()
 			return userID, err
 		}
 
@@ -193,6 +289,13 @@ func (o Options) AuthHandler() gin.HandlerFunc {
 			return
 		}
 
+		if err := o.syncAdminRole(user); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		if err := o.CreateSessionID(ctx, userID); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -225,6 +328,13 @@ func (o Options) AuthCallbackHandler() gin.HandlerFunc {
 			return
 		}
 
+		if err := o.syncAdminRole(user); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		if err := o.CreateSessionID(ctx, userID); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -242,7 +352,7 @@ func (o Options) LogoutHandler() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		session := sessions.Default(ctx)
 
-		if err := o.SessionStore.Delete(session.Get("userID").(string)); err != nil {
+		if err := o.SessionStore.Delete(session.Get("session_id").(string)); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPrivateID(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	user, err := (&StructPublicID{PublicID: "user"}).PrivateID(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != household.UserID {
+		t.Errorf("got id %d, want %d", user.ID, household.UserID)
+	}
+
+	// Users that were deleted are not found even if their tokens are still
+	// valid
+	if _, err := (&StructPublicID{PublicID: "deleted"}).PrivateID(db); err != sql.ErrNoRows {
+		t.Errorf("got error %v for a deleted user, want %v", err, sql.ErrNoRows)
+	}
+}
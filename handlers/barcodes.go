@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxItemBarcodes is the number of barcodes an item can have
+const maxItemBarcodes = 20
+
+// productMissAge is the time after which barcodes that the product database
+// didn't know are looked up again
+const productMissAge = 7 * 24 * time.Hour
+
+// ErrTooManyBarcodes is returned when an item would have more than
+// maxItemBarcodes barcodes
+var ErrTooManyBarcodes = fmt.Errorf("item can't have more than %d barcodes", maxItemBarcodes)
+
+// ItemByBarcodeGetQuery : Structure that should be used for getting query data on get request for an item by its barcode
+type ItemByBarcodeGetQuery struct {
+	HouseholdID string `form:"householdId"`
+}
+
+// normalizeBarcodes normalizes barcodes and removes duplicates
+func normalizeBarcodes(codes []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		code, err := database.NormalizeBarcode(code)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+
+	if len(normalized) > maxItemBarcodes {
+		return nil, ErrTooManyBarcodes
+	}
+
+	return normalized, nil
+}
+
+// ItemBarcodes gets barcodes of items by public ids of items
+func ItemBarcodes(db *sqlx.DB, itemIDs []string) (map[string][]string, error) {
+	barcodes := map[string][]string{}
+	if len(itemIDs) == 0 {
+		return barcodes, nil
+	}
+
+	queryString, queryStringArgs, err := sq.Select("items.public_id AS item_id, item_barcodes.code").From("item_barcodes").Join("items ON items.id = item_barcodes.item_id").Where(sq.Eq{"items.public_id": itemIDs}).OrderBy("item_barcodes.id").ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		ItemID string `db:"item_id"`
+		Code   string `db:"code"`
+	}{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		barcodes[row.ItemID] = append(barcodes[row.ItemID], row.Code)
+	}
+
+	return barcodes, nil
+}
+
+// barcodeOwner gets the public id of an item of the household other than the
+// excluded one that has one of the barcodes. Items in the trash still own
+// their barcodes. It returns an empty string if there is no such item.
+func barcodeOwner(db *sqlx.DB, householdID int, codes []string, excludedItemID int) (string, error) {
+	if len(codes) == 0 {
+		return "", nil
+	}
+
+	queryString, queryStringArgs, err := sq.Select("items.public_id").From("item_barcodes").Join("items ON items.id = item_barcodes.item_id").Where(sq.Eq{"item_barcodes.household_id": householdID, "item_barcodes.code": codes}).Where(sq.NotEq{"item_barcodes.item_id": excludedItemID}).Limit(1).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var owner string
+	if err := db.Get(&owner, queryString, queryStringArgs...); err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return owner, nil
+}
+
+// insertBarcodes adds barcodes to an item in the transaction
+func insertBarcodes(tx *sql.Tx, itemID int64, householdID int, codes []string) error {
+	for _, code := range codes {
+		if _, err := tx.Exec("INSERT INTO item_barcodes (item_id, household_id, code) VALUES (?, ?, ?)", itemID, householdID, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetItemByBarcode is a Gin handler function for getting an item by one of
+// its barcodes. If no item has the barcode, the product with the barcode is
+// looked up in the product database and sent with the not found response so
+// a new item can be filled in. Errors of the product database are sent as bad
+// gateway responses.
+func (o Options) GetItemByBarcode() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery ItemByBarcodeGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		code, err := database.NormalizeBarcode(ctx.Param("code"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := itemsQuery(user.ID).Join("item_barcodes ON item_barcodes.item_id = items.id").Where(sq.Eq{"item_barcodes.code": code}).OrderBy("items.id").Limit(1)
+		if searchQuery.HouseholdID != "" {
+			query = query.Where(sq.Eq{"households.public_id": searchQuery.HouseholdID})
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var item Item
+		if err := o.DB.Get(&item, queryString, queryStringArgs...); err == sql.ErrNoRows {
+			product, err := o.lookupProduct(code)
+			if err == database.ErrProductNotFound {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"message": "item not found",
+				})
+				return
+			} else if err != nil {
+				ctx.JSON(http.StatusBadGateway, gin.H{
+					"message": "looking up product failed: " + err.Error(),
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "item not found",
+				"product": product,
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		barcodes, err := ItemBarcodes(o.DB, []string{item.PublicID})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tags, err := ItemTags(o.DB, []string{item.PublicID})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		item.Barcodes = barcodes[item.PublicID]
+		item.Tags = tags[item.PublicID]
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+		item.NormalizedPrice, item.NormalizedUnit = NormalizePrice(item.Price, item.Unit, item.PackageSize, item.PackageUnit)
+
+		ctx.JSON(http.StatusOK, item)
+	}
+}
+
+// lookupProduct gets the product with the barcode from stored products or
+// from the product database. Products from the product database are stored
+// so they are looked up only once and barcodes it doesn't know are looked up
+// again after productMissAge. It returns database.ErrProductNotFound if the
+// product is unknown or there is no product database.
+func (o Options) lookupProduct(code string) (database.Product, error) {
+	product, err := storedProduct(o.DB, code)
+	if err != sql.ErrNoRows {
+		return product, err
+	}
+
+	if o.ProductLookup == nil {
+		return database.Product{}, database.ErrProductNotFound
+	}
+
+	var misses int
+	if err := o.DB.Get(&misses, "SELECT COUNT(*) FROM product_misses WHERE code = ? AND datetime(checked_at) > ?", code, time.Now().Add(-productMissAge).UTC().Format(sqlTimeLayout)); err != nil {
+		return database.Product{}, err
+	}
+	if misses != 0 {
+		return database.Product{}, database.ErrProductNotFound
+	}
+
+	product, err = o.ProductLookup.Product(code)
+	if err == database.ErrProductNotFound {
+		if _, err := o.DB.Exec("INSERT INTO product_misses (code, checked_at) VALUES (?, ?) ON CONFLICT (code) DO UPDATE SET checked_at = excluded.checked_at", code, time.Now().UTC().Format(sqlTimeLayout)); err != nil {
+			return database.Product{}, err
+		}
+		return database.Product{}, database.ErrProductNotFound
+	}
+	if err != nil {
+		return database.Product{}, err
+	}
+
+	product.Code = code
+	if err := saveProduct(o.DB, product); err != nil {
+		return database.Product{}, err
+	}
+
+	return product, nil
+}
+
+// storedProduct gets a product that was found by the product database
+func storedProduct(db *sqlx.DB, code string) (database.Product, error) {
+	var product database.Product
+	err := db.Get(&product, "SELECT code, name, brand, quantity, unit FROM products WHERE code = ?", code)
+	return product, err
+}
+
+// saveProduct stores a product or replaces the one with the same barcode
+func saveProduct(db sqlx.Execer, product database.Product) error {
+	_, err := db.Exec("INSERT INTO products (code, name, brand, quantity, unit) VALUES (?, ?, ?, ?, ?) ON CONFLICT (code) DO UPDATE SET name = excluded.name, brand = excluded.brand, quantity = excluded.quantity, unit = excluded.unit", product.Code, product.Name, product.Brand, product.Quantity, product.Unit)
+	return err
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeProductLookup is a product database with fixed products that records
+// barcodes it was asked for
+type fakeProductLookup struct {
+	products map[string]database.Product
+	// err is returned for every barcode if it's set
+	err   error
+	codes []string
+}
+
+// Product gets the product with the barcode
+func (l *fakeProductLookup) Product(code string) (database.Product, error) {
+	l.codes = append(l.codes, code)
+	if l.err != nil {
+		return database.Product{}, l.err
+	}
+
+	product, ok := l.products[code]
+	if !ok {
+		return database.Product{}, database.ErrProductNotFound
+	}
+	return product, nil
+}
+
+// getItemByBarcode requests an item by barcode as the user and decodes the
+// response
+func getItemByBarcode(t *testing.T, db *sqlx.DB, lookup database.ProductLookup, userID string, code string) (int, map[string]interface{}) {
+	options := Options{
+		DB:            db,
+		ProductLookup: lookup,
+	}
+	recorder := serve(options.GetItemByBarcode(), "/items/by-barcode/:code", userID, http.MethodGet, "/items/by-barcode/"+code, "")
+
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, body
+}
+
+func TestGetItemByBarcode(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	itemID := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'coffee', 'Kafa', 109999, 'kom')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO item_barcodes (item_id, household_id, code) VALUES (?, ?, '4006381333931')", itemID, household.HouseholdID)
+
+	items := func() int {
+		var count int
+		if err := db.Get(&count, "SELECT COUNT(*) FROM items"); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	t.Run("local item", func(t *testing.T) {
+		lookup := &fakeProductLookup{}
+		status, body := getItemByBarcode(t, db, lookup, "user", "4006381333931")
+		if status != http.StatusOK || body["id"] != "coffee" {
+			t.Errorf("got %d %v, want item coffee", status, body)
+		}
+		if len(lookup.codes) != 0 {
+			t.Errorf("product database was asked for %v", lookup.codes)
+		}
+	})
+
+	t.Run("product from the product database is stored", func(t *testing.T) {
+		lookup := &fakeProductLookup{
+			products: map[string]database.Product{
+				"5901234123457": {Name: "Mleko", Brand: "Imlek", Quantity: 1, Unit: "l"},
+			},
+		}
+
+		status, body := getItemByBarcode(t, db, lookup, "user", "5901234123457")
+		product, _ := body["product"].(map[string]interface{})
+		if status != http.StatusNotFound || product["name"] != "Mleko" || product["code"] != "5901234123457" {
+			t.Errorf("got %d %v, want not found with product Mleko", status, body)
+		}
+
+		// Stored product is used even without a product database
+		status, body = getItemByBarcode(t, db, nil, "user", "5901234123457")
+		product, _ = body["product"].(map[string]interface{})
+		if status != http.StatusNotFound || product["name"] != "Mleko" || product["brand"] != "Imlek" {
+			t.Errorf("got %d %v, want not found with stored product Mleko", status, body)
+		}
+
+		getItemByBarcode(t, db, lookup, "user", "5901234123457")
+		if len(lookup.codes) != 1 {
+			t.Errorf("product database was asked for %v, want once", lookup.codes)
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		lookup := &fakeProductLookup{}
+		status, body := getItemByBarcode(t, db, lookup, "user", "96385074")
+		if _, ok := body["product"]; status != http.StatusNotFound || ok {
+			t.Errorf("got %d %v, want not found without a product", status, body)
+		}
+		if len(lookup.codes) != 1 || lookup.codes[0] != "96385074" {
+			t.Errorf("product database was asked for %v", lookup.codes)
+		}
+
+		// Unknown products are not looked up again until the miss is old
+		getItemByBarcode(t, db, lookup, "user", "96385074")
+		if len(lookup.codes) != 1 {
+			t.Errorf("product database was asked for %v, want once", lookup.codes)
+		}
+		db.MustExec("UPDATE product_misses SET checked_at = datetime('now', '-8 days') WHERE code = '96385074'")
+		getItemByBarcode(t, db, lookup, "user", "96385074")
+		if len(lookup.codes) != 2 {
+			t.Errorf("product database was asked for %v after the miss expired, want twice", lookup.codes)
+		}
+	})
+
+	t.Run("UPC-A code", func(t *testing.T) {
+		lookup := &fakeProductLookup{}
+		getItemByBarcode(t, db, lookup, "user", "036000291452")
+		if len(lookup.codes) != 1 || lookup.codes[0] != "0036000291452" {
+			t.Errorf("product database was asked for %v, want the EAN-13 code", lookup.codes)
+		}
+	})
+
+	t.Run("UPC-A code in a product file", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "products")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		if _, err := file.WriteString(`[{"code": "042100005264", "name": "Cereal", "brand": "Kellogg's"}]`); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		lookup, err := database.NewFileProductLookup(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, code := range []string{"042100005264", "0042100005264"} {
+			status, body := getItemByBarcode(t, db, lookup, "user", code)
+			product, _ := body["product"].(map[string]interface{})
+			if status != http.StatusNotFound || product["name"] != "Cereal" || product["code"] != "0042100005264" {
+				t.Errorf("%s: got %d %v, want not found with product Cereal", code, status, body)
+			}
+		}
+	})
+
+	t.Run("product database error", func(t *testing.T) {
+		before := items()
+		lookup := &fakeProductLookup{
+			err: errors.New("connection refused"),
+		}
+
+		status, body := getItemByBarcode(t, db, lookup, "user", "4012345678901")
+		if _, ok := body["product"]; status != http.StatusBadGateway || ok {
+			t.Errorf("got %d %v, want bad gateway", status, body)
+		}
+
+		var stored int
+		if err := db.Get(&stored, "SELECT COUNT(*) FROM products WHERE code = '4012345678901'"); err != nil {
+			t.Fatal(err)
+		}
+		if stored != 0 || items() != before {
+			t.Errorf("failed lookup stored %d products and created %d items", stored, items()-before)
+		}
+	})
+
+	t.Run("invalid barcode", func(t *testing.T) {
+		lookup := &fakeProductLookup{}
+		if status, _ := getItemByBarcode(t, db, lookup, "user", "4006381333932"); status != http.StatusBadRequest {
+			t.Errorf("got %d, want bad request", status)
+		}
+		if len(lookup.codes) != 0 {
+			t.Errorf("product database was asked for %v", lookup.codes)
+		}
+	})
+
+	t.Run("item of another household", func(t *testing.T) {
+		newTestHousehold(t, db, "other")
+		lookup := &fakeProductLookup{}
+		if status, body := getItemByBarcode(t, db, lookup, "other", "4006381333931"); status != http.StatusNotFound {
+			t.Errorf("got %d %v, want not found", status, body)
+		}
+	})
+}
@@ -0,0 +1,1100 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Periods of budgets
+const (
+	BudgetWeek  = "week"
+	BudgetMonth = "month"
+)
+
+// Scopes of budgets. Budgets limit spending of the whole household, spending
+// at a location, spending on an item or spending on items of a category or
+// with a tag.
+const (
+	BudgetTotal    = "total"
+	BudgetLocation = "location"
+	BudgetItem     = "item"
+	BudgetCategory = "category"
+	BudgetTag      = "tag"
+)
+
+// Statuses of periods of budgets
+const (
+	BudgetOK       = "ok"
+	BudgetWarning  = "warning"
+	BudgetExceeded = "exceeded"
+)
+
+// budgetThresholds are percentages of budgets at which alerts are created.
+// The first one is the warning threshold.
+var budgetThresholds = []int64{80, 100}
+
+// budgetHistoryPeriods is the number of periods in the history of a budget if
+// it's not specified
+const budgetHistoryPeriods = 6
+
+// ErrBudgetScope is returned when a location, an item, a category or a tag of
+// a budget doesn't match its scope
+var ErrBudgetScope = errors.New("budgets of locations need a location id, budgets of items need an item id, budgets of categories need a category, budgets of tags need a tag and other budgets none of them")
+
+// BudgetsGetQuery : Structure that should be used for getting query data on get request for budgets
+type BudgetsGetQuery struct {
+	HouseholdID string `form:"householdId"`
+}
+
+// BudgetHistoryGetQuery : Structure that should be used for getting query data on get request for history of a budget
+type BudgetHistoryGetQuery struct {
+	PublicID string `form:"id" validate:"required"`
+	// Periods is the number of periods up to the current one
+	Periods int `form:"periods" validate:"omitempty,min=1,max=120"`
+}
+
+// BudgetAlertsGetQuery : Structure that should be used for getting query data on get request for alerts of budgets
+type BudgetAlertsGetQuery struct {
+	HouseholdID string `form:"householdId"`
+	Unread      bool   `form:"unread"`
+}
+
+// BudgetsPostBody : Structure that should be used for getting json from body of a post request for budgets
+type BudgetsPostBody struct {
+	Name       string `json:"name" validate:"required"`
+	Period     string `json:"period" validate:"required,oneof=week month"`
+	Scope      string `json:"scope" validate:"omitempty,oneof=total location item category tag"`
+	LocationID string `json:"locationId"`
+	ItemID     string `json:"itemId"`
+	Category   string `json:"category"`
+	Tag        string `json:"tag"`
+	Amount     *Money `json:"amount" validate:"required,min=1"`
+	// Currency of the budget. Default currency of the user is used if it's
+	// not specified.
+	Currency    string `json:"currency" validate:"omitempty,currency"`
+	HouseholdID string `json:"householdId"`
+}
+
+// BudgetsPutBody : Structure that should be used for getting json from body of a put request for budgets
+type BudgetsPutBody struct {
+	PublicID string `json:"id" validate:"required"`
+	Name     string `json:"name"`
+	Period   string `json:"period" validate:"omitempty,oneof=week month"`
+	Amount   *Money `json:"amount" validate:"omitempty,min=1"`
+	Currency string `json:"currency" validate:"omitempty,currency"`
+}
+
+// BudgetsDeleteBody : Structure that should be used for getting json data from body of a delete request for budgets
+type BudgetsDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// BudgetAlertsPutBody : Structure that should be used for getting json from body of a put request for marking alerts of budgets as read
+type BudgetAlertsPutBody struct {
+	PublicIDs []string `json:"ids" validate:"required,min=1"`
+}
+
+// Budget : Structure that should be used for getting budget information from database
+type Budget struct {
+	ID                 int    `db:"id" json:"-"`
+	HouseholdPrivateID int    `db:"household_private_id" json:"-"`
+	LocationPrivateID  *int   `db:"location_private_id" json:"-"`
+	ItemPrivateID      *int   `db:"item_private_id" json:"-"`
+	PublicID           string `db:"public_id" json:"id"`
+	HouseholdID        string `db:"household_id" json:"householdId"`
+	CreatedBy          string `db:"created_by" json:"createdBy"`
+	Name               string `db:"name" json:"name"`
+	Period             string `db:"period" json:"period"`
+	Scope              string `db:"scope" json:"scope"`
+	// LocationID and ItemID are set for budgets of a location or an item
+	LocationID   *string `db:"location_id" json:"locationId"`
+	LocationName *string `db:"location_name" json:"locationName"`
+	ItemID       *string `db:"item_id" json:"itemId"`
+	ItemName     *string `db:"item_name" json:"itemName"`
+	// Category and Tag are set for budgets of a category or a tag of items
+	Category *string `db:"category" json:"category"`
+	Tag      *string `db:"tag" json:"tag"`
+	Amount   Money   `db:"amount" json:"amount"`
+	Currency string  `db:"currency" json:"currency"`
+	// TimeZone is the time zone in which periods start. It's the time zone of
+	// the user who created the budget.
+	TimeZone  string    `db:"time_zone" json:"timeZone"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// BudgetPeriod : Structure that should be used for sending spending in a period of a budget
+type BudgetPeriod struct {
+	// Start and End are the first and the last day of the period
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Budget Money  `json:"budget"`
+	Spent  Money  `json:"spent"`
+	// Remaining is negative when the budget is exceeded
+	Remaining Money      `json:"remaining"`
+	Percent   Percentage `json:"percent"`
+	Status    string     `json:"status"`
+}
+
+// BudgetStatus : Structure that should be used for sending a budget with spending in its current period
+type BudgetStatus struct {
+	Budget
+	Current BudgetPeriod `json:"current"`
+}
+
+// BudgetAlert : Structure that should be used for getting alerts of budgets from database
+type BudgetAlert struct {
+	PublicID   string  `db:"public_id" json:"id"`
+	BudgetID   string  `db:"budget_id" json:"budgetId"`
+	BudgetName string  `db:"budget_name" json:"budgetName"`
+	ReceiptID  *string `db:"receipt_id" json:"receiptId"`
+	// Period is the first day of the period of the budget
+	Period    string     `db:"period" json:"period"`
+	Threshold int        `db:"threshold" json:"threshold"`
+	Spent     Money      `db:"spent" json:"spent"`
+	Amount    Money      `db:"amount" json:"amount"`
+	Currency  string     `db:"currency" json:"currency"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	ReadAt    *time.Time `db:"read_at" json:"readAt"`
+}
+
+// datedAmount is an amount of money with its currency and the time of
+// purchase
+type datedAmount struct {
+	Currency    string    `db:"currency"`
+	PurchasedAt time.Time `db:"purchased_at"`
+	TimeZone    string    `db:"time_zone"`
+	Amount      Money     `db:"amount"`
+}
+
+// budgetsQuery creates a query for budgets with their households, locations,
+// items, categories and tags
+func budgetsQuery() sq.SelectBuilder {
+	return sq.Select("budgets.id, budgets.household_id AS household_private_id, budgets.location_id AS location_private_id, budgets.item_id AS item_private_id, budgets.public_id, households.public_id AS household_id, users.public_id AS created_by, budgets.name, budgets.period, budgets.scope, locations.public_id AS location_id, locations.name AS location_name, items.public_id AS item_id, items.name AS item_name, budgets.category, budgets.tag, budgets.amount, budgets.currency, budgets.time_zone, budgets.created_at, budgets.updated_at").From("budgets").Join("households ON households.id = budgets.household_id").Join("users ON users.id = budgets.created_by").LeftJoin("locations ON locations.id = budgets.location_id").LeftJoin("items ON items.id = budgets.item_id").OrderBy("budgets.name")
+}
+
+// ListBudgets gets budgets of households the user is a member of. Budgets can
+// be limited to a household.
+func ListBudgets(db *sqlx.DB, userID int, householdPublicID string) ([]Budget, error) {
+	query := budgetsQuery().Where(MemberOf("budgets.household_id", userID))
+	if householdPublicID != "" {
+		query = query.Where(sq.Eq{"households.public_id": householdPublicID})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := []Budget{}
+	if err := db.Select(&budgets, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	return budgets, nil
+}
+
+// location gets the time zone of periods of the budget and UTC if it can't be
+// loaded
+func (b Budget) location() *time.Location {
+	location, err := loadTimeZone(b.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// periodStart gets the start of the period of the budget that the time is in.
+// Weeks start on Monday.
+func (b Budget) periodStart(t time.Time) time.Time {
+	t = t.In(b.location())
+	year, month, day := t.Date()
+	if b.Period == BudgetMonth {
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+
+	start := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	return start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+}
+
+// nextPeriod gets the start of the period after the period that starts at the
+// time
+func (b Budget) nextPeriod(start time.Time, periods int) time.Time {
+	if b.Period == BudgetMonth {
+		return start.AddDate(0, periods, 0)
+	}
+	return start.AddDate(0, 0, 7*periods)
+}
+
+// newPeriod creates a period of the budget that starts at the time with the
+// amount spent in it
+func (b Budget) newPeriod(start time.Time, spent Money) BudgetPeriod {
+	period := BudgetPeriod{
+		Start:     start.Format(rateDateLayout),
+		End:       b.nextPeriod(start, 1).AddDate(0, 0, -1).Format(rateDateLayout),
+		Budget:    b.Amount,
+		Spent:     spent,
+		Remaining: b.Amount - spent,
+		Percent:   Percentage(int64(spent) * 10000 / int64(b.Amount)),
+		Status:    BudgetOK,
+	}
+
+	if int64(spent)*100 >= int64(b.Amount)*budgetThresholds[len(budgetThresholds)-1] {
+		period.Status = BudgetExceeded
+	} else if int64(spent)*100 >= int64(b.Amount)*budgetThresholds[0] {
+		period.Status = BudgetWarning
+	}
+
+	return period
+}
+
+// spending calculates spending of the budget in periods between the times
+// grouped by the first day of the period. Receipts in other currencies are
+// converted using the exchange rate on the date of the receipt and refunds
+// reduce spending.
+func (b Budget) spending(db *sqlx.DB, converter *CurrencyConverter, from time.Time, to time.Time) (map[string]Money, error) {
+	var query sq.SelectBuilder
+	if b.Scope == BudgetItem || b.Scope == BudgetCategory || b.Scope == BudgetTag {
+		query = sq.Select("receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, " + LineTotalSQL + " AS amount").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id")
+		switch b.Scope {
+		case BudgetItem:
+			query = query.Where(sq.Eq{"items_in_receipt.item_id": b.ItemPrivateID})
+		case BudgetCategory:
+			query = query.Where(sq.Eq{"items.category": b.Category})
+		case BudgetTag:
+			query = query.Where("items_in_receipt.item_id IN (SELECT item_id FROM item_tags WHERE tag = ?)", b.Tag)
+		}
+	} else {
+		query = sq.Select("receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, " + ReceiptTotalSQL + " AS amount").From("receipts").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id")
+		if b.Scope == BudgetLocation {
+			query = query.Where(sq.Eq{"receipts.location_id": b.LocationPrivateID})
+		}
+	}
+
+	query = query.Where(sq.Eq{"receipts.household_id": b.HouseholdPrivateID}).Where(NotDeleted("receipts")).Where("datetime(receipts.purchased_at) >= ?", from.UTC().Format(sqlTimeLayout)).Where("datetime(receipts.purchased_at) < ?", to.UTC().Format(sqlTimeLayout))
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := []datedAmount{}
+	if err := db.Select(&amounts, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	spent := map[string]Money{}
+	for _, amount := range amounts {
+		converted, err := converter.Convert(amount.Amount, amount.Currency, b.Currency, inTimeZone(amount.PurchasedAt, amount.TimeZone))
+		if err != nil {
+			return nil, err
+		}
+
+		spent[b.periodStart(amount.PurchasedAt).Format(rateDateLayout)] += converted
+	}
+
+	return spent, nil
+}
+
+// BudgetPeriods gets spending of a budget in the number of periods up to the
+// period that the time is in, oldest first.
+func BudgetPeriods(db *sqlx.DB, rateProvider database.ExchangeRateProvider, budget Budget, periods int, now time.Time) ([]BudgetPeriod, error) {
+	current := budget.periodStart(now)
+	first := budget.nextPeriod(current, 1-periods)
+
+	spent, err := budget.spending(db, NewCurrencyConverter(db, rateProvider), first, budget.nextPeriod(current, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]BudgetPeriod, 0, periods)
+	for i := 0; i < periods; i++ {
+		start := budget.nextPeriod(first, i)
+		history = append(history, budget.newPeriod(start, spent[start.Format(rateDateLayout)]))
+	}
+
+	return history, nil
+}
+
+// CheckBudgets creates alerts of budgets when receipts push spending in a
+// period past a threshold. Each threshold alerts once per period and the alert
+// references the latest of the receipts in the period. Budgets whose spending
+// can't be converted to their currency don't stop other budgets from being
+// checked and the first such error is returned.
+func CheckBudgets(db *sqlx.DB, rateProvider database.ExchangeRateProvider, receiptIDs []string) error {
+	if len(receiptIDs) == 0 {
+		return nil
+	}
+
+	receiptsQuery := sq.Select("receipts.id, receipts.household_id, receipts.location_id, receipts.purchased_at").From("receipts").Where(sq.Eq{"receipts.public_id": receiptIDs}).Where(NotDeleted("receipts")).Where(sq.Eq{"receipts.refund_of": nil}).OrderBy("receipts.purchased_at")
+
+	receiptsQueryString, receiptsQueryStringArgs, err := receiptsQuery.ToSql()
+	if err != nil {
+		return err
+	}
+
+	receipts := []struct {
+		ID          int       `db:"id"`
+		HouseholdID int       `db:"household_id"`
+		LocationID  int       `db:"location_id"`
+		PurchasedAt time.Time `db:"purchased_at"`
+	}{}
+	if err := db.Select(&receipts, receiptsQueryString, receiptsQueryStringArgs...); err != nil {
+		return err
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	householdIDs := []int{}
+	privateIDs := []int{}
+	for _, receipt := range receipts {
+		householdIDs = append(householdIDs, receipt.HouseholdID)
+		privateIDs = append(privateIDs, receipt.ID)
+	}
+
+	budgetsQueryString, budgetsQueryStringArgs, err := budgetsQuery().Where(sq.Eq{"budgets.household_id": householdIDs}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	budgets := []Budget{}
+	if err := db.Select(&budgets, budgetsQueryString, budgetsQueryStringArgs...); err != nil {
+		return err
+	}
+	if len(budgets) == 0 {
+		return nil
+	}
+
+	linesQueryString, linesQueryStringArgs, err := sq.Select("DISTINCT items_in_receipt.receipt_id, items_in_receipt.item_id, COALESCE(items.category, '') AS category, COALESCE(item_tags.tag, '') AS tag").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").LeftJoin("item_tags ON item_tags.item_id = items_in_receipt.item_id").Where(sq.Eq{"items_in_receipt.receipt_id": privateIDs}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	lines := []struct {
+		ReceiptID int    `db:"receipt_id"`
+		ItemID    int    `db:"item_id"`
+		Category  string `db:"category"`
+		Tag       string `db:"tag"`
+	}{}
+	if err := db.Select(&lines, linesQueryString, linesQueryStringArgs...); err != nil {
+		return err
+	}
+
+	// Items, categories and tags of items on each receipt
+	items := map[int]map[int]bool{}
+	categories := map[int]map[string]bool{}
+	tags := map[int]map[string]bool{}
+	for _, line := range lines {
+		if items[line.ReceiptID] == nil {
+			items[line.ReceiptID] = map[int]bool{}
+			categories[line.ReceiptID] = map[string]bool{}
+			tags[line.ReceiptID] = map[string]bool{}
+		}
+		items[line.ReceiptID][line.ItemID] = true
+		if line.Category != "" {
+			categories[line.ReceiptID][line.Category] = true
+		}
+		if line.Tag != "" {
+			tags[line.ReceiptID][line.Tag] = true
+		}
+	}
+
+	// Periods of budgets are checked once with the latest receipt in them
+	type budgetPeriod struct {
+		budget int
+		start  string
+	}
+	checked := map[budgetPeriod]int{}
+	starts := map[budgetPeriod]time.Time{}
+	for i, budget := range budgets {
+		for _, receipt := range receipts {
+			if receipt.HouseholdID != budget.HouseholdPrivateID {
+				continue
+			}
+			if budget.Scope == BudgetLocation && (budget.LocationPrivateID == nil || *budget.LocationPrivateID != receipt.LocationID) {
+				continue
+			}
+			if budget.Scope == BudgetItem && (budget.ItemPrivateID == nil || !items[receipt.ID][*budget.ItemPrivateID]) {
+				continue
+			}
+			if budget.Scope == BudgetCategory && (budget.Category == nil || !categories[receipt.ID][*budget.Category]) {
+				continue
+			}
+			if budget.Scope == BudgetTag && (budget.Tag == nil || !tags[receipt.ID][*budget.Tag]) {
+				continue
+			}
+
+			start := budget.periodStart(receipt.PurchasedAt)
+			key := budgetPeriod{budget: i, start: start.Format(rateDateLayout)}
+			checked[key] = receipt.ID
+			starts[key] = start
+		}
+	}
+
+	var conversionErr error
+	converter := NewCurrencyConverter(db, rateProvider)
+	for key, receiptID := range checked {
+		budget := budgets[key.budget]
+		start := starts[key]
+
+		spent, err := budget.spending(db, converter, start, budget.nextPeriod(start, 1))
+		if err != nil {
+			if conversionErr == nil {
+				conversionErr = err
+			}
+			continue
+		}
+
+		for _, threshold := range budgetThresholds {
+			if int64(spent[key.start])*100 < int64(budget.Amount)*threshold {
+				continue
+			}
+
+			uuid, err := nanoid.Nanoid()
+			if err != nil {
+				return err
+			}
+
+			queryString, queryStringArgs, err := sq.Insert("budget_alerts").Options("OR IGNORE").Columns("public_id", "budget_id", "receipt_id", "period", "threshold", "spent").Values(uuid, budget.ID, receiptID, key.start, threshold, spent[key.start]).ToSql()
+			if err != nil {
+				return err
+			}
+
+			if _, err := db.Exec(queryString, queryStringArgs...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return conversionErr
+}
+
+// checkBudgets creates alerts of budgets that receipts pushed past
+// a threshold. Receipts are already saved when budgets are checked so errors
+// are only logged.
+func (o Options) checkBudgets(receiptIDs ...string) {
+	if err := CheckBudgets(o.DB, o.RateProvider, receiptIDs); err != nil {
+		log.Println("checking budgets failed:", err)
+	}
+}
+
+// ListBudgetAlerts gets alerts of budgets of households the user is a member
+// of, newest first. Alerts can be limited to a household and to alerts that
+// are not read.
+func ListBudgetAlerts(db *sqlx.DB, userID int, householdPublicID string, unread bool) ([]BudgetAlert, error) {
+	query := sq.Select("budget_alerts.public_id, budgets.public_id AS budget_id, budgets.name AS budget_name, receipts.public_id AS receipt_id, budget_alerts.period, budget_alerts.threshold, budget_alerts.spent, budgets.amount, budgets.currency, budget_alerts.created_at, budget_alerts.read_at").From("budget_alerts").Join("budgets ON budgets.id = budget_alerts.budget_id").Join("households ON households.id = budgets.household_id").LeftJoin("receipts ON receipts.id = budget_alerts.receipt_id").Where(MemberOf("budgets.household_id", userID)).OrderBy("budget_alerts.id DESC")
+
+	if householdPublicID != "" {
+		query = query.Where(sq.Eq{"households.public_id": householdPublicID})
+	}
+	if unread {
+		query = query.Where(sq.Eq{"budget_alerts.read_at": nil})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := []BudgetAlert{}
+	if err := db.Select(&alerts, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// budgetScopeID gets the database entry id of the location or the item of
+// a budget in the household
+func budgetScopeID(db *sqlx.DB, table string, publicID string, householdID int) (int, error) {
+	var id int
+	err := db.Get(&id, "SELECT id FROM "+table+" WHERE public_id = ? AND household_id = ? AND deleted_at IS NULL", publicID, householdID)
+	if err == sql.ErrNoRows {
+		return 0, ErrBudgetScope
+	}
+	return id, err
+}
+
+// GetBudgets is a Gin handler function for getting budgets.
+func (o Options) GetBudgets() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery BudgetsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		budgets, err := ListBudgets(o.DB, user.ID, searchQuery.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, budgets)
+	}
+}
+
+// GetBudgetsStatus is a Gin handler function for getting budgets with
+// spending in their current period.
+func (o Options) GetBudgetsStatus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery BudgetsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		budgets, err := ListBudgets(o.DB, user.ID, searchQuery.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		now := time.Now()
+		statuses := make([]BudgetStatus, 0, len(budgets))
+		for _, budget := range budgets {
+			periods, err := BudgetPeriods(o.DB, o.RateProvider, budget, 1, now)
+			if err != nil {
+				ctx.JSON(conversionErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			statuses = append(statuses, BudgetStatus{
+				Budget:  budget,
+				Current: periods[0],
+			})
+		}
+
+		// Budgets closest to being exceeded first
+		sort.SliceStable(statuses, func(i, j int) bool {
+			return statuses[i].Current.Percent > statuses[j].Current.Percent
+		})
+
+		ctx.JSON(http.StatusOK, statuses)
+	}
+}
+
+// GetBudgetHistory is a Gin handler function for getting spending of a budget
+// in past periods up to the current one, oldest first.
+func (o Options) GetBudgetHistory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery BudgetHistoryGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		queryString, queryStringArgs, err := budgetsQuery().Where(sq.Eq{"budgets.public_id": searchQuery.PublicID}).Where(MemberOf("budgets.household_id", user.ID)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var budget Budget
+		if err := o.DB.Get(&budget, queryString, queryStringArgs...); err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "budget not found",
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		periods := searchQuery.Periods
+		if periods == 0 {
+			periods = budgetHistoryPeriods
+		}
+
+		history, err := BudgetPeriods(o.DB, o.RateProvider, budget, periods, time.Now())
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, history)
+	}
+}
+
+// PostBudgets is a Gin handler function for adding new budgets. Periods of
+// the budget start in the time zone of the user.
+func (o Options) PostBudgets() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var budgetData BudgetsPostBody
+		if err := ctx.ShouldBindJSON(&budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		scope := budgetData.Scope
+		if scope == "" {
+			scope = BudgetTotal
+		}
+		category, tag := normalizeLabel(budgetData.Category), normalizeLabel(budgetData.Tag)
+		if (scope == BudgetLocation) != (budgetData.LocationID != "") || (scope == BudgetItem) != (budgetData.ItemID != "") || (scope == BudgetCategory) != (category != nil) || (scope == BudgetTag) != (tag != nil) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": ErrBudgetScope.Error(),
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		household, err := WritableHouseholdID(o.DB, account.ID, budgetData.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to add budgets to specified household",
+			})
+			return
+		}
+
+		budget := map[string]interface{}{
+			"household_id": household.ID,
+			"created_by":   account.ID,
+			"name":         budgetData.Name,
+			"period":       budgetData.Period,
+			"scope":        scope,
+			"amount":       *budgetData.Amount,
+			"currency":     normalizeCurrency(budgetData.Currency),
+			"time_zone":    account.TimeZone,
+			"category":     category,
+			"tag":          tag,
+		}
+		if budget["currency"] == "" {
+			budget["currency"] = account.Currency
+		}
+
+		// Location or item has to be in the same household as the budget
+		if budgetData.LocationID != "" {
+			if budget["location_id"], err = budgetScopeID(o.DB, "locations", budgetData.LocationID, household.ID); err != nil {
+				ctx.JSON(scopeErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+		if budgetData.ItemID != "" {
+			if budget["item_id"], err = budgetScopeID(o.DB, "items", budgetData.ItemID, household.ID); err != nil {
+				ctx.JSON(scopeErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		budget["public_id"] = uuid
+
+		queryString, queryStringArgs, err := sq.Insert("budgets").SetMap(budget).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"id": uuid,
+		})
+	}
+}
+
+// scopeErrorStatus gets the status code of an error of finding the location or
+// the item of a budget
+func scopeErrorStatus(err error) int {
+	if err == ErrBudgetScope {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// PutBudgets is a Gin handler function for updating a budget. Scope of
+// a budget can't be changed.
+func (o Options) PutBudgets() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var budgetData BudgetsPutBody
+		if err := ctx.ShouldBindJSON(&budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("budgets").Set("updated_at", time.Now())
+
+		if budgetData.Name != "" {
+			query = query.Set("name", budgetData.Name)
+		}
+		if budgetData.Period != "" {
+			query = query.Set("period", budgetData.Period)
+		}
+		if budgetData.Amount != nil {
+			query = query.Set("amount", *budgetData.Amount)
+		}
+		if budgetData.Currency != "" {
+			query = query.Set("currency", normalizeCurrency(budgetData.Currency))
+		}
+
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": budgetData.PublicID}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to update specified budget",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteBudgets is a Gin handler function for deleting a budget with its
+// alerts.
+func (o Options) DeleteBudgets() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var budgetData BudgetsDeleteBody
+		if err := ctx.ShouldBindJSON(&budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(budgetData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		userOwnsQueryString, userOwnsQueryStringArgs, err := sq.Select("id").From("budgets").Where(sq.Eq{"public_id": budgetData.PublicID}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var budget StructID
+		if err := o.DB.Get(&budget, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to delete specified budget",
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := execAllArgs(tx, []interface{}{budget.ID},
+			"DELETE FROM budget_alerts WHERE budget_id = ?",
+			"DELETE FROM budgets WHERE id = ?",
+		); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// GetBudgetAlerts is a Gin handler function for getting alerts of budgets,
+// newest first.
+func (o Options) GetBudgetAlerts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery BudgetAlertsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		alerts, err := ListBudgetAlerts(o.DB, user.ID, searchQuery.HouseholdID, searchQuery.Unread)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, alerts)
+	}
+}
+
+// PutBudgetAlerts is a Gin handler function for marking alerts of budgets as
+// read. Alerts are read for all members of the household.
+func (o Options) PutBudgetAlerts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var alertData BudgetAlertsPutBody
+		if err := ctx.ShouldBindJSON(&alertData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(alertData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		budgetsQueryString, budgetsQueryStringArgs, err := sq.Select("id").From("budgets").Where(MemberOf("household_id", user.ID)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		queryString, queryStringArgs, err := sq.Update("budget_alerts").Set("read_at", time.Now()).Where(sq.Eq{"public_id": alertData.PublicIDs, "read_at": nil}).Where(sq.Expr("budget_id IN ("+budgetsQueryString+")", budgetsQueryStringArgs...)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		read, err := result.RowsAffected()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"read": read,
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPostBudgetsScope(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name": "Dairy", "period": "month", "scope": "category", "category": "Dairy", "amount": 100}`, http.StatusOK},
+		{`{"name": "Organic", "period": "week", "scope": "tag", "tag": " organic ", "amount": 100}`, http.StatusOK},
+		{`{"name": "Dairy", "period": "month", "scope": "category", "category": " ", "amount": 100}`, http.StatusBadRequest},
+		{`{"name": "Organic", "period": "week", "scope": "tag", "category": "organic", "amount": 100}`, http.StatusBadRequest},
+		{`{"name": "Total", "period": "week", "tag": "organic", "amount": 100}`, http.StatusBadRequest},
+		{`{"name": "Other", "period": "week", "scope": "brand", "amount": 100}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if recorder := serve(options.PostBudgets(), "/budgets", "user", http.MethodPost, "/budgets", test.body); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.body, recorder.Code, recorder.Body, test.status)
+		}
+	}
+
+	var tag string
+	if err := db.Get(&tag, "SELECT tag FROM budgets WHERE scope = 'tag'"); err != nil {
+		t.Fatal(err)
+	}
+	if tag != "organic" {
+		t.Errorf("got tag %q, want organic", tag)
+	}
+}
+
+func TestBudgetsOfCategoriesAndTags(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	milk := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit, category) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom', 'Dairy')", household.UserID, household.HouseholdID)
+	bread := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit, category) VALUES (?, ?, 'bread', 'Hleb', 8999, 'kom', 'Bakery')", household.UserID, household.HouseholdID)
+	detergent := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'detergent', 'Deterdžent', 45000, 'kom')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO item_tags (item_id, household_id, tag) VALUES (?, ?, 'organic'), (?, ?, 'organic'), (?, ?, 'local')", milk, household.HouseholdID, bread, household.HouseholdID, milk, household.HouseholdID)
+
+	now := time.Now().UTC()
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at) VALUES (?, ?, ?, 'receipt', ?)", household.LocationID, household.HouseholdID, household.UserID, now)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'milk-line', 1), (?, ?, 'bread-line', 1), (?, ?, 'detergent-line', 1)", receipt, milk, receipt, bread, receipt, detergent)
+
+	budget := "INSERT INTO budgets (public_id, household_id, created_by, name, period, scope, category, tag, amount, currency, time_zone) VALUES (?, ?, ?, ?, 'month', ?, ?, ?, ?, 'RSD', 'UTC')"
+	db.MustExec(budget, "dairy", household.HouseholdID, household.UserID, "Dairy", BudgetCategory, "Dairy", nil, 10000)
+	db.MustExec(budget, "organic", household.HouseholdID, household.UserID, "Organic", BudgetTag, nil, "organic", 100000)
+	db.MustExec(budget, "cleaning", household.HouseholdID, household.UserID, "Cleaning", BudgetCategory, "Cleaning", nil, 100)
+
+	budgets, err := ListBudgets(db, household.UserID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spent := map[string]Money{}
+	for _, budget := range budgets {
+		periods, err := BudgetPeriods(db, nil, budget, 1, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spent[budget.PublicID] = periods[0].Spent
+	}
+
+	want := map[string]Money{"dairy": 12999, "organic": 21998, "cleaning": 0}
+	for id, amount := range want {
+		if spent[id] != amount {
+			t.Errorf("%s: got %d spent, want %d", id, spent[id], amount)
+		}
+	}
+
+	if err := CheckBudgets(db, nil, []string{"receipt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := ListBudgetAlerts(db, household.UserID, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts %+v, want 2", len(alerts), alerts)
+	}
+	for _, alert := range alerts {
+		if alert.BudgetID != "dairy" {
+			t.Errorf("got alert of budget %s, want dairy", alert.BudgetID)
+		}
+	}
+}
+
+func TestBudgetPeriodStart(t *testing.T) {
+	tests := []struct {
+		period   string
+		timeZone string
+		time     string
+		want     string
+	}{
+		// Weeks start on Monday in the time zone of the budget
+		{BudgetWeek, "Europe/Belgrade", "2020-06-07T21:59:59Z", "2020-06-01T00:00:00+02:00"},
+		{BudgetWeek, "Europe/Belgrade", "2020-06-07T22:00:00Z", "2020-06-08T00:00:00+02:00"},
+		{BudgetWeek, "UTC", "2020-06-07T22:00:00Z", "2020-06-01T00:00:00Z"},
+		{BudgetWeek, "Europe/Belgrade", "2020-06-14T12:00:00Z", "2020-06-08T00:00:00+02:00"},
+		// Months start on the first day of the month in the time zone of the budget
+		{BudgetMonth, "Europe/Belgrade", "2020-05-31T22:30:00Z", "2020-06-01T00:00:00+02:00"},
+		{BudgetMonth, "UTC", "2020-05-31T22:30:00Z", "2020-05-01T00:00:00Z"},
+		{BudgetMonth, "Europe/Belgrade", "2020-03-31T21:59:59Z", "2020-03-01T00:00:00+01:00"},
+	}
+	for _, test := range tests {
+		purchasedAt, err := time.Parse(time.RFC3339, test.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		budget := Budget{Period: test.period, TimeZone: test.timeZone}
+		if got := budget.periodStart(purchasedAt).Format(time.RFC3339); got != test.want {
+			t.Errorf("%s in %s at %s: got %s, want %s", test.period, test.timeZone, test.time, got, test.want)
+		}
+	}
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	milk := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 1000, 'kom')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO budgets (public_id, household_id, created_by, name, period, scope, amount, currency, time_zone) VALUES ('total', ?, ?, 'Total', 'month', 'total', 10000, 'RSD', 'Europe/Belgrade')", household.HouseholdID, household.UserID)
+
+	budgets, err := ListBudgets(db, household.UserID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	current := budgets[0].periodStart(now)
+	previous := budgets[0].nextPeriod(current, -1)
+
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'receipt', ?, 'Europe/Belgrade')", household.LocationID, household.HouseholdID, household.UserID, now)
+	line := insertID(t, db, "INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 8)", receipt, milk)
+
+	alerts := func() map[BudgetAlert]bool {
+		list, err := ListBudgetAlerts(db, household.UserID, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[BudgetAlert]bool{}
+		for _, alert := range list {
+			got[BudgetAlert{Period: alert.Period, Threshold: alert.Threshold, Spent: alert.Spent}] = true
+		}
+		if len(got) != len(list) {
+			t.Errorf("got %d alerts, %d of them are different", len(list), len(got))
+		}
+		return got
+	}
+	checkAlerts := func(when string, want ...BudgetAlert) {
+		got := alerts()
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d alerts %v, want %d", when, len(got), got, len(want))
+		}
+		for _, alert := range want {
+			if !got[alert] {
+				t.Errorf("%s: missing alert %+v in %v", when, alert, got)
+			}
+		}
+	}
+
+	// Spending 80% of the budget alerts once however many times it's checked
+	warning := BudgetAlert{Period: current.Format(rateDateLayout), Threshold: 80, Spent: 8000}
+	for i := 0; i < 2; i++ {
+		if err := CheckBudgets(db, nil, []string{"receipt"}); err != nil {
+			t.Fatal(err)
+		}
+		checkAlerts("spent 80%", warning)
+	}
+
+	// Changing the amount of a line checks budgets of the receipt
+	if recorder := serve(options.PutItemsInReceipt(), "/items/inreceipt", "user", http.MethodPut, "/items/inreceipt", `{"id": "line", "amount": 10}`); recorder.Code != http.StatusOK {
+		t.Fatalf("changing the amount of the line: got %d %s", recorder.Code, recorder.Body)
+	}
+	exceeded := BudgetAlert{Period: current.Format(rateDateLayout), Threshold: 100, Spent: 10000}
+	checkAlerts("spent 100%", warning, exceeded)
+
+	// Refunds reduce spending and thresholds that already alerted don't alert
+	// again in the same period
+	refund := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, refund_of) VALUES (?, ?, ?, 'refund', ?, 'Europe/Belgrade', ?)", household.LocationID, household.HouseholdID, household.UserID, now, receipt)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, refund_of) VALUES (?, ?, 'refund-line', -5, ?)", refund, milk, line)
+	if recorder := serve(options.PutItemsInReceipt(), "/items/inreceipt", "user", http.MethodPut, "/items/inreceipt", `{"id": "line", "amount": 15}`); recorder.Code != http.StatusOK {
+		t.Fatalf("changing the amount of the line: got %d %s", recorder.Code, recorder.Body)
+	}
+	checkAlerts("spent 100% again", warning, exceeded)
+
+	periods, err := BudgetPeriods(db, nil, budgets[0], 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if periods[0].Spent != 10000 {
+		t.Errorf("spent %d with a refund of 5 of 15, want 10000", periods[0].Spent)
+	}
+
+	// Restoring a receipt from the trash checks budgets in its period
+	trashed := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, deleted_at) VALUES (?, ?, ?, 'trashed', ?, 'Europe/Belgrade', current_timestamp)", household.LocationID, household.HouseholdID, household.UserID, current.AddDate(0, 0, -1).UTC())
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'trashed-line', 9)", trashed, milk)
+	if recorder := serve(options.RestoreTrash(), "/trash/:type/:id/restore", "user", http.MethodPost, "/trash/receipts/trashed/restore", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("restoring the receipt: got %d %s", recorder.Code, recorder.Body)
+	}
+	checkAlerts("restored a receipt in the previous month", warning, exceeded, BudgetAlert{Period: previous.Format(rateDateLayout), Threshold: 80, Spent: 9000})
+
+	// History shows spending against the budget in each period
+	recorder := serve(options.GetBudgetHistory(), "/budgets/history", "user", http.MethodGet, "/budgets/history?id=total&periods=3", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("getting history: got %d %s", recorder.Code, recorder.Body)
+	}
+	history := []BudgetPeriod{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	want := []BudgetPeriod{
+		{Start: budgets[0].nextPeriod(current, -2).Format(rateDateLayout), End: previous.AddDate(0, 0, -1).Format(rateDateLayout), Budget: 10000, Spent: 0, Remaining: 10000, Percent: 0, Status: BudgetOK},
+		{Start: previous.Format(rateDateLayout), End: current.AddDate(0, 0, -1).Format(rateDateLayout), Budget: 10000, Spent: 9000, Remaining: 1000, Percent: 9000, Status: BudgetWarning},
+		{Start: current.Format(rateDateLayout), End: budgets[0].nextPeriod(current, 1).AddDate(0, 0, -1).Format(rateDateLayout), Budget: 10000, Spent: 10000, Remaining: 0, Percent: 10000, Status: BudgetExceeded},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("got history %+v, want %+v", history, want)
+	}
+
+	newTestHousehold(t, db, "other")
+	if recorder := serve(options.GetBudgetHistory(), "/budgets/history", "other", http.MethodGet, "/budgets/history?id=total", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("history of a budget of another household: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusNotFound)
+	}
+}
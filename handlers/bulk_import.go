@@ -0,0 +1,671 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoImportReceipts is returned when a bulk import has no receipts
+var ErrNoImportReceipts = errors.New("no receipts to import")
+
+// BulkImportPostBody : Structure that should be used for getting json from body of a post request for bulk imports of receipts
+type BulkImportPostBody struct {
+	// CSV is the content of a csv file with a line of a receipt in each row.
+	// Mapping maps its columns to fields of receipts and lines. Receipts are
+	// used if there is no csv.
+	CSV         string              `json:"csv"`
+	Mapping     CSVMapping          `json:"mapping"`
+	Receipts    []BulkImportReceipt `json:"receipts"`
+	HouseholdID string              `json:"householdId"`
+	// DryRun validates the import and reports what would be created without
+	// creating anything
+	DryRun bool `json:"dryRun"`
+}
+
+// BulkImportReceipt : Structure that should be used for getting a receipt of a bulk import. Location and items are matched by name in the household and created if they don't exist. Items are matched by barcode first if lines have one.
+type BulkImportReceipt struct {
+	// Row is the csv row of the receipt or its position in json
+	Row      int    `json:"-"`
+	Location string `json:"location"`
+	// Address is only used for new locations
+	Address string `json:"address"`
+	// PurchasedAt is the time of purchase in RFC 3339 format or a local time
+	// in the time zone of the receipt. TimeZone and Currency are the defaults
+	// of the user if they are not specified.
+	PurchasedAt string           `json:"purchasedAt"`
+	TimeZone    string           `json:"timeZone"`
+	Currency    string           `json:"currency"`
+	Notes       string           `json:"notes"`
+	FiscalID    string           `json:"fiscalId"`
+	Lines       []BulkImportLine `json:"lines"`
+}
+
+// BulkImportLine : Structure that should be used for getting a line of a receipt of a bulk import. Price is the unit price on the receipt, price of the item is used if it's not specified. Unit is only used for new items and it has to be in the unit registry.
+type BulkImportLine struct {
+	// Row is the csv row of the line, lines from json don't have rows
+	Row      int     `json:"-"`
+	Item     string  `json:"item"`
+	Price    *Money  `json:"price"`
+	Unit     string  `json:"unit"`
+	Amount   float64 `json:"amount"`
+	TaxLabel string  `json:"taxLabel"`
+	// Barcode matches the item before its name. Barcodes that no item has
+	// are added to the item of the line.
+	Barcode string `json:"barcode"`
+}
+
+// BulkImportError : Structure that should be used for reporting an invalid row of a bulk import. Row is the csv row or the position of the receipt in json and Line is the position of the line in a receipt from json.
+type BulkImportError struct {
+	Row     int    `json:"row"`
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// BulkImportErrors is a list of invalid rows of a bulk import
+type BulkImportErrors []BulkImportError
+
+func (e BulkImportErrors) Error() string {
+	return fmt.Sprintf("import has %d invalid rows", len(e))
+}
+
+// BulkImportReport : Structure that should be used for sending what was created by a bulk import or would be created by a dry run. Ids are empty in dry runs.
+type BulkImportReport struct {
+	DryRun       bool                   `json:"dryRun"`
+	Receipts     []BulkImportedReceipt  `json:"receipts"`
+	NewLocations []BulkImportedLocation `json:"newLocations"`
+	NewItems     []BulkImportedItem     `json:"newItems"`
+	NewBarcodes  []BulkImportedBarcode  `json:"newBarcodes"`
+}
+
+// ReceiptIDs gets ids of imported receipts
+func (r *BulkImportReport) ReceiptIDs() []string {
+	ids := make([]string, 0, len(r.Receipts))
+	for _, receipt := range r.Receipts {
+		ids = append(ids, receipt.ID)
+	}
+	return ids
+}
+
+// BulkImportedReceipt : Structure that should be used for reporting a receipt of a bulk import
+type BulkImportedReceipt struct {
+	Row         int       `json:"row"`
+	ID          string    `json:"id,omitempty"`
+	Location    string    `json:"location"`
+	PurchasedAt time.Time `json:"purchasedAt"`
+	Currency    string    `json:"currency"`
+	Lines       int       `json:"lines"`
+	Total       Money     `json:"total"`
+}
+
+// BulkImportedLocation : Structure that should be used for reporting a location created by a bulk import
+type BulkImportedLocation struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// BulkImportedItem : Structure that should be used for reporting an item created by a bulk import
+type BulkImportedItem struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Price Money  `json:"price"`
+	Unit  string `json:"unit"`
+}
+
+// BulkImportedBarcode : Structure that should be used for reporting a barcode added to an item by a bulk import
+type BulkImportedBarcode struct {
+	Code string `json:"code"`
+	Item string `json:"item"`
+}
+
+// importRecord is a location or an item that exists in the household
+type importRecord struct {
+	ID        int        `db:"id"`
+	Name      string     `db:"name"`
+	Price     Money      `db:"price"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// importLine is a validated line of a bulk import
+type importLine struct {
+	item     string
+	price    *Money
+	amount   float64
+	taxLabel *string
+	taxRate  *Percentage
+}
+
+// importReceipt is a validated receipt of a bulk import
+type importReceipt struct {
+	location    string
+	purchasedAt time.Time
+	timeZone    string
+	currency    string
+	notes       string
+	fiscalID    string
+	lines       []importLine
+}
+
+// bulkImport is a bulk import that is validated before anything is created
+type bulkImport struct {
+	db          *sqlx.DB
+	userID      int
+	householdID int
+	timeZone    string
+	currency    string
+	locations   map[string]importRecord
+	items       map[string]importRecord
+	fiscalIDs   map[string]bool
+	// barcodes are names of items by their barcodes, including barcodes that
+	// the import adds
+	barcodes map[string]string
+	taxRates map[string]Percentage
+	errors   BulkImportErrors
+	report   BulkImportReport
+	receipts []importReceipt
+	// newLocations and newItems are positions of new records in the report
+	newLocations map[string]int
+	newItems     map[string]int
+}
+
+// BulkImport imports receipts to the household of the user. Locations and
+// items are matched by name and created if they don't exist. Everything is
+// validated first and BulkImportErrors with all invalid rows are returned if
+// anything is invalid. Receipts are created in one transaction unless it's a
+// dry run.
+func BulkImport(db *sqlx.DB, userID int, householdPublicID string, receipts []BulkImportReceipt, dryRun bool) (*BulkImportReport, error) {
+	if len(receipts) == 0 {
+		return nil, ErrNoImportReceipts
+	}
+
+	household, err := WritableHouseholdID(db, userID, householdPublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bulkImport{
+		db:           db,
+		userID:       userID,
+		householdID:  household.ID,
+		locations:    map[string]importRecord{},
+		items:        map[string]importRecord{},
+		fiscalIDs:    map[string]bool{},
+		barcodes:     map[string]string{},
+		taxRates:     map[string]Percentage{},
+		errors:       BulkImportErrors{},
+		newLocations: map[string]int{},
+		newItems:     map[string]int{},
+		report: BulkImportReport{
+			DryRun:       dryRun,
+			Receipts:     []BulkImportedReceipt{},
+			NewLocations: []BulkImportedLocation{},
+			NewItems:     []BulkImportedItem{},
+			NewBarcodes:  []BulkImportedBarcode{},
+		},
+	}
+
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	for i, receipt := range receipts {
+		if receipt.Row == 0 {
+			receipt.Row = i + 1
+		}
+		if err := b.add(receipt); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b.errors) != 0 {
+		return nil, b.errors
+	}
+
+	if !dryRun {
+		if err := b.create(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &b.report, nil
+}
+
+// load loads defaults of the user and records of the household that receipts
+// are matched with. Records in the trash are loaded too since they still hold
+// their names.
+func (b *bulkImport) load() error {
+	if err := b.db.QueryRow("SELECT time_zone, currency FROM users WHERE id = ?", b.userID).Scan(&b.timeZone, &b.currency); err != nil {
+		return err
+	}
+
+	locations := []importRecord{}
+	if err := b.db.Select(&locations, "SELECT id, name, deleted_at FROM locations WHERE household_id = ?", b.householdID); err != nil {
+		return err
+	}
+	for _, location := range locations {
+		b.locations[location.Name] = location
+	}
+
+	items := []importRecord{}
+	if err := b.db.Select(&items, "SELECT id, name, price, deleted_at FROM items WHERE household_id = ?", b.householdID); err != nil {
+		return err
+	}
+	for _, item := range items {
+		b.items[item.Name] = item
+	}
+
+	barcodes := []struct {
+		Code string `db:"code"`
+		Item string `db:"name"`
+	}{}
+	if err := b.db.Select(&barcodes, "SELECT item_barcodes.code, items.name FROM item_barcodes JOIN items ON items.id = item_barcodes.item_id WHERE item_barcodes.household_id = ?", b.householdID); err != nil {
+		return err
+	}
+	for _, barcode := range barcodes {
+		b.barcodes[barcode.Code] = barcode.Item
+	}
+
+	fiscalIDs := []string{}
+	if err := b.db.Select(&fiscalIDs, "SELECT fiscal_id FROM receipts WHERE household_id = ? AND fiscal_id IS NOT NULL", b.householdID); err != nil {
+		return err
+	}
+	for _, fiscalID := range fiscalIDs {
+		b.fiscalIDs[fiscalID] = true
+	}
+
+	return nil
+}
+
+// fail adds an invalid row
+func (b *bulkImport) fail(row int, line int, field string, message string) {
+	b.errors = append(b.errors, BulkImportError{
+		Row:     row,
+		Line:    line,
+		Field:   field,
+		Message: message,
+	})
+}
+
+// add validates a receipt and adds it to the report. Errors are only returned
+// if the database can't be read, invalid rows are added to errors.
+func (b *bulkImport) add(data BulkImportReceipt) error {
+	failed := len(b.errors)
+	receipt := importReceipt{
+		location: strings.TrimSpace(data.Location),
+		timeZone: data.TimeZone,
+		currency: normalizeCurrency(data.Currency),
+		notes:    data.Notes,
+		fiscalID: strings.TrimSpace(data.FiscalID),
+	}
+
+	if receipt.location == "" {
+		b.fail(data.Row, 0, "location", "location is required")
+	} else if location, ok := b.locations[receipt.location]; ok && location.DeletedAt != nil {
+		b.fail(data.Row, 0, "location", "location with the same name is in the trash")
+	} else if !ok {
+		if _, ok := b.newLocations[receipt.location]; !ok {
+			if strings.TrimSpace(data.Address) == "" {
+				b.fail(data.Row, 0, "address", "address is required for new locations")
+			} else {
+				b.newLocations[receipt.location] = len(b.report.NewLocations)
+				b.report.NewLocations = append(b.report.NewLocations, BulkImportedLocation{
+					Name:    receipt.location,
+					Address: strings.TrimSpace(data.Address),
+				})
+			}
+		}
+	}
+
+	if receipt.timeZone == "" {
+		receipt.timeZone = b.timeZone
+	}
+	zone, err := loadTimeZone(receipt.timeZone)
+	if err != nil {
+		b.fail(data.Row, 0, "timeZone", err.Error())
+	} else if data.PurchasedAt == "" {
+		b.fail(data.Row, 0, "purchasedAt", "purchase time is required")
+	} else if receipt.purchasedAt, err = parsePurchaseTime(data.PurchasedAt, zone); err != nil {
+		b.fail(data.Row, 0, "purchasedAt", err.Error())
+	}
+
+	if receipt.currency == "" {
+		receipt.currency = b.currency
+	}
+	if !isCurrencyCode(receipt.currency) {
+		b.fail(data.Row, 0, "currency", "currency must be a three letter code of a currency with two decimal places")
+	}
+
+	if receipt.fiscalID != "" {
+		if b.fiscalIDs[receipt.fiscalID] {
+			b.fail(data.Row, 0, "fiscalId", "receipt with the same fiscal id already exists")
+		}
+		b.fiscalIDs[receipt.fiscalID] = true
+	}
+
+	if len(data.Lines) == 0 {
+		b.fail(data.Row, 0, "lines", "receipt has no lines")
+	}
+
+	var total Money
+	for i, lineData := range data.Lines {
+		// Lines from csv have their own rows
+		row, position := lineData.Row, 0
+		if row == 0 {
+			row, position = data.Row, i+1
+		}
+
+		line, price, err := b.addLine(row, position, lineData)
+		if err != nil {
+			return err
+		}
+		receipt.lines = append(receipt.lines, line)
+		total += price.Multiply(line.amount)
+	}
+
+	if len(b.errors) != failed {
+		return nil
+	}
+
+	b.receipts = append(b.receipts, receipt)
+	b.report.Receipts = append(b.report.Receipts, BulkImportedReceipt{
+		Row:         data.Row,
+		Location:    receipt.location,
+		PurchasedAt: receipt.purchasedAt.In(zone),
+		Currency:    receipt.currency,
+		Lines:       len(receipt.lines),
+		Total:       total,
+	})
+
+	return nil
+}
+
+// addLine validates a line of a receipt. It returns the line and its unit
+// price.
+func (b *bulkImport) addLine(row int, position int, data BulkImportLine) (importLine, Money, error) {
+	line := importLine{
+		item:   strings.TrimSpace(data.Item),
+		price:  data.Price,
+		amount: data.Amount,
+	}
+
+	if line.amount <= 0 {
+		b.fail(row, position, "amount", "amount must be greater than 0")
+	}
+	if line.price != nil && *line.price < 0 {
+		b.fail(row, position, "price", "price can't be negative")
+	}
+
+	if data.TaxLabel != "" {
+		rate, ok := b.taxRates[data.TaxLabel]
+		if !ok {
+			var err error
+			rate, err = resolveTaxRate(b.db, b.householdID, data.TaxLabel)
+			switch {
+			case err == ErrUnknownTaxLabel:
+				b.fail(row, position, "taxLabel", err.Error())
+			case err != nil:
+				return line, 0, err
+			default:
+				b.taxRates[data.TaxLabel] = rate
+			}
+		}
+		line.taxLabel, line.taxRate = &data.TaxLabel, &rate
+	}
+
+	var price Money
+	if line.price != nil {
+		price = *line.price
+	}
+
+	if data.Barcode != "" {
+		code, err := database.NormalizeBarcode(data.Barcode)
+		if err != nil {
+			b.fail(row, position, "barcode", err.Error())
+		} else if item, ok := b.barcodes[code]; ok {
+			line.item = item
+		} else if line.item != "" {
+			b.barcodes[code] = line.item
+			b.report.NewBarcodes = append(b.report.NewBarcodes, BulkImportedBarcode{
+				Code: code,
+				Item: line.item,
+			})
+		}
+	}
+
+	if line.item == "" {
+		b.fail(row, position, "item", "item is required")
+		return line, price, nil
+	}
+
+	if item, ok := b.items[line.item]; ok {
+		if item.DeletedAt != nil {
+			b.fail(row, position, "item", "item with the same name is in the trash")
+		} else if line.price == nil {
+			price = item.Price
+		}
+		return line, price, nil
+	}
+
+	if i, ok := b.newItems[line.item]; ok {
+		if line.price == nil {
+			price = b.report.NewItems[i].Price
+		}
+		return line, price, nil
+	}
+
+	// New items get the price and the unit of their first line
+	if line.price == nil {
+		b.fail(row, position, "price", "price is required for new items")
+		return line, price, nil
+	}
+
+	unit := defaultItemUnit
+	if strings.TrimSpace(data.Unit) != "" {
+		registered, ok := LookupUnit(data.Unit)
+		if !ok {
+			b.fail(row, position, "unit", ErrUnknownUnit.Error())
+			return line, price, nil
+		}
+		unit = registered.Name
+	}
+
+	b.newItems[line.item] = len(b.report.NewItems)
+	b.report.NewItems = append(b.report.NewItems, BulkImportedItem{
+		Name:  line.item,
+		Price: price,
+		Unit:  unit,
+	})
+
+	return line, price, nil
+}
+
+// create creates new locations, new items and receipts in one transaction and
+// adds their ids to the report
+func (b *bulkImport) create() error {
+	tx, err := b.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := b.insert(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insert inserts records of the import in the transaction
+func (b *bulkImport) insert(tx *sqlx.Tx) error {
+	for i, location := range b.report.NewLocations {
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("INSERT INTO locations (public_id, name, address, created_by, household_id) VALUES (?, ?, ?, ?, ?)", uuid, location.Name, location.Address, b.userID, b.householdID)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		b.locations[location.Name] = importRecord{ID: int(id), Name: location.Name}
+		b.report.NewLocations[i].ID = uuid
+	}
+
+	for i, item := range b.report.NewItems {
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("INSERT INTO items (public_id, created_by, household_id, name, price, unit) VALUES (?, ?, ?, ?, ?, ?)", uuid, b.userID, b.householdID, item.Name, item.Price, item.Unit)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		b.items[item.Name] = importRecord{ID: int(id), Name: item.Name, Price: item.Price}
+		b.report.NewItems[i].ID = uuid
+	}
+
+	for _, barcode := range b.report.NewBarcodes {
+		if _, err := tx.Exec("INSERT INTO item_barcodes (item_id, household_id, code) VALUES (?, ?, ?)", b.items[barcode.Item].ID, b.householdID, barcode.Code); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for i, receipt := range b.receipts {
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("INSERT INTO receipts (public_id, location_id, household_id, created_by, currency, purchased_at, time_zone, notes, fiscal_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, b.locations[receipt.location].ID, b.householdID, b.userID, receipt.currency, receipt.purchasedAt.UTC(), receipt.timeZone, nullableText(receipt.notes), nullableText(receipt.fiscalID), now, now)
+		if err != nil {
+			return err
+		}
+
+		receiptID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, line := range receipt.lines {
+			lineUUID, err := nanoid.Nanoid()
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("INSERT INTO items_in_receipt (public_id, receipt_id, item_id, price, amount, tax_label, tax_rate) VALUES (?, ?, ?, ?, ?, ?, ?)", lineUUID, receiptID, b.items[line.item].ID, line.price, line.amount, line.taxLabel, line.taxRate); err != nil {
+				return err
+			}
+		}
+
+		b.report.Receipts[i].ID = uuid
+	}
+
+	return nil
+}
+
+// PostBulkImport is a Gin handler function for importing receipts from csv or
+// json. Invalid rows are reported and nothing is imported if there are any.
+func (o Options) PostBulkImport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var importData BulkImportPostBody
+		if err := ctx.ShouldBindJSON(&importData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var report *BulkImportReport
+		if importData.CSV != "" {
+			report, err = ImportReceiptsCSV(o.DB, user.ID, importData.HouseholdID, strings.NewReader(importData.CSV), importData.Mapping, importData.DryRun)
+		} else {
+			report, err = BulkImport(o.DB, user.ID, importData.HouseholdID, importData.Receipts, importData.DryRun)
+		}
+		if err != nil {
+			ctx.JSON(bulkImportErrorStatus(err), bulkImportErrorBody(err))
+			return
+		}
+
+		if !report.DryRun {
+			o.checkBudgets(report.ReceiptIDs()...)
+		}
+
+		ctx.JSON(http.StatusOK, report)
+	}
+}
+
+// bulkImportErrorStatus gets the HTTP status code for errors of bulk imports
+func bulkImportErrorStatus(err error) int {
+	if _, ok := err.(BulkImportErrors); ok {
+		return http.StatusBadRequest
+	}
+
+	switch {
+	case err == ErrNoImportReceipts:
+		return http.StatusBadRequest
+	case err == sql.ErrNoRows:
+		return http.StatusUnauthorized
+	case isUniqueConstraintError(err):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// bulkImportErrorBody gets the response body for errors of bulk imports
+func bulkImportErrorBody(err error) gin.H {
+	if errs, ok := err.(BulkImportErrors); ok {
+		return gin.H{
+			"message": errs.Error(),
+			"errors":  errs,
+		}
+	}
+
+	if err == sql.ErrNoRows {
+		return gin.H{
+			"message": "not authorized to add receipts to specified household",
+		}
+	}
+	return gin.H{
+		"message": err.Error(),
+	}
+}
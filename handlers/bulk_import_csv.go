@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CSVMapping : Structure that should be used for getting the mapping of columns of a csv file to fields of imported receipts
+type CSVMapping struct {
+	// Columns are headers of columns with fields. Headers that are not
+	// specified are the same as names of fields, e.g. purchasedAt.
+	Columns CSVColumns `json:"columns"`
+	// Delimiter is the delimiter of values, comma is used if it's not
+	// specified
+	Delimiter string `json:"delimiter"`
+	// DecimalComma is set for numbers like 1.234,56
+	DecimalComma bool `json:"decimalComma"`
+	// TimeLayout is the layout of purchase times as a Go time layout, e.g.
+	// 02.01.2006 15:04. Times are in the time zone of the receipt. Times in
+	// RFC 3339 or YYYY-MM-DDThh:mm:ss format are expected if it's not
+	// specified.
+	TimeLayout string `json:"timeLayout"`
+}
+
+// CSVColumns : Structure that should be used for getting headers of columns of a csv file. Each row is a line of a receipt. Rows with the same value in the receipt column are lines of the same receipt. Consecutive rows with the same location, purchase time and fiscal id are lines of the same receipt if there is no receipt column.
+type CSVColumns struct {
+	Receipt     string `json:"receipt"`
+	Location    string `json:"location"`
+	Address     string `json:"address"`
+	PurchasedAt string `json:"purchasedAt"`
+	TimeZone    string `json:"timeZone"`
+	Currency    string `json:"currency"`
+	Notes       string `json:"notes"`
+	FiscalID    string `json:"fiscalId"`
+	Item        string `json:"item"`
+	Price       string `json:"price"`
+	Unit        string `json:"unit"`
+	Amount      string `json:"amount"`
+	TaxLabel    string `json:"taxLabel"`
+	Barcode     string `json:"barcode"`
+}
+
+// csvRow is a row of a csv file with values by field. Number is the number of
+// the row like in spreadsheets, it can differ from the line in the file if
+// values have new lines.
+type csvRow struct {
+	number int
+	values map[string]string
+}
+
+// value gets the value of the field in the row
+func (r csvRow) value(field string) string {
+	return strings.TrimSpace(r.values[field])
+}
+
+// fields gets headers of columns by field. Headers default to names of fields.
+func (c CSVColumns) fields() map[string]string {
+	columns := map[string]string{
+		"receipt":     c.Receipt,
+		"location":    c.Location,
+		"address":     c.Address,
+		"purchasedAt": c.PurchasedAt,
+		"timeZone":    c.TimeZone,
+		"currency":    c.Currency,
+		"notes":       c.Notes,
+		"fiscalId":    c.FiscalID,
+		"item":        c.Item,
+		"price":       c.Price,
+		"unit":        c.Unit,
+		"amount":      c.Amount,
+		"taxLabel":    c.TaxLabel,
+		"barcode":     c.Barcode,
+	}
+
+	for field, header := range columns {
+		if header == "" {
+			columns[field] = field
+		}
+	}
+
+	return columns
+}
+
+// receiptFields are fields of a receipt that have to be the same in all rows
+// of the receipt
+var receiptFields = []string{"location", "address", "purchasedAt", "timeZone", "currency", "notes", "fiscalId"}
+
+// requiredCSVFields are fields that must have a column in the csv file
+var requiredCSVFields = []string{"location", "purchasedAt", "item"}
+
+// ParseReceiptsCSV parses receipts from a csv file with a header row. All rows
+// are parsed and BulkImportErrors with all invalid rows is returned if any row
+// is invalid. Receipts are returned with invalid values left out unless the
+// file can't be read, so they can still be validated.
+func ParseReceiptsCSV(r io.Reader, mapping CSVMapping) ([]BulkImportReceipt, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		delimiter, size := utf8.DecodeRuneInString(mapping.Delimiter)
+		if size != len(mapping.Delimiter) {
+			return nil, BulkImportErrors{{Field: "delimiter", Message: "delimiter must be a single character"}}
+		}
+		reader.Comma = delimiter
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, csvError(err)
+	}
+	// Spreadsheet programs often start files with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	positions := map[string]int{}
+	for i, name := range header {
+		positions[strings.TrimSpace(name)] = i
+	}
+
+	columns := map[string]int{}
+	errs := BulkImportErrors{}
+	for field, name := range mapping.Columns.fields() {
+		if i, ok := positions[name]; ok {
+			columns[field] = i
+		}
+	}
+	for _, field := range requiredCSVFields {
+		if _, ok := columns[field]; !ok {
+			errs = append(errs, BulkImportError{Row: 1, Field: field, Message: "column " + mapping.Columns.fields()[field] + " is missing"})
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	// Rows are numbered like in spreadsheets, the header is the first row
+	rows := []csvRow{}
+	for number := 2; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok && parseErr.Err == csv.ErrFieldCount {
+				errs = append(errs, BulkImportError{Row: number, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, append(errs, csvError(err)...)
+		}
+
+		row := csvRow{number: number, values: map[string]string{}}
+		for field, i := range columns {
+			row.values[field] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	receipts := groupCSVRows(rows, mapping, &errs)
+	if len(errs) != 0 {
+		return receipts, errs
+	}
+
+	return receipts, nil
+}
+
+// ImportReceiptsCSV imports receipts from a csv file like BulkImport. Rows that
+// can't be parsed are reported together with rows that are invalid.
+func ImportReceiptsCSV(db *sqlx.DB, userID int, householdPublicID string, r io.Reader, mapping CSVMapping, dryRun bool) (*BulkImportReport, error) {
+	receipts, err := ParseReceiptsCSV(r, mapping)
+	parseErrs, ok := err.(BulkImportErrors)
+	if err != nil && (!ok || receipts == nil) {
+		return nil, err
+	}
+
+	// Nothing is created if some rows can't be parsed
+	report, err := BulkImport(db, userID, householdPublicID, receipts, dryRun || len(parseErrs) != 0)
+	if len(parseErrs) == 0 {
+		return report, err
+	}
+
+	errs, ok := err.(BulkImportErrors)
+	if err != nil && !ok {
+		return nil, err
+	}
+
+	// Values that can't be parsed are left out so they are not reported again
+	reported := map[BulkImportError]bool{}
+	for _, e := range parseErrs {
+		reported[BulkImportError{Row: e.Row, Line: e.Line, Field: e.Field}] = true
+	}
+	for _, e := range errs {
+		if !reported[BulkImportError{Row: e.Row, Line: e.Line, Field: e.Field}] {
+			parseErrs = append(parseErrs, e)
+		}
+	}
+
+	sort.SliceStable(parseErrs, func(i, j int) bool {
+		if parseErrs[i].Row != parseErrs[j].Row {
+			return parseErrs[i].Row < parseErrs[j].Row
+		}
+		return parseErrs[i].Line < parseErrs[j].Line
+	})
+
+	return nil, parseErrs
+}
+
+// groupCSVRows groups rows into receipts and parses their lines. Invalid rows
+// are added to errors.
+func groupCSVRows(rows []csvRow, mapping CSVMapping, errs *BulkImportErrors) []BulkImportReceipt {
+	receipts := []BulkImportReceipt{}
+	first := []csvRow{}
+	keys := map[string]int{}
+
+	for i, row := range rows {
+		// Rows are grouped by the receipt column or by consecutive rows with
+		// the same receipt
+		key, grouped := row.value("receipt"), row.value("receipt") != ""
+		position, ok := keys[key]
+		if !grouped {
+			ok = i > 0 && len(receipts) > 0 && sameCSVReceipt(first[len(first)-1], row)
+			position = len(receipts) - 1
+		}
+
+		if !ok {
+			receipt, err := csvReceipt(row, mapping)
+			if err != nil {
+				*errs = append(*errs, *err)
+			}
+			position = len(receipts)
+			if grouped {
+				keys[key] = position
+			}
+			receipts = append(receipts, receipt)
+			first = append(first, row)
+		} else {
+			for _, field := range receiptFields {
+				if value := row.value(field); value != "" && value != first[position].value(field) {
+					*errs = append(*errs, BulkImportError{Row: row.number, Field: field, Message: "value is different from row " + strconv.Itoa(first[position].number) + " of the same receipt"})
+				}
+			}
+		}
+
+		line, lineErrs := csvLine(row, mapping)
+		*errs = append(*errs, lineErrs...)
+		receipts[position].Lines = append(receipts[position].Lines, line)
+	}
+
+	return receipts
+}
+
+// sameCSVReceipt checks if rows are lines of the same receipt when there is no
+// receipt column
+func sameCSVReceipt(first csvRow, row csvRow) bool {
+	return row.value("location") == first.value("location") && row.value("purchasedAt") == first.value("purchasedAt") && row.value("fiscalId") == first.value("fiscalId")
+}
+
+// csvReceipt parses a receipt from its first row
+func csvReceipt(row csvRow, mapping CSVMapping) (BulkImportReceipt, *BulkImportError) {
+	receipt := BulkImportReceipt{
+		Row:         row.number,
+		Location:    row.value("location"),
+		Address:     row.value("address"),
+		PurchasedAt: row.value("purchasedAt"),
+		TimeZone:    row.value("timeZone"),
+		Currency:    row.value("currency"),
+		Notes:       row.value("notes"),
+		FiscalID:    row.value("fiscalId"),
+	}
+
+	if mapping.TimeLayout != "" && receipt.PurchasedAt != "" {
+		purchasedAt, err := time.Parse(mapping.TimeLayout, receipt.PurchasedAt)
+		if err != nil {
+			return receipt, &BulkImportError{Row: row.number, Field: "purchasedAt", Message: "purchase time doesn't match layout " + mapping.TimeLayout}
+		}
+		receipt.PurchasedAt = purchasedAt.Format(localTimeLayout)
+	}
+
+	return receipt, nil
+}
+
+// csvLine parses a line of a receipt from a row. Amount is 1 if it's empty.
+func csvLine(row csvRow, mapping CSVMapping) (BulkImportLine, BulkImportErrors) {
+	errs := BulkImportErrors{}
+	line := BulkImportLine{
+		Row:      row.number,
+		Item:     row.value("item"),
+		Unit:     row.value("unit"),
+		Amount:   1,
+		TaxLabel: row.value("taxLabel"),
+		Barcode:  row.value("barcode"),
+	}
+
+	if value := row.value("price"); value != "" {
+		price, err := ParseMoney(csvNumber(value, mapping.DecimalComma))
+		if err != nil {
+			errs = append(errs, BulkImportError{Row: row.number, Field: "price", Message: err.Error()})
+		} else {
+			line.Price = &price
+		}
+	}
+
+	if value := row.value("amount"); value != "" {
+		amount, err := strconv.ParseFloat(csvNumber(value, mapping.DecimalComma), 64)
+		if err != nil {
+			errs = append(errs, BulkImportError{Row: row.number, Field: "amount", Message: "amount must be a number"})
+		} else {
+			line.Amount = amount
+		}
+	}
+
+	return line, errs
+}
+
+// csvNumber converts a number from a csv file to a number with a decimal point
+// and without thousands separators
+func csvNumber(value string, decimalComma bool) string {
+	value = strings.Replace(value, " ", "", -1)
+	if decimalComma {
+		return strings.Replace(strings.Replace(value, ".", "", -1), ",", ".", 1)
+	}
+	return strings.Replace(value, ",", "", -1)
+}
+
+// csvError converts an error of reading a csv file to an invalid row
+func csvError(err error) BulkImportErrors {
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		return BulkImportErrors{{Row: parseErr.Line, Message: parseErr.Err.Error()}}
+	}
+	if err == io.EOF {
+		return BulkImportErrors{{Row: 1, Message: "file is empty"}}
+	}
+	return BulkImportErrors{{Message: err.Error()}}
+}
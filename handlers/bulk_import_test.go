@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// importTables are tables that bulk imports create records in
+var importTables = []string{"locations", "items", "receipts", "items_in_receipt"}
+
+// countImportRows counts rows of tables that bulk imports create records in
+func countImportRows(t *testing.T, db *sqlx.DB) map[string]int {
+	counts := map[string]int{}
+	for _, table := range importTables {
+		var count int
+		if err := db.Get(&count, "SELECT COUNT(*) FROM "+table); err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = count
+	}
+	return counts
+}
+
+// importErrors gets invalid rows of a bulk import
+func importErrors(t *testing.T, err error) BulkImportErrors {
+	errs, ok := err.(BulkImportErrors)
+	if !ok {
+		t.Fatalf("got error %v, want invalid rows", err)
+	}
+	return errs
+}
+
+func TestParseReceiptsCSVMapping(t *testing.T) {
+	text := "\ufeffProdavnica;Vreme;Artikal;Cena;Količina\n" +
+		"Maxi;14.03.2023 17:42;Mleko;1.299,99;2\n" +
+		"Maxi;14.03.2023 17:42;Hleb;64,99;\n" +
+		"Idea;15.03.2023 08:05;Kafa;\"1 099,99\";0,5\n"
+	mapping := CSVMapping{
+		Columns:      CSVColumns{Location: "Prodavnica", PurchasedAt: "Vreme", Item: "Artikal", Price: "Cena", Amount: "Količina"},
+		Delimiter:    ";",
+		DecimalComma: true,
+		TimeLayout:   "02.01.2006 15:04",
+	}
+
+	receipts, err := ParseReceiptsCSV(strings.NewReader(text), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price := func(amount Money) *Money {
+		return &amount
+	}
+	want := []BulkImportReceipt{
+		{Row: 2, Location: "Maxi", PurchasedAt: "2023-03-14T17:42:00", Lines: []BulkImportLine{
+			{Row: 2, Item: "Mleko", Price: price(129999), Amount: 2},
+			{Row: 3, Item: "Hleb", Price: price(6499), Amount: 1},
+		}},
+		{Row: 4, Location: "Idea", PurchasedAt: "2023-03-15T08:05:00", Lines: []BulkImportLine{
+			{Row: 4, Item: "Kafa", Price: price(109999), Amount: 0.5},
+		}},
+	}
+	if !reflect.DeepEqual(receipts, want) {
+		t.Errorf("got %+v, want %+v", receipts, want)
+	}
+
+	if _, err := ParseReceiptsCSV(strings.NewReader(text), CSVMapping{Delimiter: ";;"}); !reflect.DeepEqual(err, BulkImportErrors{{Field: "delimiter", Message: "delimiter must be a single character"}}) {
+		t.Errorf("got error %v for a delimiter of two characters", err)
+	}
+}
+
+func TestImportReceiptsCSVInvalidRows(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	before := countImportRows(t, db)
+
+	text := "receipt,location,address,purchasedAt,item,price,amount\n" +
+		"1,Maxi,,2023-03-14T17:42:00,Mleko,129.99,2\n" +
+		"1,Maxi,,2023-03-14T17:42:00,Hleb,abc,1\n" +
+		"2,Lidl,,2023-03-15T08:05:00,Kafa,1099.99,1\n" +
+		"3,Maxi,,14.03.2023,Mleko,129.99,x\n" +
+		"4,Maxi,,2023-03-16T10:00:00,,10.00,1\n" +
+		"1,Idea,,2023-03-14T17:42:00,Jaja,20.00,1\n"
+
+	_, priceErr := ParseMoney("abc")
+	_, err := ImportReceiptsCSV(db, household.UserID, "", strings.NewReader(text), CSVMapping{}, false)
+	got := importErrors(t, err)
+	want := BulkImportErrors{
+		{Row: 3, Field: "price", Message: priceErr.Error()},
+		{Row: 4, Field: "address", Message: "address is required for new locations"},
+		{Row: 5, Field: "amount", Message: "amount must be a number"},
+		{Row: 5, Field: "purchasedAt", Message: ErrInvalidPurchaseTime.Error()},
+		{Row: 6, Field: "item", Message: "item is required"},
+		{Row: 7, Field: "location", Message: "value is different from row 2 of the same receipt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%+v\nwant\n%+v", got, want)
+	}
+
+	if after := countImportRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("import with invalid rows changed the database from %v to %v", before, after)
+	}
+}
+
+func TestBulkImportDryRun(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	before := countImportRows(t, db)
+
+	price := Money(109999)
+	receipts := []BulkImportReceipt{
+		{Location: "Maxi", PurchasedAt: "2023-03-14T17:42:00", Lines: []BulkImportLine{
+			{Item: "Mleko", Amount: 2},
+			{Item: "Kafa", Price: &price, Amount: 1},
+		}},
+		{Location: "Idea", Address: "Bulevar 2", PurchasedAt: "2023-03-15T08:05:00+01:00", TimeZone: "UTC", Currency: "eur", Lines: []BulkImportLine{
+			{Item: "Kafa", Amount: 0.5},
+		}},
+	}
+
+	report, err := BulkImport(db, household.UserID, "", receipts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BulkImportReport{
+		DryRun: true,
+		Receipts: []BulkImportedReceipt{
+			{Row: 1, Location: "Maxi", PurchasedAt: time.Date(2023, 3, 14, 17, 42, 0, 0, belgrade), Currency: "RSD", Lines: 2, Total: 135997},
+			{Row: 2, Location: "Idea", PurchasedAt: time.Date(2023, 3, 15, 7, 5, 0, 0, time.UTC), Currency: "EUR", Lines: 1, Total: 55000},
+		},
+		NewLocations: []BulkImportedLocation{{Name: "Idea", Address: "Bulevar 2"}},
+		NewItems:     []BulkImportedItem{{Name: "Kafa", Price: 109999, Unit: defaultItemUnit}},
+		NewBarcodes:  []BulkImportedBarcode{},
+	}
+	for i := range report.Receipts {
+		if !report.Receipts[i].PurchasedAt.Equal(want.Receipts[i].PurchasedAt) {
+			t.Errorf("receipt %d purchased at %v, want %v", i+1, report.Receipts[i].PurchasedAt, want.Receipts[i].PurchasedAt)
+		}
+		report.Receipts[i].PurchasedAt = want.Receipts[i].PurchasedAt
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("got report\n%+v\nwant\n%+v", report, want)
+	}
+
+	if after := countImportRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("dry run changed the database from %v to %v", before, after)
+	}
+
+	// The import creates what the dry run reported
+	report, err = BulkImport(db, household.UserID, "", receipts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := countImportRows(t, db)
+	created := map[string]int{"locations": 1, "items": 1, "receipts": 2, "items_in_receipt": 3}
+	for table, count := range created {
+		if after[table]-before[table] != count {
+			t.Errorf("import created %d rows in %s, want %d", after[table]-before[table], table, count)
+		}
+	}
+	if report.Receipts[0].ID == "" || report.NewLocations[0].ID == "" || report.NewItems[0].ID == "" {
+		t.Errorf("import didn't report ids of created records: %+v", report)
+	}
+}
+
+func TestBulkImportRollback(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	before := countImportRows(t, db)
+
+	// Receipts are inserted after new locations and items so the last
+	// receipt fails after everything else was inserted
+	db.MustExec("CREATE TRIGGER fail_last_receipt BEFORE INSERT ON receipts WHEN NEW.fiscal_id = 'LAST' BEGIN SELECT RAISE(ABORT, 'last receipt failed'); END")
+
+	price := Money(12999)
+	receipts := []BulkImportReceipt{
+		{Location: "Idea", Address: "Bulevar 2", PurchasedAt: "2023-03-14T17:42:00", Lines: []BulkImportLine{
+			{Item: "Mleko", Price: &price, Amount: 1},
+		}},
+		{Location: "Maxi", PurchasedAt: "2023-03-15T08:05:00", FiscalID: "LAST", Lines: []BulkImportLine{
+			{Item: "Mleko", Amount: 1},
+		}},
+	}
+
+	if _, err := BulkImport(db, household.UserID, "", receipts, false); err == nil || !strings.Contains(err.Error(), "last receipt failed") {
+		t.Fatalf("got error %v, want the error of the last receipt", err)
+	}
+
+	if after := countImportRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("failed import changed the database from %v to %v", before, after)
+	}
+}
+
+func TestBulkImportBarcodes(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	milk := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO item_barcodes (item_id, household_id, code) VALUES (?, ?, '4006381333931')", milk, household.HouseholdID)
+
+	price := Money(109999)
+	receipts := []BulkImportReceipt{
+		{Location: "Maxi", PurchasedAt: "2023-03-14T17:42:00", Lines: []BulkImportLine{
+			// Barcodes match items before their names and UPC-A codes match
+			// their EAN-13 form
+			{Item: "Mleko 2.8%", Barcode: "4006381333931", Amount: 1},
+			{Item: "Kafa", Barcode: "036000291452", Price: &price, Amount: 1},
+			{Item: "Kafa", Barcode: "0036000291452", Amount: 1},
+			{Item: "Hleb", Barcode: "4006381333932", Price: &price, Amount: 1},
+		}},
+	}
+
+	_, err := BulkImport(db, household.UserID, "", receipts, false)
+	if got, want := importErrors(t, err), (BulkImportErrors{{Row: 1, Line: 4, Field: "barcode", Message: database.ErrInvalidBarcode.Error()}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %+v, want %+v", got, want)
+	}
+
+	receipts[0].Lines = receipts[0].Lines[:3]
+	report, err := BulkImport(db, household.UserID, "", receipts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []BulkImportedBarcode{{Code: "0036000291452", Item: "Kafa"}}; !reflect.DeepEqual(report.NewBarcodes, want) {
+		t.Errorf("got new barcodes %+v, want %+v", report.NewBarcodes, want)
+	}
+	if len(report.NewItems) != 1 || report.NewItems[0].Name != "Kafa" {
+		t.Errorf("got new items %+v, want Kafa", report.NewItems)
+	}
+
+	lines := []string{}
+	if err := db.Select(&lines, "SELECT items.name FROM items_in_receipt JOIN items ON items.id = items_in_receipt.item_id ORDER BY items_in_receipt.id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Mleko", "Kafa", "Kafa"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines of %v, want %v", lines, want)
+	}
+
+	var item string
+	if err := db.Get(&item, "SELECT items.name FROM item_barcodes JOIN items ON items.id = item_barcodes.item_id WHERE item_barcodes.code = '0036000291452'"); err != nil {
+		t.Fatal(err)
+	}
+	if item != "Kafa" {
+		t.Errorf("barcode was added to %s, want Kafa", item)
+	}
+}
+
+func TestBulkImportUnits(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	price := Money(14999)
+	receipts := []BulkImportReceipt{
+		{Location: "Maxi", PurchasedAt: "2023-03-14T17:42:00", Lines: []BulkImportLine{
+			{Item: "Banane", Price: &price, Unit: " Kg ", Amount: 1.25},
+			{Item: "Jabuke", Price: &price, Unit: "kilo", Amount: 1},
+		}},
+	}
+
+	_, err := BulkImport(db, household.UserID, "", receipts, true)
+	if got, want := importErrors(t, err), (BulkImportErrors{{Row: 1, Line: 2, Field: "unit", Message: ErrUnknownUnit.Error()}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %+v, want %+v", got, want)
+	}
+
+	receipts[0].Lines[1].Unit = ""
+	report, err := BulkImport(db, household.UserID, "", receipts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BulkImportedItem{{Name: "Banane", Price: price, Unit: "kg"}, {Name: "Jabuke", Price: price, Unit: defaultItemUnit}}
+	if !reflect.DeepEqual(report.NewItems, want) {
+		t.Errorf("got new items %+v, want %+v", report.NewItems, want)
+	}
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/dusansimic/receipts-archive-backend/database"
 	"github.com/go-playground/validator"
 	"github.com/jmoiron/sqlx"
 )
@@ -17,6 +17,15 @@ type StructID struct {
 // Options stores database and validator options for handlers
 type Options struct {
 	DB           *sqlx.DB
-	SessionStore *memcache.Client
+	SessionStore database.SessionStore
 	V            *validator.Validate
+	// AdminUsers are ids or emails of users that get the admin role when
+	// they log in
+	AdminUsers []string
+	// RateProvider gets exchange rates that aren't stored in the database. It
+	// can be nil.
+	RateProvider database.ExchangeRateProvider
+	// ProductLookup finds products by barcode when no item has it. It can be
+	// nil.
+	ProductLookup database.ProductLookup
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// nameDuplicate is a record that has the name of a record that is added or
+// renamed
+type nameDuplicate struct {
+	PublicID string `db:"public_id"`
+	// Trashed records still hold their names until they are purged
+	Trashed bool `db:"trashed"`
+}
+
+// duplicateName gets the record from the table that has the specified name
+// and is in the household matched by the household condition. Record with
+// the except public id is ignored so records can keep their names when
+// updated. Records in the trash are matched too since they still hold their
+// names and can be restored. If there is no such record, nil is returned.
+func duplicateName(db *sqlx.DB, table string, household sq.Sqlizer, name string, exceptPublicID string) (*nameDuplicate, error) {
+	query := sq.Select("public_id", "deleted_at IS NOT NULL AS trashed").From(table).Where(sq.Eq{"name": name}).Where(household)
+
+	if exceptPublicID != "" {
+		query = query.Where(sq.NotEq{"public_id": exceptPublicID})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicate nameDuplicate
+	if err := db.Get(&duplicate, queryString, queryStringArgs...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &duplicate, nil
+}
+
+// nameConflict creates the body of a conflict response for a record of the
+// table whose name is taken by the duplicate. Client is pointed to restoring
+// duplicates that are in the trash since their names can't be taken until
+// they are purged. Duplicate is nil if it was removed after the conflict.
+func nameConflict(table string, duplicate *nameDuplicate) gin.H {
+	record := strings.TrimSuffix(table, "s")
+	if duplicate == nil {
+		return gin.H{
+			"message": record + " with the same name already exists",
+		}
+	}
+
+	if duplicate.Trashed {
+		return gin.H{
+			"message": record + " with the same name is in the trash and can be restored with POST /trash/" + table + "/" + duplicate.PublicID + "/restore",
+			"id":      duplicate.PublicID,
+		}
+	}
+
+	return gin.H{
+		"message": record + " with the same name already exists",
+		"id":      duplicate.PublicID,
+	}
+}
+
+// sameHouseholdAs creates a condition that matches records in the same
+// household as the record with the specified public id.
+func sameHouseholdAs(table string, publicID string) sq.Sqlizer {
+	return sq.Expr("household_id = (SELECT household_id FROM "+table+" WHERE public_id = ?)", publicID)
+}
+
+// isUniqueConstraintError checks if the error is caused by a violated unique
+// constraint. It's used for catching duplicates inserted between the check
+// and the insert.
+func isUniqueConstraintError(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// isConstraintError checks if the error is caused by any violated constraint,
+// like a check or a foreign key, so it can be reported as invalid data
+func isConstraintError(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.Code == sqlite3.ErrConstraint
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDuplicateNames(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom'), (?, ?, 'bread', 'Hleb', 6499, 'kom')", household.UserID, household.HouseholdID, household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit, deleted_at) VALUES (?, ?, 'juice', 'Sok', 14999, 'l', current_timestamp)", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO locations (created_by, household_id, public_id, name, address, deleted_at) VALUES (?, ?, 'idea', 'Idea', 'Bulevar 2', current_timestamp)", household.UserID, household.HouseholdID)
+
+	tests := []struct {
+		handler func() gin.HandlerFunc
+		method  string
+		body    string
+		status  int
+		want    map[string]string
+	}{
+		{options.PostItems, http.MethodPost, `{"name": "Mleko", "price": 129.99, "unit": "kom"}`, http.StatusConflict, map[string]string{
+			"message": "item with the same name already exists",
+			"id":      "milk",
+		}},
+		{options.PostItems, http.MethodPost, `{"name": "Sok", "price": 149.99, "unit": "l"}`, http.StatusConflict, map[string]string{
+			"message": "item with the same name is in the trash and can be restored with POST /trash/items/juice/restore",
+			"id":      "juice",
+		}},
+		{options.PutItems, http.MethodPut, `{"id": "bread", "name": "Sok"}`, http.StatusConflict, map[string]string{
+			"message": "item with the same name is in the trash and can be restored with POST /trash/items/juice/restore",
+			"id":      "juice",
+		}},
+		{options.PutItems, http.MethodPut, `{"id": "milk", "name": "Mleko"}`, http.StatusOK, nil},
+		{options.PostLocations, http.MethodPost, `{"name": "Maxi", "address": "Bulevar 3"}`, http.StatusConflict, map[string]string{
+			"message": "location with the same name already exists",
+			"id":      "user-location",
+		}},
+		{options.PutLocations, http.MethodPut, `{"id": "user-location", "name": "Idea"}`, http.StatusConflict, map[string]string{
+			"message": "location with the same name is in the trash and can be restored with POST /trash/locations/idea/restore",
+			"id":      "idea",
+		}},
+	}
+	for _, test := range tests {
+		recorder := serve(test.handler(), "/records", "user", test.method, "/records", test.body)
+		if recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.body, recorder.Code, recorder.Body, test.status)
+			continue
+		}
+		if test.want == nil {
+			continue
+		}
+
+		got := map[string]string{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.body, got, test.want)
+		}
+	}
+}
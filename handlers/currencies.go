@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+	"github.com/jmoiron/sqlx"
+)
+
+// rateDateLayout is the layout of dates of exchange rates
+const rateDateLayout = "2006-01-02"
+
+// ErrNoExchangeRate is returned when an amount can't be converted because
+// there is no exchange rate between currencies
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// ExchangeRatesGetQuery : Structure that should be used for getting query data on get request for exchange rates
+type ExchangeRatesGetQuery struct {
+	Base  string `form:"base" validate:"omitempty,len=3,alpha"`
+	Quote string `form:"quote" validate:"omitempty,len=3,alpha"`
+	From  string `form:"from"`
+	To    string `form:"to"`
+}
+
+// ExchangeRate : Structure that should be used for getting exchange rate information from database
+type ExchangeRate struct {
+	Date  string  `db:"date" json:"date"`
+	Base  string  `db:"base" json:"base"`
+	Quote string  `db:"quote" json:"quote"`
+	Rate  float64 `db:"rate" json:"rate"`
+}
+
+// unsupportedCurrencies are ISO 4217 codes of currencies and funds with minor
+// units that aren't hundredths (e.g. yen has none and Kuwaiti dinar has
+// thousandths) and of metals and units without minor units. Money is stored in
+// hundredths so amounts in these currencies can't be stored exactly.
+var unsupportedCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+	"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "UYI": true,
+	"VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+	"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true,
+	"TND": true, "CLF": true, "UYW": true,
+	"XAG": true, "XAU": true, "XBA": true, "XBB": true, "XBC": true, "XBD": true,
+	"XDR": true, "XPD": true, "XPT": true, "XSU": true, "XTS": true, "XUA": true,
+	"XXX": true,
+}
+
+// isCurrencyCode checks if the currency looks like an ISO 4217 code of a
+// currency with two decimal places
+func isCurrencyCode(currency string) bool {
+	if len(currency) != 3 || unsupportedCurrencies[currency] {
+		return false
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewValidator creates a request data validator with the currency tag for
+// currencies amounts can be stored in.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return isCurrencyCode(normalizeCurrency(fl.Field().String()))
+	})
+	return v
+}
+
+// normalizeCurrency converts currency code to upper case which is used for
+// storing currencies
+func normalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// CurrencyConverter converts amounts of money between currencies using stored
+// exchange rates. Rates that are missing are fetched from the exchange rate
+// provider if there is one and stored for later. Rates are cached so a
+// converter should be used only for a single request.
+type CurrencyConverter struct {
+	db       *sqlx.DB
+	provider database.ExchangeRateProvider
+	rates    map[string]float64
+}
+
+// NewCurrencyConverter creates a currency converter. Provider can be nil.
+func NewCurrencyConverter(db *sqlx.DB, provider database.ExchangeRateProvider) *CurrencyConverter {
+	return &CurrencyConverter{
+		db:       db,
+		provider: provider,
+		rates:    map[string]float64{},
+	}
+}
+
+// Convert converts money from one currency to another using the exchange rate
+// on the specified date. Date should be in the time zone of the purchase.
+func (c *CurrencyConverter) Convert(amount Money, from, to string, date time.Time) (Money, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	rate, err := c.Rate(from, to, date)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount.Multiply(rate), nil
+}
+
+// Rate gets the exchange rate between currencies on the specified date. Rate
+// from that date is preferred, then a rate from the provider and then the
+// latest rate before that date. Provider errors are logged and the latest
+// rate is used instead since the provider can be unavailable. Rates are
+// looked up, fetched and stored by the day of the date in its own time zone
+// so a receipt gets the rate of the day it was bought on.
+func (c *CurrencyConverter) Rate(from, to string, date time.Time) (float64, error) {
+	day := date.Format(rateDateLayout)
+	key := day + from + to
+
+	if rate, ok := c.rates[key]; ok {
+		return rate, nil
+	}
+
+	rate, err := storedRate(c.db, from, to, sq.Eq{"date": day})
+	if err == sql.ErrNoRows && c.provider != nil {
+		rate, err = c.fetchRate(from, to, date)
+		if err != nil {
+			if err != database.ErrExchangeRatesNotFound {
+				log.Printf("fetching exchange rate from %s to %s on %s failed: %v", from, to, day, err)
+			}
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		rate, err = storedRate(c.db, from, to, sq.LtOrEq{"date": day})
+	}
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w from %s to %s on %s", ErrNoExchangeRate, from, to, day)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.rates[key] = rate
+	return rate, nil
+}
+
+// fetchRate gets rates on the day from the provider and stores them
+func (c *CurrencyConverter) fetchRate(from, to string, date time.Time) (float64, error) {
+	rates, err := c.provider.Rates(date, from)
+	if err != nil {
+		return 0, err
+	}
+
+	day := date.Format(rateDateLayout)
+	for quote, rate := range rates {
+		if err := saveRate(c.db, ExchangeRate{Date: day, Base: from, Quote: normalizeCurrency(quote), Rate: rate}); err != nil {
+			return 0, err
+		}
+	}
+
+	rate, ok := rates[to]
+	if !ok {
+		return 0, database.ErrExchangeRatesNotFound
+	}
+
+	return rate, nil
+}
+
+// storedRate gets the latest stored rate between currencies that matches the
+// date condition. Rates in the opposite direction are used as well.
+func storedRate(db *sqlx.DB, from, to string, date sq.Sqlizer) (float64, error) {
+	direct := sq.Select("date, rate").From("exchange_rates").Where(sq.Eq{"base": from, "quote": to}).Where(date)
+	inverse := sq.Select("date, 1.0 / rate AS rate").From("exchange_rates").Where(sq.Eq{"base": to, "quote": from}).Where(date)
+
+	directString, directArgs, err := direct.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	inverseString, inverseArgs, err := inverse.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var rate float64
+	err = db.Get(&rate, "SELECT rate FROM ("+directString+" UNION ALL "+inverseString+") ORDER BY date DESC LIMIT 1", append(directArgs, inverseArgs...)...)
+	return rate, err
+}
+
+// saveRate stores an exchange rate or replaces the one from the same date
+func saveRate(db sqlx.Execer, rate ExchangeRate) error {
+	_, err := db.Exec("INSERT INTO exchange_rates (date, base, quote, rate) VALUES (?, ?, ?, ?) ON CONFLICT (date, base, quote) DO UPDATE SET rate = excluded.rate", rate.Date, rate.Base, rate.Quote, rate.Rate)
+	return err
+}
+
+// conversionErrorStatus gets the response status for an error returned while
+// converting currencies
+func conversionErrorStatus(err error) int {
+	if errors.Is(err, ErrNoExchangeRate) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetExchangeRates is a Gin handler function for getting stored exchange rates.
+func (o Options) GetExchangeRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var searchQuery ExchangeRatesGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("date, base, quote, rate").From("exchange_rates").OrderBy("date DESC, base, quote")
+
+		if searchQuery.Base != "" {
+			query = query.Where(sq.Eq{"base": normalizeCurrency(searchQuery.Base)})
+		}
+		if searchQuery.Quote != "" {
+			query = query.Where(sq.Eq{"quote": normalizeCurrency(searchQuery.Quote)})
+		}
+		if searchQuery.From != "" {
+			query = query.Where(sq.GtOrEq{"date": searchQuery.From})
+		}
+		if searchQuery.To != "" {
+			query = query.Where(sq.LtOrEq{"date": searchQuery.To})
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		rates := []ExchangeRate{}
+		if err := o.DB.Select(&rates, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, rates)
+	}
+}
+
+// parseExchangeRates reads exchange rates from CSV with date, base, quote and
+// rate columns. First row is a header.
+func parseExchangeRates(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	rates := []ExchangeRate{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse(rateDateLayout, record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: date must be in YYYY-MM-DD format", line)
+		}
+
+		base, quote := normalizeCurrency(record[1]), normalizeCurrency(record[2])
+		if !isCurrencyCode(base) || !isCurrencyCode(quote) || base == quote {
+			return nil, fmt.Errorf("line %d: base and quote must be different currency codes with two decimal places", line)
+		}
+
+		rate, err := strconv.ParseFloat(record[3], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %d: rate must be a positive number", line)
+		}
+
+		rates = append(rates, ExchangeRate{
+			Date:  date.Format(rateDateLayout),
+			Base:  base,
+			Quote: quote,
+			Rate:  rate,
+		})
+	}
+
+	return rates, nil
+}
+
+// PostExchangeRatesImport is a Gin handler function for importing exchange
+// rates from a CSV file. File can be sent as the body of the request or as a
+// file field of a multipart form. Rates that already exist are replaced.
+func (o Options) PostExchangeRatesImport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var body io.Reader = ctx.Request.Body
+		if strings.HasPrefix(ctx.ContentType(), "multipart/form-data") {
+			file, err := ctx.FormFile("file")
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			opened, err := file.Open()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			defer opened.Close()
+			body = opened
+		}
+
+		rates, err := parseExchangeRates(body)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, rate := range rates {
+			if err := saveRate(tx, rate); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := audit(tx, ctx, "import_exchange_rates", "", gin.H{"rates": len(rates)}); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"imported": len(rates),
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+)
+
+func TestCurrencyConverterRate(t *testing.T) {
+	// Provider has rates for June 10th, doesn't know June 11th and fails on
+	// every other date
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-06-10/EUR":
+			w.Write([]byte(`{"base": "EUR", "rates": {"RSD": 117.5, "USD": 1.13}}`))
+		case "/2020-06-11/EUR":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	provider := database.HTTPExchangeRateProvider{
+		URL:    server.URL + "/{date}/{base}",
+		Client: server.Client(),
+	}
+	day := func(d int) time.Time {
+		return time.Date(2020, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	db := newTestDB(t)
+	if err := saveRate(db, ExchangeRate{Date: "2020-06-01", Base: "EUR", Quote: "RSD", Rate: 117.3}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		date     time.Time
+		want     float64
+		err      error
+	}{
+		{"stored", "EUR", "RSD", day(1), 117.3, nil},
+		{"inverse of stored", "RSD", "EUR", day(1), 1 / 117.3, nil},
+		{"stored on the local day", "EUR", "RSD", time.Date(2020, 6, 1, 0, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), 117.3, nil},
+		// Rate of a purchase shortly after midnight is the rate of the local
+		// day of the purchase and not of the previous day in UTC
+		{"fetched on the local day", "EUR", "USD", time.Date(2020, 6, 10, 0, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), 1.13, nil},
+		{"fetched", "EUR", "RSD", day(10), 117.5, nil},
+		{"not found falls back to latest", "EUR", "RSD", day(11), 117.5, nil},
+		{"server error falls back to latest", "EUR", "RSD", day(9), 117.3, nil},
+		{"server error without stored rates", "EUR", "GBP", day(9), 0, ErrNoExchangeRate},
+		{"before any rate", "EUR", "RSD", time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), 0, ErrNoExchangeRate},
+	}
+	for _, test := range tests {
+		converter := NewCurrencyConverter(db, provider)
+		rate, err := converter.Rate(test.from, test.to, test.date)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if rate != test.want {
+			t.Errorf("%s: got rate %v, want %v", test.name, rate, test.want)
+		}
+	}
+
+	// Fetched rates are stored so the provider is not asked again
+	var stored int
+	if err := db.Get(&stored, "SELECT COUNT(*) FROM exchange_rates WHERE date = '2020-06-10'"); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 2 {
+		t.Errorf("%d fetched rates are stored, want 2", stored)
+	}
+}
+
+func TestCurrencyConverterConvert(t *testing.T) {
+	db := newTestDB(t)
+	if err := saveRate(db, ExchangeRate{Date: "2020-06-01", Base: "EUR", Quote: "RSD", Rate: 117.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := NewCurrencyConverter(db, nil)
+	date := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	if got, err := converter.Convert(1050, "EUR", "RSD", date); err != nil || got != 123375 {
+		t.Errorf("got %d, %v, want 123375", got, err)
+	}
+	if got, err := converter.Convert(1050, "RSD", "RSD", date); err != nil || got != 1050 {
+		t.Errorf("got %d, %v, want 1050", got, err)
+	}
+	if _, err := converter.Convert(1050, "EUR", "USD", date); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("got error %v, want %v", err, ErrNoExchangeRate)
+	}
+}
+
+func TestCurrencyValidation(t *testing.T) {
+	v := NewValidator()
+	tests := []struct {
+		currency string
+		valid    bool
+	}{
+		{"", true},
+		{"RSD", true},
+		{"eur", true},
+		{"JPY", false},
+		{"KWD", false},
+		{"XAU", false},
+		{"EU", false},
+		{"EU1", false},
+	}
+	for _, test := range tests {
+		if err := v.Var(test.currency, "omitempty,currency"); (err == nil) != test.valid {
+			t.Errorf("currency %q got error %v, want valid %v", test.currency, err, test.valid)
+		}
+	}
+}
+
+func TestParseExchangeRates(t *testing.T) {
+	rates, err := parseExchangeRates(strings.NewReader("date,base,quote,rate\n2020-06-10, eur,RSD,117.5\n2020-06-10,USD,rsd,104.25\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExchangeRate{
+		{Date: "2020-06-10", Base: "EUR", Quote: "RSD", Rate: 117.5},
+		{Date: "2020-06-10", Base: "USD", Quote: "RSD", Rate: 104.25},
+	}
+	if !reflect.DeepEqual(rates, want) {
+		t.Errorf("got rates %+v, want %+v", rates, want)
+	}
+
+	// Rows are reported by their line in the file, the header is line 1
+	invalid := map[string]string{
+		"not a letter":          "2020-06-10,X1Z,RSD,1.5",
+		"unsupported currency":  "2020-06-10,EUR,JPY,130",
+		"too long":              "2020-06-10,EURO,RSD,117.5",
+		"same currencies":       "2020-06-10,EUR,eur,1",
+		"date in another style": "10.06.2020.,EUR,RSD,117.5",
+		"negative rate":         "2020-06-10,EUR,RSD,-117.5",
+	}
+	for name, row := range invalid {
+		_, err := parseExchangeRates(strings.NewReader("date,base,quote,rate\n2020-06-10,EUR,RSD,117.5\n" + row + "\n"))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+			t.Errorf("%s: got error %v, want an error of line 3", name, err)
+		}
+	}
+}
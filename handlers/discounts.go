@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+)
+
+// Discount types as they are stored in the database
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// SQL expressions for totals and discounts of receipts. Receipt expressions
+// have to be used in queries of receipts grouped by receipt that join lines
+// and their items.
+var (
+	// LineDiscountSQL is an SQL expression for the discount on a line
+	LineDiscountSQL = discountSQL("items_in_receipt.discount_type", "items_in_receipt.discount_value", lineSubtotalSQL)
+	// LineTotalSQL is an SQL expression for the total of a line after its
+	// discount
+	LineTotalSQL = "(" + lineSubtotalSQL + " - " + LineDiscountSQL + ")"
+	// ReceiptSubtotalSQL is an SQL expression for the sum of line totals
+	ReceiptSubtotalSQL = "COALESCE(SUM(" + LineTotalSQL + "), 0)"
+	// ReceiptDiscountSQL is an SQL expression for the discount on the whole
+	// receipt
+	ReceiptDiscountSQL = discountSQL("receipts.discount_type", "receipts.discount_value", ReceiptSubtotalSQL)
+	// ReceiptTotalSQL is an SQL expression for the total of a receipt after
+	// all discounts
+	ReceiptTotalSQL = "(" + ReceiptSubtotalSQL + " - " + ReceiptDiscountSQL + ")"
+	// ReceiptSavedSQL is an SQL expression for the sum of line and receipt
+	// discounts
+	ReceiptSavedSQL = "(COALESCE(SUM(" + LineDiscountSQL + "), 0) + " + ReceiptDiscountSQL + ")"
+)
+
+// ErrInvalidDiscount is returned when both kinds of a discount are set
+var ErrInvalidDiscount = errors.New("discount must be either a percentage or a fixed amount")
+
+// Discount : Structure that should be used for getting and sending a discount on a receipt line or a whole receipt. Only one of percent and fixed can be set and a discount without either removes the discount.
+type Discount struct {
+	Percent *Percentage `json:"percent,omitempty" validate:"omitempty,min=0,max=10000"`
+	Fixed   *Money      `json:"fixed,omitempty" validate:"omitempty,min=0"`
+}
+
+// discountSQL creates an SQL expression for the discount on an amount. Percent
+// discounts are rounded half away from zero and fixed discounts are never
+// larger than the amount. Discounts on negative amounts of refunds are
+// negative.
+func discountSQL(kind string, value string, amount string) string {
+	return "(CASE " + kind + " WHEN '" + DiscountPercent + "' THEN CAST(ROUND(" + amount + " * " + value + " / 10000.0) AS INTEGER) WHEN '" + DiscountFixed + "' THEN (CASE WHEN " + amount + " < 0 THEN -MIN(" + value + ", -" + amount + ") ELSE MIN(" + value + ", " + amount + ") END) ELSE 0 END)"
+}
+
+// NewDiscount creates a discount from its database columns. It returns nil if
+// there is no discount.
+func NewDiscount(kind *string, value *int64) *Discount {
+	if kind == nil || value == nil {
+		return nil
+	}
+
+	switch *kind {
+	case DiscountPercent:
+		percent := Percentage(*value)
+		return &Discount{Percent: &percent}
+	case DiscountFixed:
+		fixed := Money(*value)
+		return &Discount{Fixed: &fixed}
+	}
+
+	return nil
+}
+
+// validate checks that only one kind of the discount is set
+func (d *Discount) validate() error {
+	if d != nil && d.Percent != nil && d.Fixed != nil {
+		return ErrInvalidDiscount
+	}
+	return nil
+}
+
+// columns gets values of the type and value columns of the discount. Both are
+// nil if the discount is empty.
+func (d *Discount) columns() (interface{}, interface{}) {
+	switch {
+	case d == nil:
+		return nil, nil
+	case d.Percent != nil:
+		return DiscountPercent, int64(*d.Percent)
+	case d.Fixed != nil:
+		return DiscountFixed, int64(*d.Fixed)
+	}
+	return nil, nil
+}
+
+// Amount calculates the discount on an amount the same way as discountSQL
+func (d *Discount) Amount(amount Money) Money {
+	switch {
+	case d == nil:
+		return 0
+	case d.Percent != nil:
+		return Money(math.Round(float64(amount) * float64(*d.Percent) / 10000))
+	case d.Fixed != nil && amount < 0:
+		return -d.Amount(-amount)
+	case d.Fixed != nil && *d.Fixed < amount:
+		return *d.Fixed
+	case d.Fixed != nil:
+		return amount
+	}
+	return 0
+}
+
+// splitDiscount splits the discount on the sum of amounts in proportion to
+// amounts. The rounding difference goes to the last amount so shares add up to
+// the discount.
+func splitDiscount(amounts []Money, discount *Discount) []Money {
+	shares := make([]Money, len(amounts))
+
+	var subtotal Money
+	for _, amount := range amounts {
+		subtotal += amount
+	}
+
+	total := discount.Amount(subtotal)
+	if total == 0 || subtotal == 0 {
+		return shares
+	}
+
+	remaining := total
+	for i, amount := range amounts {
+		share := remaining
+		if i < len(amounts)-1 {
+			share = Money(math.Round(float64(total) * float64(amount) / float64(subtotal)))
+		}
+
+		shares[i] = share
+		remaining -= share
+	}
+
+	return shares
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiscounts(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 1000, 'l')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'receipt', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+
+	invalid := map[string]string{
+		"both kinds":            `{"receiptId": "receipt", "itemId": "milk", "amount": 2, "discount": {"percent": 10, "fixed": 1}}`,
+		"more than 100 percent": `{"receiptId": "receipt", "itemId": "milk", "amount": 2, "discount": {"percent": 100.01}}`,
+		"negative fixed":        `{"receiptId": "receipt", "itemId": "milk", "amount": 2, "discount": {"fixed": -1}}`,
+	}
+	for name, body := range invalid {
+		if recorder := serve(options.PostItemsInReceipt(), "/items/inreceipt", "user", http.MethodPost, "/items/inreceipt", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("line with %s: got %d %s, want %d", name, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+	for _, body := range []string{`{"id": "receipt", "discount": {"percent": 10, "fixed": 1}}`, `{"id": "receipt", "discount": {"percent": 150}}`} {
+		if recorder := serve(options.PutReceipts(), "/receipts", "user", http.MethodPut, "/receipts", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("receipt %s: got %d %s, want %d", body, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+
+	if recorder := serve(options.PostItemsInReceipt(), "/items/inreceipt", "user", http.MethodPost, "/items/inreceipt", `{"receiptId": "receipt", "itemId": "milk", "amount": 2, "discount": {"fixed": 50}}`); recorder.Code != http.StatusOK {
+		t.Fatalf("adding a line: got %d %s", recorder.Code, recorder.Body)
+	}
+	var line string
+	if err := db.Get(&line, "SELECT public_id FROM items_in_receipt"); err != nil {
+		t.Fatal(err)
+	}
+
+	totals := func() (Money, Money, Money) {
+		var got struct {
+			Subtotal Money `db:"subtotal"`
+			Total    Money `db:"total"`
+			Saved    Money `db:"saved"`
+		}
+		if err := db.Get(&got, "SELECT "+ReceiptSubtotalSQL+" AS subtotal, "+ReceiptTotalSQL+" AS total, "+ReceiptSavedSQL+" AS saved FROM receipts LEFT JOIN items_in_receipt ON items_in_receipt.receipt_id = receipts.id LEFT JOIN items ON items.id = items_in_receipt.item_id WHERE receipts.public_id = 'receipt' GROUP BY receipts.id"); err != nil {
+			t.Fatal(err)
+		}
+		return got.Subtotal, got.Total, got.Saved
+	}
+
+	// Fixed discounts larger than the line total make the line free
+	if subtotal, total, saved := totals(); subtotal != 0 || total != 0 || saved != 2000 {
+		t.Errorf("line with a fixed discount of 50.00 on 20.00: subtotal %d, total %d, saved %d, want 0, 0, 2000", subtotal, total, saved)
+	}
+
+	updates := []struct {
+		handler gin.HandlerFunc
+		route   string
+		body    string
+	}{
+		{options.PutItemsInReceipt(), "/items/inreceipt", `{"id": "` + line + `", "discount": {"percent": 25}}`},
+		{options.PutReceipts(), "/receipts", `{"id": "receipt", "discount": {"fixed": 3}}`},
+	}
+	for _, update := range updates {
+		if recorder := serve(update.handler, update.route, "user", http.MethodPut, update.route, update.body); recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", update.body, recorder.Code, recorder.Body)
+		}
+	}
+	if subtotal, total, saved := totals(); subtotal != 1500 || total != 1200 || saved != 800 {
+		t.Errorf("25%% off the line and 3.00 off the receipt: subtotal %d, total %d, saved %d, want 1500, 1200, 800", subtotal, total, saved)
+	}
+
+	recorder := serve(options.GetStats(), "/stats", "user", http.MethodGet, "/stats?currency=RSD", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("getting stats: got %d %s", recorder.Code, recorder.Body)
+	}
+	stats := Stats{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 1200 || stats.Saved != 800 {
+		t.Errorf("stats total %d and saved %d, want 1200 and 800", stats.Total, stats.Saved)
+	}
+
+	// Empty discounts remove discounts
+	removals := []struct {
+		handler gin.HandlerFunc
+		route   string
+		body    string
+	}{
+		{options.PutItemsInReceipt(), "/items/inreceipt", `{"id": "` + line + `", "discount": {}}`},
+		{options.PutReceipts(), "/receipts", `{"id": "receipt", "discount": {}}`},
+	}
+	for _, removal := range removals {
+		if recorder := serve(removal.handler, removal.route, "user", http.MethodPut, removal.route, removal.body); recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", removal.body, recorder.Code, recorder.Body)
+		}
+	}
+	var discounts int
+	if err := db.Get(&discounts, "SELECT (SELECT COUNT(*) FROM items_in_receipt WHERE discount_type IS NOT NULL OR discount_value IS NOT NULL) + (SELECT COUNT(*) FROM receipts WHERE discount_type IS NOT NULL OR discount_value IS NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if discounts != 0 {
+		t.Errorf("%d discounts left after removing them", discounts)
+	}
+	if subtotal, total, saved := totals(); subtotal != 2000 || total != 2000 || saved != 0 {
+		t.Errorf("without discounts: subtotal %d, total %d, saved %d, want 2000, 2000, 0", subtotal, total, saved)
+	}
+}
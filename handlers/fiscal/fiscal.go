@@ -0,0 +1,135 @@
+// Package fiscal parses receipts issued through the Serbian e-fiscalization
+// system (SUF/PURS). Receipts can be parsed from the text of the fiscal
+// journal printed on the receipt or from the verification URL in its QR code.
+// Parsing doesn't need access to the network.
+package fiscal
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InvoiceType is the type of a fiscal invoice
+type InvoiceType int
+
+// Invoice types as they are numbered in verification URLs
+const (
+	Normal InvoiceType = iota
+	ProForma
+	Copy
+	Training
+	Advance
+)
+
+// TransactionType is the type of a fiscal transaction
+type TransactionType int
+
+// Transaction types as they are numbered in verification URLs
+const (
+	Sale TransactionType = iota
+	Refund
+)
+
+// ErrInvalidJournal is returned when the text is not a fiscal journal
+var ErrInvalidJournal = errors.New("text is not a fiscal receipt journal")
+
+// ErrInvalidVerificationURL is returned when the URL is not a verification
+// URL of a fiscal receipt
+var ErrInvalidVerificationURL = errors.New("url is not a fiscal receipt verification url")
+
+// timeZone is the time zone of times on fiscal receipts
+var timeZone = loadTimeZone()
+
+// TimeZoneName is the name of the time zone of times on fiscal receipts
+const TimeZoneName = "Europe/Belgrade"
+
+// Receipt is a fiscal receipt. Amounts are in hundredths of a dinar and tax
+// rates in hundredths of a percent.
+type Receipt struct {
+	// TaxID is the tax identification number (PIB) of the company
+	TaxID        string
+	Company      string
+	PointOfSale  string
+	Address      string
+	Municipality string
+	// InvoiceNumber is the number given to the invoice by the tax
+	// administration (PFR) and it's unique for each receipt
+	InvoiceNumber   string
+	InvoiceType     InvoiceType
+	TransactionType TransactionType
+	IssuedAt        time.Time
+	Lines           []Line
+	Taxes           []Tax
+	Total           int64
+}
+
+// Line is a line of a fiscal receipt
+type Line struct {
+	Name     string
+	Unit     string
+	TaxLabel string
+	Price    int64
+	Quantity float64
+	Total    int64
+}
+
+// Tax is a tax rate with the amount of tax on a fiscal receipt
+type Tax struct {
+	Label  string
+	Name   string
+	Rate   int64
+	Amount int64
+}
+
+func loadTimeZone() *time.Location {
+	location, err := time.LoadLocation(TimeZoneName)
+	if err != nil {
+		// Central European Time without daylight saving is better than UTC
+		// if time zone data is missing
+		return time.FixedZone("CET", 60*60)
+	}
+	return location
+}
+
+// parseAmount parses an amount with a decimal comma and optional thousands
+// separators like "1.234,56" into hundredths
+func parseAmount(s string) (int64, bool) {
+	s = strings.Replace(s, ".", "", -1)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	parts := strings.Split(s, ",")
+	if len(parts) > 2 || parts[0] == "" {
+		return 0, false
+	}
+
+	fraction := "00"
+	if len(parts) == 2 {
+		if len(parts[1]) == 0 || len(parts[1]) > 2 {
+			return 0, false
+		}
+		fraction = parts[1] + strings.Repeat("0", 2-len(parts[1]))
+	}
+
+	value, err := strconv.ParseInt(parts[0]+fraction, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if negative {
+		value = -value
+	}
+	return value, true
+}
+
+// parseQuantity parses a quantity with a decimal comma like "0,524"
+func parseQuantity(s string) (float64, bool) {
+	s = strings.Replace(strings.Replace(s, ".", "", -1), ",", ".", 1)
+	quantity, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return quantity, true
+}
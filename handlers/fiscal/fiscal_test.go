@@ -0,0 +1,241 @@
+package fiscal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestdata reads a file from the testdata directory
+func readTestdata(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseJournal(t *testing.T) {
+	tests := []struct {
+		file string
+		want Receipt
+	}{
+		{"sale.txt", Receipt{
+			TaxID:           "100002092",
+			Company:         "DELHAIZE SERBIA DOO",
+			PointOfSale:     "1012345-Maxi 105",
+			Address:         "Булевар ослобођења 101",
+			Municipality:    "Нови Сад",
+			InvoiceNumber:   "AB12CD34-AB12CD34-12345",
+			InvoiceType:     Normal,
+			TransactionType: Sale,
+			IssuedAt:        time.Date(2023, 3, 14, 18, 42, 7, 0, timeZone),
+			Lines: []Line{
+				{Name: "Mleko 2,8% m.m. 1l", Unit: "KOM", TaxLabel: "Ђ", Price: 12999, Quantity: 2, Total: 25998},
+				{Name: "Hleb beli 500g", Unit: "KOM", TaxLabel: "Е", Price: 6499, Quantity: 1, Total: 6499},
+				{Name: "Kafa Doncafe Moment 500g", Unit: "KOM", TaxLabel: "Ђ", Price: 109999, Quantity: 1, Total: 109999},
+			},
+			Taxes: []Tax{
+				{Label: "Ђ", Name: "О-ПДВ", Rate: 2000, Amount: 22666},
+				{Label: "Е", Name: "П-ПДВ", Rate: 1000, Amount: 591},
+			},
+			Total: 142496,
+		}},
+		{"wrapped-names.txt", Receipt{
+			TaxID:           "101670560",
+			Company:         "MERCATOR-S DOO",
+			PointOfSale:     "1098765-IDEA 0412",
+			Address:         "Змај Јовина 12",
+			Municipality:    "Београд",
+			InvoiceNumber:   "QW9ER8TY-QW9ER8TY-88012",
+			InvoiceType:     Normal,
+			TransactionType: Sale,
+			IssuedAt:        time.Date(2023, 4, 2, 11, 7, 59, 0, timeZone),
+			Lines: []Line{
+				{Name: "Coca Cola Zero 1,5l PET boca pakovanje", Unit: "KOM", TaxLabel: "Ђ", Price: 18999, Quantity: 6, Total: 113994},
+				{Name: "Čokolada Milka alpsko mleko sa lešnikom i grožđicama 100g", Unit: "KOM", TaxLabel: "Ђ", Price: 15999, Quantity: 2, Total: 31998},
+				{Name: "Sok Next jabuka (100%) 1l", Unit: "KOM", TaxLabel: "Ђ", Price: 14999, Quantity: 1, Total: 14999},
+			},
+			Taxes: []Tax{
+				{Label: "Ђ", Name: "О-ПДВ", Rate: 2000, Amount: 26832},
+			},
+			Total: 160991,
+		}},
+		{"refund.txt", Receipt{
+			TaxID:           "100002092",
+			Company:         "DELHAIZE SERBIA DOO",
+			PointOfSale:     "1012345-Maxi 105",
+			Address:         "Булевар ослобођења 101",
+			Municipality:    "Нови Сад",
+			InvoiceNumber:   "AB12CD34-AB12CD34-12399",
+			InvoiceType:     Normal,
+			TransactionType: Refund,
+			IssuedAt:        time.Date(2023, 3, 15, 9, 5, 41, 0, timeZone),
+			Lines: []Line{
+				{Name: "Mleko 2,8% m.m. 1l", Unit: "KOM", TaxLabel: "Ђ", Price: 12999, Quantity: 1, Total: -12999},
+			},
+			Taxes: []Tax{
+				{Label: "Ђ", Name: "О-ПДВ", Rate: 2000, Amount: 2167},
+			},
+			Total: 12999,
+		}},
+		{"decimal-quantity.txt", Receipt{
+			TaxID:           "106884584",
+			Company:         "LIDL SRBIJA KD",
+			PointOfSale:     "1155432-Lidl Zemun",
+			Address:         "Угриновачка 210",
+			Municipality:    "Земун",
+			InvoiceNumber:   "LD7ZK2PM-LD7ZK2PM-40417",
+			InvoiceType:     Normal,
+			TransactionType: Sale,
+			IssuedAt:        time.Date(2022, 11, 18, 19, 3, 12, 0, timeZone),
+			Lines: []Line{
+				{Name: "Banane", Unit: "KG", TaxLabel: "Е", Price: 14999, Quantity: 1.254, Total: 18809},
+				{Name: "Sir gauda", Unit: "KG", TaxLabel: "Ђ", Price: 129999, Quantity: 0.524, Total: 68119},
+			},
+			Taxes: []Tax{
+				{Label: "Ђ", Name: "О-ПДВ", Rate: 2000, Amount: 11353},
+				{Label: "Е", Name: "П-ПДВ", Rate: 1000, Amount: 1710},
+			},
+			Total: 86928,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := ParseJournal(readTestdata(t, filepath.Join("journals", test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.IssuedAt.Equal(test.want.IssuedAt) {
+				t.Errorf("issued at %v, want %v", got.IssuedAt, test.want.IssuedAt)
+			}
+			got.IssuedAt, test.want.IssuedAt = time.Time{}, time.Time{}
+
+			if !reflect.DeepEqual(got.Lines, test.want.Lines) {
+				t.Errorf("lines are\n%+v\nwant\n%+v", got.Lines, test.want.Lines)
+			}
+			if !reflect.DeepEqual(got.Taxes, test.want.Taxes) {
+				t.Errorf("taxes are\n%+v\nwant\n%+v", got.Taxes, test.want.Taxes)
+			}
+			got.Lines, got.Taxes, test.want.Lines, test.want.Taxes = nil, nil, nil, nil
+
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("receipt is\n%+v\nwant\n%+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseJournalInvalid(t *testing.T) {
+	sale := readTestdata(t, filepath.Join("journals", "sale.txt"))
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"not a journal", "Hello, world!"},
+		{"without invoice number", strings.Replace(sale, "ПФР број рачуна:", "Број:", 1)},
+		{"without type", strings.Replace(sale, "ПРОМЕТ ПРОДАЈА", "", 1)},
+		{"invalid time", strings.Replace(sale, "14.03.2023. 18:42:07", "14.03.2023.", 1)},
+		{"item without amounts", strings.Replace(sale, "      64,99          1             64,99\n", "", 1)},
+		{"item without tax label", strings.Replace(sale, "Hleb beli 500g/KOM (Е)", "Hleb beli 500g/KOM", 1)},
+		{"name at the end of items", strings.Replace(sale, "----------------------------------------\nУкупан износ:", "Kesa/KOM (Ђ)\n----------------------------------------\nУкупан износ:", 1)},
+	}
+	for _, test := range tests {
+		if _, err := ParseJournal(test.text); err != ErrInvalidJournal {
+			t.Errorf("%s: got error %v, want %v", test.name, err, ErrInvalidJournal)
+		}
+	}
+}
+
+func TestParseVerificationURL(t *testing.T) {
+	tests := []struct {
+		file string
+		want Verification
+	}{
+		{"sale.url", Verification{
+			InvoiceNumber:   "AB12CD34-AB12CD34-12345",
+			InvoiceType:     Normal,
+			TransactionType: Sale,
+			IssuedAt:        time.Date(2023, 3, 14, 18, 42, 7, 0, timeZone),
+			Total:           142496,
+		}},
+		{"refund.url", Verification{
+			InvoiceNumber:   "AB12CD34-AB12CD34-12399",
+			InvoiceType:     Normal,
+			TransactionType: Refund,
+			IssuedAt:        time.Date(2023, 3, 15, 9, 5, 41, 0, timeZone),
+			Total:           12999,
+		}},
+		// Payload is not escaped so plus signs are decoded as spaces
+		{"unescaped.url", Verification{
+			InvoiceNumber:   "AB12CD34-AB12CD34-12345",
+			InvoiceType:     Normal,
+			TransactionType: Sale,
+			IssuedAt:        time.Date(2023, 3, 14, 18, 42, 7, 0, timeZone),
+			Total:           142496,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := ParseVerificationURL(readTestdata(t, filepath.Join("verification", test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.IssuedAt.Equal(test.want.IssuedAt) {
+				t.Errorf("issued at %v, want %v", got.IssuedAt, test.want.IssuedAt)
+			}
+			got.IssuedAt, test.want.IssuedAt = time.Time{}, time.Time{}
+
+			if *got != test.want {
+				t.Errorf("verification is\n%+v\nwant\n%+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVerificationURLInvalid(t *testing.T) {
+	sale := readTestdata(t, filepath.Join("verification", "sale.url"))
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		// Total in the payload was changed without updating the hash
+		{"md5 mismatch", readTestdata(t, filepath.Join("verification", "md5-mismatch.url"))},
+		{"truncated", sale[:200]},
+		{"without payload", "https://suf.purs.gov.rs/v/?id=1"},
+		{"not base64", "https://suf.purs.gov.rs/v/?vl=not*base64"},
+		{"not a url", "%zz"},
+	}
+	for _, test := range tests {
+		if _, err := ParseVerificationURL(test.url); err != ErrInvalidVerificationURL {
+			t.Errorf("%s: got error %v, want %v", test.name, err, ErrInvalidVerificationURL)
+		}
+	}
+}
+
+// Journal and verification URL of the same receipt have the same invoice
+// number and total
+func TestJournalMatchesVerificationURL(t *testing.T) {
+	journal, err := ParseJournal(readTestdata(t, filepath.Join("journals", "sale.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err := ParseVerificationURL(readTestdata(t, filepath.Join("verification", "sale.url")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if journal.InvoiceNumber != verification.InvoiceNumber || journal.Total != verification.Total || !journal.IssuedAt.Equal(verification.IssuedAt) {
+		t.Errorf("journal %s %d %v doesn't match verification %s %d %v", journal.InvoiceNumber, journal.Total, journal.IssuedAt, verification.InvoiceNumber, verification.Total, verification.IssuedAt)
+	}
+}
@@ -0,0 +1,222 @@
+package fiscal
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// journalTimeLayout is the layout of times on fiscal receipts
+const journalTimeLayout = "02.01.2006. 15:04:05"
+
+var (
+	// amountsPattern matches the line with price, quantity and total that
+	// follows the name of an item
+	amountsPattern = regexp.MustCompile(`^(-?[\d.]+,\d{2})\s+(-?[\d.]*\d(?:,\d+)?)\s+(-?[\d.]+,\d{2})$`)
+	// labelPattern matches the tax label at the end of the name of an item
+	labelPattern = regexp.MustCompile(`\s*\(([^()]+)\)$`)
+	// labelEndPattern matches a tax label of one letter, like all labels are,
+	// at the end of a line. Longer text in brackets can be a part of a name
+	// that continues on the next line.
+	labelEndPattern = regexp.MustCompile(`\(\p{L}\)$`)
+	// unitPattern matches the unit of measure at the end of the name of an
+	// item like "Mleko 1l/KOM"
+	unitPattern = regexp.MustCompile(`\s*/\s*([\p{L}.]{1,5})$`)
+	// taxPattern matches a row of the table of taxes
+	taxPattern = regexp.MustCompile(`^(\S+)\s+(.+?)\s+([\d.]+,\d{1,2})%\s+(-?[\d.]+,\d{2})$`)
+)
+
+// Invoice types and transaction types as they are written in journals
+var (
+	journalInvoiceTypes = map[string]InvoiceType{
+		"ПРОМЕТ":    Normal,
+		"ПРЕДРАЧУН": ProForma,
+		"КОПИЈА":    Copy,
+		"ОБУКА":     Training,
+		"АВАНС":     Advance,
+	}
+	journalTransactionTypes = map[string]TransactionType{
+		"ПРОДАЈА":     Sale,
+		"РЕФУНДАЦИЈА": Refund,
+	}
+)
+
+// journalSection is the part of the journal that is being parsed
+type journalSection int
+
+const (
+	headerSection journalSection = iota
+	itemsSection
+	totalsSection
+	taxesSection
+	footerSection
+)
+
+// ParseJournal parses the text of a fiscal journal as it's printed on the
+// receipt or shown on the verification page
+func ParseJournal(text string) (*Receipt, error) {
+	receipt := Receipt{}
+	section := headerSection
+	typeFound := false
+	var name []string
+
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// Separators and titles of sections
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "===") {
+			title := strings.TrimSpace(strings.Trim(line, "=-"))
+
+			switch {
+			case title == "" && section == itemsSection && len(receipt.Lines) > 0:
+				section = totalsSection
+			case title == "" && section == taxesSection:
+				section = footerSection
+			case title != "":
+				if invoiceType, transactionType, ok := parseJournalType(title); ok {
+					receipt.InvoiceType, receipt.TransactionType = invoiceType, transactionType
+					typeFound = true
+				}
+			}
+			continue
+		}
+
+		switch {
+		case line == "Артикли":
+			section = itemsSection
+			continue
+		case strings.HasPrefix(line, "Ознака") && strings.Contains(line, "Стопа"):
+			section = taxesSection
+			continue
+		case section == itemsSection && strings.HasPrefix(line, "Назив") && strings.Contains(line, "Укупно"):
+			continue
+		}
+
+		switch section {
+		case itemsSection:
+			match := amountsPattern.FindStringSubmatch(strings.Join(strings.Fields(line), " "))
+			if match == nil {
+				// Tax label ends the name so amounts of the item are missing
+				if len(name) != 0 && labelEndPattern.MatchString(name[len(name)-1]) {
+					return nil, ErrInvalidJournal
+				}
+				name = append(name, line)
+				continue
+			}
+
+			item, ok := parseJournalLine(strings.Join(name, " "), match[1], match[2], match[3])
+			if !ok {
+				return nil, ErrInvalidJournal
+			}
+			receipt.Lines = append(receipt.Lines, item)
+			name = nil
+		case taxesSection:
+			match := taxPattern.FindStringSubmatch(strings.Join(strings.Fields(line), " "))
+			if match == nil {
+				continue
+			}
+
+			rate, rateOk := parseAmount(match[3])
+			amount, amountOk := parseAmount(match[4])
+			if !rateOk || !amountOk {
+				return nil, ErrInvalidJournal
+			}
+			receipt.Taxes = append(receipt.Taxes, Tax{
+				Label:  match[1],
+				Name:   match[2],
+				Rate:   rate,
+				Amount: amount,
+			})
+		default:
+			key, value, ok := journalField(line)
+			if !ok {
+				continue
+			}
+
+			switch key {
+			case "ПИБ":
+				receipt.TaxID = value
+			case "Предузеће":
+				receipt.Company = value
+			case "Место продаје":
+				receipt.PointOfSale = value
+			case "Адреса":
+				receipt.Address = value
+			case "Општина":
+				receipt.Municipality = value
+			case "ПФР време":
+				issuedAt, err := time.ParseInLocation(journalTimeLayout, value, timeZone)
+				if err != nil {
+					return nil, ErrInvalidJournal
+				}
+				receipt.IssuedAt = issuedAt
+			case "ПФР број рачуна":
+				receipt.InvoiceNumber = value
+			case "Укупан износ", "Укупна рефундација":
+				// Refunds have their total under a different name
+				total, ok := parseAmount(value)
+				if !ok {
+					return nil, ErrInvalidJournal
+				}
+				receipt.Total = total
+			}
+		}
+	}
+
+	if !typeFound || receipt.TaxID == "" || receipt.InvoiceNumber == "" || receipt.IssuedAt.IsZero() || len(receipt.Lines) == 0 || len(name) != 0 {
+		return nil, ErrInvalidJournal
+	}
+
+	return &receipt, nil
+}
+
+// parseJournalType parses the type of the invoice and the transaction from a
+// title like "ПРОМЕТ ПРОДАЈА"
+func parseJournalType(title string) (InvoiceType, TransactionType, bool) {
+	words := strings.Fields(title)
+	if len(words) != 2 {
+		return 0, 0, false
+	}
+
+	invoiceType, invoiceOk := journalInvoiceTypes[words[0]]
+	transactionType, transactionOk := journalTransactionTypes[words[1]]
+	return invoiceType, transactionType, invoiceOk && transactionOk
+}
+
+// parseJournalLine parses an item from its name with a tax label and an
+// optional unit and the amounts that follow it
+func parseJournalLine(name, price, quantity, total string) (Line, bool) {
+	line := Line{}
+
+	match := labelPattern.FindStringSubmatch(name)
+	if match == nil {
+		return line, false
+	}
+	line.TaxLabel = match[1]
+	name = strings.TrimSpace(name[:len(name)-len(match[0])])
+
+	if match := unitPattern.FindStringSubmatch(name); match != nil {
+		line.Unit = match[1]
+		name = strings.TrimSpace(name[:len(name)-len(match[0])])
+	}
+	line.Name = name
+
+	var priceOk, quantityOk, totalOk bool
+	line.Price, priceOk = parseAmount(price)
+	line.Quantity, quantityOk = parseQuantity(quantity)
+	line.Total, totalOk = parseAmount(total)
+
+	return line, line.Name != "" && priceOk && quantityOk && totalOk
+}
+
+// journalField splits a line like "ПИБ: 100002092" into the key and the value
+func journalField(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i == -1 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
@@ -0,0 +1,90 @@
+package fiscal
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verificationHeaderLength is the length of the part of the verification
+// payload before the buyer id
+const verificationHeaderLength = 43
+
+// Verification is the data of a fiscal receipt in its verification URL. It
+// doesn't contain the company or the items of the receipt, they are only on
+// the verification page. Total is in hundredths of a dinar.
+type Verification struct {
+	InvoiceNumber   string
+	InvoiceType     InvoiceType
+	TransactionType TransactionType
+	IssuedAt        time.Time
+	Total           int64
+}
+
+// ParseVerificationURL parses the verification URL from the QR code of a
+// fiscal receipt. The payload in the vl query parameter is a base64 encoded
+// binary structure:
+//
+//	1 byte     version
+//	8 bytes    id of the secure element that requested the signature
+//	8 bytes    id of the secure element that signed the invoice
+//	4 bytes    total counter (little endian)
+//	4 bytes    transaction type counter (little endian)
+//	8 bytes    total amount in ten thousandths (little endian)
+//	8 bytes    time of the invoice in Unix milliseconds (big endian)
+//	1 byte     invoice type
+//	1 byte     transaction type
+//	1 byte     length of the buyer id followed by the buyer id
+//	           encrypted internal data and the signature
+//	16 bytes   MD5 hash of everything before it
+//
+// Invoice number is made of both ids and the total counter like on the
+// journal.
+func ParseVerificationURL(rawURL string) (*Verification, error) {
+	verificationURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, ErrInvalidVerificationURL
+	}
+
+	payload, err := decodeVerificationPayload(verificationURL.Query().Get("vl"))
+	if err != nil || len(payload) < verificationHeaderLength+1+md5.Size {
+		return nil, ErrInvalidVerificationURL
+	}
+
+	content, hash := payload[:len(payload)-md5.Size], payload[len(payload)-md5.Size:]
+	if sum := md5.Sum(content); !bytes.Equal(sum[:], hash) {
+		return nil, ErrInvalidVerificationURL
+	}
+
+	requestedBy, signedBy := string(payload[1:9]), string(payload[9:17])
+	totalCounter := binary.LittleEndian.Uint32(payload[17:21])
+	total := binary.LittleEndian.Uint64(payload[25:33])
+	issuedAt := int64(binary.BigEndian.Uint64(payload[33:41]))
+
+	verification := Verification{
+		InvoiceNumber:   fmt.Sprintf("%s-%s-%d", requestedBy, signedBy, totalCounter),
+		InvoiceType:     InvoiceType(payload[41]),
+		TransactionType: TransactionType(payload[42]),
+		IssuedAt:        time.Unix(issuedAt/1000, issuedAt%1000*int64(time.Millisecond)).In(timeZone),
+		// Amounts are rounded to hundredths like on the receipt
+		Total: int64((total + 50) / 100),
+	}
+
+	return &verification, nil
+}
+
+// decodeVerificationPayload decodes the payload of a verification URL. It's
+// standard base64 but plus signs are often decoded as spaces when the URL is
+// copied.
+func decodeVerificationPayload(payload string) ([]byte, error) {
+	payload = strings.Replace(payload, " ", "+", -1)
+	if decoded, err := base64.StdEncoding.DecodeString(payload); err == nil {
+		return decoded, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/handlers/fiscal"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// fiscalCurrency is the currency of fiscal receipts
+const fiscalCurrency = "RSD"
+
+// ErrNoFiscalReceipt is returned when neither a verification URL nor a journal
+// is sent
+var ErrNoFiscalReceipt = errors.New("verification url or journal must be specified")
+
+// ErrFiscalMismatch is returned when the verification URL and the journal are
+// not of the same receipt
+var ErrFiscalMismatch = errors.New("verification url and journal are not of the same receipt")
+
+// ErrFiscalNotSale is returned when the fiscal receipt is not a normal sale.
+// Copies, pro forma and training receipts are not purchases and refunds are
+// added to the original receipt.
+var ErrFiscalNotSale = errors.New("only normal sale receipts can be imported")
+
+// ErrFiscalTotal is returned when lines of a journal don't add up to its total
+var ErrFiscalTotal = errors.New("lines of the journal don't add up to the total")
+
+// ErrFiscalLocationRequired is returned when a receipt is imported from a
+// verification URL without a location. The URL doesn't contain the store.
+var ErrFiscalLocationRequired = errors.New("location id must be specified when importing only a verification url")
+
+// errFiscalItemDeleted is returned when an item of a fiscal receipt is in the
+// trash
+var errFiscalItemDeleted = errors.New("item with the same name is in the trash")
+
+// FiscalImportPostBody : Structure that should be used for getting json from body of a post request for importing fiscal receipts
+type FiscalImportPostBody struct {
+	// URL is the verification URL from the QR code of the receipt
+	URL string `json:"url"`
+	// Journal is the text of the receipt as it's printed or shown on the
+	// verification page
+	Journal string `json:"journal"`
+	// LocationID is the location of the receipt, it's matched or created
+	// from the journal if it's not specified
+	LocationID  string `json:"locationId"`
+	HouseholdID string `json:"householdId"`
+}
+
+// FiscalImport : Structure that should be used for sending the result of an import of a fiscal receipt
+type FiscalImport struct {
+	ID         string `json:"id"`
+	LocationID string `json:"locationId"`
+	FiscalID   string `json:"fiscalId"`
+	// Total is the total of the fiscal receipt. Receipts imported only from a
+	// verification URL have no lines so the total is only reported.
+	Total       Money    `json:"total"`
+	Lines       int      `json:"lines"`
+	NewLocation bool     `json:"newLocation"`
+	NewItems    []string `json:"newItems"`
+	// UnknownUnits are new items whose unit on the receipt is not in the
+	// unit registry so they are counted in pieces
+	UnknownUnits []FiscalUnknownUnit `json:"unknownUnits"`
+}
+
+// FiscalUnknownUnit : Structure that should be used for sending a new item of a fiscal receipt whose unit is not in the unit registry
+type FiscalUnknownUnit struct {
+	ItemID string `json:"itemId"`
+	Name   string `json:"name"`
+	Unit   string `json:"unit"`
+}
+
+// fiscalImportErrorStatus gets the HTTP status code for errors of fiscal
+// imports
+func fiscalImportErrorStatus(err error) int {
+	switch err {
+	case ErrNoFiscalReceipt, ErrFiscalMismatch, ErrFiscalNotSale, ErrFiscalTotal, ErrFiscalLocationRequired, fiscal.ErrInvalidJournal, fiscal.ErrInvalidVerificationURL:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// parseFiscalImport parses the journal and the verification URL of a fiscal
+// receipt. The receipt has no lines if there is no journal.
+func parseFiscalImport(data FiscalImportPostBody) (*fiscal.Receipt, error) {
+	if strings.TrimSpace(data.URL) == "" && strings.TrimSpace(data.Journal) == "" {
+		return nil, ErrNoFiscalReceipt
+	}
+
+	var receipt *fiscal.Receipt
+	if strings.TrimSpace(data.Journal) != "" {
+		journal, err := fiscal.ParseJournal(data.Journal)
+		if err != nil {
+			return nil, err
+		}
+		receipt = journal
+	}
+
+	if strings.TrimSpace(data.URL) != "" {
+		verification, err := fiscal.ParseVerificationURL(data.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		if receipt == nil {
+			receipt = &fiscal.Receipt{
+				InvoiceNumber:   verification.InvoiceNumber,
+				InvoiceType:     verification.InvoiceType,
+				TransactionType: verification.TransactionType,
+				IssuedAt:        verification.IssuedAt,
+				Total:           verification.Total,
+			}
+		} else if receipt.InvoiceNumber != verification.InvoiceNumber || receipt.Total != verification.Total {
+			return nil, ErrFiscalMismatch
+		}
+	}
+
+	if receipt.InvoiceType != fiscal.Normal || receipt.TransactionType != fiscal.Sale {
+		return nil, ErrFiscalNotSale
+	}
+
+	if len(receipt.Lines) != 0 {
+		var total Money
+		for _, line := range receipt.Lines {
+			total += Money(line.Price).Multiply(line.Quantity)
+		}
+		if int64(total) != receipt.Total {
+			return nil, ErrFiscalTotal
+		}
+	}
+
+	return receipt, nil
+}
+
+// fiscalLocationName gets the name of a location of a fiscal receipt. Point of
+// sale is the name of the store while the company can have many stores.
+func fiscalLocationName(receipt *fiscal.Receipt) string {
+	if receipt.PointOfSale != "" {
+		return receipt.PointOfSale
+	}
+	return receipt.Company
+}
+
+// fiscalLocationAddress gets the address of a location of a fiscal receipt
+func fiscalLocationAddress(receipt *fiscal.Receipt) string {
+	if receipt.Municipality == "" {
+		return receipt.Address
+	}
+	return receipt.Address + ", " + receipt.Municipality
+}
+
+// matchFiscalLocation finds the location of a fiscal receipt in the household
+// by the tax id of the company and the address or by its name and address. A
+// location matched by name gets the tax id if it doesn't have one. Location is
+// created if there is no match. It returns the id, the public id of the
+// location and whether it was created.
+func matchFiscalLocation(tx *sqlx.Tx, userID int, householdID int, receipt *fiscal.Receipt) (int, string, bool, error) {
+	name, address := fiscalLocationName(receipt), fiscalLocationAddress(receipt)
+
+	location := struct {
+		ID       int     `db:"id"`
+		PublicID string  `db:"public_id"`
+		TaxID    *string `db:"tax_id"`
+	}{}
+	err := tx.Get(&location, "SELECT id, public_id, tax_id FROM locations WHERE household_id = ? AND deleted_at IS NULL AND address = ? AND (tax_id = ? OR name = ?) ORDER BY tax_id = ? DESC LIMIT 1", householdID, address, receipt.TaxID, name, receipt.TaxID)
+	switch {
+	case err == nil:
+		if location.TaxID == nil {
+			if _, err := tx.Exec("UPDATE locations SET tax_id = ?, updated_at = ? WHERE id = ?", receipt.TaxID, time.Now(), location.ID); err != nil {
+				return 0, "", false, err
+			}
+		}
+		return location.ID, location.PublicID, false, nil
+	case err != sql.ErrNoRows:
+		return 0, "", false, err
+	}
+
+	// Stores of different companies can have the same name so the company is
+	// added to the name of the new location
+	var taken int
+	if err := tx.Get(&taken, "SELECT COUNT(*) FROM locations WHERE household_id = ? AND name = ?", householdID, name); err != nil {
+		return 0, "", false, err
+	}
+	if taken != 0 && receipt.Company != "" && receipt.Company != name {
+		name = name + " (" + receipt.Company + ")"
+	}
+
+	uuid, err := nanoid.Nanoid()
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	result, err := tx.Exec("INSERT INTO locations (public_id, name, address, tax_id, created_by, household_id) VALUES (?, ?, ?, ?, ?, ?)", uuid, name, address, receipt.TaxID, userID, householdID)
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	return int(id), uuid, true, nil
+}
+
+// matchFiscalItem finds an item of a fiscal receipt in the household by its
+// name or creates it with the price and the unit from the receipt. It returns
+// the id of the item and its public id if it was created. Items in the trash
+// are not used, they have to be restored first.
+func matchFiscalItem(tx *sqlx.Tx, userID int, householdID int, line fiscal.Line) (int, string, error) {
+	item := struct {
+		ID        int        `db:"id"`
+		PublicID  string     `db:"public_id"`
+		DeletedAt *time.Time `db:"deleted_at"`
+	}{}
+	err := tx.Get(&item, "SELECT id, public_id, deleted_at FROM items WHERE household_id = ? AND name = ?", householdID, line.Name)
+	switch {
+	case err == nil && item.DeletedAt != nil:
+		return 0, item.PublicID, errFiscalItemDeleted
+	case err == nil:
+		return item.ID, "", nil
+	case err != sql.ErrNoRows:
+		return 0, "", err
+	}
+
+	// Units that are not in the unit registry are counted in pieces and
+	// reported in the result of the import
+	unit := defaultItemUnit
+	if registered, ok := LookupUnit(line.Unit); ok {
+		unit = registered.Name
+	}
+
+	uuid, err := nanoid.Nanoid()
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := tx.Exec("INSERT INTO items (public_id, created_by, household_id, name, price, unit) VALUES (?, ?, ?, ?, ?, ?)", uuid, userID, householdID, line.Name, line.Price, unit)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return int(id), uuid, nil
+}
+
+// PostFiscalImport is a Gin handler function for importing a receipt issued
+// through the Serbian e-fiscalization system from the verification URL in its
+// QR code or the text of its journal. Location, items and the receipt are
+// matched or created in one transaction.
+func (o Options) PostFiscalImport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var importData FiscalImportPostBody
+		if err := ctx.ShouldBindJSON(&importData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receipt, err := parseFiscalImport(importData)
+		if err != nil {
+			ctx.JSON(fiscalImportErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if len(receipt.Lines) == 0 && importData.LocationID == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": ErrFiscalLocationRequired.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Receipt is stored in the household of its location if the location
+		// is specified
+		location := struct {
+			ID          int    `db:"id"`
+			PublicID    string `db:"public_id"`
+			HouseholdID int    `db:"household_id"`
+		}{}
+		if importData.LocationID != "" {
+			locationQuery := sq.Select("id, public_id, household_id").From("locations").Where(sq.Eq{"public_id": importData.LocationID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+			locationQueryString, locationQueryStringArgs, err := locationQuery.ToSql()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if err := o.DB.Get(&location, locationQueryString, locationQueryStringArgs...); err != nil {
+				switch err {
+				case sql.ErrNoRows:
+					ctx.JSON(http.StatusUnauthorized, gin.H{
+						"message": "not authorized to add receipts to specified location",
+					})
+					break
+				default:
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+				}
+				return
+			}
+		} else {
+			household, err := WritableHouseholdID(o.DB, user.ID, importData.HouseholdID)
+			if err != nil {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to add receipts to specified household",
+				})
+				return
+			}
+			location.HouseholdID = household.ID
+		}
+
+		// Receipts in the trash are matched too since they can be restored
+		var duplicate StructPublicID
+		if err := o.DB.Get(&duplicate, "SELECT public_id FROM receipts WHERE household_id = ? AND fiscal_id = ?", location.HouseholdID, receipt.InvoiceNumber); err != sql.ErrNoRows {
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "receipt with the same fiscal id already exists",
+				"id":      duplicate.PublicID,
+			})
+			return
+		}
+
+		// Rates from the journal are used since they are the rates the receipt
+		// was issued with. Labels missing from the table of taxes use rates of
+		// the household.
+		rates := map[string]Percentage{}
+		for _, tax := range receipt.Taxes {
+			rates[tax.Label] = Percentage(tax.Rate)
+		}
+		for _, line := range receipt.Lines {
+			if _, ok := rates[line.TaxLabel]; ok {
+				continue
+			}
+
+			rate, err := resolveTaxRate(o.DB, location.HouseholdID, line.TaxLabel)
+			if err != nil {
+				ctx.JSON(taxRateErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			rates[line.TaxLabel] = rate
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		imported := FiscalImport{
+			ID:           uuid,
+			FiscalID:     receipt.InvoiceNumber,
+			Total:        Money(receipt.Total),
+			Lines:        len(receipt.Lines),
+			NewItems:     []string{},
+			UnknownUnits: []FiscalUnknownUnit{},
+		}
+
+		if location.PublicID == "" {
+			location.ID, location.PublicID, imported.NewLocation, err = matchFiscalLocation(tx, user.ID, location.HouseholdID, receipt)
+			if err != nil {
+				tx.Rollback()
+				if isUniqueConstraintError(err) {
+					ctx.JSON(http.StatusConflict, gin.H{
+						"message": "location with the same name already exists",
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+		imported.LocationID = location.PublicID
+
+		now := time.Now()
+		result, err := tx.Exec("INSERT INTO receipts (public_id, location_id, household_id, created_by, currency, purchased_at, time_zone, fiscal_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, location.ID, location.HouseholdID, user.ID, fiscalCurrency, receipt.IssuedAt.UTC(), fiscal.TimeZoneName, receipt.InvoiceNumber, now, now)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receiptID, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, line := range receipt.Lines {
+			itemID, itemPublicID, err := matchFiscalItem(tx, user.ID, location.HouseholdID, line)
+			if err != nil {
+				tx.Rollback()
+				if err == errFiscalItemDeleted {
+					ctx.JSON(http.StatusConflict, gin.H{
+						"message": err.Error(),
+						"id":      itemPublicID,
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			if itemPublicID != "" {
+				imported.NewItems = append(imported.NewItems, itemPublicID)
+				if _, ok := LookupUnit(line.Unit); !ok && strings.TrimSpace(line.Unit) != "" {
+					imported.UnknownUnits = append(imported.UnknownUnits, FiscalUnknownUnit{
+						ItemID: itemPublicID,
+						Name:   line.Name,
+						Unit:   line.Unit,
+					})
+				}
+			}
+
+			lineUUID, err := nanoid.Nanoid()
+			if err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if _, err := tx.Exec("INSERT INTO items_in_receipt (public_id, receipt_id, item_id, price, amount, tax_label, tax_rate) VALUES (?, ?, ?, ?, ?, ?, ?)", lineUUID, receiptID, itemID, line.Price, line.Quantity, line.TaxLabel, rates[line.TaxLabel]); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		o.checkBudgets(imported.ID)
+
+		ctx.JSON(http.StatusOK, imported)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dusansimic/receipts-archive-backend/handlers/fiscal"
+)
+
+func TestMatchFiscalItemUnits(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	tests := []struct {
+		line fiscal.Line
+		unit string
+	}{
+		{fiscal.Line{Name: "Banane", Unit: "KG", Price: 14999}, "kg"},
+		{fiscal.Line{Name: "Mleko", Unit: "KOM", Price: 12999}, "kom"},
+		{fiscal.Line{Name: "Sok", Unit: "L", Price: 14999}, "l"},
+		// Units that are not in the registry are counted in pieces and
+		// reported by PostFiscalImport
+		{fiscal.Line{Name: "Jaja", Unit: "PAK", Price: 29999}, defaultItemUnit},
+		{fiscal.Line{Name: "Hleb", Price: 6499}, defaultItemUnit},
+	}
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	for _, test := range tests {
+		id, _, err := matchFiscalItem(tx, household.UserID, household.HouseholdID, test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var unit string
+		if err := tx.Get(&unit, "SELECT unit FROM items WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+		if unit != test.unit {
+			t.Errorf("%s in %q got unit %q, want %q", test.line.Name, test.line.Unit, unit, test.unit)
+		}
+	}
+}
+
+func TestPostFiscalImport(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	other := newTestHousehold(t, db, "other")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	journal, err := ioutil.ReadFile(filepath.Join("fiscal", "testdata", "journals", "sale.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Coffee is sold in a unit that is not in the unit registry
+	body, err := json.Marshal(FiscalImportPostBody{Journal: strings.Replace(string(journal), "Moment 500g/KOM", "Moment 500g/PAK", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Location is matched by the tax id and the address even if it was
+	// renamed
+	db.MustExec("INSERT INTO locations (created_by, household_id, public_id, name, address, tax_id) VALUES (?, ?, 'maxi', 'Maxi Liman', 'Булевар ослобођења 101, Нови Сад', '100002092')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko 2,8% m.m. 1l', 11999, 'kom')", household.UserID, household.HouseholdID)
+
+	recorder := serve(options.PostFiscalImport(), "/receipts/import/fiscal", "user", http.MethodPost, "/receipts/import/fiscal", string(body))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	imported := FiscalImport{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if imported.LocationID != "maxi" || imported.NewLocation || imported.Lines != 3 || len(imported.NewItems) != 2 || imported.Total != 142496 {
+		t.Errorf("import is %+v, want 3 lines at maxi with 2 new items", imported)
+	}
+	var coffee string
+	if err := db.Get(&coffee, "SELECT public_id FROM items WHERE name = 'Kafa Doncafe Moment 500g' AND unit = ?", defaultItemUnit); err != nil {
+		t.Fatal(err)
+	}
+	if want := []FiscalUnknownUnit{{ItemID: coffee, Name: "Kafa Doncafe Moment 500g", Unit: "PAK"}}; !reflect.DeepEqual(imported.UnknownUnits, want) {
+		t.Errorf("got unknown units %+v, want %+v", imported.UnknownUnits, want)
+	}
+
+	// Lines keep prices and rates of the receipt, existing items keep theirs
+	lines := []struct {
+		Item  string     `db:"item"`
+		Price Money      `db:"price"`
+		Label string     `db:"tax_label"`
+		Rate  Percentage `db:"tax_rate"`
+	}{}
+	if err := db.Select(&lines, "SELECT items.public_id AS item, items_in_receipt.price, items_in_receipt.tax_label, items_in_receipt.tax_rate FROM items_in_receipt JOIN items ON items.id = items_in_receipt.item_id JOIN receipts ON receipts.id = items_in_receipt.receipt_id WHERE receipts.public_id = ? ORDER BY items_in_receipt.id", imported.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[0].Item != "milk" || lines[0].Price != 12999 || lines[0].Label != "Ђ" || lines[0].Rate != 2000 || lines[1].Label != "Е" || lines[1].Rate != 1000 {
+		t.Errorf("lines are %+v", lines)
+	}
+	var itemPrice Money
+	if err := db.Get(&itemPrice, "SELECT price FROM items WHERE public_id = 'milk'"); err != nil {
+		t.Fatal(err)
+	}
+	if itemPrice != 11999 {
+		t.Errorf("price of the existing item is %d, want 11999", itemPrice)
+	}
+
+	recorder = serve(options.PostFiscalImport(), "/receipts/import/fiscal", "user", http.MethodPost, "/receipts/import/fiscal", string(body))
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), imported.ID) {
+		t.Errorf("importing the receipt again: got %d %s, want %d with id %s", recorder.Code, recorder.Body, http.StatusConflict, imported.ID)
+	}
+
+	// The second line is an item in the trash so nothing of the receipt is
+	// stored, not even items of lines before it
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit, deleted_at) VALUES (?, ?, 'trashed-bread', 'Hleb beli 500g', 6499, 'kom', current_timestamp)", other.UserID, other.HouseholdID)
+	recorder = serve(options.PostFiscalImport(), "/receipts/import/fiscal", "other", http.MethodPost, "/receipts/import/fiscal", string(body))
+	if recorder.Code != http.StatusConflict || !strings.Contains(recorder.Body.String(), "trashed-bread") {
+		t.Errorf("importing with an item in the trash: got %d %s, want %d with id trashed-bread", recorder.Code, recorder.Body, http.StatusConflict)
+	}
+
+	var records int
+	if err := db.Get(&records, "SELECT (SELECT COUNT(*) FROM receipts WHERE household_id = ?) + (SELECT COUNT(*) FROM items WHERE household_id = ?) + (SELECT COUNT(*) FROM locations WHERE household_id = ?)", other.HouseholdID, other.HouseholdID, other.HouseholdID); err != nil {
+		t.Fatal(err)
+	}
+	if records != 2 {
+		t.Errorf("other household has %d records after a failed import, want its location and the trashed item", records)
+	}
+}
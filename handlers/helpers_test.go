@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// newTestDB creates a database with the current schema in a temporary
+// directory that is removed when the test ends
+func newTestDB(t *testing.T) *sqlx.DB {
+	dir, err := ioutil.TempDir("", "receipts-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	db, err := database.SQLOptions{
+		DatabasePath: filepath.Join(dir, "database.db"),
+	}.GenerateDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+// insertID executes an insert and gets the id of the inserted row
+func insertID(t *testing.T, db *sqlx.DB, query string, args ...interface{}) int64 {
+	id, err := db.MustExec(query, args...).LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testHousehold is a user with a household and a location for receipts
+type testHousehold struct {
+	UserID      int
+	HouseholdID int
+	LocationID  int
+}
+
+// newTestHousehold creates a user with the public id and a household with
+// a location
+func newTestHousehold(t *testing.T, db *sqlx.DB, publicID string) testHousehold {
+	result := db.MustExec("INSERT INTO users (public_id, real_name) VALUES (?, ?)", publicID, publicID)
+	userID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.MustBegin()
+	householdID, err := database.CreateHousehold(tx, int(userID), publicID)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	result = db.MustExec("INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (?, ?, ?, 'Maxi', 'Bulevar 1')", userID, householdID, publicID+"-location")
+	locationID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testHousehold{
+		UserID:      int(userID),
+		HouseholdID: int(householdID),
+		LocationID:  int(locationID),
+	}
+}
+
+// serve sends a request with the json body to the handler registered on the
+// route as if the user was logged in
+func serve(handler gin.HandlerFunc, route string, userID string, method string, path string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Handle(method, route, func(ctx *gin.Context) {
+		ctx.Set("userID", userID)
+	}, handler)
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// sessionRouter serves handlers behind AuthRequired with sessions stored in
+// cookies. Logging in is done with GET /login?id= and the returned cookies
+// are sent with later requests.
+type sessionRouter struct {
+	router  *gin.Engine
+	options Options
+}
+
+// newSessionRouter creates a router with the login route
+func newSessionRouter(options Options) sessionRouter {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(sessions.Sessions("auth_session", cookie.NewStore([]byte("secret"))))
+	router.GET("/login", func(ctx *gin.Context) {
+		if err := options.CreateSessionID(ctx, StructPublicID{PublicID: ctx.Query("id")}); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+	})
+
+	return sessionRouter{router, options}
+}
+
+// handle registers the handler on the route behind AuthRequired
+func (r sessionRouter) handle(method string, route string, handler gin.HandlerFunc) {
+	r.router.Handle(method, route, r.options.AuthRequired(), handler)
+}
+
+// login creates a session of the user and returns its cookies
+func (r sessionRouter) login(t *testing.T, publicID string) []*http.Cookie {
+	recorder := r.serve(http.MethodGet, "/login?id="+publicID, "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("logging in: got %d %s", recorder.Code, recorder.Body)
+	}
+	return recorder.Result().Cookies()
+}
+
+// serve sends a request with the json body and the cookies of a session
+func (r sessionRouter) serve(method string, path string, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		request.AddCookie(c)
+	}
+
+	recorder := httptest.NewRecorder()
+	r.router.ServeHTTP(recorder, request)
+	return recorder
+}
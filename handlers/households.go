@@ -0,0 +1,962 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Roles of household members. Owners can manage the household and its
+// members, members can add and change records and viewers can only read them.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// WriteRoles are roles of household members that are allowed to add, change
+// and delete records of a household.
+var WriteRoles = []string{RoleOwner, RoleMember}
+
+// invitationExpiration is the time after which an invitation can't be accepted
+const invitationExpiration = 7 * 24 * time.Hour
+
+// HouseholdsPostBody : Structure that should be used for getting json from body of a post request for households
+type HouseholdsPostBody struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// HouseholdsPutBody : Structure that should be used for getting json from body of a put request for households
+type HouseholdsPutBody struct {
+	PublicID string `json:"id" validate:"required"`
+	Name     string `json:"name"`
+}
+
+// HouseholdsDeleteBody : Structure that should be used for getting json data from body of a delete request for households
+type HouseholdsDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// HouseholdMembersPutBody : Structure that should be used for getting json from body of a put request for household members
+type HouseholdMembersPutBody struct {
+	UserID string `json:"userId" validate:"required"`
+	Role   string `json:"role" validate:"required,oneof=owner member viewer"`
+}
+
+// HouseholdMembersDeleteBody : Structure that should be used for getting json data from body of a delete request for household members
+type HouseholdMembersDeleteBody struct {
+	UserID string `json:"userId" validate:"required"`
+}
+
+// HouseholdInvitationsPostBody : Structure that should be used for getting json from body of a post request for household invitations
+type HouseholdInvitationsPostBody struct {
+	Role string `json:"role" validate:"required,oneof=owner member viewer"`
+}
+
+// Household : Structure that should be used for getting household information from database
+type Household struct {
+	PublicID  string    `db:"public_id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Role      string    `db:"role" json:"role"`
+	CreatedBy string    `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// HouseholdMember : Structure that should be used for getting household member information from database
+type HouseholdMember struct {
+	UserID   string    `db:"user_id" json:"userId"`
+	RealName string    `db:"real_name" json:"realName"`
+	Role     string    `db:"role" json:"role"`
+	JoinedAt time.Time `db:"created_at" json:"joinedAt"`
+}
+
+// HouseholdInvitation : Structure that should be used for getting household invitation information from database
+type HouseholdInvitation struct {
+	PublicID   string     `db:"public_id" json:"id"`
+	Role       string     `db:"role" json:"role"`
+	InvitedBy  string     `db:"invited_by" json:"invitedBy"`
+	AcceptedBy *string    `db:"accepted_by" json:"acceptedBy"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expiresAt"`
+	AcceptedAt *time.Time `db:"accepted_at" json:"acceptedAt"`
+}
+
+type memberOf struct {
+	column string
+	userID int
+	roles  []string
+}
+
+func (m memberOf) ToSql() (string, []interface{}, error) {
+	query := sq.Select("household_id").From("household_members").Where(sq.Eq{"user_id": m.userID})
+	if len(m.roles) > 0 {
+		query = query.Where(sq.Eq{"role": m.roles})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return m.column + " IN (" + queryString + ")", queryStringArgs, nil
+}
+
+// MemberOf creates a condition that limits rows to the ones whose household
+// column references a household the user is a member of. If roles are
+// specified, user has to have one of them in the household.
+func MemberOf(column string, userID int, roles ...string) sq.Sqlizer {
+	return memberOf{
+		column: column,
+		userID: userID,
+		roles:  roles,
+	}
+}
+
+// WritableHouseholdID gets the database entry id of a household the user is
+// allowed to add records to. If household public id is not specified, the
+// household the user joined first (personal household) is used.
+func WritableHouseholdID(db *sqlx.DB, userID int, householdPublicID string) (StructID, error) {
+	query := sq.Select("households.id").From("households").Join("household_members ON household_members.household_id = households.id").Where(sq.Eq{"household_members.user_id": userID, "household_members.role": WriteRoles}).OrderBy("household_members.id").Limit(1)
+
+	if householdPublicID != "" {
+		query = query.Where(sq.Eq{"households.public_id": householdPublicID})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return StructID{}, err
+	}
+
+	household := StructID{}
+	if err := db.Get(&household, queryString, queryStringArgs...); err != nil {
+		return StructID{}, err
+	}
+
+	return household, nil
+}
+
+// householdRole gets the database entry id of a household and the role the user
+// has in it.
+func householdRole(db *sqlx.DB, userID int, householdPublicID string) (int, string, error) {
+	query := sq.Select("households.id, household_members.role").From("households").Join("household_members ON household_members.household_id = households.id").Where(sq.Eq{"households.public_id": householdPublicID, "household_members.user_id": userID})
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return 0, "", err
+	}
+
+	var household struct {
+		ID   int    `db:"id"`
+		Role string `db:"role"`
+	}
+	if err := db.Get(&household, queryString, queryStringArgs...); err != nil {
+		return 0, "", err
+	}
+
+	return household.ID, household.Role, nil
+}
+
+// householdMember gets the database entry id of a member of a household by
+// the public id of the user. It returns sql.ErrNoRows if the user is not a
+// member.
+func householdMember(db *sqlx.DB, householdID int, userPublicID string) (int, error) {
+	query := sq.Select("users.id").From("household_members").Join("users ON users.id = household_members.user_id").Where(sq.Eq{"household_members.household_id": householdID, "users.public_id": userPublicID})
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var memberID int
+	if err := db.Get(&memberID, queryString, queryStringArgs...); err != nil {
+		return 0, err
+	}
+
+	return memberID, nil
+}
+
+// GetHouseholds is a Gin handler function for getting households the user is
+// a member of.
+func (o Options) GetHouseholds() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("households.public_id, households.name, household_members.role, users.public_id AS created_by, households.created_at, households.updated_at").From("households").Join("household_members ON household_members.household_id = households.id").Join("users ON users.id = households.created_by").Where(sq.Eq{"household_members.user_id": user.ID}).OrderBy("household_members.id")
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		households := []Household{}
+		if err := o.DB.Select(&households, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, households)
+	}
+}
+
+// PostHouseholds is a Gin handler function for creating a household. The user
+// creating the household becomes its owner.
+func (o Options) PostHouseholds() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var householdData HouseholdsPostBody
+		if err := ctx.ShouldBindJSON(&householdData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(householdData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := database.CreateHousehold(tx, user.ID, householdData.Name); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// PutHouseholds is a Gin handler function for renaming a household.
+func (o Options) PutHouseholds() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var householdData HouseholdsPutBody
+		if err := ctx.ShouldBindJSON(&householdData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(householdData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, householdData.PublicID)
+		if err != nil || role != RoleOwner {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to edit specified household",
+			})
+			return
+		}
+
+		query := sq.Update("households")
+
+		if householdData.Name != "" {
+			query = query.Set("name", householdData.Name)
+		}
+
+		query = query.Set("updated_at", time.Now())
+
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"id": householdID}).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteHouseholds is a Gin handler function for deleting a household. Only
+// empty households can be deleted so no records are lost by accident.
+func (o Options) DeleteHouseholds() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var householdData HouseholdsDeleteBody
+		if err := ctx.ShouldBindJSON(&householdData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(householdData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, householdData.PublicID)
+		if err != nil || role != RoleOwner {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to delete specified household",
+			})
+			return
+		}
+
+		var records int
+		if err := o.DB.Get(&records, "SELECT (SELECT COUNT(*) FROM locations WHERE household_id = ? AND deleted_at IS NULL) + (SELECT COUNT(*) FROM items WHERE household_id = ? AND deleted_at IS NULL) + (SELECT COUNT(*) FROM receipts WHERE household_id = ? AND deleted_at IS NULL)", householdID, householdID, householdID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if records != 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "household still has locations, items or receipts",
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Records in the trash are deleted with the household
+		if err := deleteHousehold(tx, householdID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// GetHouseholdMembers is a Gin handler function for getting members of a
+// household.
+func (o Options) GetHouseholdMembers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, _, err := householdRole(o.DB, user.ID, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to view specified household",
+			})
+			return
+		}
+
+		query := sq.Select("users.public_id AS user_id, users.real_name, household_members.role, household_members.created_at").From("household_members").Join("users ON users.id = household_members.user_id").Where(sq.Eq{"household_members.household_id": householdID}).OrderBy("household_members.id")
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		members := []HouseholdMember{}
+		if err := o.DB.Select(&members, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, members)
+	}
+}
+
+// PutHouseholdMembers is a Gin handler function for changing the role of a
+// household member.
+func (o Options) PutHouseholdMembers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var memberData HouseholdMembersPutBody
+		if err := ctx.ShouldBindJSON(&memberData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(memberData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, ctx.Param("id"))
+		if err != nil || role != RoleOwner {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to manage members of specified household",
+			})
+			return
+		}
+
+		memberID, err := householdMember(o.DB, householdID, memberData.UserID)
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "user is not a member of specified household",
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if memberData.Role != RoleOwner {
+			owners, err := o.otherOwners(householdID, memberID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if owners == 0 {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "household must have at least one owner",
+				})
+				return
+			}
+		}
+
+		query := sq.Update("household_members").Set("role", memberData.Role).Where(sq.Eq{"household_id": householdID, "user_id": memberID})
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Member could have left the household in the meantime
+		if updated, err := result.RowsAffected(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		} else if updated == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "user is not a member of specified household",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteHouseholdMembers is a Gin handler function for removing a member from
+// a household. Owners can remove anyone and other members can only leave the
+// household.
+func (o Options) DeleteHouseholdMembers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var memberData HouseholdMembersDeleteBody
+		if err := ctx.ShouldBindJSON(&memberData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(memberData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, ctx.Param("id"))
+		if err != nil || (role != RoleOwner && memberData.UserID != createdBy.PublicID) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to remove specified member",
+			})
+			return
+		}
+
+		memberID, err := householdMember(o.DB, householdID, memberData.UserID)
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "user is not a member of specified household",
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		owners, err := o.otherOwners(householdID, memberID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if owners == 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "household must have at least one owner",
+			})
+			return
+		}
+
+		query := sq.Delete("household_members").Where(sq.Eq{"household_id": householdID, "user_id": memberID})
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// otherOwners counts owners of a household other than the specified user.
+func (o Options) otherOwners(householdID, userID int) (int, error) {
+	query := sq.Select("COUNT(*)").From("household_members").Where(sq.Eq{"household_id": householdID, "role": RoleOwner}).Where(sq.NotEq{"user_id": userID})
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var owners int
+	if err := o.DB.Get(&owners, queryString, queryStringArgs...); err != nil {
+		return 0, err
+	}
+
+	return owners, nil
+}
+
+// GetHouseholdInvitations is a Gin handler function for getting invitations
+// to a household.
+func (o Options) GetHouseholdInvitations() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, ctx.Param("id"))
+		if err != nil || role != RoleOwner {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to manage members of specified household",
+			})
+			return
+		}
+
+		query := sq.Select("household_invitations.public_id, household_invitations.role, inviters.public_id AS invited_by, accepters.public_id AS accepted_by, household_invitations.created_at, household_invitations.expires_at, household_invitations.accepted_at").From("household_invitations").Join("users inviters ON inviters.id = household_invitations.invited_by").LeftJoin("users accepters ON accepters.id = household_invitations.accepted_by").Where(sq.Eq{"household_invitations.household_id": householdID})
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		invitations := []HouseholdInvitation{}
+		if err := o.DB.Select(&invitations, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, invitations)
+	}
+}
+
+// PostHouseholdInvitations is a Gin handler function for inviting users to a
+// household. It responds with an invitation id which the invited user can use
+// to join the household.
+func (o Options) PostHouseholdInvitations() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var invitationData HouseholdInvitationsPostBody
+		if err := ctx.ShouldBindJSON(&invitationData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(invitationData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		householdID, role, err := householdRole(o.DB, user.ID, ctx.Param("id"))
+		if err != nil || role != RoleOwner {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to manage members of specified household",
+			})
+			return
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Times are stored as text and compared as text so they are stored in
+		// UTC like other timestamps
+		createdAt := time.Now().UTC()
+		expiresAt := createdAt.Add(invitationExpiration)
+
+		query := sq.Insert("household_invitations").Columns("public_id", "household_id", "role", "invited_by", "created_at", "expires_at").Values(uuid, householdID, invitationData.Role, user.ID, createdAt, expiresAt)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, HouseholdInvitation{
+			PublicID:  uuid,
+			Role:      invitationData.Role,
+			InvitedBy: createdBy.PublicID,
+			CreatedAt: createdAt,
+			ExpiresAt: expiresAt,
+		})
+	}
+}
+
+// AcceptHouseholdInvitation is a Gin handler function for joining a household
+// using an invitation.
+func (o Options) AcceptHouseholdInvitation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		invitationQuery := sq.Select("id, household_id, role").From("household_invitations").Where(sq.Eq{"public_id": ctx.Param("id"), "accepted_at": nil}).Where(sq.Gt{"expires_at": time.Now().UTC()})
+
+		invitationQueryString, invitationQueryStringArgs, err := invitationQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var invitation struct {
+			ID          int    `db:"id"`
+			HouseholdID int    `db:"household_id"`
+			Role        string `db:"role"`
+		}
+		if err := o.DB.Get(&invitation, invitationQueryString, invitationQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"message": "invitation does not exist or has expired",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		tx, err := o.DB.Begin()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Members can't accept invitations since the role of the invitation
+		// could demote the last owner. Roles are changed by owners instead.
+		if _, err := tx.Exec("INSERT INTO household_members (household_id, user_id, role) VALUES (?, ?, ?)", invitation.HouseholdID, user.ID, invitation.Role); err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "user is already a member of specified household",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// The invitation is checked again since it could have been accepted by
+		// someone else after it was read.
+		result, err := tx.Exec("UPDATE household_invitations SET accepted_by = ?, accepted_at = ? WHERE id = ? AND accepted_at IS NULL", user.ID, time.Now().UTC(), invitation.ID)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if accepted, err := result.RowsAffected(); err != nil || accepted != 1 {
+			tx.Rollback()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "invitation has already been accepted",
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
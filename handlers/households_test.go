@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/jmoiron/sqlx"
+)
+
+// householdPublicID gets the public id of a household
+func householdPublicID(t *testing.T, db *sqlx.DB, householdID int) string {
+	var publicID string
+	if err := db.Get(&publicID, "SELECT public_id FROM households WHERE id = ?", householdID); err != nil {
+		t.Fatal(err)
+	}
+	return publicID
+}
+
+func TestHouseholdMembers(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "owner")
+	newTestHousehold(t, db, "stranger")
+	options := Options{
+		DB: db,
+		V:  validator.New(),
+	}
+	id := householdPublicID(t, db, household.HouseholdID)
+	path := "/households/" + id + "/members"
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"change role of unknown user", http.MethodPut, `{"userId": "unknown", "role": "member"}`, http.StatusNotFound},
+		{"change role of user that is not a member", http.MethodPut, `{"userId": "stranger", "role": "member"}`, http.StatusNotFound},
+		{"remove unknown user", http.MethodDelete, `{"userId": "unknown"}`, http.StatusNotFound},
+		{"demote last owner", http.MethodPut, `{"userId": "owner", "role": "member"}`, http.StatusConflict},
+		{"remove last owner", http.MethodDelete, `{"userId": "owner"}`, http.StatusConflict},
+	}
+	for _, test := range tests {
+		handler := options.PutHouseholdMembers()
+		if test.method == http.MethodDelete {
+			handler = options.DeleteHouseholdMembers()
+		}
+		if recorder := serve(handler, "/households/:id/members", "owner", test.method, path, test.body); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.name, recorder.Code, recorder.Body, test.status)
+		}
+	}
+}
+
+func TestAcceptHouseholdInvitation(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "owner")
+	newTestHousehold(t, db, "guest")
+	options := Options{
+		DB: db,
+	}
+
+	invite := func(publicID string, expiresAt time.Time) {
+		db.MustExec("INSERT INTO household_invitations (public_id, household_id, role, invited_by, expires_at) VALUES (?, ?, 'viewer', ?, ?)", publicID, household.HouseholdID, household.UserID, expiresAt)
+	}
+	accept := func(userID string, publicID string) int {
+		return serve(options.AcceptHouseholdInvitation(), "/invitations/:id/accept", userID, http.MethodPost, "/invitations/"+publicID+"/accept", "").Code
+	}
+
+	// Owner can't demote themselves by accepting an invitation
+	invite("demote", time.Now().Add(time.Hour).UTC())
+	if status := accept("owner", "demote"); status != http.StatusConflict {
+		t.Errorf("owner accepting an invitation got %d, want %d", status, http.StatusConflict)
+	}
+	var role string
+	if err := db.Get(&role, "SELECT role FROM household_members WHERE household_id = ? AND user_id = ?", household.HouseholdID, household.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if role != RoleOwner {
+		t.Errorf("owner has role %s after accepting an invitation", role)
+	}
+
+	// Expiry is stored in UTC and compared as text so it must not be compared
+	// with the local time of a server behind UTC
+	local := time.Local
+	time.Local = time.FixedZone("UTC-10", -10*60*60)
+	defer func() {
+		time.Local = local
+	}()
+	invite("expired", time.Now().Add(-time.Minute).UTC())
+	if status := accept("guest", "expired"); status != http.StatusNotFound {
+		t.Errorf("accepting an expired invitation got %d, want %d", status, http.StatusNotFound)
+	}
+
+	invite("valid", time.Now().Add(time.Minute).UTC())
+	if status := accept("guest", "valid"); status != http.StatusOK {
+		t.Errorf("accepting an invitation got %d, want %d", status, http.StatusOK)
+	}
+
+	// Invitation accepted by someone else after it was read by the handler
+	racer := newTestHousehold(t, db, "racer")
+	invite("raced", time.Now().Add(time.Minute).UTC())
+	db.MustExec(fmt.Sprintf("CREATE TRIGGER accept_raced BEFORE INSERT ON household_members WHEN NEW.user_id = %d BEGIN UPDATE household_invitations SET accepted_at = CURRENT_TIMESTAMP WHERE public_id = 'raced'; END", racer.UserID))
+	if status := accept("racer", "raced"); status != http.StatusConflict {
+		t.Errorf("accepting an accepted invitation got %d, want %d", status, http.StatusConflict)
+	}
+	var members int
+	if err := db.Get(&members, "SELECT COUNT(*) FROM household_members WHERE household_id = ? AND user_id = ?", household.HouseholdID, racer.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if members != 0 {
+		t.Errorf("user joined a household with an accepted invitation")
+	}
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -10,26 +12,50 @@ import (
 	"github.com/jkomyno/nanoid"
 )
 
+// defaultItemUnit is the unit of imported items without a unit of measure
+const defaultItemUnit = "kom"
+
 // ItemsGetQuery : Structure that should be used for getting query data on get request for items
 type ItemsGetQuery struct {
 	// CreatedBy string `form:"createdBy"`
-	Name string `form:"name"`
+	Name        string `form:"name"`
+	HouseholdID string `form:"householdId"`
+	Category    string `form:"category"`
+	Tag         string `form:"tag"`
 }
 
 // ItemsPostBody : Structure that should be used for getting json from body of a post request for items
 type ItemsPostBody struct {
 	// CreatedBy string `json:"createdBy" validate:"required"`
-	Name  string  `json:"name" validate:"required"`
-	Price float32 `json:"price" validate:"required"`
-	Unit  string  `json:"unit" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Price       Money  `json:"price" validate:"required"`
+	Unit        string `json:"unit" validate:"required"`
+	HouseholdID string `json:"householdId"`
+	// PackageSize and PackageUnit are the size of a package of an item that
+	// is counted in pieces, like 500 g of a pack of coffee
+	PackageSize *float64 `json:"packageSize"`
+	PackageUnit *string  `json:"packageUnit"`
+	// Barcodes are EAN-8, EAN-13 or UPC-A codes of the item
+	Barcodes []string `json:"barcodes"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
 }
 
 // ItemsPutBody : Structure that should be used for getting json from body of a put request for items
 type ItemsPutBody struct {
-	PublicID string  `json:"id" validate:"required"`
-	Name     string  `json:"name"`
-	Price    float32 `json:"price"`
-	Unit     string  `json:"unit"`
+	PublicID string `json:"id" validate:"required"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Unit     string `json:"unit"`
+	// Package size of 0 removes the package size
+	PackageSize *float64 `json:"packageSize"`
+	PackageUnit *string  `json:"packageUnit"`
+	// Barcodes replace all barcodes of the item if they are specified
+	Barcodes *[]string `json:"barcodes"`
+	// Empty category removes the category
+	Category *string `json:"category"`
+	// Tags replace all tags of the item if they are specified
+	Tags *[]string `json:"tags"`
 }
 
 // ItemsDeleteBody : Structure that should be used for getting json data from body of a delete request for items
@@ -37,14 +63,36 @@ type ItemsDeleteBody struct {
 	PublicID string `json:"id" validate:"required"`
 }
 
+// ItemsDeleteQuery : Structure that should be used for getting query data of a delete request for items
+type ItemsDeleteQuery struct {
+	Cascade bool `form:"cascade"`
+}
+
 // Item : Structure that should be used for getting item information from database
 type Item struct {
-	PublicID  string    `db:"public_id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	Price     float32   `db:"price" json:"price"`
-	Unit      string    `db:"unit" json:"unit"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	PublicID    string   `db:"public_id" json:"id"`
+	HouseholdID string   `db:"household_id" json:"householdId"`
+	CreatedBy   string   `db:"created_by" json:"createdBy"`
+	Name        string   `db:"name" json:"name"`
+	Price       Money    `db:"price" json:"price"`
+	Unit        string   `db:"unit" json:"unit"`
+	PackageSize *float64 `db:"package_size" json:"packageSize"`
+	PackageUnit *string  `db:"package_unit" json:"packageUnit"`
+	Category    *string  `db:"category" json:"category"`
+	// NormalizedPrice is the price per kg, l or piece and it's nil if the
+	// unit is not in the unit registry
+	NormalizedPrice *Money    `db:"-" json:"normalizedPrice"`
+	NormalizedUnit  *string   `db:"-" json:"normalizedUnit"`
+	Barcodes        []string  `db:"-" json:"barcodes"`
+	Tags            []string  `db:"-" json:"tags"`
+	CreatedAt       time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// itemsQuery selects items that are not deleted from households the user is
+// a member of
+func itemsQuery(userID int) sq.SelectBuilder {
+	return sq.Select("items.public_id, households.public_id AS household_id, users.public_id AS created_by, items.name, items.price, items.unit, items.package_size, items.package_unit, items.category, items.created_at, items.updated_at").From("items").Join("households ON households.id = items.household_id").Join("users ON users.id = items.created_by").Where(MemberOf("items.household_id", userID)).Where(NotDeleted("items"))
 }
 
 // GetItems is a Gin handler function for getting items.
@@ -66,13 +114,28 @@ func (o Options) GetItems() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Select("items.public_id, name, price, unit, created_at, updated_at").From("items")
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 
-		query = query.Join("users ON users.id = items.created_by").Where(sq.Eq{"users.public_id": createdBy.PublicID})
+		query := itemsQuery(user.ID)
 
 		if searchQuery.Name != "" {
 			query = query.Where("items.name LIKE ?", fmt.Sprint("%", searchQuery.Name, "%"))
 		}
+		if searchQuery.HouseholdID != "" {
+			query = query.Where(sq.Eq{"households.public_id": searchQuery.HouseholdID})
+		}
+		if searchQuery.Category != "" {
+			query = query.Where(sq.Eq{"items.category": searchQuery.Category})
+		}
+		if searchQuery.Tag != "" {
+			query = query.Where("items.id IN (SELECT item_id FROM item_tags WHERE tag = ?)", searchQuery.Tag)
+		}
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -87,6 +150,40 @@ func (o Options) GetItems() gin.HandlerFunc {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
+			return
+		}
+
+		itemIDs := make([]string, 0, len(items))
+		for _, item := range items {
+			itemIDs = append(itemIDs, item.PublicID)
+		}
+
+		barcodes, err := ItemBarcodes(o.DB, itemIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tags, err := ItemTags(o.DB, itemIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for i, item := range items {
+			items[i].Barcodes = barcodes[item.PublicID]
+			if items[i].Barcodes == nil {
+				items[i].Barcodes = []string{}
+			}
+			items[i].Tags = tags[item.PublicID]
+			if items[i].Tags == nil {
+				items[i].Tags = []string{}
+			}
+			items[i].NormalizedPrice, items[i].NormalizedUnit = NormalizePrice(item.Price, item.Unit, item.PackageSize, item.PackageUnit)
 		}
 
 		ctx.JSON(http.StatusOK, items)
@@ -120,6 +217,42 @@ func (o Options) PostItems() gin.HandlerFunc {
 			return
 		}
 
+		unit, ok := LookupUnit(itemData.Unit)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": ErrUnknownUnit.Error(),
+			})
+			return
+		}
+
+		if err := validPackage(unit.Name, itemData.PackageSize, itemData.PackageUnit); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if itemData.PackageUnit != nil {
+			packageUnit, _ := LookupUnit(*itemData.PackageUnit)
+			itemData.PackageUnit = &packageUnit.Name
+		}
+
+		barcodes, err := normalizeBarcodes(itemData.Barcodes)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tags, err := normalizeTags(itemData.Tags)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		user, err := createdBy.PrivateID(o.DB)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -128,6 +261,43 @@ func (o Options) PostItems() gin.HandlerFunc {
 			return
 		}
 
+		household, err := WritableHouseholdID(o.DB, user.ID, itemData.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to add items to specified household",
+			})
+			return
+		}
+
+		duplicate, err := duplicateName(o.DB, "items", sq.Eq{"household_id": household.ID}, itemData.Name, "")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if duplicate != nil {
+			ctx.JSON(http.StatusConflict, nameConflict("items", duplicate))
+			return
+		}
+
+		owner, err := barcodeOwner(o.DB, household.ID, barcodes, 0)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if owner != "" {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "barcode is already used by another item",
+				"id":      owner,
+			})
+			return
+		}
+
 		uuid, err := nanoid.Nanoid()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -136,7 +306,7 @@ func (o Options) PostItems() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Insert("items").Columns("public_id", "created_by", "name", "price", "unit").Values(uuid, user.ID, itemData.Name, itemData.Price, itemData.Unit)
+		query := sq.Insert("items").Columns("public_id", "created_by", "household_id", "name", "price", "unit", "package_size", "package_unit", "category").Values(uuid, user.ID, household.ID, itemData.Name, itemData.Price, unit.Name, itemData.PackageSize, itemData.PackageUnit, normalizeLabel(itemData.Category))
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -154,7 +324,54 @@ func (o Options) PostItems() gin.HandlerFunc {
 			return
 		}
 
-		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+		result, err := tx.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				duplicate, err := duplicateName(o.DB, "items", sq.Eq{"household_id": household.ID}, itemData.Name, "")
+				if err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusConflict, nameConflict("items", duplicate))
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := insertBarcodes(tx, itemID, household.ID, barcodes); err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "barcode is already used by another item",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := insertTags(tx, itemID, household.ID, tags); err != nil {
+			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -207,21 +424,114 @@ func (o Options) PutItems() gin.HandlerFunc {
 			return
 		}
 
+		if itemData.Name != "" {
+			duplicate, err := duplicateName(o.DB, "items", sq.And{sameHouseholdAs("items", itemData.PublicID), MemberOf("household_id", user.ID)}, itemData.Name, itemData.PublicID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if duplicate != nil {
+				ctx.JSON(http.StatusConflict, nameConflict("items", duplicate))
+				return
+			}
+		}
+
 		query := sq.Update("items")
 
 		if itemData.Name != "" {
 			query = query.Set("name", itemData.Name)
 		}
-		if itemData.Price != 0.0 {
+		if itemData.Price != 0 {
 			query = query.Set("price", itemData.Price)
 		}
-		if itemData.Unit != "" {
-			query = query.Set("unit", itemData.Unit)
+		if itemData.Unit != "" || itemData.PackageSize != nil || itemData.PackageUnit != nil {
+			unit, packageSize, packageUnit, err := o.itemPackage(user.ID, itemData)
+			if err == sql.ErrNoRows {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to update specified item",
+				})
+				return
+			} else if err == ErrUnknownUnit || err == ErrInvalidPackage {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			} else if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			query = query.Set("unit", unit).Set("package_size", packageSize).Set("package_unit", packageUnit)
+		}
+		if itemData.Category != nil {
+			query = query.Set("category", normalizeLabel(*itemData.Category))
+		}
+
+		var barcodes, tags []string
+		if itemData.Barcodes != nil {
+			if barcodes, err = normalizeBarcodes(*itemData.Barcodes); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+		if itemData.Tags != nil {
+			if tags, err = normalizeTags(*itemData.Tags); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		var item struct {
+			ID          int64 `db:"id"`
+			HouseholdID int   `db:"household_id"`
+		}
+		if itemData.Barcodes != nil || itemData.Tags != nil {
+			itemQueryString, itemQueryStringArgs, err := sq.Select("id, household_id").From("items").Where(sq.Eq{"public_id": itemData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if err := o.DB.Get(&item, itemQueryString, itemQueryStringArgs...); err != nil {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to update specified item",
+				})
+				return
+			}
+		}
+
+		if itemData.Barcodes != nil {
+			owner, err := barcodeOwner(o.DB, item.HouseholdID, barcodes, int(item.ID))
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if owner != "" {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "barcode is already used by another item",
+					"id":      owner,
+				})
+				return
+			}
 		}
 
 		query = query.Set("updated_at", time.Now())
 
-		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": itemData.PublicID, "created_by": user.ID}).ToSql()
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": itemData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -238,12 +548,69 @@ func (o Options) PutItems() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				duplicate, err := duplicateName(o.DB, "items", sq.And{sameHouseholdAs("items", itemData.PublicID), MemberOf("household_id", user.ID)}, itemData.Name, itemData.PublicID)
+				if err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusConflict, nameConflict("items", duplicate))
+				return
+			}
+
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
 
+		if itemData.Barcodes != nil {
+			if _, err := tx.Exec("DELETE FROM item_barcodes WHERE item_id = ?", item.ID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if err := insertBarcodes(tx, item.ID, item.HouseholdID, barcodes); err != nil {
+				tx.Rollback()
+				if isUniqueConstraintError(err) {
+					ctx.JSON(http.StatusConflict, gin.H{
+						"message": "barcode is already used by another item",
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if itemData.Tags != nil {
+			if _, err := tx.Exec("DELETE FROM item_tags WHERE item_id = ?", item.ID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if err := insertTags(tx, item.ID, item.HouseholdID, tags); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
 		if err := tx.Commit(); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -255,7 +622,56 @@ func (o Options) PutItems() gin.HandlerFunc {
 	}
 }
 
-// DeleteItems is a Gin handler function for deleting items.
+// itemPackage merges the unit and package size of an update of an item with
+// the ones the item has and checks them. Units that are in the unit registry
+// are stored with their name from the registry.
+func (o Options) itemPackage(userID int, itemData ItemsPutBody) (string, *float64, *string, error) {
+	queryString, queryStringArgs, err := sq.Select("unit, package_size, package_unit").From("items").Where(sq.Eq{"public_id": itemData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", userID, WriteRoles...)).ToSql()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var item struct {
+		Unit        string   `db:"unit"`
+		PackageSize *float64 `db:"package_size"`
+		PackageUnit *string  `db:"package_unit"`
+	}
+	if err := o.DB.Get(&item, queryString, queryStringArgs...); err != nil {
+		return "", nil, nil, err
+	}
+
+	if itemData.Unit != "" {
+		unit, ok := LookupUnit(itemData.Unit)
+		if !ok {
+			return "", nil, nil, ErrUnknownUnit
+		}
+		item.Unit = unit.Name
+	}
+
+	if itemData.PackageSize != nil && *itemData.PackageSize == 0 {
+		item.PackageSize, item.PackageUnit = nil, nil
+	} else {
+		if itemData.PackageSize != nil {
+			item.PackageSize = itemData.PackageSize
+		}
+		if itemData.PackageUnit != nil {
+			item.PackageUnit = itemData.PackageUnit
+			if unit, ok := LookupUnit(*itemData.PackageUnit); ok {
+				item.PackageUnit = &unit.Name
+			}
+		}
+	}
+
+	if err := validPackage(item.Unit, item.PackageSize, item.PackageUnit); err != nil {
+		return "", nil, nil, err
+	}
+
+	return item.Unit, item.PackageSize, item.PackageUnit, nil
+}
+
+// DeleteItems is a Gin handler function for moving items to the trash. Items
+// used in receipts are deleted only if cascade is requested. Lines of the item
+// stay on receipts and the item is purged only after those receipts are.
 func (o Options) DeleteItems() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		createdBy, createdByExists := GetUserID(ctx)
@@ -266,6 +682,14 @@ func (o Options) DeleteItems() gin.HandlerFunc {
 			return
 		}
 
+		var deleteQuery ItemsDeleteQuery
+		if err := ctx.ShouldBindQuery(&deleteQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		var itemData ItemsDeleteBody
 		if err := ctx.ShouldBindJSON(&itemData); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
@@ -290,8 +714,41 @@ func (o Options) DeleteItems() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Delete("items").Where(sq.Eq{"public_id": itemData.PublicID, "created_by": user.ID})
-		queryString, queryStringArgs, err := query.ToSql()
+		userOwnsQuery := sq.Select("id").From("items").Where(sq.Eq{"public_id": itemData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var item StructID
+		if err := o.DB.Get(&item, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to delete specified item",
+			})
+			return
+		}
+
+		var lines int
+		if err := o.DB.Get(&lines, "SELECT COUNT(*) FROM items_in_receipt JOIN receipts ON receipts.id = items_in_receipt.receipt_id WHERE items_in_receipt.item_id = ? AND receipts.deleted_at IS NULL", item.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if lines != 0 && !deleteQuery.Cascade {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message":        "item is used in receipts",
+				"itemsInReceipt": lines,
+			})
+			return
+		}
+
+		batch, err := nanoid.Nanoid()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -307,14 +764,52 @@ func (o Options) DeleteItems() gin.HandlerFunc {
 			return
 		}
 
-		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+		if _, err := tx.Exec("UPDATE items SET deleted_at = current_timestamp, delete_batch = ? WHERE id = ?", batch, item.ID); err != nil {
+			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
+			return
 		}
 
-		tx.Commit()
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 
 		ctx.Status(http.StatusOK)
 	}
 }
+
+// GetItemActions is a Gin handler function for GET requests to paths under an
+// item. Gin doesn't route static paths next to item ids so lines of receipts
+// and items by barcode are dispatched here as well.
+func (o Options) GetItemActions() gin.HandlerFunc {
+	itemsInReceipt := o.GetItemsInReceipt()
+	byBarcode := o.GetItemByBarcode()
+	comparison := o.GetItemComparison()
+
+	return func(ctx *gin.Context) {
+		id, action := ctx.Param("id"), ctx.Param("action")
+		value := strings.TrimPrefix(action, "/")
+		single := value != "" && !strings.Contains(value, "/")
+
+		switch {
+		case id == "inreceipt" && single:
+			ctx.Params = gin.Params{{Key: "id", Value: value}}
+			itemsInReceipt(ctx)
+		case id == "by-barcode" && single:
+			ctx.Params = gin.Params{{Key: "code", Value: value}}
+			byBarcode(ctx)
+		case action == "/compare":
+			ctx.Params = gin.Params{{Key: "id", Value: id}}
+			comparison(ctx)
+		default:
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "404 page not found",
+			})
+		}
+	}
+}
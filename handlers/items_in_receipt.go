@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
 	"net/http"
 
 	sq "github.com/Masterminds/squirrel"
@@ -14,13 +13,19 @@ import (
 type ItemsInReceiptPostBody struct {
 	ReceiptID string  `json:"receiptId" validate:"required"`
 	ItemID    string  `json:"itemId" validate:"required"`
-	Amount    float32 `json:"amount" validate:"required"`
+	Amount    float64 `json:"amount" validate:"required"`
+	// TaxLabel is a label of a tax rate available to the user, e.g. Ђ
+	TaxLabel string    `json:"taxLabel"`
+	Discount *Discount `json:"discount"`
 }
 
 // ItemsInReceiptPutBody : Structure that should be used for getting json from body of a put request for items form a specific receipt
 type ItemsInReceiptPutBody struct {
 	PublicID string  `json:"id" validate:"required"`
-	Amount   float32 `json:"amount"`
+	Amount   float64 `json:"amount"`
+	TaxLabel string  `json:"taxLabel"`
+	// Discount replaces the discount of the line, an empty discount removes it
+	Discount *Discount `json:"discount"`
 }
 
 // ItemsInReceiptDeleteBody : Structure that should be used for getting json data from body of a delete request for items in a specific receipt
@@ -34,11 +39,33 @@ type ItemInReceipt struct {
 	PublicID     string  `db:"public_id" json:"id"`
 	ItemPublicID string  `db:"item_public_id" json:"itemId"`
 	Name         string  `db:"item_name" json:"name"`
-	Price        float32 `db:"item_price" json:"price"`
+	Price        Money   `db:"item_price" json:"price"`
 	Unit         string  `db:"item_unit" json:"unit"`
-	Amount       float32 `db:"amount" json:"amount"`
+	Amount       float64 `db:"amount" json:"amount"`
+	// PackageSize and PackageUnit of the item are used for NormalizedPrice,
+	// the price per kg, l or piece
+	PackageSize     *float64 `db:"item_package_size" json:"-"`
+	PackageUnit     *string  `db:"item_package_unit" json:"-"`
+	NormalizedPrice *Money   `db:"-" json:"normalizedPrice"`
+	NormalizedUnit  *string  `db:"-" json:"normalizedUnit"`
+	// TaxLabel and TaxRate are copied from the tax rate when the item is
+	// added so later changes of the rate don't change the receipt
+	TaxLabel *string     `db:"tax_label" json:"taxLabel"`
+	TaxRate  *Percentage `db:"tax_rate" json:"taxRate"`
+	// DiscountType and DiscountValue are columns of the discount that is sent
+	// as Discount
+	DiscountType  *string   `db:"discount_type" json:"-"`
+	DiscountValue *int64    `db:"discount_value" json:"-"`
+	Discount      *Discount `db:"-" json:"discount"`
+	// Saved is the amount of the discount and Total is the total of the line
+	// after it
+	Saved Money `db:"saved" json:"saved"`
+	Total Money `db:"total" json:"total"`
 }
 
+// ItemsInReceiptColumns are columns that should be selected for ItemInReceipt
+var ItemsInReceiptColumns = "items_in_receipt.public_id, items.public_id as item_public_id, items.name as item_name, " + linePriceSQL + " as item_price, items.unit as item_unit, items.package_size as item_package_size, items.package_unit as item_package_unit, items_in_receipt.amount, items_in_receipt.tax_label, items_in_receipt.tax_rate, items_in_receipt.discount_type, items_in_receipt.discount_value, " + LineDiscountSQL + " AS saved, " + LineTotalSQL + " AS total"
+
 // GetItemsInReceipt is a Gin handler function for getting items from
 // a specific receipt.
 func (o Options) GetItemsInReceipt() gin.HandlerFunc {
@@ -67,7 +94,7 @@ func (o Options) GetItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Select("items_in_receipt.public_id, items.public_id as item_public_id, items.name as item_name, items.price as item_price, items.unit as item_unit, items_in_receipt.amount").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"receipts.public_id": receiptPublicID, "receipts.created_by": user.ID})
+		query := sq.Select(ItemsInReceiptColumns).From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"receipts.public_id": receiptPublicID}).Where(MemberOf("receipts.household_id", user.ID)).Where(NotDeleted("receipts"))
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -85,6 +112,11 @@ func (o Options) GetItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
+		for i, item := range items {
+			items[i].Discount = NewDiscount(item.DiscountType, item.DiscountValue)
+			items[i].NormalizedPrice, items[i].NormalizedUnit = NormalizePrice(item.Price, item.Unit, item.PackageSize, item.PackageUnit)
+		}
+
 		ctx.JSON(http.StatusOK, items)
 	}
 }
@@ -117,6 +149,13 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
+		if err := itemData.Discount.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		user, err := createdBy.PrivateID(o.DB)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -125,7 +164,7 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		receiptIDQuery := sq.Select("id").From("receipts").Where(sq.Eq{"public_id": itemData.ReceiptID, "created_by": user.ID})
+		receiptIDQuery := sq.Select("id, household_id, refund_of IS NOT NULL AS refund").From("receipts").Where(sq.Eq{"public_id": itemData.ReceiptID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
 
 		receiptIDQueryString, receiptIDQueryStringArgs, err := receiptIDQuery.ToSql()
 		if err != nil {
@@ -135,7 +174,11 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		receipt := StructID{}
+		receipt := struct {
+			ID          int  `db:"id"`
+			HouseholdID int  `db:"household_id"`
+			Refund      bool `db:"refund"`
+		}{}
 		if err := o.DB.Get(&receipt, receiptIDQueryString, receiptIDQueryStringArgs...); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -143,7 +186,15 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		itemIDQuery := sq.Select("id").From("items").Where(sq.Eq{"public_id": itemData.ItemID, "created_by": user.ID})
+		if receipt.Refund {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": ErrRefundLine.Error(),
+			})
+			return
+		}
+
+		// Item has to be in the same household as the receipt
+		itemIDQuery := sq.Select("id").From("items").Where(sq.Eq{"public_id": itemData.ItemID, "household_id": receipt.HouseholdID, "deleted_at": nil})
 
 		itemIDQueryString, itemIDQueryStringArgs, err := itemIDQuery.ToSql()
 		if err != nil {
@@ -169,7 +220,24 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Insert("items_in_receipt").Columns("public_id", "receipt_id", "item_id", "amount").Values(uuid, receipt.ID, item.ID, itemData.Amount)
+		line := map[string]interface{}{"public_id": uuid, "receipt_id": receipt.ID, "item_id": item.ID, "amount": itemData.Amount}
+
+		if itemData.TaxLabel != "" {
+			rate, err := resolveTaxRate(o.DB, receipt.HouseholdID, itemData.TaxLabel)
+			if err != nil {
+				ctx.JSON(taxRateErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			line["tax_label"] = itemData.TaxLabel
+			line["tax_rate"] = rate
+		}
+
+		line["discount_type"], line["discount_value"] = itemData.Discount.columns()
+
+		query := sq.Insert("items_in_receipt").SetMap(line)
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -188,6 +256,14 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+			tx.Rollback()
+			if isConstraintError(err) {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -201,6 +277,8 @@ func (o Options) PostItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
+		o.checkBudgets(itemData.ReceiptID)
+
 		ctx.Status(http.StatusOK)
 	}
 }
@@ -225,6 +303,20 @@ func (o Options) PutItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
+		if err := o.V.Struct(itemData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := itemData.Discount.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		user, err := createdBy.PrivateID(o.DB)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -233,7 +325,7 @@ func (o Options) PutItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		userOwnsQuery := sq.Select("items_in_receipt.id").From("items_in_receipt").Join("receipts on receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"items_in_receipt.public_id": itemData.PublicID, "receipts.created_by": user.ID})
+		userOwnsQuery := sq.Select("items_in_receipt.id, receipts.public_id AS receipt_id, receipts.household_id, receipts.refund_of IS NOT NULL AS refund, " + lineRefundedSQL + " AS refunded").From("items_in_receipt").Join("receipts on receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"items_in_receipt.public_id": itemData.PublicID}).Where(MemberOf("receipts.household_id", user.ID, WriteRoles...)).Where(NotDeleted("receipts"))
 
 		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
 		if err != nil {
@@ -243,10 +335,32 @@ func (o Options) PutItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		item := StructID{}
+		item := struct {
+			ID          int     `db:"id"`
+			ReceiptID   string  `db:"receipt_id"`
+			HouseholdID int     `db:"household_id"`
+			Refund      bool    `db:"refund"`
+			Refunded    float64 `db:"refunded"`
+		}{}
 		if err := o.DB.Get(&item, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"message": "not authrized to edit specified item from receipt",
+				"message": "not authorized to edit specified item from receipt",
+			})
+			return
+		}
+
+		if item.Refund {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": ErrRefundLine.Error(),
+			})
+			return
+		}
+
+		// Line can't have less than was already returned
+		if itemData.Amount != 0.0 && itemData.Amount < item.Refunded-refundAmountTolerance {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message":  "amount can't be less than the refunded amount",
+				"refunded": item.Refunded,
 			})
 			return
 		}
@@ -256,6 +370,21 @@ func (o Options) PutItemsInReceipt() gin.HandlerFunc {
 		if itemData.Amount != 0.0 {
 			query = query.Set("amount", itemData.Amount)
 		}
+		if itemData.TaxLabel != "" {
+			rate, err := resolveTaxRate(o.DB, item.HouseholdID, itemData.TaxLabel)
+			if err != nil {
+				ctx.JSON(taxRateErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			query = query.Set("tax_label", itemData.TaxLabel).Set("tax_rate", rate)
+		}
+		if itemData.Discount != nil {
+			discountType, discountValue := itemData.Discount.columns()
+			query = query.Set("discount_type", discountType).Set("discount_value", discountValue)
+		}
 
 		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": itemData.PublicID}).ToSql()
 		if err != nil {
@@ -274,10 +403,28 @@ func (o Options) PutItemsInReceipt() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
-			log.Fatalln(err.Error())
+			tx.Rollback()
+			if isConstraintError(err) {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
 		}
 
-		tx.Commit()
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		o.checkBudgets(item.ReceiptID)
 
 		ctx.Status(http.StatusOK)
 	}
@@ -319,17 +466,22 @@ func (o Options) DeleteItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
-		userOwnsQuery := sq.Select("items_in_receipt.id").From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id")
+		userOwnsQuery := sq.Select("items_in_receipt.id, receipts.refund_of IS NOT NULL AS refund").From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id")
 
 		if itemData.ReceiptID == "" {
-			userOwnsQuery = userOwnsQuery.Where(sq.Eq{"items_in_receipt.public_id": itemData.ItemID, "receipts.created_by": user.ID})
+			userOwnsQuery = userOwnsQuery.Where(sq.Eq{"items_in_receipt.public_id": itemData.ItemID})
 		} else {
-			userOwnsQuery = userOwnsQuery.Where(sq.Eq{"items_in_receipt.item_id": itemData.ItemID, "items_in_receipt.receipt_id": itemData.ReceiptID, "receipts.created_by": user.ID})
+			userOwnsQuery = userOwnsQuery.Where(sq.Eq{"items_in_receipt.item_id": itemData.ItemID, "items_in_receipt.receipt_id": itemData.ReceiptID})
 		}
 
+		userOwnsQuery = userOwnsQuery.Where(MemberOf("receipts.household_id", user.ID, WriteRoles...)).Where(NotDeleted("receipts"))
+
 		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
 
-		var item StructID
+		item := struct {
+			ID     int  `db:"id"`
+			Refund bool `db:"refund"`
+		}{}
 		if err := o.DB.Get(&item, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
 			switch err {
 			case sql.ErrNoRows:
@@ -345,6 +497,29 @@ func (o Options) DeleteItemsInReceipt() gin.HandlerFunc {
 			return
 		}
 
+		if item.Refund {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": ErrRefundLine.Error(),
+			})
+			return
+		}
+
+		// Refunded lines would take their refunds with them
+		var refunds int
+		if err := o.DB.Get(&refunds, "SELECT COUNT(*) FROM items_in_receipt WHERE refund_of = ?", item.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if refunds != 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": "line is refunded and can't be deleted",
+			})
+			return
+		}
+
 		query := sq.Delete("items_in_receipt")
 
 		if itemData.ReceiptID == "" {
@@ -370,6 +545,7 @@ func (o Options) DeleteItemsInReceipt() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator"
+)
+
+func TestPutItemsInReceiptConstraintError(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  validator.New(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'receipt')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 1)", receipt, item)
+
+	// Any constraint violated by the update is reported instead of stopping
+	// the server
+	db.MustExec("CREATE TRIGGER reject_amounts BEFORE UPDATE OF amount ON items_in_receipt WHEN new.amount > 10 BEGIN SELECT RAISE(ABORT, 'amount is too large'); END")
+
+	recorder := serve(options.PutItemsInReceipt(), "/items-in-receipt", "user", http.MethodPut, "/items-in-receipt", `{"id": "line", "amount": 11}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s, want %d", recorder.Code, recorder.Body, http.StatusBadRequest)
+	}
+
+	var amount float64
+	if err := db.Get(&amount, "SELECT amount FROM items_in_receipt WHERE public_id = 'line'"); err != nil {
+		t.Fatal(err)
+	}
+	if amount != 1 {
+		t.Errorf("amount is %v after a failed update, want 1", amount)
+	}
+}
+
+func TestItemsInReceiptRefunds(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  validator.New(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at) VALUES (?, ?, ?, 'receipt', ?)", household.LocationID, household.HouseholdID, household.UserID, time.Now().UTC())
+	line := insertID(t, db, "INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 3)", receipt, item)
+	refund := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, refund_of) VALUES (?, ?, ?, 'refund', ?, ?)", household.LocationID, household.HouseholdID, household.UserID, time.Now().UTC(), receipt)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, refund_of) VALUES (?, ?, 'refund-line', -2, ?)", refund, item, line)
+
+	tests := []struct {
+		name    string
+		handler func() gin.HandlerFunc
+		method  string
+		body    string
+		status  int
+	}{
+		{"amount below refunded", options.PutItemsInReceipt, http.MethodPut, `{"id": "line", "amount": 1}`, http.StatusConflict},
+		{"change refund line", options.PutItemsInReceipt, http.MethodPut, `{"id": "refund-line", "amount": 5}`, http.StatusConflict},
+		{"add line to refund", options.PostItemsInReceipt, http.MethodPost, `{"receiptId": "refund", "itemId": "milk", "amount": 1}`, http.StatusConflict},
+		{"remove refund line", options.DeleteItemsInReceipt, http.MethodDelete, `{"itemId": "refund-line"}`, http.StatusConflict},
+		{"amount of refunded", options.PutItemsInReceipt, http.MethodPut, `{"id": "line", "amount": 2}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if recorder := serve(test.handler(), "/items/inreceipt", "user", test.method, "/items/inreceipt", test.body); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.name, recorder.Code, recorder.Body, test.status)
+		}
+	}
+
+	var amounts []float64
+	if err := db.Select(&amounts, "SELECT amount FROM items_in_receipt ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 || amounts[0] != 2 || amounts[1] != -2 {
+		t.Errorf("amounts are %v, want [2 -2]", amounts)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetItemActions(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO item_barcodes (item_id, household_id, code) VALUES (?, ?, '4006381333931')", item, household.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at) VALUES (?, ?, ?, 'receipt', ?)", household.LocationID, household.HouseholdID, household.UserID, time.Now().UTC())
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 1)", receipt, item)
+
+	tests := []struct {
+		route  string
+		path   string
+		status int
+	}{
+		{"/items/:id/*action", "/items/milk/compare", http.StatusOK},
+		{"/items/:id/*action", "/items/unknown/compare", http.StatusNotFound},
+		{"/items/:id/*action", "/items/inreceipt/receipt", http.StatusOK},
+		{"/items/:id/*action", "/items/by-barcode/4006381333931", http.StatusOK},
+		{"/items/:id/*action", "/items/milk/unknown", http.StatusNotFound},
+		{"/items/:id/*action", "/items/inreceipt/receipt/milk", http.StatusNotFound},
+		{"/items/:id/*action", "/items/compare/", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if recorder := serve(options.GetItemActions(), test.route, "user", http.MethodGet, test.path, ""); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.path, recorder.Code, recorder.Body, test.status)
+		}
+	}
+}
+
+func TestItemCategoriesAndTags(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	for _, body := range []string{
+		`{"name": "Mleko", "price": 129.99, "unit": "kom", "category": " Dairy ", "tags": ["organic", " local", "organic", ""]}`,
+		`{"name": "Hleb", "price": 89.99, "unit": "kom", "category": "Bakery", "tags": ["organic"]}`,
+		`{"name": "Deterdžent", "price": 450, "unit": "kom"}`,
+	} {
+		if recorder := serve(options.PostItems(), "/items", "user", http.MethodPost, "/items", body); recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", body, recorder.Code, recorder.Body)
+		}
+	}
+
+	// items gets names, categories and tags of items listed at the path
+	items := func(path string) map[string]string {
+		recorder := serve(options.GetItems(), "/items", "user", http.MethodGet, path, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", path, recorder.Code, recorder.Body)
+		}
+
+		var items []Item
+		if err := json.Unmarshal(recorder.Body.Bytes(), &items); err != nil {
+			t.Fatal(err)
+		}
+
+		labels := map[string]string{}
+		for _, item := range items {
+			category := ""
+			if item.Category != nil {
+				category = *item.Category
+			}
+			labels[item.Name] = fmt.Sprint(category, item.Tags)
+		}
+		return labels
+	}
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/items", map[string]string{"Mleko": "Dairy[organic local]", "Hleb": "Bakery[organic]", "Deterdžent": "[]"}},
+		{"/items?category=Dairy", map[string]string{"Mleko": "Dairy[organic local]"}},
+		{"/items?tag=organic", map[string]string{"Mleko": "Dairy[organic local]", "Hleb": "Bakery[organic]"}},
+		{"/items?category=Bakery&tag=local", map[string]string{}},
+	}
+	for _, test := range tests {
+		if got := items(test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.path, got, test.want)
+		}
+	}
+
+	var milk string
+	if err := db.Get(&milk, "SELECT public_id FROM items WHERE name = 'Mleko'"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id": "` + milk + `", "category": "", "tags": ["fresh"]}`
+	if recorder := serve(options.PutItems(), "/items", "user", http.MethodPut, "/items", body); recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	if got, want := items("/items")["Mleko"], "[fresh]"; got != want {
+		t.Errorf("got %s after update, want %s", got, want)
+	}
+}
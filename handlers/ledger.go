@@ -0,0 +1,678 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Formats of plain text accounting exports
+const (
+	LedgerFormat    = "ledger"
+	HledgerFormat   = "hledger"
+	BeancountFormat = "beancount"
+)
+
+// Default accounts that are used when the user didn't set them
+const (
+	defaultExpenseAccount = "Expenses:Groceries"
+	defaultAssetAccount   = "Assets:Cash"
+)
+
+// ErrInvalidLedgerAccount is returned when an account name can't be written
+// to a journal
+var ErrInvalidLedgerAccount = errors.New("account must be a name without tabs, double spaces, semicolons or new lines")
+
+// ErrBeancountAccount is returned when an account can't be used in beancount.
+// Beancount accounts start with Assets, Liabilities, Equity, Income or
+// Expenses and each part of the name starts with a capital letter or a digit.
+var ErrBeancountAccount = errors.New("account is not a valid beancount account")
+
+// beancountAccountRegexp matches account names that beancount accepts
+var beancountAccountRegexp = regexp.MustCompile(`^(Assets|Liabilities|Equity|Income|Expenses)(:[\p{Lu}\p{Nd}][\p{L}\p{Nd}-]*)+$`)
+
+// LedgerExportQuery : Structure that should be used for getting query data on get request for plain text accounting exports. Receipts are filtered like receipts of a get request for receipts.
+type LedgerExportQuery struct {
+	ReceiptsGetQuery
+	Format string `form:"format" validate:"omitempty,oneof=ledger hledger beancount"`
+}
+
+// LedgerAccounts : Structure that should be used for getting and setting accounts of the user for plain text accounting exports. Lines are posted to the account of their item, the account of its category, the account of its first tag in alphabetical order that has one, the account of the location or the expense account. Payments are posted to the account of their payment method, the account of its type or the asset account and so is the part of a receipt without payments. Items, locations and payment methods are matched by name so the same account is used in all households and so are categories and tags.
+type LedgerAccounts struct {
+	Expense        string            `json:"expense"`
+	Asset          string            `json:"asset"`
+	Items          map[string]string `json:"items"`
+	Categories     map[string]string `json:"categories"`
+	Tags           map[string]string `json:"tags"`
+	Locations      map[string]string `json:"locations"`
+	PaymentMethods map[string]string `json:"paymentMethods"`
+	PaymentTypes   map[string]string `json:"paymentTypes" validate:"dive,keys,oneof=cash card voucher other,endkeys"`
+}
+
+// kinds gets maps of accounts by their kind in the database
+func (a *LedgerAccounts) kinds() map[string]map[string]string {
+	return map[string]map[string]string{
+		"item":           a.Items,
+		"category":       a.Categories,
+		"tag":            a.Tags,
+		"location":       a.Locations,
+		"payment_method": a.PaymentMethods,
+		"payment_type":   a.PaymentTypes,
+	}
+}
+
+// validate checks that all accounts can be written to a journal
+func (a *LedgerAccounts) validate() error {
+	// Default accounts can be empty so they are reset
+	accounts := []string{}
+	for _, account := range []string{a.Expense, a.Asset} {
+		if account != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	for _, names := range a.kinds() {
+		for _, account := range names {
+			accounts = append(accounts, account)
+		}
+	}
+
+	for _, account := range accounts {
+		if !validLedgerAccount(account) {
+			return fmt.Errorf("%v: %q", ErrInvalidLedgerAccount, account)
+		}
+	}
+
+	return nil
+}
+
+// validLedgerAccount checks if an account name can be written to a journal.
+// Two spaces or a tab end account names and semicolons start comments.
+func validLedgerAccount(account string) bool {
+	return account != "" && utf8.ValidString(account) &&
+		account == strings.TrimSpace(account) &&
+		!strings.ContainsAny(account, "\t\r\n;") &&
+		!strings.Contains(account, "  ") &&
+		!strings.HasPrefix(account, ":") && !strings.HasSuffix(account, ":") &&
+		!strings.ContainsAny(account[:1], "([")
+}
+
+// expense gets the account of a line of a receipt. Tags have to be sorted.
+func (a *LedgerAccounts) expense(item string, category string, tags []string, location string) string {
+	if account, ok := a.Items[item]; ok {
+		return account
+	}
+	if account, ok := a.Categories[category]; ok {
+		return account
+	}
+	for _, tag := range tags {
+		if account, ok := a.Tags[tag]; ok {
+			return account
+		}
+	}
+	if account, ok := a.Locations[location]; ok {
+		return account
+	}
+	return a.Expense
+}
+
+// asset gets the account of a payment
+func (a *LedgerAccounts) asset(method string, methodType string) string {
+	if account, ok := a.PaymentMethods[method]; ok {
+		return account
+	}
+	if account, ok := a.PaymentTypes[methodType]; ok {
+		return account
+	}
+	return a.Asset
+}
+
+// userLedgerAccounts gets accounts of the user for plain text accounting
+// exports. Default accounts are set if the user didn't set them.
+func userLedgerAccounts(db *sqlx.DB, userID int) (*LedgerAccounts, error) {
+	rows := []struct {
+		Kind    string `db:"kind"`
+		Name    string `db:"name"`
+		Account string `db:"account"`
+	}{}
+	if err := db.Select(&rows, "SELECT kind, name, account FROM ledger_accounts WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	accounts := &LedgerAccounts{
+		Expense:        defaultExpenseAccount,
+		Asset:          defaultAssetAccount,
+		Items:          map[string]string{},
+		Categories:     map[string]string{},
+		Tags:           map[string]string{},
+		Locations:      map[string]string{},
+		PaymentMethods: map[string]string{},
+		PaymentTypes:   map[string]string{},
+	}
+	kinds := accounts.kinds()
+	for _, row := range rows {
+		switch {
+		case row.Kind == "default" && row.Name == "expense":
+			accounts.Expense = row.Account
+		case row.Kind == "default" && row.Name == "asset":
+			accounts.Asset = row.Account
+		case kinds[row.Kind] != nil:
+			kinds[row.Kind][row.Name] = row.Account
+		}
+	}
+
+	return accounts, nil
+}
+
+// ledgerPosting is an amount posted to an account
+type ledgerPosting struct {
+	account string
+	amount  Money
+}
+
+// ledgerTransaction is a receipt as a transaction of a journal
+type ledgerTransaction struct {
+	receiptID string
+	date      string
+	payee     string
+	currency  string
+	fiscalID  string
+	notes     string
+	postings  []ledgerPosting
+}
+
+// post adds an amount to an account. Amounts of the same account are summed.
+func (t *ledgerTransaction) post(account string, amount Money) {
+	for i := range t.postings {
+		if t.postings[i].account == account {
+			t.postings[i].amount += amount
+			return
+		}
+	}
+	t.postings = append(t.postings, ledgerPosting{account, amount})
+}
+
+// compact removes postings without an amount and checks that the transaction
+// has any postings left
+func (t *ledgerTransaction) compact() bool {
+	postings := t.postings[:0]
+	for _, posting := range t.postings {
+		if posting.amount != 0 {
+			postings = append(postings, posting)
+		}
+	}
+	t.postings = postings
+
+	return len(t.postings) != 0
+}
+
+// ledgerLine is a line of a receipt with columns of its receipt
+type ledgerLine struct {
+	ReceiptID     string    `db:"receipt_id"`
+	PurchasedAt   time.Time `db:"purchased_at"`
+	TimeZone      string    `db:"time_zone"`
+	Location      string    `db:"location"`
+	Currency      string    `db:"currency"`
+	Notes         string    `db:"notes"`
+	FiscalID      string    `db:"fiscal_id"`
+	DiscountType  *string   `db:"discount_type"`
+	DiscountValue *int64    `db:"discount_value"`
+	ItemID        string    `db:"item_id"`
+	Item          string    `db:"item"`
+	Category      string    `db:"category"`
+	Total         Money     `db:"total"`
+}
+
+// ledgerPayment is a payment of a receipt
+type ledgerPayment struct {
+	ReceiptID string `db:"receipt_id"`
+	Name      string `db:"name"`
+	Type      string `db:"type"`
+	Amount    Money  `db:"amount"`
+}
+
+// ledgerReceipts adds joins and conditions of receipts of the user in an
+// export to a query
+func ledgerReceipts(query sq.SelectBuilder, userID int, search ReceiptsGetQuery) sq.SelectBuilder {
+	query = query.Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").LeftJoin("receipts originals ON originals.id = receipts.refund_of").Where(MemberOf("receipts.household_id", userID)).Where(NotDeleted("receipts"))
+	return search.filter(query)
+}
+
+// ledgerTransactions gets receipts of the user as transactions. Receipt
+// discounts are split between expense accounts in proportion to their amounts
+// and the part of a receipt without payments is posted to the asset account.
+func ledgerTransactions(db *sqlx.DB, userID int, search ReceiptsGetQuery, accounts *LedgerAccounts) ([]*ledgerTransaction, error) {
+	linesQuery := ledgerReceipts(sq.Select("receipts.public_id AS receipt_id, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, locations.name AS location, receipts.currency, COALESCE(receipts.notes, '') AS notes, COALESCE(receipts.fiscal_id, '') AS fiscal_id, receipts.discount_type, receipts.discount_value, items.public_id AS item_id, items.name AS item, COALESCE(items.category, '') AS category, "+LineTotalSQL+" AS total").From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("items ON items.id = items_in_receipt.item_id"), userID, search).OrderBy("receipts.purchased_at", "receipts.id", "items_in_receipt.id")
+
+	queryString, queryStringArgs, err := linesQuery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []ledgerLine{}
+	if err := db.Select(&lines, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	itemIDs := []string{}
+	seen := map[string]bool{}
+	for _, line := range lines {
+		if !seen[line.ItemID] {
+			seen[line.ItemID] = true
+			itemIDs = append(itemIDs, line.ItemID)
+		}
+	}
+
+	tags, err := ItemTags(db, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tags are sorted so accounts of tags don't depend on the order in which
+	// they were added
+	for _, itemTags := range tags {
+		sort.Strings(itemTags)
+	}
+
+	paymentsQuery := ledgerReceipts(sq.Select("receipts.public_id AS receipt_id, payment_methods.name, payment_methods.type, receipt_payments.amount").From("receipt_payments").Join("receipts ON receipts.id = receipt_payments.receipt_id").Join("payment_methods ON payment_methods.id = receipt_payments.payment_method_id"), userID, search).OrderBy("receipt_payments.id")
+
+	queryString, queryStringArgs, err = paymentsQuery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []ledgerPayment{}
+	if err := db.Select(&payments, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	paymentsByReceipt := map[string][]ledgerPayment{}
+	for _, payment := range payments {
+		paymentsByReceipt[payment.ReceiptID] = append(paymentsByReceipt[payment.ReceiptID], payment)
+	}
+
+	transactions := []*ledgerTransaction{}
+	for start := 0; start < len(lines); {
+		end := start
+		for end < len(lines) && lines[end].ReceiptID == lines[start].ReceiptID {
+			end++
+		}
+
+		first := lines[start]
+		transaction := &ledgerTransaction{
+			receiptID: first.ReceiptID,
+			date:      inTimeZone(first.PurchasedAt, first.TimeZone).Format("2006-01-02"),
+			payee:     first.Location,
+			currency:  first.Currency,
+			fiscalID:  first.FiscalID,
+			notes:     first.Notes,
+		}
+
+		// Lines are grouped by account before the receipt discount is split
+		// so each account gets a single share
+		for _, line := range lines[start:end] {
+			transaction.post(accounts.expense(line.Item, line.Category, tags[line.ItemID], line.Location), line.Total)
+		}
+
+		amounts := make([]Money, len(transaction.postings))
+		for i, posting := range transaction.postings {
+			amounts[i] = posting.amount
+		}
+
+		var total Money
+		for i, share := range splitDiscount(amounts, NewDiscount(first.DiscountType, first.DiscountValue)) {
+			transaction.postings[i].amount -= share
+			total += transaction.postings[i].amount
+		}
+
+		for _, payment := range paymentsByReceipt[first.ReceiptID] {
+			transaction.post(accounts.asset(payment.Name, payment.Type), -payment.Amount)
+			total -= payment.Amount
+		}
+		transaction.post(accounts.Asset, -total)
+
+		if transaction.compact() {
+			transactions = append(transactions, transaction)
+		}
+
+		start = end
+	}
+
+	return transactions, nil
+}
+
+// ledgerText converts text to a single line that can be written to a journal
+func ledgerText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// beancountString quotes text as a beancount string
+func beancountString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(ledgerText(text)) + `"`
+}
+
+// writeLedgerPostings writes postings with amounts aligned to the right
+func writeLedgerPostings(b *bytes.Buffer, indent string, transaction *ledgerTransaction) {
+	width := 0
+	for _, posting := range transaction.postings {
+		if n := utf8.RuneCountInString(posting.account) + len(posting.amount.String()); n > width {
+			width = n
+		}
+	}
+
+	for _, posting := range transaction.postings {
+		amount := posting.amount.String()
+		padding := strings.Repeat(" ", width-utf8.RuneCountInString(posting.account)-len(amount)+2)
+		b.WriteString(indent + posting.account + padding + amount + " " + transaction.currency + "\n")
+	}
+}
+
+// writeLedger writes transactions as a ledger journal. Fiscal ids are codes
+// of transactions and receipt ids and notes are comments.
+func writeLedger(b *bytes.Buffer, transactions []*ledgerTransaction) {
+	for _, transaction := range transactions {
+		b.WriteString(transaction.date + " *")
+		if transaction.fiscalID != "" {
+			b.WriteString(" (" + ledgerText(transaction.fiscalID) + ")")
+		}
+		b.WriteString(" " + ledgerText(transaction.payee) + "\n")
+		b.WriteString("    ; Receipt: " + transaction.receiptID + "\n")
+		for _, line := range strings.Split(strings.TrimSpace(transaction.notes), "\n") {
+			if line = ledgerText(line); line != "" {
+				b.WriteString("    ; " + line + "\n")
+			}
+		}
+		writeLedgerPostings(b, "    ", transaction)
+		b.WriteString("\n")
+	}
+}
+
+// writeHledger writes transactions as an hledger journal. Notes are written
+// after the payee and receipt ids are tags.
+func writeHledger(b *bytes.Buffer, transactions []*ledgerTransaction) {
+	for _, transaction := range transactions {
+		b.WriteString(transaction.date + " *")
+		if transaction.fiscalID != "" {
+			b.WriteString(" (" + ledgerText(transaction.fiscalID) + ")")
+		}
+		// Payees end at the first pipe so it's removed from the payee
+		b.WriteString(" " + ledgerText(strings.Replace(transaction.payee, "|", " ", -1)))
+		if notes := ledgerText(transaction.notes); notes != "" {
+			b.WriteString(" | " + notes)
+		}
+		b.WriteString("  ; receipt:" + transaction.receiptID + "\n")
+		writeLedgerPostings(b, "    ", transaction)
+		b.WriteString("\n")
+	}
+}
+
+// writeBeancount writes transactions as a beancount file. Accounts are opened
+// on the date of their first transaction and receipt and fiscal ids are
+// metadata of transactions.
+func writeBeancount(b *bytes.Buffer, transactions []*ledgerTransaction) error {
+	opened := map[string]string{}
+	accounts := []string{}
+	for _, transaction := range transactions {
+		for _, posting := range transaction.postings {
+			if _, ok := opened[posting.account]; ok {
+				continue
+			}
+			if !beancountAccountRegexp.MatchString(posting.account) {
+				return fmt.Errorf("%v: %s", ErrBeancountAccount, posting.account)
+			}
+			opened[posting.account] = transaction.date
+			accounts = append(accounts, posting.account)
+		}
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return opened[accounts[i]] < opened[accounts[j]]
+	})
+	for _, account := range accounts {
+		b.WriteString(opened[account] + " open " + account + "\n")
+	}
+	if len(accounts) != 0 {
+		b.WriteString("\n")
+	}
+
+	for _, transaction := range transactions {
+		b.WriteString(transaction.date + " * " + beancountString(transaction.payee) + " " + beancountString(transaction.notes) + "\n")
+		b.WriteString("  receipt: " + beancountString(transaction.receiptID) + "\n")
+		if transaction.fiscalID != "" {
+			b.WriteString("  fiscal_id: " + beancountString(transaction.fiscalID) + "\n")
+		}
+		writeLedgerPostings(b, "  ", transaction)
+		b.WriteString("\n")
+	}
+
+	return nil
+}
+
+// GetLedgerExport is a Gin handler function for exporting receipts as a
+// ledger, hledger or beancount journal. Receipts are transactions with the
+// location as the payee and accounts of the user.
+func (o Options) GetLedgerExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var exportQueryData LedgerExportQuery
+		if err := ctx.ShouldBindQuery(&exportQueryData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(exportQueryData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if exportQueryData.Currency != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": ErrExportCurrency.Error(),
+			})
+			return
+		}
+
+		format := exportQueryData.Format
+		if format == "" {
+			format = LedgerFormat
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		accounts, err := userLedgerAccounts(o.DB, user.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		transactions, err := ledgerTransactions(o.DB, user.ID, exportQueryData.ReceiptsGetQuery, accounts)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var journal bytes.Buffer
+		extension := "journal"
+		switch format {
+		case BeancountFormat:
+			if err := writeBeancount(&journal, transactions); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			extension = "beancount"
+		case HledgerFormat:
+			writeHledger(&journal, transactions)
+		default:
+			writeLedger(&journal, transactions)
+			extension = "ledger"
+		}
+
+		ctx.Header("Content-Disposition", "attachment; filename=\"receipts."+extension+"\"")
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", journal.Bytes())
+	}
+}
+
+// GetLedgerAccounts is a Gin handler function for getting accounts of
+// the user for plain text accounting exports.
+func (o Options) GetLedgerAccounts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		accounts, err := userLedgerAccounts(o.DB, user.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, accounts)
+	}
+}
+
+// PutLedgerAccounts is a Gin handler function for replacing accounts of the
+// user for plain text accounting exports. Empty default accounts are reset.
+func (o Options) PutLedgerAccounts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var accountsData LedgerAccounts
+		if err := ctx.ShouldBindJSON(&accountsData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(accountsData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := accountsData.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DELETE FROM ledger_accounts WHERE user_id = ?", user.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Rows are inserted one by one since users can have more accounts
+		// than SQLite allows variables in a statement
+		rows := [][]interface{}{}
+		if accountsData.Expense != "" {
+			rows = append(rows, []interface{}{user.ID, "default", "expense", accountsData.Expense})
+		}
+		if accountsData.Asset != "" {
+			rows = append(rows, []interface{}{user.ID, "default", "asset", accountsData.Asset})
+		}
+		for kind, names := range accountsData.kinds() {
+			for name, account := range names {
+				rows = append(rows, []interface{}{user.ID, kind, name, account})
+			}
+		}
+
+		for _, row := range rows {
+			if _, err := tx.Exec("INSERT INTO ledger_accounts (user_id, kind, name, account) VALUES (?, ?, ?, ?)", row...); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		accounts, err := userLedgerAccounts(o.DB, user.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, accounts)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// newLedgerTestDB creates a database with receipts of a user for exports.
+// Receipts have a split payment, a receipt discount on items of different
+// accounts, a refund and a foreign currency. Items have categories and tags.
+func newLedgerTestDB(t *testing.T) (*sqlx.DB, int) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	spar := insertID(t, db, "INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (?, ?, 'spar', 'Spar', 'Mariahilfer Straße 1')", household.UserID, household.HouseholdID)
+
+	item := func(publicID, name string, price Money) int64 {
+		return insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, ?, ?, ?, 'kom')", household.UserID, household.HouseholdID, publicID, name, price)
+	}
+	milk := item("milk", "Mleko", 12999)
+	bread := item("bread", "Hleb", 6499)
+	detergent := item("detergent", "Deterdžent", 49999)
+	coffee := item("coffee", "Kafa", 109999)
+
+	// Milk and bread get accounts of their tag and category, the account of
+	// detergent is preferred over the account of its category
+	db.MustExec("UPDATE items SET category = 'Bakery' WHERE id = ?", bread)
+	db.MustExec("UPDATE items SET category = 'Household' WHERE id = ?", detergent)
+	db.MustExec("INSERT INTO item_tags (item_id, household_id, tag) VALUES (?, ?, 'fresh'), (?, ?, 'dairy')", milk, household.HouseholdID, milk, household.HouseholdID)
+
+	method := func(publicID, name, methodType string) int64 {
+		return insertID(t, db, "INSERT INTO payment_methods (public_id, household_id, created_by, name, type) VALUES (?, ?, ?, ?, ?)", publicID, household.HouseholdID, household.UserID, name, methodType)
+	}
+	cash := method("cash", "Gotovina", "cash")
+	visa := method("visa", "Visa", "card")
+	dina := method("dina", "Dina", "card")
+
+	utc := func(day, hour, min int) time.Time {
+		return time.Date(2023, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	// Paid partly in cash and partly with a card
+	split := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, notes, fiscal_id) VALUES (?, ?, ?, 'split', ?, 'Europe/Belgrade', ?, 'AB12CD34-AB12CD34-12345')", household.LocationID, household.HouseholdID, household.UserID, utc(14, 17, 42), "Weekly shopping\n  with the kids")
+	splitMilk := insertID(t, db, "INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'split-milk', 2)", split, milk)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'split-bread', 1)", split, bread)
+	db.MustExec("INSERT INTO receipt_payments (receipt_id, payment_method_id, amount) VALUES (?, ?, 12497), (?, ?, 20000)", split, cash, split, visa)
+
+	// Receipt discount is split between groceries and household expenses and
+	// the part without payments is paid in cash. Purchase is after midnight in
+	// Belgrade so it's on the next day.
+	discount := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, discount_type, discount_value) VALUES (?, ?, ?, 'discount', ?, 'Europe/Belgrade', 'percent', 1000)", household.LocationID, household.HouseholdID, household.UserID, utc(15, 23, 30))
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'discount-milk', 1)", discount, milk)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'discount-detergent', 1)", discount, detergent)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, discount_type, discount_value) VALUES (?, ?, 'discount-coffee', 1, 'fixed', 10000)", discount, coffee)
+	db.MustExec("INSERT INTO receipt_payments (receipt_id, payment_method_id, amount) VALUES (?, ?, 100000)", discount, dina)
+
+	// Refund of a bottle of milk from the first receipt
+	refund := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, refund_of, fiscal_id) VALUES (?, ?, ?, 'refund', ?, 'Europe/Belgrade', ?, 'AB12CD34-AB12CD34-12399')", household.LocationID, household.HouseholdID, household.UserID, utc(17, 8, 5), split)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, refund_of) VALUES (?, ?, 'refund-milk', -1, ?)", refund, milk, splitMilk)
+
+	// Bought in euros with a card
+	euro := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, currency, notes) VALUES (?, ?, ?, 'euro', ?, 'Europe/Vienna', 'EUR', 'Coffee \"to go\"')", spar, household.HouseholdID, household.UserID, utc(20, 10, 0))
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, price) VALUES (?, ?, 'euro-coffee', 2, 899)", euro, coffee)
+	db.MustExec("INSERT INTO receipt_payments (receipt_id, payment_method_id, amount) VALUES (?, ?, 1798)", euro, visa)
+
+	return db, household.UserID
+}
+
+func TestLedgerExport(t *testing.T) {
+	db, userID := newLedgerTestDB(t)
+
+	accounts := &LedgerAccounts{
+		Expense:        defaultExpenseAccount,
+		Asset:          defaultAssetAccount,
+		Items:          map[string]string{"Deterdžent": "Expenses:Household"},
+		Categories:     map[string]string{"Bakery": "Expenses:Food:Bakery", "Household": "Expenses:Cleaning"},
+		Tags:           map[string]string{"dairy": "Expenses:Food:Dairy", "fresh": "Expenses:Food:Fresh"},
+		Locations:      map[string]string{"Spar": "Expenses:Travel"},
+		PaymentMethods: map[string]string{"Visa": "Liabilities:Visa"},
+		PaymentTypes:   map[string]string{"card": "Assets:Bank"},
+	}
+	transactions, err := ledgerTransactions(db, userID, ReceiptsGetQuery{}, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formats := []struct {
+		file  string
+		write func(b *bytes.Buffer) error
+	}{
+		{"receipts.ledger", func(b *bytes.Buffer) error {
+			writeLedger(b, transactions)
+			return nil
+		}},
+		{"receipts.hledger", func(b *bytes.Buffer) error {
+			writeHledger(b, transactions)
+			return nil
+		}},
+		{"receipts.beancount", func(b *bytes.Buffer) error {
+			return writeBeancount(b, transactions)
+		}},
+	}
+
+	for _, format := range formats {
+		t.Run(format.file, func(t *testing.T) {
+			var got bytes.Buffer
+			if err := format.write(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "ledger", format.file)
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("export doesn't match %s, run the test with -update if the change is expected\ngot:\n%s", golden, got.Bytes())
+			}
+		})
+	}
+}
+
+func TestLedgerExportInvalidBeancountAccount(t *testing.T) {
+	db, userID := newLedgerTestDB(t)
+
+	accounts := &LedgerAccounts{
+		Expense: "Groceries",
+		Asset:   defaultAssetAccount,
+	}
+	transactions, err := ledgerTransactions(db, userID, ReceiptsGetQuery{}, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := writeBeancount(&b, transactions); err == nil {
+		t.Error("beancount export with an invalid account succeeded")
+	}
+}
+
+func TestLedgerAccountsExpense(t *testing.T) {
+	accounts := &LedgerAccounts{
+		Expense:    defaultExpenseAccount,
+		Items:      map[string]string{"Mleko": "Expenses:Milk"},
+		Categories: map[string]string{"Dairy": "Expenses:Dairy"},
+		Tags:       map[string]string{"fresh": "Expenses:Fresh", "organic": "Expenses:Organic"},
+		Locations:  map[string]string{"Spar": "Expenses:Travel"},
+	}
+
+	tests := []struct {
+		item     string
+		category string
+		tags     []string
+		location string
+		want     string
+	}{
+		{"Mleko", "Dairy", []string{"fresh"}, "Spar", "Expenses:Milk"},
+		{"Jogurt", "Dairy", []string{"fresh"}, "Spar", "Expenses:Dairy"},
+		{"Jogurt", "Bakery", []string{"fresh", "organic"}, "Spar", "Expenses:Fresh"},
+		{"Jogurt", "", []string{"local", "organic"}, "Spar", "Expenses:Organic"},
+		{"Jogurt", "Bakery", []string{"local"}, "Spar", "Expenses:Travel"},
+		{"Jogurt", "", nil, "Maxi", defaultExpenseAccount},
+	}
+	for _, test := range tests {
+		if got := accounts.expense(test.item, test.category, test.tags, test.location); got != test.want {
+			t.Errorf("%s %q %v at %s: got %s, want %s", test.item, test.category, test.tags, test.location, got, test.want)
+		}
+	}
+}
@@ -16,13 +16,18 @@ import (
 
 // LocationsGetQuery : Structure that should be used for getting query data on get request for locations
 type LocationsGetQuery struct {
-	Name string `form:"name"`
+	Name        string `form:"name"`
+	HouseholdID string `form:"householdId"`
 }
 
 // LocationsPostBody : Structure that should be used for getting json from body of a post request for locations
 type LocationsPostBody struct {
-	Name    string `json:"name" validate:"required"`
-	Address string `json:"address" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Address     string `json:"address" validate:"required"`
+	HouseholdID string `json:"householdId"`
+	// TaxID is the tax identification number of the company, it's used to
+	// match locations of imported fiscal receipts
+	TaxID string `json:"taxId"`
 }
 
 // LocationsPutBody : Structure that should be used for getting json from body of a put request for locations
@@ -30,6 +35,8 @@ type LocationsPutBody struct {
 	PublicID string `json:"id" validate:"required"`
 	Name     string `json:"name"`
 	Address  string `json:"address"`
+	// TaxID replaces the tax id of the location, an empty string removes it
+	TaxID *string `json:"taxId"`
 }
 
 // LocationsDeleteBody : Structure that should be used for getting json data from body of a delete request for locations
@@ -37,13 +44,21 @@ type LocationsDeleteBody struct {
 	PublicID string `json:"id" validate:"required"`
 }
 
+// LocationsDeleteQuery : Structure that should be used for getting query data of a delete request for locations
+type LocationsDeleteQuery struct {
+	Cascade bool `form:"cascade"`
+}
+
 // Location : Structure that should be used for getting location information from database
 type Location struct {
-	PublicID  string    `db:"public_id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	Address   string    `db:"address" json:"address"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	PublicID    string    `db:"public_id" json:"id"`
+	HouseholdID string    `db:"household_id" json:"householdId"`
+	CreatedBy   string    `db:"created_by" json:"createdBy"`
+	Name        string    `db:"name" json:"name"`
+	Address     string    `db:"address" json:"address"`
+	TaxID       *string   `db:"tax_id" json:"taxId"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updatedAt"`
 }
 
 // GetLocations is a Gin handler function for getting locations.
@@ -73,10 +88,13 @@ func (o Options) GetLocations() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Select("public_id, name, address, created_at, updated_at").From("locations").Where(sq.Eq{"created_by": user.ID})
+		query := sq.Select("locations.public_id, households.public_id AS household_id, users.public_id AS created_by, locations.name, locations.address, locations.tax_id, locations.created_at, locations.updated_at").From("locations").Join("households ON households.id = locations.household_id").Join("users ON users.id = locations.created_by").Where(MemberOf("locations.household_id", user.ID)).Where(NotDeleted("locations"))
 
 		if searchQuery.Name != "" {
-			query = query.Where("name LIKE ?", fmt.Sprint("%", searchQuery.Name, "%"))
+			query = query.Where("locations.name LIKE ?", fmt.Sprint("%", searchQuery.Name, "%"))
+		}
+		if searchQuery.HouseholdID != "" {
+			query = query.Where(sq.Eq{"households.public_id": searchQuery.HouseholdID})
 		}
 
 		queryString, queryStringArgs, err := query.ToSql()
@@ -126,6 +144,27 @@ func (o Options) PostLocations() gin.HandlerFunc {
 			return
 		}
 
+		household, err := WritableHouseholdID(o.DB, user.ID, locationData.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to add locations to specified household",
+			})
+			return
+		}
+
+		duplicate, err := duplicateName(o.DB, "locations", sq.Eq{"household_id": household.ID}, locationData.Name, "")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if duplicate != nil {
+			ctx.JSON(http.StatusConflict, nameConflict("locations", duplicate))
+			return
+		}
+
 		uuid, err := nanoid.Nanoid()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -134,7 +173,7 @@ func (o Options) PostLocations() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Insert("locations").Columns("public_id", "name", "address", "created_by").Values(uuid, locationData.Name, locationData.Address, user.ID)
+		query := sq.Insert("locations").Columns("public_id", "name", "address", "tax_id", "created_by", "household_id").Values(uuid, locationData.Name, locationData.Address, nullableText(locationData.TaxID), user.ID, household.ID)
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -153,6 +192,20 @@ func (o Options) PostLocations() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				duplicate, err := duplicateName(o.DB, "locations", sq.Eq{"household_id": household.ID}, locationData.Name, "")
+				if err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusConflict, nameConflict("locations", duplicate))
+				return
+			}
+
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -205,7 +258,7 @@ func (o Options) PutLocations() gin.HandlerFunc {
 			return
 		}
 
-		userOwnsQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": locationData.PublicID, "created_by": user.ID})
+		userOwnsQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": locationData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
 
 		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
 		if err != nil {
@@ -231,6 +284,21 @@ func (o Options) PutLocations() gin.HandlerFunc {
 			return
 		}
 
+		if locationData.Name != "" {
+			duplicate, err := duplicateName(o.DB, "locations", sq.And{sameHouseholdAs("locations", locationData.PublicID), MemberOf("household_id", user.ID)}, locationData.Name, locationData.PublicID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if duplicate != nil {
+				ctx.JSON(http.StatusConflict, nameConflict("locations", duplicate))
+				return
+			}
+		}
+
 		query := sq.Update("locations")
 
 		if locationData.Name != "" {
@@ -239,6 +307,9 @@ func (o Options) PutLocations() gin.HandlerFunc {
 		if locationData.Address != "" {
 			query = query.Set("address", locationData.Address)
 		}
+		if locationData.TaxID != nil {
+			query = query.Set("tax_id", nullableText(*locationData.TaxID))
+		}
 
 		query = query.Set("updated_at", time.Now())
 
@@ -259,6 +330,20 @@ func (o Options) PutLocations() gin.HandlerFunc {
 		}
 
 		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+			tx.Rollback()
+			if isUniqueConstraintError(err) {
+				duplicate, err := duplicateName(o.DB, "locations", sq.And{sameHouseholdAs("locations", locationData.PublicID), MemberOf("household_id", user.ID)}, locationData.Name, locationData.PublicID)
+				if err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+					return
+				}
+
+				ctx.JSON(http.StatusConflict, nameConflict("locations", duplicate))
+				return
+			}
+
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -276,7 +361,9 @@ func (o Options) PutLocations() gin.HandlerFunc {
 	}
 }
 
-// DeleteLocations is a Gin handler function for deleting a location.
+// DeleteLocations is a Gin handler function for moving a location to the
+// trash. Location used by receipts is deleted with its receipts only if
+// cascade is requested.
 func (o Options) DeleteLocations() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		createdBy, createdByExists := GetUserID(ctx)
@@ -287,6 +374,14 @@ func (o Options) DeleteLocations() gin.HandlerFunc {
 			return
 		}
 
+		var deleteQuery LocationsDeleteQuery
+		if err := ctx.ShouldBindQuery(&deleteQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		var locationData LocationsDeleteBody
 		if err := ctx.ShouldBindJSON(&locationData); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{
@@ -311,7 +406,7 @@ func (o Options) DeleteLocations() gin.HandlerFunc {
 			return
 		}
 
-		userOwnsQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": locationData.PublicID, "created_by": user.ID})
+		userOwnsQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": locationData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
 
 		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
 		if err != nil {
@@ -329,8 +424,23 @@ func (o Options) DeleteLocations() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Delete("locations").Where(sq.Eq{"public_id": locationData.PublicID})
-		queryString, queryStringArgs, err := query.ToSql()
+		var receipts int
+		if err := o.DB.Get(&receipts, "SELECT COUNT(*) FROM receipts WHERE location_id = ? AND deleted_at IS NULL", location.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if receipts != 0 && !deleteQuery.Cascade {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message":  "location is used by receipts",
+				"receipts": receipts,
+			})
+			return
+		}
+
+		batch, err := nanoid.Nanoid()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -346,7 +456,18 @@ func (o Options) DeleteLocations() gin.HandlerFunc {
 			return
 		}
 
-		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+		if _, err := tx.Exec("UPDATE locations SET deleted_at = current_timestamp, delete_batch = ? WHERE id = ?", batch, location.ID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		// Receipts are moved to the trash in the same batch as the location so
+		// they can be restored together
+		if _, err := tx.Exec("UPDATE receipts SET deleted_at = (SELECT deleted_at FROM locations WHERE id = ?), delete_batch = ? WHERE location_id = ? AND deleted_at IS NULL", location.ID, batch, location.ID); err != nil {
+			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeleteRecordsInUse(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 150, 'l')", household.UserID, household.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'first')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, deleted_at) VALUES (?, ?, ?, 'trashed', current_timestamp)", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'second')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 1)", receipt, item)
+
+	// Records in the trash don't count as dependents
+	conflicts := []struct {
+		handler gin.HandlerFunc
+		route   string
+		body    string
+		want    map[string]interface{}
+	}{
+		{options.DeleteLocations(), "/locations", `{"id": "user-location"}`, map[string]interface{}{
+			"message":  "location is used by receipts",
+			"receipts": float64(2),
+		}},
+		{options.DeleteItems(), "/items", `{"id": "milk"}`, map[string]interface{}{
+			"message":        "item is used in receipts",
+			"itemsInReceipt": float64(1),
+		}},
+	}
+	for _, conflict := range conflicts {
+		recorder := serve(conflict.handler, conflict.route, "user", http.MethodDelete, conflict.route, conflict.body)
+		if recorder.Code != http.StatusConflict {
+			t.Errorf("%s: got %d %s, want %d", conflict.route, recorder.Code, recorder.Body, http.StatusConflict)
+			continue
+		}
+
+		got := map[string]interface{}{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, conflict.want) {
+			t.Errorf("%s: got %v, want %v", conflict.route, got, conflict.want)
+		}
+	}
+
+	// Items are trashed without their lines so receipts don't change
+	if recorder := serve(options.DeleteItems(), "/items", "user", http.MethodDelete, "/items?cascade=true", `{"id": "milk"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("deleting an item with cascade: got %d %s", recorder.Code, recorder.Body)
+	}
+	var lines int
+	if err := db.Get(&lines, "SELECT COUNT(*) FROM items_in_receipt WHERE public_id = 'line'"); err != nil {
+		t.Fatal(err)
+	}
+	if lines != 1 {
+		t.Error("line of a trashed item was deleted")
+	}
+
+	// Receipts are trashed with their location
+	if recorder := serve(options.DeleteLocations(), "/locations", "user", http.MethodDelete, "/locations?cascade=true", `{"id": "user-location"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("deleting a location with cascade: got %d %s", recorder.Code, recorder.Body)
+	}
+	trashed := []string{}
+	if err := db.Select(&trashed, "SELECT public_id FROM receipts WHERE delete_batch = (SELECT delete_batch FROM locations WHERE id = ?) ORDER BY id", household.LocationID); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(trashed, want) {
+		t.Errorf("receipts trashed with the location are %v, want %v", trashed, want)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of money in minor units (e.g. cents). It's stored in the
+// database as an integer and written in JSON as a decimal number with two
+// decimal places so amounts never go through floating point numbers.
+type Money int64
+
+// moneyDecimals is the number of decimal places of minor units
+const moneyDecimals = 2
+
+// linePriceSQL is an SQL expression for the unit price of a line on a
+// receipt. Lines keep their own price if it was known when they were added
+// (e.g. imported fiscal receipts), otherwise the price of the item is used.
+const linePriceSQL = "COALESCE(items_in_receipt.price, items.price)"
+
+// lineSubtotalSQL is an SQL expression for the total of a line on a receipt
+// before discounts. Line totals are rounded half away from zero to minor units
+// before they are summed so receipt totals always equal the sum of their
+// lines. Lines of items in the trash are still counted so trashing an item
+// doesn't change receipts it was bought on.
+const lineSubtotalSQL = "CAST(ROUND(" + linePriceSQL + " * items_in_receipt.amount) AS INTEGER)"
+
+// ErrInvalidMoney is returned when an amount of money can't be parsed
+var ErrInvalidMoney = errors.New("amount of money must be a decimal number with at most 2 decimal places")
+
+// ParseMoney parses a decimal number like "12", "12.3" or "-12.34" into
+// money. Numbers with more decimal places than minor units are rejected
+// instead of being rounded.
+func ParseMoney(s string) (Money, error) {
+	amount, ok := parseHundredths(s)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+
+	return Money(amount), nil
+}
+
+// String formats money as a decimal number with two decimal places
+func (m Money) String() string {
+	return formatHundredths(int64(m))
+}
+
+// parseHundredths parses a decimal number with at most two decimal places
+// into an integer number of hundredths
+func parseHundredths(s string) (int64, bool) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		whole, fraction = s[:i], s[i+1:]
+		if fraction == "" {
+			return 0, false
+		}
+	}
+
+	if whole == "" || len(fraction) > moneyDecimals {
+		return 0, false
+	}
+	fraction += strings.Repeat("0", moneyDecimals-len(fraction))
+
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	value, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return value, true
+}
+
+// formatHundredths formats an integer number of hundredths as a decimal
+// number with two decimal places
+func formatHundredths(value int64) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	fraction := strconv.FormatInt(value%100, 10)
+	if len(fraction) < moneyDecimals {
+		fraction = "0" + fraction
+	}
+
+	return sign + strconv.FormatInt(value/100, 10) + "." + fraction
+}
+
+// Float64 converts money to a number of major units. It should only be used
+// for presenting amounts.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Multiply multiplies money by a quantity and rounds the result half away from
+// zero, the same way as lineSubtotalSQL.
+func (m Money) Multiply(quantity float64) Money {
+	return Money(math.Round(float64(m) * quantity))
+}
+
+// MarshalJSON writes money as a JSON number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads money from a JSON number or a string with a number. Null
+// leaves the money unchanged like it does for other types that aren't
+// pointers.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	amount, err := ParseMoney(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+
+	*m = amount
+	return nil
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := []struct {
+		in   string
+		want Money
+	}{
+		{"12", 1200},
+		{"12.3", 1230},
+		{"12.34", 1234},
+		{"-12.34", -1234},
+		{"0.05", 5},
+		{"0", 0},
+		{"007.10", 710},
+	}
+	for _, test := range valid {
+		got, err := ParseMoney(test.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q) failed: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+
+	invalid := []string{"1e3", "12.345", ".5", "+1", "", "-", "12.", "1,5", "1.2.3", "abc", " 1", "--1", "99999999999999999999"}
+	for _, in := range invalid {
+		if got, err := ParseMoney(in); err != ErrInvalidMoney {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %v", in, got, err, ErrInvalidMoney)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1230, "12.30"},
+		{-1234, "-12.34"},
+		{-5, "-0.05"},
+	}
+	for _, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("Money(%d).String() = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`{"price": 12.34}`, 1234},
+		{`{"price": "12.34"}`, 1234},
+		// Null leaves the price unchanged
+		{`{"price": null}`, 500},
+		{`{}`, 500},
+	}
+	for _, test := range tests {
+		got := struct {
+			Price Money `json:"price"`
+		}{Price: 500}
+		if err := json.Unmarshal([]byte(test.in), &got); err != nil {
+			t.Errorf("%s failed: %v", test.in, err)
+			continue
+		}
+		if got.Price != test.want {
+			t.Errorf("%s got price %d, want %d", test.in, got.Price, test.want)
+		}
+	}
+
+	price := Money(0)
+	if err := json.Unmarshal([]byte(`"12.345"`), &price); err == nil {
+		t.Errorf("12.345 got price %d, want an error", price)
+	}
+}
+
+func TestMoneyMultiply(t *testing.T) {
+	tests := []struct {
+		money    Money
+		quantity float64
+		want     Money
+	}{
+		{199, 3, 597},
+		// Halves are rounded away from zero, not to even
+		{5, 0.5, 3},
+		{3, 0.5, 2},
+		{-5, 0.5, -3},
+		{-3, 0.5, -2},
+		{333, 1.5, 500},
+		{1000, 0.333, 333},
+		{150, -1, -150},
+	}
+	for _, test := range tests {
+		if got := test.money.Multiply(test.quantity); got != test.want {
+			t.Errorf("Money(%d).Multiply(%v) = %d, want %d", test.money, test.quantity, got, test.want)
+		}
+	}
+}
+
+func TestTotalsSQL(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	percent := func(p Percentage) *Discount {
+		return &Discount{Percent: &p}
+	}
+	fixed := func(m Money) *Discount {
+		return &Discount{Fixed: &m}
+	}
+	price := func(m Money) *Money {
+		return &m
+	}
+
+	type line struct {
+		// Price of the line. Price of the item is used if it's nil.
+		price    *Money
+		amount   float64
+		discount *Discount
+	}
+	receipts := []struct {
+		name     string
+		discount *Discount
+		lines    []line
+	}{
+		{"empty", nil, nil},
+		{"plain", nil, []line{
+			{nil, 1, nil},
+			{nil, 3, nil},
+		}},
+		{"fractional amounts", nil, []line{
+			{price(199), 0.5, nil},
+			{price(333), 1.5, nil},
+			{price(1000), 0.333, nil},
+		}},
+		{"line discounts", nil, []line{
+			{price(999), 1, percent(1250)},
+			{price(500), 2, fixed(150)},
+			{price(100), 1, fixed(500)},
+		}},
+		{"receipt percent discount", percent(333), []line{
+			{price(1299), 1, nil},
+			{price(250), 3, percent(1000)},
+		}},
+		{"receipt fixed discount", fixed(10000), []line{
+			{price(1299), 2, nil},
+			{nil, 1, nil},
+		}},
+		{"refund", fixed(100), []line{
+			{price(150), -1, nil},
+			{price(333), -1.5, fixed(1000)},
+			{price(999), -1, percent(1250)},
+		}},
+	}
+
+	result := db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'item', 'Item', 1299, 'kom')", household.UserID, household.HouseholdID)
+	itemID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const itemPrice Money = 1299
+
+	for r, receipt := range receipts {
+		discountType, discountValue := receipt.discount.columns()
+		result := db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, discount_type, discount_value) VALUES (?, ?, ?, ?, ?, ?)", household.LocationID, household.HouseholdID, household.UserID, receipt.name, discountType, discountValue)
+		receiptID, err := result.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wantSubtotal, wantSaved Money
+		for l, line := range receipt.lines {
+			discountType, discountValue := line.discount.columns()
+			var linePrice interface{}
+			if line.price != nil {
+				linePrice = int64(*line.price)
+			}
+			publicID := receipt.name + string(rune('a'+l))
+			db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, price, discount_type, discount_value) VALUES (?, ?, ?, ?, ?, ?, ?)", receiptID, itemID, publicID, line.amount, linePrice, discountType, discountValue)
+
+			unitPrice := itemPrice
+			if line.price != nil {
+				unitPrice = *line.price
+			}
+			subtotal := unitPrice.Multiply(line.amount)
+			discount := line.discount.Amount(subtotal)
+
+			var got struct {
+				Discount Money `db:"discount"`
+				Total    Money `db:"total"`
+			}
+			if err := db.Get(&got, "SELECT "+LineDiscountSQL+" AS discount, "+LineTotalSQL+" AS total FROM items_in_receipt JOIN items ON items.id = items_in_receipt.item_id WHERE items_in_receipt.public_id = ?", publicID); err != nil {
+				t.Fatal(err)
+			}
+			if got.Discount != discount || got.Total != subtotal-discount {
+				t.Errorf("%s line %d: SQL discount %d and total %d, want %d and %d", receipt.name, l, got.Discount, got.Total, discount, subtotal-discount)
+			}
+
+			wantSubtotal += subtotal - discount
+			wantSaved += discount
+		}
+
+		receiptDiscount := receipt.discount.Amount(wantSubtotal)
+		wantTotal := wantSubtotal - receiptDiscount
+		wantSaved += receiptDiscount
+
+		var got struct {
+			Subtotal Money `db:"subtotal"`
+			Total    Money `db:"total"`
+			Saved    Money `db:"saved"`
+		}
+		if err := db.Get(&got, "SELECT "+ReceiptSubtotalSQL+" AS subtotal, "+ReceiptTotalSQL+" AS total, "+ReceiptSavedSQL+" AS saved FROM receipts LEFT JOIN items_in_receipt ON items_in_receipt.receipt_id = receipts.id LEFT JOIN items ON items.id = items_in_receipt.item_id WHERE receipts.id = ? GROUP BY receipts.id", receiptID); err != nil {
+			t.Fatal(err)
+		}
+		if got.Subtotal != wantSubtotal || got.Total != wantTotal || got.Saved != wantSaved {
+			t.Errorf("receipt %d (%s): SQL subtotal %d, total %d, saved %d, want %d, %d, %d", r, receipt.name, got.Subtotal, got.Total, got.Saved, wantSubtotal, wantTotal, wantSaved)
+		}
+	}
+}
+
+func TestTotalsSQLKeepsTrashedItems(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	db.MustExec("INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 150, 'l'), (?, ?, 'bread', 'Bread', 120, 'kom')", household.UserID, household.HouseholdID, household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'receipt')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (1, 1, 'a', 2), (1, 2, 'b', 1)")
+
+	total := func() Money {
+		var total Money
+		if err := db.Get(&total, "SELECT "+ReceiptTotalSQL+" FROM receipts LEFT JOIN items_in_receipt ON items_in_receipt.receipt_id = receipts.id LEFT JOIN items ON items.id = items_in_receipt.item_id GROUP BY receipts.id"); err != nil {
+			t.Fatal(err)
+		}
+		return total
+	}
+
+	if got := total(); got != 420 {
+		t.Errorf("total before deleting items is %d, want 420", got)
+	}
+
+	// Trashing items doesn't change receipts they were bought on
+	db.MustExec("UPDATE items SET deleted_at = current_timestamp")
+	if got := total(); got != 420 {
+		t.Errorf("total with trashed items is %d, want 420", got)
+	}
+}
@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// PaymentMethodsGetQuery : Structure that should be used for getting query data on get request for payment methods
+type PaymentMethodsGetQuery struct {
+	HouseholdID string `form:"householdId"`
+}
+
+// PaymentMethodsPostBody : Structure that should be used for getting json from body of a post request for payment methods
+type PaymentMethodsPostBody struct {
+	Name        string `json:"name" validate:"required"`
+	Type        string `json:"type" validate:"omitempty,oneof=cash card voucher other"`
+	HouseholdID string `json:"householdId"`
+}
+
+// PaymentMethodsPutBody : Structure that should be used for getting json from body of a put request for payment methods
+type PaymentMethodsPutBody struct {
+	PublicID string `json:"id" validate:"required"`
+	Name     string `json:"name"`
+	Type     string `json:"type" validate:"omitempty,oneof=cash card voucher other"`
+}
+
+// PaymentMethodsDeleteBody : Structure that should be used for getting json data from body of a delete request for payment methods
+type PaymentMethodsDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// PaymentsPutBody : Structure that should be used for getting json from body of a put request for payments of a receipt
+type PaymentsPutBody struct {
+	Payments []PaymentBody `json:"payments" validate:"dive"`
+}
+
+// PaymentBody : Structure that should be used for getting a single payment of a receipt. Amount can be left out only if the receipt is paid with a single payment method.
+type PaymentBody struct {
+	MethodID string `json:"methodId" validate:"required"`
+	Amount   *Money `json:"amount" validate:"omitempty,min=1"`
+}
+
+// PaymentMethod : Structure that should be used for getting payment method information from database
+type PaymentMethod struct {
+	PublicID    string    `db:"public_id" json:"id"`
+	HouseholdID string    `db:"household_id" json:"householdId"`
+	CreatedBy   string    `db:"created_by" json:"createdBy"`
+	Name        string    `db:"name" json:"name"`
+	Type        string    `db:"type" json:"type"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// Payment : Structure that should be used for getting payments of a receipt from database
+type Payment struct {
+	ReceiptID string `db:"receipt_id" json:"-"`
+	MethodID  string `db:"method_id" json:"methodId"`
+	Name      string `db:"name" json:"name"`
+	Type      string `db:"type" json:"type"`
+	Amount    Money  `db:"amount" json:"amount"`
+}
+
+// PaidWith creates a condition that matches receipts paid with a payment
+// method with the public id or of the type
+func PaidWith(column string, value string) sq.Sqlizer {
+	return sq.Expr("receipts.id IN (SELECT receipt_payments.receipt_id FROM receipt_payments JOIN payment_methods ON payment_methods.id = receipt_payments.payment_method_id WHERE payment_methods."+column+" = ?)", value)
+}
+
+// PaymentsMismatch checks if a receipt has payments that don't add up to its
+// total, e.g. because its lines were changed after the payments were set
+func PaymentsMismatch(payments []Payment, total Money) bool {
+	if len(payments) == 0 {
+		return false
+	}
+
+	var paid Money
+	for _, payment := range payments {
+		paid += payment.Amount
+	}
+	return paid != total
+}
+
+// ReceiptPayments gets payments of receipts with specified ids
+func ReceiptPayments(db *sqlx.DB, receiptIDs []string) (map[string][]Payment, error) {
+	payments := map[string][]Payment{}
+	if len(receiptIDs) == 0 {
+		return payments, nil
+	}
+
+	query := sq.Select("receipts.public_id AS receipt_id, payment_methods.public_id AS method_id, payment_methods.name, payment_methods.type, receipt_payments.amount").From("receipt_payments").Join("receipts ON receipts.id = receipt_payments.receipt_id").Join("payment_methods ON payment_methods.id = receipt_payments.payment_method_id").Where(sq.Eq{"receipts.public_id": receiptIDs}).OrderBy("receipt_payments.id")
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []Payment{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	for _, payment := range rows {
+		payments[payment.ReceiptID] = append(payments[payment.ReceiptID], payment)
+	}
+
+	return payments, nil
+}
+
+// GetPaymentMethods is a Gin handler function for getting payment methods.
+func (o Options) GetPaymentMethods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery PaymentMethodsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("payment_methods.public_id, households.public_id AS household_id, users.public_id AS created_by, payment_methods.name, payment_methods.type, payment_methods.created_at, payment_methods.updated_at").From("payment_methods").Join("households ON households.id = payment_methods.household_id").Join("users ON users.id = payment_methods.created_by").Where(MemberOf("payment_methods.household_id", user.ID)).OrderBy("payment_methods.name")
+
+		if searchQuery.HouseholdID != "" {
+			query = query.Where(sq.Eq{"households.public_id": searchQuery.HouseholdID})
+		}
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		methods := []PaymentMethod{}
+		if err := o.DB.Select(&methods, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, methods)
+	}
+}
+
+// PostPaymentMethods is a Gin handler function for adding new payment methods.
+func (o Options) PostPaymentMethods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var methodData PaymentMethodsPostBody
+		if err := ctx.ShouldBindJSON(&methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		household, err := WritableHouseholdID(o.DB, user.ID, methodData.HouseholdID)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to add payment methods to specified household",
+			})
+			return
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		methodType := methodData.Type
+		if methodType == "" {
+			methodType = "other"
+		}
+
+		query := sq.Insert("payment_methods").Columns("public_id", "household_id", "created_by", "name", "type").Values(uuid, household.ID, user.ID, methodData.Name, methodType)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "payment method with the same name already exists",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"id": uuid,
+		})
+	}
+}
+
+// PutPaymentMethods is a Gin handler function for updating a payment method.
+func (o Options) PutPaymentMethods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var methodData PaymentMethodsPutBody
+		if err := ctx.ShouldBindJSON(&methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("payment_methods").Set("updated_at", time.Now())
+
+		if methodData.Name != "" {
+			query = query.Set("name", methodData.Name)
+		}
+		if methodData.Type != "" {
+			query = query.Set("type", methodData.Type)
+		}
+
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": methodData.PublicID}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "payment method with the same name already exists",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to update specified payment method",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeletePaymentMethods is a Gin handler function for deleting a payment
+// method. Payment methods used by receipts can't be deleted.
+func (o Options) DeletePaymentMethods() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var methodData PaymentMethodsDeleteBody
+		if err := ctx.ShouldBindJSON(&methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(methodData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		userOwnsQuery := sq.Select("id").From("payment_methods").Where(sq.Eq{"public_id": methodData.PublicID}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var method StructID
+		if err := o.DB.Get(&method, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to delete specified payment method",
+			})
+			return
+		}
+
+		// Receipts in the trash still reference the payment method
+		var receipts int
+		if err := o.DB.Get(&receipts, "SELECT COUNT(DISTINCT receipt_id) FROM receipt_payments WHERE payment_method_id = ?", method.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if receipts != 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message":  "payment method is used by receipts",
+				"receipts": receipts,
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec("DELETE FROM payment_methods WHERE id = ?", method.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// PutPayments is a Gin handler function for replacing payments of a receipt.
+// Amounts of payments have to add up to the total of the receipt when they are
+// set and an empty list removes all payments. Lines and discounts of the
+// receipt can change its total later, receipts show that with
+// paymentsMismatch.
+func (o Options) PutPayments() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var paymentsData PaymentsPutBody
+		if err := ctx.ShouldBindJSON(&paymentsData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(paymentsData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receiptQuery := sq.Select("receipts.id, receipts.household_id, " + ReceiptTotalSQL + " AS total_price").From("receipts").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").Where(sq.Eq{"receipts.public_id": ctx.Param("id"), "receipts.deleted_at": nil}).Where(MemberOf("receipts.household_id", user.ID, WriteRoles...)).GroupBy("receipts.id")
+
+		receiptQueryString, receiptQueryStringArgs, err := receiptQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receipt := struct {
+			ID          int   `db:"id"`
+			HouseholdID int   `db:"household_id"`
+			TotalPrice  Money `db:"total_price"`
+		}{}
+		if err := o.DB.Get(&receipt, receiptQueryString, receiptQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to edit payments of specified receipt",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		// A single payment without an amount pays the whole total which is
+		// zero for receipts that were fully discounted
+		payments := paymentsData.Payments
+		whole := len(payments) == 1 && payments[0].Amount == nil
+		if whole {
+			payments[0].Amount = &receipt.TotalPrice
+		}
+
+		var paid Money
+		methods := map[string]bool{}
+		for _, payment := range payments {
+			if payment.Amount == nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": "amounts must be specified for split payments",
+				})
+				return
+			}
+			if *payment.Amount < 0 || (*payment.Amount == 0 && !whole) {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": "amounts of payments must be positive",
+				})
+				return
+			}
+			if methods[payment.MethodID] {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": "payment method can only be used once for a receipt",
+					"id":      payment.MethodID,
+				})
+				return
+			}
+			methods[payment.MethodID] = true
+			paid += *payment.Amount
+		}
+
+		if len(payments) != 0 && paid != receipt.TotalPrice {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message":    "payments must add up to the total of the receipt",
+				"totalPrice": receipt.TotalPrice,
+				"paid":       paid,
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := tx.Exec("DELETE FROM receipt_payments WHERE receipt_id = ?", receipt.ID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, payment := range payments {
+			// Payment method has to be in the same household as the receipt
+			var method StructID
+			if err := tx.Get(&method, "SELECT id FROM payment_methods WHERE public_id = ? AND household_id = ?", payment.MethodID, receipt.HouseholdID); err != nil {
+				tx.Rollback()
+				switch err {
+				case sql.ErrNoRows:
+					ctx.JSON(http.StatusBadRequest, gin.H{
+						"message": "payment method does not exist",
+						"id":      payment.MethodID,
+					})
+					break
+				default:
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+				}
+				return
+			}
+
+			if _, err := tx.Exec("INSERT INTO receipt_payments (receipt_id, payment_method_id, amount) VALUES (?, ?, ?)", receipt.ID, method.ID, *payment.Amount); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPaymentsMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		payments []Payment
+		total    Money
+		want     bool
+	}{
+		{"no payments", nil, 1000, false},
+		{"single payment", []Payment{{Amount: 1000}}, 1000, false},
+		{"split payment", []Payment{{Amount: 400}, {Amount: 600}}, 1000, false},
+		// Line was added after payments were set
+		{"total increased", []Payment{{Amount: 400}, {Amount: 600}}, 1250, true},
+		{"total decreased", []Payment{{Amount: 1000}}, 900, true},
+	}
+	for _, test := range tests {
+		if got := PaymentsMismatch(test.payments, test.total); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPutPayments(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	other := newTestHousehold(t, db, "other")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 1000, 'l')", household.UserID, household.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'receipt', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 1)", receipt, item)
+	free := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, discount_type, discount_value) VALUES (?, ?, ?, 'free', '2020-06-01 11:00:00', 'UTC', 'percent', 10000)", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'free-line', 1)", free, item)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'unpaid', '2020-06-01 12:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO payment_methods (public_id, household_id, created_by, name, type) VALUES ('cash', ?, ?, 'Cash', 'cash'), ('card', ?, ?, 'Card', 'card'), ('others-card', ?, ?, 'Card', 'card')", household.HouseholdID, household.UserID, household.HouseholdID, household.UserID, other.HouseholdID, other.UserID)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"split that doesn't add up", `{"payments": [{"methodId": "cash", "amount": 3}, {"methodId": "card", "amount": 6}]}`, http.StatusBadRequest},
+		{"split without amounts", `{"payments": [{"methodId": "cash"}, {"methodId": "card", "amount": 10}]}`, http.StatusBadRequest},
+		{"method of another household", `{"payments": [{"methodId": "others-card"}]}`, http.StatusBadRequest},
+		{"same method twice", `{"payments": [{"methodId": "cash", "amount": 4}, {"methodId": "cash", "amount": 6}]}`, http.StatusBadRequest},
+		{"zero amount", `{"payments": [{"methodId": "cash", "amount": 0}, {"methodId": "card", "amount": 10}]}`, http.StatusBadRequest},
+		{"split", `{"payments": [{"methodId": "cash", "amount": 4}, {"methodId": "card", "amount": 6}]}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if recorder := serve(options.PutPayments(), "/receipts/:id/payments", "user", http.MethodPut, "/receipts/receipt/payments", test.body); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.name, recorder.Code, recorder.Body, test.status)
+		}
+	}
+	if recorder := serve(options.PutPayments(), "/receipts/:id/payments", "other", http.MethodPut, "/receipts/receipt/payments", `{"payments": []}`); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("payments of a receipt of another household: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+
+	// Fully discounted receipts are paid with a single payment of nothing
+	if recorder := serve(options.PutPayments(), "/receipts/:id/payments", "user", http.MethodPut, "/receipts/free/payments", `{"payments": [{"methodId": "card"}]}`); recorder.Code != http.StatusOK {
+		t.Errorf("paying a free receipt: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+
+	receipts := func(query string) []string {
+		recorder := serve(options.GetReceipts(), "/receipts", "user", http.MethodGet, "/receipts"+query, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("getting receipts%s: got %d %s", query, recorder.Code, recorder.Body)
+		}
+		response := []ReceiptWithData{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, receipt := range response {
+			ids = append(ids, receipt.PublicID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	filters := map[string][]string{
+		"?paymentMethodId=cash":    {"receipt"},
+		"?paymentMethodId=card":    {"free", "receipt"},
+		"?paymentType=card":        {"free", "receipt"},
+		"?paymentType=voucher":     {},
+		"?paymentMethodId=unknown": {},
+		"":                         {"free", "receipt", "unpaid"},
+	}
+	for query, want := range filters {
+		if got := receipts(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("receipts%s are %v, want %v", query, got, want)
+		}
+	}
+
+	recorder := serve(options.GetPaymentStats(), "/stats/payment-methods", "user", http.MethodGet, "/stats/payment-methods?currency=RSD", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("getting payment stats: got %d %s", recorder.Code, recorder.Body)
+	}
+	stats := PaymentStats{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]PaymentMethodStats{}
+	for _, method := range stats.Methods {
+		got[method.PublicID] = method
+	}
+	want := map[string]PaymentMethodStats{
+		"cash": {PublicID: "cash", Name: "Cash", Type: "cash", Receipts: 1, Total: 400},
+		"card": {PublicID: "card", Name: "Card", Type: "card", Receipts: 2, Total: 600},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payment methods are %+v, want %+v", got, want)
+	}
+	if stats.Unassigned != 0 {
+		t.Errorf("unassigned total is %d, want 0 for a receipt without lines", stats.Unassigned)
+	}
+
+	// An empty list removes payments
+	if recorder := serve(options.PutPayments(), "/receipts/:id/payments", "user", http.MethodPut, "/receipts/receipt/payments", `{"payments": []}`); recorder.Code != http.StatusOK {
+		t.Fatalf("removing payments: got %d %s", recorder.Code, recorder.Body)
+	}
+	if got := receipts("?paymentType=cash"); len(got) != 0 {
+		t.Errorf("receipts paid in cash after removing payments are %v", got)
+	}
+}
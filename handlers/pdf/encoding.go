@@ -0,0 +1,125 @@
+package pdf
+
+// winAnsi are characters of Windows-1252 that are not at the same code point
+// as in Unicode
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// transliterations are letters that are not in Windows-1252. Serbian
+// Cyrillic is written in Latin script and Latin letters are written without
+// diacritics that are missing.
+var transliterations = map[rune]string{
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Ђ': "Dj", 'Е': "E",
+	'Ж': "Ž", 'З': "Z", 'И': "I", 'Ј': "J", 'К': "K", 'Л': "L", 'Љ': "Lj",
+	'М': "M", 'Н': "N", 'Њ': "Nj", 'О': "O", 'П': "P", 'Р': "R", 'С': "S",
+	'Т': "T", 'Ћ': "C", 'У': "U", 'Ф': "F", 'Х': "H", 'Ц': "C", 'Ч': "C",
+	'Џ': "Dž", 'Ш': "Š",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'ђ': "dj", 'е': "e",
+	'ж': "ž", 'з': "z", 'и': "i", 'ј': "j", 'к': "k", 'л': "l", 'љ': "lj",
+	'м': "m", 'н': "n", 'њ': "nj", 'о': "o", 'п': "p", 'р': "r", 'с': "s",
+	'т': "t", 'ћ': "c", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c", 'ч': "c",
+	'џ': "dž", 'ш': "š",
+	'Č': "C", 'č': "c", 'Ć': "C", 'ć': "c", 'Đ': "Dj", 'đ': "dj",
+	'Ő': "Ö", 'ő': "ö", 'Ű': "Ü", 'ű': "ü", 'Ł': "L", 'ł': "l",
+	'Ś': "S", 'ś': "s", 'Ź': "Z", 'ź': "z", 'Ż': "Z", 'ż': "z", 'Ń': "N",
+	'ń': "n", 'Ą': "A", 'ą': "a", 'Ę': "E", 'ę': "e", 'Ř': "R", 'ř': "r",
+	'Ě': "E", 'ě': "e", 'Ů': "U", 'ů': "u", 'Ť': "T", 'ť': "t", 'Ď': "D",
+	'ď': "d", 'Ň': "N", 'ň': "n", 'Ľ': "L", 'ľ': "l", 'Ă': "A", 'ă': "a",
+	'Ș': "S", 'ș': "s", 'Ț': "T", 'ț': "t", 'Ğ': "G", 'ğ': "g", 'İ': "I",
+	'ı': "i", 'Ş': "S", 'ş': "s",
+	'−': "-", '‐': "-", ' ': " ",
+}
+
+// encode encodes text in Windows-1252. Characters that can't be encoded or
+// transliterated are replaced with a question mark.
+func encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, c := range text {
+		if t, ok := transliterations[c]; ok {
+			encoded = append(encoded, encode(t)...)
+			continue
+		}
+		encoded = append(encoded, encodeRune(c))
+	}
+	return encoded
+}
+
+// encodeRune encodes a character that doesn't have to be transliterated
+func encodeRune(c rune) byte {
+	if b, ok := winAnsi[c]; ok {
+		return b
+	}
+	if (c >= 0x20 && c < 0x7f) || (c >= 0xa0 && c <= 0xff) {
+		return byte(c)
+	}
+	if c == '\n' || c == '\r' || c == '\t' {
+		return byte(c)
+	}
+	return '?'
+}
+
+// latinBase are letters of Windows-1252 with diacritics and the letters they
+// are based on. They have the same width as their base letter.
+var latinBase = map[string]string{
+	"A": "ÀÁÂÃÄÅ", "C": "Ç", "E": "ÈÉÊË", "I": "ÌÍÎÏ", "N": "Ñ",
+	"O": "ÒÓÔÕÖØ", "U": "ÙÚÛÜ", "Y": "ÝŸ", "S": "Š", "Z": "Ž",
+	"a": "àáâãäå", "c": "ç", "e": "èéêë", "i": "ìíîï", "n": "ñ",
+	"o": "òóôõöø", "u": "ùúûü", "y": "ýÿ", "s": "š", "z": "ž",
+}
+
+// baseLetters are base letters by their encoded letter with diacritics
+var baseLetters = func() map[byte]byte {
+	letters := map[byte]byte{}
+	for base, derived := range latinBase {
+		for _, c := range derived {
+			letters[encodeRune(c)] = base[0]
+		}
+	}
+	return letters
+}()
+
+// glyphWidth gets the width of an encoded character in thousandths of the
+// font size
+func glyphWidth(widths *[95]int, c byte) int {
+	if base, ok := baseLetters[c]; ok {
+		c = base
+	}
+	if c >= 0x20 && c < 0x7f {
+		return widths[c-0x20]
+	}
+
+	switch c {
+	case 0x85, 0x89, 0x97, 0x99:
+		return 1000
+	case 0x80, 0x96, 0xa3, 0xa5:
+		return 556
+	case 0xa0:
+		return widths[0]
+	}
+	return widths['n'-0x20]
+}
+
+// helveticaWidths are widths of printable ASCII characters of Helvetica
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaBoldWidths are widths of printable ASCII characters of
+// Helvetica-Bold
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
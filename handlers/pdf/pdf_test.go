@@ -0,0 +1,199 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	sizePattern      = regexp.MustCompile(`trailer\n<< /Size (\d+) /Root 1 0 R >>`)
+	entryPattern     = regexp.MustCompile(`(\d{10}) 00000 n \n`)
+	streamPattern    = regexp.MustCompile(`(?s)<< /Length (\d+) /Filter /FlateDecode >>\nstream\n(.*?)\nendstream`)
+)
+
+// write writes the document and checks that the cross-reference table points
+// at its objects
+func write(t *testing.T, d *Document) []byte {
+	var b bytes.Buffer
+	if _, err := d.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	document := b.Bytes()
+
+	if !bytes.HasPrefix(document, []byte("%PDF-1.4\n")) {
+		t.Fatalf("document starts with %q", document[:10])
+	}
+
+	match := startxrefPattern.FindSubmatch(document)
+	if match == nil {
+		t.Fatal("document doesn't end with startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(document[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point at the cross-reference table", xref)
+	}
+
+	entries := entryPattern.FindAllSubmatch(document[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if object := []byte(strconv.Itoa(i+1) + " 0 obj\n"); !bytes.HasPrefix(document[offset:], object) {
+			t.Errorf("offset %d of object %d points at %q", offset, i+1, document[offset:offset+len(object)])
+		}
+	}
+
+	size := sizePattern.FindSubmatch(document)
+	if size == nil || string(size[1]) != strconv.Itoa(len(entries)+1) {
+		t.Errorf("trailer doesn't have size %d", len(entries)+1)
+	}
+
+	return document
+}
+
+// contents gets the uncompressed content streams of pages of a document
+func contents(t *testing.T, document []byte) []string {
+	pages := []string{}
+	for _, match := range streamPattern.FindAllSubmatch(document, -1) {
+		if length, _ := strconv.Atoi(string(match[1])); length != len(match[2]) {
+			t.Errorf("stream has length %d, want %d", len(match[2]), length)
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(match[2]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, string(content))
+	}
+	return pages
+}
+
+func TestWriteTo(t *testing.T) {
+	d := New()
+	first := d.AddPage()
+	first.Text(50, 60, 12, true, "Račun (kopija) \\ Ђорђе")
+	first.Line(50, 70, 545, 70, 0.5)
+	second := d.AddPage()
+	second.Rect(50, 100, 20.5, 10, 0.4)
+
+	pages := contents(t, write(t, d))
+	want := []string{
+		"BT /F2 12 Tf 50 781.89 Td (Racun \\(kopija\\) \\\\ Djordje) Tj ET\n0.5 w 0 G 50 771.89 m 545 771.89 l S\n",
+		"0.4 g 50 731.89 20.5 10 re f 0 g\n",
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("document has %d pages, want %d", len(pages), len(want))
+	}
+	for i := range want {
+		if pages[i] != want[i] {
+			t.Errorf("page %d is %q, want %q", i+1, pages[i], want[i])
+		}
+	}
+}
+
+func TestWriteToEmpty(t *testing.T) {
+	if pages := contents(t, write(t, New())); len(pages) != 1 || pages[0] != "" {
+		t.Errorf("empty document has pages %q, want one empty page", pages)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Mleko (1l)", `Mleko \(1l\)`},
+		{`C:\temp`, `C:\\temp`},
+		{"((\\))", `\(\(\\\)\)`},
+		{"two\nlines\tand\rtabs", "two lines and tabs"},
+	}
+	for _, test := range tests {
+		if got := escape([]byte(test.in)); got != test.want {
+			t.Errorf("escape(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Čačak", "Cacak"},
+		{"ćevapi", "cevapi"},
+		{"Ђорђе", "Djordje"},
+		{"Џем", "D\x9eem"},
+		{"Šećer", "\x8aecer"},
+		{"Müller 5€", "M\xfcller 5\x80"},
+		{"日本", "??"},
+	}
+	for _, test := range tests {
+		if got := string(encode(test.in)); got != test.want {
+			t.Errorf("encode(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	// Transliterated and accented letters are as wide as their base letters
+	if got, want := TextWidth("Đorđe", 10, false), TextWidth("Djordje", 10, false); got != want {
+		t.Errorf("width of Đorđe is %v, want %v", got, want)
+	}
+	if got, want := TextWidth("Čačak", 10, true), TextWidth("Cacak", 10, true); got != want {
+		t.Errorf("width of Čačak is %v, want %v", got, want)
+	}
+	if regular, bold := TextWidth("Mleko", 10, false), TextWidth("Mleko", 10, true); bold <= regular {
+		t.Errorf("bold width %v isn't larger than regular width %v", bold, regular)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := "Čokoladni preliv sa lešnicima"
+	width := TextWidth(text, 10, false)
+
+	if got := Truncate(text, width, 10, false); got != text {
+		t.Errorf("text that fits was truncated to %q", got)
+	}
+
+	got := Truncate(text, width/2, 10, false)
+	if got == "" || got == text || []rune(got)[len([]rune(got))-1] != '…' {
+		t.Errorf("truncated text is %q, want it shortened with an ellipsis", got)
+	}
+	if TextWidth(got, 10, false) > width/2 {
+		t.Errorf("truncated text %q is %v wide, want at most %v", got, TextWidth(got, 10, false), width/2)
+	}
+	// Truncated text is as long as it can be
+	if longer := []rune(text)[:len([]rune(got))]; TextWidth(string(longer)+"…", 10, false) <= width/2 {
+		t.Errorf("truncated text %q could be longer", got)
+	}
+
+	if got := Truncate(text, 1, 10, false); got != "" {
+		t.Errorf("text truncated to 1 point is %q, want empty", got)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{12, "12"},
+		{841.89, "841.89"},
+		{0.5, "0.5"},
+		{-0.001, "0"},
+		{-3.456, "-3.46"},
+	}
+	for _, test := range tests {
+		if got := number(test.in); got != test.want {
+			t.Errorf("number(%v) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
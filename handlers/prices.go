@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+)
+
+// priceMaxAge is the number of days after which observed prices are stale if
+// it's not specified
+const priceMaxAge = 90
+
+// ErrItemNotFound is returned when an item is deleted or the user is not
+// a member of its household
+var ErrItemNotFound = errors.New("item not found")
+
+// ItemCompareGetQuery : Structure that should be used for getting query data on get request for price comparison of an item
+type ItemCompareGetQuery struct {
+	// Currency in which prices are compared. Default currency of the user is
+	// used if it's not specified.
+	Currency string `form:"currency" validate:"omitempty,currency"`
+	// MaxAge is the number of days after the last purchase at a location
+	// after which its price is stale
+	MaxAge int `form:"maxAge" validate:"omitempty,min=1"`
+}
+
+// BasketPostBody : Structure that should be used for getting json from body of a post request for price comparison of a basket
+type BasketPostBody struct {
+	Items    []BasketItem `json:"items" validate:"required,min=1,max=100,dive"`
+	Currency string       `json:"currency" validate:"omitempty,currency"`
+	MaxAge   int          `json:"maxAge" validate:"omitempty,min=1"`
+}
+
+// BasketItem : Structure that should be used for getting json of an item of a basket. Amount is in the unit of the item and defaults to 1.
+type BasketItem struct {
+	PublicID string  `json:"id" validate:"required"`
+	Amount   float64 `json:"amount" validate:"omitempty,gt=0"`
+}
+
+// LocationPrice : Structure that should be used for sending prices of an item at a location
+type LocationPrice struct {
+	PublicID string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	// Prices are per unit of the item. Last price is the price of the latest
+	// purchase and average price is weighted by the amounts bought.
+	LastPrice    Money `json:"lastPrice"`
+	AveragePrice Money `json:"averagePrice"`
+	// Normalized prices are per kg, l or piece and nil if the unit of the item
+	// is not in the unit registry
+	NormalizedLastPrice    *Money    `json:"normalizedLastPrice"`
+	NormalizedAveragePrice *Money    `json:"normalizedAveragePrice"`
+	Purchases              int       `json:"purchases"`
+	LastPurchasedAt        time.Time `json:"lastPurchasedAt"`
+	// Age is the number of days since the last purchase
+	Age   int  `json:"age"`
+	Stale bool `json:"stale"`
+}
+
+// ItemComparison : Structure that should be used for sending prices of an item at locations it was bought at
+type ItemComparison struct {
+	PublicID string `json:"id"`
+	Name     string `json:"name"`
+	Unit     string `json:"unit"`
+	// NormalizedUnit is the unit of normalized prices
+	NormalizedUnit *string `json:"normalizedUnit"`
+	Currency       string  `json:"currency"`
+	// Locations with current prices are first and cheapest first
+	Locations []LocationPrice `json:"locations"`
+	// Cheapest is the id of the location with the lowest last price that is
+	// not stale, or of any location if all are stale
+	Cheapest *string `json:"cheapest"`
+}
+
+// BasketStore : Structure that should be used for sending the total of a basket at a location
+type BasketStore struct {
+	PublicID string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	// Total is the sum of last prices of items that were bought at the
+	// location times their amounts
+	Total Money `json:"total"`
+	Items int   `json:"items"`
+	// Missing and Stale are ids of items that were never bought at the
+	// location and of items whose price there is stale
+	Missing []string `json:"missing"`
+	Stale   []string `json:"stale"`
+}
+
+// Basket : Structure that should be used for sending price comparison of a basket
+type Basket struct {
+	Currency string           `json:"currency"`
+	Items    []ItemComparison `json:"items"`
+	// Stores with the fewest missing and stale items are first and cheapest
+	// first
+	Stores []BasketStore `json:"stores"`
+	// Recommended is the id of the first store if it has all items
+	Recommended *string `json:"recommended"`
+	// SplitTotal is the total of buying every item at its cheapest location
+	SplitTotal Money `json:"splitTotal"`
+}
+
+// observedPrice is a line of a receipt of an item with the location and date
+// of the receipt
+type observedPrice struct {
+	ItemID          int       `db:"item_id"`
+	LocationID      string    `db:"location_id"`
+	LocationName    string    `db:"location_name"`
+	LocationAddress string    `db:"location_address"`
+	Currency        string    `db:"currency"`
+	PurchasedAt     time.Time `db:"purchased_at"`
+	TimeZone        string    `db:"time_zone"`
+	Amount          float64   `db:"amount"`
+	Total           Money     `db:"total"`
+}
+
+// comparePrices gets prices of items at locations they were bought at in the
+// order of item ids. Prices are converted to the currency using exchange rates
+// on dates of receipts and are stale if the last purchase is older than the
+// maximum age in days. Refunds are not counted and items whose ids are
+// repeated are compared once.
+func (o Options) comparePrices(userID int, itemIDs []string, currency string, maxAge int, now time.Time) ([]ItemComparison, error) {
+	itemsQueryString, itemsQueryStringArgs, err := sq.Select("id, public_id, name, unit, package_size, package_unit").From("items").Where(sq.Eq{"public_id": itemIDs}).Where(NotDeleted("items")).Where(MemberOf("household_id", userID)).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []struct {
+		ID          int      `db:"id"`
+		PublicID    string   `db:"public_id"`
+		Name        string   `db:"name"`
+		Unit        string   `db:"unit"`
+		PackageSize *float64 `db:"package_size"`
+		PackageUnit *string  `db:"package_unit"`
+	}{}
+	if err := o.DB.Select(&items, itemsQueryString, itemsQueryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	privateIDs := map[string]int{}
+	linesItemIDs := []int{}
+	comparisons := map[int]*ItemComparison{}
+	indexes := map[int]int{}
+	for i, item := range items {
+		_, normalizedUnit := NormalizePrice(0, item.Unit, item.PackageSize, item.PackageUnit)
+		privateIDs[item.PublicID] = item.ID
+		indexes[item.ID] = i
+		linesItemIDs = append(linesItemIDs, item.ID)
+		comparisons[item.ID] = &ItemComparison{
+			PublicID:       item.PublicID,
+			Name:           item.Name,
+			Unit:           item.Unit,
+			NormalizedUnit: normalizedUnit,
+			Currency:       currency,
+			Locations:      []LocationPrice{},
+		}
+	}
+	for _, itemID := range itemIDs {
+		if _, ok := privateIDs[itemID]; !ok {
+			return nil, ErrItemNotFound
+		}
+	}
+
+	query := sq.Select("items_in_receipt.item_id, locations.public_id AS location_id, locations.name AS location_name, locations.address AS location_address, receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, items_in_receipt.amount, " + LineTotalSQL + " AS total").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("locations ON locations.id = receipts.location_id").Where(sq.Eq{"items_in_receipt.item_id": linesItemIDs}).Where("items_in_receipt.amount > 0").Where(sq.Eq{"receipts.refund_of": nil}).Where(NotDeleted("receipts")).Where(MemberOf("receipts.household_id", userID)).OrderBy("receipts.purchased_at")
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	observed := []observedPrice{}
+	if err := o.DB.Select(&observed, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	// Amounts are summed per item and location for the weighted average
+	type itemLocation struct {
+		item     int
+		location string
+	}
+	prices := map[itemLocation]int{}
+	totals := map[itemLocation]Money{}
+	amounts := map[itemLocation]float64{}
+	converter := NewCurrencyConverter(o.DB, o.RateProvider)
+	for _, line := range observed {
+		total, err := converter.Convert(line.Total, line.Currency, currency, inTimeZone(line.PurchasedAt, line.TimeZone))
+		if err != nil {
+			return nil, err
+		}
+
+		comparison := comparisons[line.ItemID]
+		key := itemLocation{item: line.ItemID, location: line.LocationID}
+		i, ok := prices[key]
+		if !ok {
+			i = len(comparison.Locations)
+			prices[key] = i
+			comparison.Locations = append(comparison.Locations, LocationPrice{
+				PublicID: line.LocationID,
+				Name:     line.LocationName,
+				Address:  line.LocationAddress,
+			})
+		}
+		price := &comparison.Locations[i]
+
+		// Lines are ordered by date of purchase so the last line is the
+		// latest one
+		price.LastPrice = Money(math.Round(float64(total) / line.Amount))
+		price.LastPurchasedAt = line.PurchasedAt
+		price.Purchases++
+		totals[key] += total
+		amounts[key] += line.Amount
+	}
+
+	result := make([]ItemComparison, 0, len(items))
+	compared := map[string]bool{}
+	for _, itemID := range itemIDs {
+		if compared[itemID] {
+			continue
+		}
+		compared[itemID] = true
+
+		comparison := comparisons[privateIDs[itemID]]
+		item := items[indexes[privateIDs[itemID]]]
+		for i := range comparison.Locations {
+			price := &comparison.Locations[i]
+			key := itemLocation{item: privateIDs[itemID], location: price.PublicID}
+			price.AveragePrice = Money(math.Round(float64(totals[key]) / amounts[key]))
+			price.NormalizedLastPrice, _ = NormalizePrice(price.LastPrice, item.Unit, item.PackageSize, item.PackageUnit)
+			price.NormalizedAveragePrice, _ = NormalizePrice(price.AveragePrice, item.Unit, item.PackageSize, item.PackageUnit)
+			price.Age = int(now.Sub(price.LastPurchasedAt).Hours() / 24)
+			price.Stale = price.Age > maxAge
+		}
+
+		sort.SliceStable(comparison.Locations, func(i, j int) bool {
+			a, b := comparison.Locations[i], comparison.Locations[j]
+			if a.Stale != b.Stale {
+				return !a.Stale
+			}
+			return a.LastPrice < b.LastPrice
+		})
+		if len(comparison.Locations) > 0 {
+			comparison.Cheapest = &comparison.Locations[0].PublicID
+		}
+
+		result = append(result, *comparison)
+	}
+
+	return result, nil
+}
+
+// priceComparisonAccount gets the account of the user and the currency and
+// maximum age of a price comparison with defaults of the account
+func (o Options) priceComparisonAccount(publicID string, currency string, maxAge int) (Account, string, int, error) {
+	account, err := GetAccount(o.DB, publicID)
+	if err != nil {
+		return Account{}, "", 0, err
+	}
+
+	if currency = normalizeCurrency(currency); currency == "" {
+		currency = account.Currency
+	}
+	if maxAge == 0 {
+		maxAge = priceMaxAge
+	}
+
+	return account, currency, maxAge, nil
+}
+
+// priceErrorStatus gets the status of an error of a price comparison
+func priceErrorStatus(err error) int {
+	if err == ErrItemNotFound {
+		return http.StatusNotFound
+	}
+	return conversionErrorStatus(err)
+}
+
+// GetItemComparison is a Gin handler function for comparing last and average
+// prices of an item at locations it was bought at
+func (o Options) GetItemComparison() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery ItemCompareGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		account, currency, maxAge, err := o.priceComparisonAccount(createdBy.PublicID, searchQuery.Currency, searchQuery.MaxAge)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		comparisons, err := o.comparePrices(account.ID, []string{ctx.Param("id")}, currency, maxAge, time.Now())
+		if err != nil {
+			ctx.JSON(priceErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, comparisons[0])
+	}
+}
+
+// PostBasketComparison is a Gin handler function for comparing totals of
+// a basket of items at locations and recommending the cheapest one. Items
+// that are in the basket more than once are merged.
+func (o Options) PostBasketComparison() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var basketData BasketPostBody
+		if err := ctx.ShouldBindJSON(&basketData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(basketData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		account, currency, maxAge, err := o.priceComparisonAccount(createdBy.PublicID, basketData.Currency, basketData.MaxAge)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		itemIDs := []string{}
+		itemAmounts := map[string]float64{}
+		for _, item := range basketData.Items {
+			if _, ok := itemAmounts[item.PublicID]; !ok {
+				itemIDs = append(itemIDs, item.PublicID)
+			}
+			if item.Amount == 0 {
+				item.Amount = 1
+			}
+			itemAmounts[item.PublicID] += item.Amount
+		}
+
+		comparisons, err := o.comparePrices(account.ID, itemIDs, currency, maxAge, time.Now())
+		if err != nil {
+			ctx.JSON(priceErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, newBasket(currency, comparisons, itemAmounts))
+	}
+}
+
+// newBasket calculates totals of a basket at every location that any of the
+// items was bought at
+func newBasket(currency string, comparisons []ItemComparison, amounts map[string]float64) Basket {
+	basket := Basket{
+		Currency: currency,
+		Items:    comparisons,
+		Stores:   []BasketStore{},
+	}
+
+	stores := map[string]int{}
+	for _, comparison := range comparisons {
+		for _, price := range comparison.Locations {
+			if _, ok := stores[price.PublicID]; !ok {
+				stores[price.PublicID] = len(basket.Stores)
+				basket.Stores = append(basket.Stores, BasketStore{
+					PublicID: price.PublicID,
+					Name:     price.Name,
+					Address:  price.Address,
+					Missing:  []string{},
+					Stale:    []string{},
+				})
+			}
+		}
+	}
+
+	for _, comparison := range comparisons {
+		amount := amounts[comparison.PublicID]
+		prices := map[string]LocationPrice{}
+		for _, price := range comparison.Locations {
+			prices[price.PublicID] = price
+		}
+		if len(comparison.Locations) > 0 {
+			basket.SplitTotal += Money(math.Round(float64(comparison.Locations[0].LastPrice) * amount))
+		}
+
+		for i := range basket.Stores {
+			store := &basket.Stores[i]
+			price, ok := prices[store.PublicID]
+			if !ok {
+				store.Missing = append(store.Missing, comparison.PublicID)
+				continue
+			}
+			if price.Stale {
+				store.Stale = append(store.Stale, comparison.PublicID)
+			}
+			store.Items++
+			store.Total += Money(math.Round(float64(price.LastPrice) * amount))
+		}
+	}
+
+	sort.SliceStable(basket.Stores, func(i, j int) bool {
+		a, b := basket.Stores[i], basket.Stores[j]
+		if len(a.Missing) != len(b.Missing) {
+			return len(a.Missing) < len(b.Missing)
+		}
+		if len(a.Stale) != len(b.Stale) {
+			return len(a.Stale) < len(b.Stale)
+		}
+		return a.Total < b.Total
+	})
+	if len(basket.Stores) > 0 && len(basket.Stores[0].Missing) == 0 {
+		basket.Recommended = &basket.Stores[0].PublicID
+	}
+
+	return basket
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComparePrices(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{DB: db}
+
+	idea := insertID(t, db, "INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (?, ?, 'idea', 'Idea', 'Bulevar 2')", household.UserID, household.HouseholdID)
+	lidl := insertID(t, db, "INSERT INTO locations (created_by, household_id, public_id, name, address) VALUES (?, ?, 'lidl', 'Lidl', 'Bulevar 3')", household.UserID, household.HouseholdID)
+
+	bananas := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'bananas', 'Banane', 14999, 'kg')", household.UserID, household.HouseholdID)
+	yogurt := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit, package_size, package_unit) VALUES (?, ?, 'yogurt', 'Jogurt', 12999, 'kom', 500, 'g')", household.UserID, household.HouseholdID)
+	juice := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'juice', 'Sok', 14999, 'l')", household.UserID, household.HouseholdID)
+
+	now := time.Now().UTC()
+	line := func(publicID string, location interface{}, daysAgo int, item int64, amount float64, price Money) {
+		receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at) VALUES (?, ?, ?, ?, ?)", location, household.HouseholdID, household.UserID, publicID, now.AddDate(0, 0, -daysAgo))
+		db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, price) VALUES (?, ?, ?, ?, ?)", receipt, item, publicID+"-line", amount, price)
+	}
+	line("maxi-old", household.LocationID, 10, bananas, 1, 15000)
+	line("maxi-new", household.LocationID, 2, bananas, 2, 14000)
+	line("maxi-yogurt", household.LocationID, 2, yogurt, 1, 12999)
+	line("lidl", lidl, 5, bananas, 1, 14500)
+	line("lidl-juice", lidl, 5, juice, 1, 15999)
+	// The cheapest price is stale so it's listed after current prices
+	line("idea", idea, 100, bananas, 1, 10000)
+
+	// Repeated items are compared once
+	comparisons, err := options.comparePrices(household.UserID, []string{"bananas", "yogurt", "bananas"}, "RSD", priceMaxAge, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comparisons) != 2 {
+		t.Fatalf("got %d comparisons, want 2", len(comparisons))
+	}
+
+	type price struct {
+		id         string
+		last       Money
+		average    Money
+		normalized Money
+		purchases  int
+		stale      bool
+	}
+	tests := []struct {
+		comparison     ItemComparison
+		normalizedUnit string
+		prices         []price
+	}{
+		{comparisons[0], "kg", []price{
+			{"user-location", 14000, 14333, 14000, 2, false},
+			{"lidl", 14500, 14500, 14500, 1, false},
+			{"idea", 10000, 10000, 10000, 1, true},
+		}},
+		{comparisons[1], "kg", []price{
+			{"user-location", 12999, 12999, 25998, 1, false},
+		}},
+	}
+	for _, test := range tests {
+		comparison := test.comparison
+		if comparison.NormalizedUnit == nil || *comparison.NormalizedUnit != test.normalizedUnit {
+			t.Errorf("%s: got normalized unit %v, want %s", comparison.PublicID, comparison.NormalizedUnit, test.normalizedUnit)
+		}
+		if comparison.Cheapest == nil || *comparison.Cheapest != test.prices[0].id {
+			t.Errorf("%s: got cheapest %v, want %s", comparison.PublicID, comparison.Cheapest, test.prices[0].id)
+		}
+
+		got := []price{}
+		for _, location := range comparison.Locations {
+			got = append(got, price{location.PublicID, location.LastPrice, location.AveragePrice, *location.NormalizedLastPrice, location.Purchases, location.Stale})
+		}
+		if !reflect.DeepEqual(got, test.prices) {
+			t.Errorf("%s: got prices %+v, want %+v", comparison.PublicID, got, test.prices)
+		}
+	}
+
+	if _, err := options.comparePrices(household.UserID, []string{"bananas", "unknown"}, "RSD", priceMaxAge, now); err != ErrItemNotFound {
+		t.Errorf("got error %v of an unknown item, want %v", err, ErrItemNotFound)
+	}
+
+	// Amounts of items that are in the basket more than once are summed
+	options.V = NewValidator()
+	recorder := serve(options.PostBasketComparison(), "/items/compare", "user", http.MethodPost, "/items/compare", `{"items": [{"id": "bananas"}, {"id": "yogurt"}, {"id": "bananas", "amount": 2}]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("comparing a basket: got %d %s", recorder.Code, recorder.Body)
+	}
+	basket := Basket{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &basket); err != nil {
+		t.Fatal(err)
+	}
+	if len(basket.Items) != 2 {
+		t.Errorf("got %d items in the basket, want 2", len(basket.Items))
+	}
+	if len(basket.Stores) == 0 || basket.Stores[0].PublicID != "user-location" || basket.Stores[0].Total != 54999 || basket.Stores[0].Items != 2 {
+		t.Errorf("got stores %+v, want user-location with 2 items for 54999 first", basket.Stores)
+	}
+	if basket.SplitTotal != 54999 {
+		t.Errorf("got split total %d, want 54999", basket.SplitTotal)
+	}
+}
+
+func TestNewBasket(t *testing.T) {
+	location := func(id string, last Money, stale bool) LocationPrice {
+		return LocationPrice{PublicID: id, Name: id, LastPrice: last, Stale: stale}
+	}
+	bananas := ItemComparison{PublicID: "bananas", Locations: []LocationPrice{location("maxi", 14000, false), location("lidl", 14500, false), location("idea", 10000, true)}}
+	yogurt := ItemComparison{PublicID: "yogurt", Locations: []LocationPrice{location("maxi", 12999, false)}}
+	juice := ItemComparison{PublicID: "juice", Locations: []LocationPrice{location("lidl", 15999, false)}}
+
+	type store struct {
+		id      string
+		total   Money
+		missing []string
+		stale   []string
+	}
+	tests := []struct {
+		comparisons []ItemComparison
+		amounts     map[string]float64
+		stores      []store
+		recommended string
+		splitTotal  Money
+	}{
+		{
+			[]ItemComparison{bananas, yogurt},
+			map[string]float64{"bananas": 2, "yogurt": 1},
+			[]store{
+				{"maxi", 40999, []string{}, []string{}},
+				{"lidl", 29000, []string{"yogurt"}, []string{}},
+				{"idea", 20000, []string{"yogurt"}, []string{"bananas"}},
+			},
+			"maxi",
+			40999,
+		},
+		{
+			// Every store is missing an item so none is recommended
+			[]ItemComparison{yogurt, juice},
+			map[string]float64{"yogurt": 1, "juice": 1.5},
+			[]store{
+				{"maxi", 12999, []string{"juice"}, []string{}},
+				{"lidl", 23999, []string{"yogurt"}, []string{}},
+			},
+			"",
+			36998,
+		},
+	}
+	for _, test := range tests {
+		basket := newBasket("RSD", test.comparisons, test.amounts)
+
+		got := []store{}
+		for _, total := range basket.Stores {
+			got = append(got, store{total.PublicID, total.Total, total.Missing, total.Stale})
+		}
+		if !reflect.DeepEqual(got, test.stores) {
+			t.Errorf("got stores %+v, want %+v", got, test.stores)
+		}
+
+		recommended := ""
+		if basket.Recommended != nil {
+			recommended = *basket.Recommended
+		}
+		if recommended != test.recommended {
+			t.Errorf("got recommended store %q, want %q", recommended, test.recommended)
+		}
+		if basket.SplitTotal != test.splitTotal {
+			t.Errorf("got split total %d, want %d", basket.SplitTotal, test.splitTotal)
+		}
+	}
+}
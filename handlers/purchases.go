@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// localTimeLayout is the layout of purchase times without a time zone. They
+// are in the time zone of the receipt.
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// sqlTimeLayout is the layout of UTC times returned by SQLite date and time
+// functions
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// ErrInvalidTimeZone is returned when a time zone is not a name from the IANA
+// time zone database
+var ErrInvalidTimeZone = errors.New("invalid time zone")
+
+// ErrInvalidPurchaseTime is returned when a purchase time is neither in RFC
+// 3339 format nor a local time in YYYY-MM-DDThh:mm:ss format
+var ErrInvalidPurchaseTime = errors.New("purchase time must be in RFC 3339 or YYYY-MM-DDThh:mm:ss format")
+
+// ErrNoReceiptDetails is returned when an update of purchase details doesn't
+// specify any details
+var ErrNoReceiptDetails = errors.New("no details specified")
+
+// ReceiptDetails : Structure that should be used for getting purchase details of a receipt from body of a put request or a mutation
+type ReceiptDetails struct {
+	// PurchasedAt is the time of purchase in RFC 3339 format or a local time
+	// in the time zone of the receipt
+	PurchasedAt string `json:"purchasedAt"`
+	// TimeZone is a name from the IANA time zone database like Europe/Belgrade
+	TimeZone string `json:"timeZone"`
+	// Notes and FiscalID replace notes and the fiscal id of the receipt, empty
+	// strings remove them
+	Notes    *string `json:"notes"`
+	FiscalID *string `json:"fiscalId"`
+}
+
+// loadTimeZone loads a time zone by its name from the IANA time zone database
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimeZone
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimeZone
+	}
+
+	return location, nil
+}
+
+// inTimeZone gets the time in the named time zone. Time is returned unchanged
+// if the time zone can't be loaded.
+func inTimeZone(t time.Time, name string) time.Time {
+	location, err := loadTimeZone(name)
+	if err != nil {
+		return t
+	}
+	return t.In(location)
+}
+
+// parsePurchaseTime parses a purchase time in RFC 3339 format or a local time
+// in the time zone
+func parsePurchaseTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(localTimeLayout, value, location)
+	if err != nil {
+		return time.Time{}, ErrInvalidPurchaseTime
+	}
+
+	return t, nil
+}
+
+// nullableText gets a value for a text column that is NULL for empty strings
+func nullableText(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// empty checks if no details are specified
+func (d ReceiptDetails) empty() bool {
+	return d.PurchasedAt == "" && d.TimeZone == "" && d.Notes == nil && d.FiscalID == nil
+}
+
+// set adds specified details to an update of the receipt. Local purchase times
+// are in the specified time zone or in the time zone of the receipt.
+func (d ReceiptDetails) set(db *sqlx.DB, query sq.UpdateBuilder, publicID string) (sq.UpdateBuilder, error) {
+	if d.TimeZone != "" {
+		if _, err := loadTimeZone(d.TimeZone); err != nil {
+			return query, err
+		}
+		query = query.Set("time_zone", d.TimeZone)
+	}
+
+	if d.PurchasedAt != "" {
+		zone := d.TimeZone
+		if zone == "" {
+			if err := db.Get(&zone, "SELECT COALESCE(time_zone, 'UTC') FROM receipts WHERE public_id = ?", publicID); err != nil && err != sql.ErrNoRows {
+				return query, err
+			}
+		}
+
+		location, err := loadTimeZone(zone)
+		if err != nil {
+			location = time.UTC
+		}
+
+		purchasedAt, err := parsePurchaseTime(d.PurchasedAt, location)
+		if err != nil {
+			return query, err
+		}
+		query = query.Set("purchased_at", purchasedAt.UTC())
+	}
+
+	if d.Notes != nil {
+		query = query.Set("notes", nullableText(*d.Notes))
+	}
+	if d.FiscalID != nil {
+		query = query.Set("fiscal_id", nullableText(*d.FiscalID))
+	}
+
+	return query, nil
+}
+
+// UpdateReceiptDetails updates purchase details of the receipt if the user can
+// edit receipts of its household. It returns false if there is no such receipt.
+func UpdateReceiptDetails(db *sqlx.DB, userID int, publicID string, details ReceiptDetails) (bool, error) {
+	if details.empty() {
+		return false, ErrNoReceiptDetails
+	}
+
+	query, err := details.set(db, sq.Update("receipts"), publicID)
+	if err != nil {
+		return false, err
+	}
+
+	query = query.Set("updated_at", time.Now()).Where(sq.Eq{"public_id": publicID, "deleted_at": nil}).Where(MemberOf("household_id", userID, WriteRoles...))
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := db.Exec(queryString, queryStringArgs...)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return updated != 0, nil
+}
+
+// purchaseDetailsErrorStatus gets the HTTP status code for errors of purchase
+// details
+func purchaseDetailsErrorStatus(err error) int {
+	if err == ErrInvalidTimeZone || err == ErrInvalidPurchaseTime {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
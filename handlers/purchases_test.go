@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePurchaseTime(t *testing.T) {
+	belgrade, err := loadTimeZone("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  time.Time
+		err   error
+	}{
+		// Local times are in the time zone of the receipt, in summer and in
+		// winter time
+		{"2020-07-01T10:00:00", time.Date(2020, 7, 1, 8, 0, 0, 0, time.UTC), nil},
+		{"2020-01-01T10:00:00", time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC), nil},
+		// Times with an offset keep it
+		{"2020-07-01T10:00:00Z", time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC), nil},
+		{"2020-07-01T10:00:00-04:00", time.Date(2020, 7, 1, 14, 0, 0, 0, time.UTC), nil},
+		{"2020-07-01 10:00", time.Time{}, ErrInvalidPurchaseTime},
+		{"yesterday", time.Time{}, ErrInvalidPurchaseTime},
+	}
+	for _, test := range tests {
+		got, err := parsePurchaseTime(test.value, belgrade)
+		if err != test.err || !got.Equal(test.want) {
+			t.Errorf("%s: got %v, %v, want %v, %v", test.value, got.UTC(), err, test.want, test.err)
+		}
+	}
+}
+
+func TestUpdateReceiptDetails(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	newTestHousehold(t, db, "other")
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, notes, fiscal_id) VALUES (?, ?, ?, 'receipt', '2020-06-01 10:00:00', 'Europe/Belgrade', 'Notes', 'ABCD-1234')", household.LocationID, household.HouseholdID, household.UserID)
+
+	text := func(value string) *string {
+		return &value
+	}
+	type details struct {
+		PurchasedAt time.Time `db:"purchased_at"`
+		TimeZone    string    `db:"time_zone"`
+		Notes       *string   `db:"notes"`
+		FiscalID    *string   `db:"fiscal_id"`
+	}
+	get := func() details {
+		var got details
+		if err := db.Get(&got, "SELECT purchased_at, time_zone, notes, fiscal_id FROM receipts WHERE public_id = 'receipt'"); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name    string
+		details ReceiptDetails
+		want    time.Time
+		zone    string
+	}{
+		{"local time in the time zone of the receipt", ReceiptDetails{PurchasedAt: "2020-06-02T12:00:00"}, time.Date(2020, 6, 2, 10, 0, 0, 0, time.UTC), "Europe/Belgrade"},
+		{"local time in a new time zone", ReceiptDetails{PurchasedAt: "2020-06-02T12:00:00", TimeZone: "America/New_York"}, time.Date(2020, 6, 2, 16, 0, 0, 0, time.UTC), "America/New_York"},
+		{"time with an offset", ReceiptDetails{PurchasedAt: "2020-06-02T12:00:00+02:00"}, time.Date(2020, 6, 2, 10, 0, 0, 0, time.UTC), "America/New_York"},
+	}
+	for _, test := range tests {
+		updated, err := UpdateReceiptDetails(db, household.UserID, "receipt", test.details)
+		if err != nil || !updated {
+			t.Fatalf("%s: got %v, %v", test.name, updated, err)
+		}
+		if got := get(); !got.PurchasedAt.Equal(test.want) || got.TimeZone != test.zone {
+			t.Errorf("%s: purchased at %v in %s, want %v in %s", test.name, got.PurchasedAt, got.TimeZone, test.want, test.zone)
+		}
+	}
+
+	invalid := map[string]ReceiptDetails{
+		"nothing":              {},
+		"invalid time zone":    {TimeZone: "Mars/Olympus"},
+		"invalid time":         {PurchasedAt: "02.06.2020."},
+		"local time zone name": {TimeZone: "Local"},
+	}
+	for name, details := range invalid {
+		if _, err := UpdateReceiptDetails(db, household.UserID, "receipt", details); err == nil {
+			t.Errorf("%s: updated receipt", name)
+		}
+	}
+	if updated, err := UpdateReceiptDetails(db, household.UserID+1, "receipt", ReceiptDetails{Notes: text("Others")}); err != nil || updated {
+		t.Errorf("receipt of another household: got %v, %v, want not updated", updated, err)
+	}
+
+	// Empty strings remove notes and the fiscal id
+	if updated, err := UpdateReceiptDetails(db, household.UserID, "receipt", ReceiptDetails{Notes: text(""), FiscalID: text("")}); err != nil || !updated {
+		t.Fatalf("clearing: got %v, %v", updated, err)
+	}
+	if got := get(); got.Notes != nil || got.FiscalID != nil {
+		t.Errorf("notes %v and fiscal id %v after clearing, want NULL", got.Notes, got.FiscalID)
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/handlers/pdf"
+	"github.com/gin-gonic/gin"
+)
+
+// pdfExtension is the extension of receipt ids in paths of printable receipts
+const pdfExtension = ".pdf"
+
+// Layout of printed documents in points
+const (
+	pdfMargin = 50
+	pdfRight  = pdf.PageWidth - pdfMargin
+	pdfBottom = pdf.PageHeight - pdfMargin
+)
+
+// pdfLayout writes lines of a document from the top of the page down and
+// starts a new page when a page is full
+type pdfLayout struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+// newPDFLayout creates a document with an empty page
+func newPDFLayout() *pdfLayout {
+	doc := pdf.New()
+	return &pdfLayout{doc: doc, page: doc.AddPage(), y: pdfMargin}
+}
+
+// space makes sure there is space for the height on the page and starts a
+// new page if there isn't
+func (l *pdfLayout) space(height float64) {
+	if l.y+height > pdfBottom {
+		l.page = l.doc.AddPage()
+		l.y = pdfMargin
+	}
+}
+
+// heading writes a bold heading of a section
+func (l *pdfLayout) heading(text string) {
+	l.space(40)
+	l.y += 24
+	l.page.Text(pdfMargin, l.y, 12, true, text)
+	l.y += 6
+	l.page.Line(pdfMargin, l.y, pdfRight, l.y, 0.5)
+}
+
+// row writes a row of a table. Columns are right aligned at their positions
+// and the first column is left aligned at the margin and truncated to fit
+// before the second column.
+func (l *pdfLayout) row(bold bool, columns []float64, values ...string) {
+	l.space(16)
+	l.y += 14
+	for i, value := range values {
+		if i == 0 {
+			width := pdfRight - pdfMargin
+			if len(columns) > 1 {
+				width = columns[1] - pdfMargin - 60
+			}
+			l.page.Text(pdfMargin, l.y, 9, bold, pdf.Truncate(value, width, 9, bold))
+			continue
+		}
+		l.page.TextRight(columns[i], l.y, 9, bold, value)
+	}
+}
+
+// label writes a label and a value
+func (l *pdfLayout) label(name string, value string) {
+	l.space(14)
+	l.y += 13
+	l.page.Text(pdfMargin, l.y, 9, true, name)
+	l.page.Text(pdfMargin+90, l.y, 9, false, pdf.Truncate(value, pdfRight-pdfMargin-90, 9, false))
+}
+
+// bytes writes the document
+func (l *pdfLayout) bytes() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := l.doc.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// formatPercentage formats a percentage with two decimal places
+func formatPercentage(p Percentage) string {
+	return formatHundredths(int64(p)) + "%"
+}
+
+// formatAmount formats an amount of a line with its unit
+func formatAmount(amount float64, unit string) string {
+	return strings.TrimSpace(strconv.FormatFloat(amount, 'f', -1, 64) + " " + unit)
+}
+
+// printedReceipt is a receipt with columns that are printed
+type printedReceipt struct {
+	ID            int64     `db:"id"`
+	PublicID      string    `db:"public_id"`
+	LocationName  string    `db:"location_name"`
+	Address       string    `db:"address"`
+	TaxID         *string   `db:"tax_id"`
+	SubtotalPrice Money     `db:"subtotal_price"`
+	TotalPrice    Money     `db:"total_price"`
+	Currency      string    `db:"currency"`
+	RefundOf      *string   `db:"refund_of"`
+	PurchasedAt   time.Time `db:"purchased_at"`
+	TimeZone      string    `db:"time_zone"`
+	Notes         *string   `db:"notes"`
+	FiscalID      *string   `db:"fiscal_id"`
+}
+
+// GetReceiptPDF is a Gin handler function for getting a receipt as a
+// printable PDF document with its location, lines, taxes and payments. Path
+// of the document is the id of the receipt with the pdf extension.
+func (o Options) GetReceiptPDF() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		receiptPublicID := ctx.Param("id")
+		if !strings.HasSuffix(receiptPublicID, pdfExtension) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "receipts are printed at /receipts/:id.pdf",
+			})
+			return
+		}
+		receiptPublicID = strings.TrimSuffix(receiptPublicID, pdfExtension)
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("receipts.id, receipts.public_id, locations.name AS location_name, locations.address, locations.tax_id, " + ReceiptSubtotalSQL + " AS subtotal_price, " + ReceiptTotalSQL + " AS total_price, receipts.currency, originals.public_id AS refund_of, receipts.purchased_at, receipts.time_zone, receipts.notes, receipts.fiscal_id").From("receipts").Join("locations ON locations.id = receipts.location_id").LeftJoin("receipts originals ON originals.id = receipts.refund_of").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(sq.Eq{"receipts.public_id": receiptPublicID}).Where(MemberOf("receipts.household_id", user.ID)).Where(NotDeleted("receipts"))
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var receipt printedReceipt
+		if err := o.DB.Get(&receipt, queryString, queryStringArgs...); err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "receipt not found",
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		linesQuery := sq.Select(ItemsInReceiptColumns).From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Where(sq.Eq{"items_in_receipt.receipt_id": receipt.ID}).OrderBy("items_in_receipt.id")
+
+		linesQueryString, linesQueryStringArgs, err := linesQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		lines := []ItemInReceipt{}
+		if err := o.DB.Select(&lines, linesQueryString, linesQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		taxes, err := ReceiptTaxes(o.DB, []string{receipt.PublicID})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		payments, err := ReceiptPayments(o.DB, []string{receipt.PublicID})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		refunds, err := ReceiptRefunds(o.DB, []string{receipt.PublicID})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		document, err := printReceipt(receipt, lines, taxes[receipt.PublicID], payments[receipt.PublicID], refunds[receipt.PublicID])
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Header("Content-Disposition", "inline; filename=\"receipt-"+receipt.PublicID+pdfExtension+"\"")
+		ctx.Data(http.StatusOK, "application/pdf", document)
+	}
+}
+
+// printReceipt writes a receipt as a PDF document. Time of purchase is in the
+// time zone of the receipt.
+func printReceipt(receipt printedReceipt, lines []ItemInReceipt, taxes []TaxBreakdown, payments []Payment, refunded Money) ([]byte, error) {
+	layout := newPDFLayout()
+
+	title := "Receipt"
+	if receipt.RefundOf != nil {
+		title = "Refund"
+	}
+
+	layout.y += 18
+	layout.page.Text(pdfMargin, layout.y, 18, true, pdf.Truncate(receipt.LocationName, pdfRight-pdfMargin-120, 18, true))
+	layout.page.TextRight(pdfRight, layout.y, 14, true, title)
+	if receipt.Address != "" {
+		layout.y += 14
+		layout.page.Text(pdfMargin, layout.y, 10, false, receipt.Address)
+	}
+	layout.y += 6
+
+	layout.label("Receipt", receipt.PublicID)
+	layout.label("Purchased at", inTimeZone(receipt.PurchasedAt, receipt.TimeZone).Format("2006-01-02 15:04")+" ("+receipt.TimeZone+")")
+	if receipt.TaxID != nil {
+		layout.label("Tax ID", *receipt.TaxID)
+	}
+	if receipt.FiscalID != nil {
+		layout.label("Fiscal ID", *receipt.FiscalID)
+	}
+	if receipt.RefundOf != nil {
+		layout.label("Refund of", *receipt.RefundOf)
+	}
+	if receipt.Notes != nil && *receipt.Notes != "" {
+		layout.label("Notes", *receipt.Notes)
+	}
+
+	columns := []float64{pdfMargin, 300, 370, 440, pdfRight}
+	layout.heading("Items")
+	layout.row(true, columns, "Item", "Amount", "Price", "Discount", "Total")
+	for _, line := range lines {
+		discount := ""
+		if line.Saved != 0 {
+			discount = (-line.Saved).String()
+		}
+		layout.row(false, columns, line.Name, formatAmount(line.Amount, line.Unit), line.Price.String(), discount, line.Total.String())
+	}
+
+	layout.y += 6
+	layout.page.Line(pdfMargin, layout.y, pdfRight, layout.y, 0.5)
+	if receipt.SubtotalPrice != receipt.TotalPrice {
+		layout.row(false, columns, "Subtotal", "", "", "", receipt.SubtotalPrice.String())
+		layout.row(false, columns, "Discount", "", "", "", (receipt.TotalPrice - receipt.SubtotalPrice).String())
+	}
+	layout.row(true, columns, "Total ("+receipt.Currency+")", "", "", "", receipt.TotalPrice.String())
+	if refunded != 0 {
+		layout.row(false, columns, "Refunded", "", "", "", (-refunded).String())
+		layout.row(true, columns, "Total after refunds", "", "", "", (receipt.TotalPrice - refunded).String())
+	}
+
+	if len(taxes) > 0 {
+		layout.heading("Taxes")
+		layout.row(true, columns, "Label", "Rate", "Net", "Tax", "Gross")
+		for _, tax := range taxes {
+			layout.row(false, columns, tax.Label, formatPercentage(tax.Rate), tax.Net.String(), tax.Tax.String(), tax.Gross.String())
+		}
+	}
+
+	if len(payments) > 0 {
+		layout.heading("Payments")
+		for _, payment := range payments {
+			layout.row(false, columns, payment.Name, "", "", payment.Type, payment.Amount.String())
+		}
+	}
+
+	return layout.bytes()
+}
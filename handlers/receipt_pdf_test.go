@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var pdfStreamPattern = regexp.MustCompile(`(?s)\nstream\n(.*?)\nendstream`)
+
+// pdfContents gets the uncompressed content of pages of a PDF document. It's
+// compared instead of the document since compressed streams depend on the
+// version of zlib.
+func pdfContents(t *testing.T, document []byte) []byte {
+	var b bytes.Buffer
+	for i, match := range pdfStreamPattern.FindAllSubmatch(document, -1) {
+		reader, err := zlib.NewReader(bytes.NewReader(match[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i > 0 {
+			b.WriteString("% page break\n")
+		}
+		b.Write(content)
+	}
+	return b.Bytes()
+}
+
+func TestPrintedDocuments(t *testing.T) {
+	db, _ := newLedgerTestDB(t)
+	if err := saveRate(db, ExchangeRate{Date: "2023-03-20", Base: "EUR", Quote: "RSD", Rate: 117.3}); err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec("UPDATE locations SET name = 'Maxi (Ђерам) \\ Čačak', tax_id = '100002288' WHERE name = 'Maxi'")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	documents := []struct {
+		file    string
+		handler gin.HandlerFunc
+		route   string
+		path    string
+	}{
+		{"receipt.txt", options.GetReceiptPDF(), "/receipts/:id", "/receipts/split.pdf"},
+		{"refund.txt", options.GetReceiptPDF(), "/receipts/:id", "/receipts/refund.pdf"},
+		{"report.txt", options.GetMonthlyReportPDF(), "/reports/monthly.pdf", "/reports/monthly.pdf?month=2023-03"},
+	}
+
+	for _, document := range documents {
+		t.Run(document.file, func(t *testing.T) {
+			recorder := serve(document.handler, document.route, "user", http.MethodGet, document.path, "")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+			}
+			if !strings.HasPrefix(recorder.Body.String(), "%PDF-") {
+				t.Fatalf("response isn't a PDF document")
+			}
+			got := pdfContents(t, recorder.Body.Bytes())
+
+			golden := filepath.Join("testdata", "pdf", document.file)
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("document doesn't match %s, run the test with -update if the change is expected\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -12,20 +12,75 @@ import (
 
 // ReceiptsGetQuery : Structure that should be used for getting query data on get request for receipts
 type ReceiptsGetQuery struct {
-	PublicID   string `form:"id"`
-	LocationID string `form:"locationId"`
+	PublicID    string `form:"id"`
+	LocationID  string `form:"locationId"`
+	HouseholdID string `form:"householdId"`
+	// Currency in which totals are converted
+	Currency string `form:"currency" validate:"omitempty,currency"`
+	// PaymentMethodID and PaymentType limit receipts to receipts paid with
+	// the payment method or a payment method of the type
+	PaymentMethodID string `form:"paymentMethodId"`
+	PaymentType     string `form:"paymentType" validate:"omitempty,oneof=cash card voucher other"`
+	// RefundOf limits receipts to refunds of the receipt
+	RefundOf string `form:"refundOf"`
+	FiscalID string `form:"fiscalId"`
+}
+
+// filter adds conditions of the search to a query of receipts. Query has to
+// join locations, households and refunded receipts as originals.
+func (q ReceiptsGetQuery) filter(query sq.SelectBuilder) sq.SelectBuilder {
+	if q.PublicID != "" {
+		return query.Where(sq.Eq{"receipts.public_id": q.PublicID})
+	}
+
+	if q.LocationID != "" {
+		query = query.Where(sq.Eq{"locations.public_id": q.LocationID})
+	}
+	if q.HouseholdID != "" {
+		query = query.Where(sq.Eq{"households.public_id": q.HouseholdID})
+	}
+	if q.PaymentMethodID != "" {
+		query = query.Where(PaidWith("public_id", q.PaymentMethodID))
+	}
+	if q.PaymentType != "" {
+		query = query.Where(PaidWith("type", q.PaymentType))
+	}
+	if q.RefundOf != "" {
+		query = query.Where(sq.Eq{"originals.public_id": q.RefundOf})
+	}
+	if q.FiscalID != "" {
+		query = query.Where(sq.Eq{"receipts.fiscal_id": q.FiscalID})
+	}
+
+	return query
 }
 
 // ReceiptsPostBody : Structure that should be used for getting json from body of a post request for receipts
 type ReceiptsPostBody struct {
 	LocationPublicID string `json:"id" validate:"required"`
-	CreatedAt        string `json:"createdAt"`
+	// CreatedAt is used as the time of purchase if PurchasedAt is not
+	// specified for clients that don't know about it
+	CreatedAt string `json:"createdAt"`
+	// PurchasedAt is the time of purchase in RFC 3339 format or a local time
+	// in the time zone of the receipt. TimeZone is the default time zone of
+	// the user if it's not specified.
+	PurchasedAt string    `json:"purchasedAt"`
+	TimeZone    string    `json:"timeZone"`
+	Notes       string    `json:"notes"`
+	FiscalID    string    `json:"fiscalId"`
+	Currency    string    `json:"currency" validate:"omitempty,currency"`
+	Discount    *Discount `json:"discount"`
 }
 
 // ReceiptsPutBody : Structure that should be used for getting json from body of a put request for receipts
 type ReceiptsPutBody struct {
 	PublicID   string `json:"id" validate:"required"`
 	LocationID string `json:"locationId"`
+	Currency   string `json:"currency" validate:"omitempty,currency"`
+	// Discount replaces the discount of the receipt, an empty discount
+	// removes it
+	Discount *Discount `json:"discount"`
+	ReceiptDetails
 }
 
 // ReceiptsDeleteBody : Structure that should be used for getting json data from body of a delete request for items
@@ -35,21 +90,53 @@ type ReceiptsDeleteBody struct {
 
 // Receipt : Structure that should be used for getting receipt information from database
 type Receipt struct {
-	PublicID   string    `db:"public_id" json:"id"`
-	LocationID string    `db:"location_id" json:"locationId"`
-	CreatedBy  string    `db:"created_by" json:"createdBy"`
-	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt  time.Time `db:"updated_at" json:"updatedAt"`
+	PublicID    string    `db:"public_id" json:"id"`
+	LocationID  string    `db:"location_id" json:"locationId"`
+	HouseholdID string    `db:"household_id" json:"householdId"`
+	CreatedBy   string    `db:"created_by" json:"createdBy"`
+	Currency    string    `db:"currency" json:"currency"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updatedAt"`
 }
 
 // ReceiptWithData : Structure that should be used for getting receipt information including names, addresses, and everything else from receipts location from database
 type ReceiptWithData struct {
-	PublicID   string    `json:"id" graphql:"id"`
-	CreatedBy  string    `json:"createdBy" graphql:"createdBy"`
-	Location   Location  `json:"location" graphql:"location"`
-	TotalPrice float64   `json:"totalPrice" graphql:"totalPrice"`
-	CreatedAt  time.Time `json:"createdAt" grpahql:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt" graphql:"updatedAt"`
+	PublicID    string   `json:"id" graphql:"id"`
+	HouseholdID string   `json:"householdId" graphql:"householdId"`
+	CreatedBy   string   `json:"createdBy" graphql:"createdBy"`
+	Location    Location `json:"location" graphql:"location"`
+	// SubtotalPrice is the sum of line totals before the discount of the
+	// receipt and TotalPrice is the total after all discounts
+	SubtotalPrice Money     `json:"subtotalPrice" graphql:"subtotalPrice"`
+	Discount      *Discount `json:"discount" graphql:"discount"`
+	TotalPrice    Money     `json:"totalPrice" graphql:"totalPrice"`
+	// Saved is the sum of discounts of lines and the receipt
+	Saved    Money  `json:"saved" graphql:"saved"`
+	Currency string `json:"currency" graphql:"currency"`
+	// RefundOf is the id of the original receipt of a refund
+	RefundOf *string `json:"refundOf" graphql:"refundOf"`
+	// RefundedPrice is the sum of refunds of the receipt and NetTotalPrice is
+	// the total price after refunds
+	RefundedPrice Money `json:"refundedPrice" graphql:"refundedPrice"`
+	NetTotalPrice Money `json:"netTotalPrice" graphql:"netTotalPrice"`
+	// Payments are amounts paid with each payment method
+	Payments []Payment `json:"payments" graphql:"payments"`
+	// PaymentsMismatch is true if payments don't add up to the total price
+	PaymentsMismatch bool `json:"paymentsMismatch" graphql:"paymentsMismatch"`
+	// ConvertedTotalPrice is the total price in the requested currency
+	ConvertedTotalPrice *Money `json:"convertedTotalPrice,omitempty" graphql:"convertedTotalPrice"`
+	// Taxes are net, tax and gross subtotals of the receipt grouped by rate
+	Taxes []TaxBreakdown `json:"taxes" graphql:"taxes"`
+	// PurchasedAt is the time of purchase in the time zone of the receipt
+	PurchasedAt time.Time `json:"purchasedAt" graphql:"purchasedAt"`
+	TimeZone    string    `json:"timeZone" graphql:"timeZone"`
+	Notes       *string   `json:"notes" graphql:"notes"`
+	FiscalID    *string   `json:"fiscalId" graphql:"fiscalId"`
+	// StatementTransaction is the transaction of a bank statement that was
+	// confirmed for the receipt
+	StatementTransaction *StatementTransaction `json:"statementTransaction" graphql:"statementTransaction"`
+	CreatedAt            time.Time             `json:"createdAt" grpahql:"createdAt"`
+	UpdatedAt            time.Time             `json:"updatedAt" graphql:"updatedAt"`
 }
 
 // GetReceipts handles get requests for receipts
@@ -71,6 +158,13 @@ func (o Options) GetReceipts() gin.HandlerFunc {
 			return
 		}
 
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		if searchQuery.PublicID == "" && createdBy.PublicID == "" && searchQuery.LocationID == "" {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"message": "No search parameters specified!",
@@ -85,19 +179,18 @@ func (o Options) GetReceipts() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Select("receipts.public_id, locations.public_id AS location_id, users.public_id AS created_by, locations.name AS name, locations.address AS address, receipts.created_at, receipts.updated_at, SUM(items.price * items_in_receipt.amount) AS total_price").From("receipts").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id")
-
-		if searchQuery.PublicID != "" {
-			query = query.Where(sq.Eq{"receipts.public_id": searchQuery.PublicID})
-		} else {
-			if createdBy.PublicID != "" {
-				query = query.Where(sq.Eq{"users.public_id": createdBy.PublicID})
-			}
-			if searchQuery.LocationID != "" {
-				query = query.Where(sq.Eq{"locations.public_id": searchQuery.LocationID})
-			}
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
 		}
 
+		query := sq.Select("receipts.public_id, households.public_id AS household_id, locations.public_id AS location_id, users.public_id AS created_by, locations.name AS name, locations.address AS address, locations.tax_id, receipts.created_at, receipts.updated_at, " + ReceiptSubtotalSQL + " AS subtotal_price, receipts.discount_type, receipts.discount_value, " + ReceiptTotalSQL + " AS total_price, " + ReceiptSavedSQL + " AS saved, receipts.currency, originals.public_id AS refund_of, receipts.purchased_at, receipts.time_zone, receipts.notes, receipts.fiscal_id").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("receipts originals ON originals.id = receipts.refund_of").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(MemberOf("receipts.household_id", user.ID)).Where(NotDeleted("receipts"))
+
+		query = searchQuery.filter(query)
+
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -118,16 +211,15 @@ func (o Options) GetReceipts() gin.HandlerFunc {
 
 		for rows.Next() {
 			receipt := ReceiptWithData{}
-			var totalPrice sql.NullFloat64
+			var discountType *string
+			var discountValue *int64
 
-			err := rows.Scan(&receipt.PublicID, &receipt.Location.PublicID, &receipt.CreatedBy, &receipt.Location.Name, &receipt.Location.Address, &receipt.CreatedAt, &receipt.UpdatedAt, &totalPrice)
+			// Receipts without items have a total price of 0
+			err := rows.Scan(&receipt.PublicID, &receipt.HouseholdID, &receipt.Location.PublicID, &receipt.CreatedBy, &receipt.Location.Name, &receipt.Location.Address, &receipt.Location.TaxID, &receipt.CreatedAt, &receipt.UpdatedAt, &receipt.SubtotalPrice, &discountType, &discountValue, &receipt.TotalPrice, &receipt.Saved, &receipt.Currency, &receipt.RefundOf, &receipt.PurchasedAt, &receipt.TimeZone, &receipt.Notes, &receipt.FiscalID)
 
-			// If database is unable to get the total price that means there are no
-			// items in the receipt and the default result for that will be an invalid
-			// flag in sql.NullFloat64 type and a 0 (zero) in Float64 value. This is
-			// nice for us since we just wan't that, the result and if there are no
-			// receipts the result is 0.
-			receipt.TotalPrice = totalPrice.Float64
+			receipt.Location.HouseholdID = receipt.HouseholdID
+			receipt.PurchasedAt = inTimeZone(receipt.PurchasedAt, receipt.TimeZone)
+			receipt.Discount = NewDiscount(discountType, discountValue)
 
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -139,6 +231,75 @@ func (o Options) GetReceipts() gin.HandlerFunc {
 			receipts = append(receipts, receipt)
 		}
 
+		receiptIDs := make([]string, len(receipts))
+		for i, receipt := range receipts {
+			receiptIDs[i] = receipt.PublicID
+		}
+
+		taxes, err := ReceiptTaxes(o.DB, receiptIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		payments, err := ReceiptPayments(o.DB, receiptIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		refunds, err := ReceiptRefunds(o.DB, receiptIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		statementTransactions, err := ReceiptStatementTransactions(o.DB, receiptIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for i, receipt := range receipts {
+			receipts[i].RefundedPrice = refunds[receipt.PublicID]
+			receipts[i].NetTotalPrice = receipt.TotalPrice - receipts[i].RefundedPrice
+			receipts[i].Taxes = taxes[receipt.PublicID]
+			if receipts[i].Taxes == nil {
+				receipts[i].Taxes = []TaxBreakdown{}
+			}
+			receipts[i].Payments = payments[receipt.PublicID]
+			if receipts[i].Payments == nil {
+				receipts[i].Payments = []Payment{}
+			}
+			receipts[i].PaymentsMismatch = PaymentsMismatch(receipts[i].Payments, receipt.TotalPrice)
+			receipts[i].StatementTransaction = statementTransactions[receipt.PublicID]
+		}
+
+		if searchQuery.Currency != "" {
+			converter := NewCurrencyConverter(o.DB, o.RateProvider)
+			currency := normalizeCurrency(searchQuery.Currency)
+
+			for i, receipt := range receipts {
+				converted, err := converter.Convert(receipt.TotalPrice, receipt.Currency, currency, receipt.PurchasedAt)
+				if err != nil {
+					ctx.JSON(conversionErrorStatus(err), gin.H{
+						"message": err.Error(),
+					})
+					return
+				}
+
+				receipts[i].ConvertedTotalPrice = &converted
+			}
+		}
+
 		ctx.JSON(http.StatusOK, receipts)
 	}
 }
@@ -170,24 +331,24 @@ func (o Options) PostReceipts() gin.HandlerFunc {
 			return
 		}
 
-		locationIDQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": receiptData.LocationPublicID})
-		locationIDQueryString, locationIDQueryStringArgs, err := locationIDQuery.ToSql()
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
+		if err := receiptData.Discount.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
 
-		location := StructID{}
-		if err := o.DB.Get(&location, locationIDQueryString, locationIDQueryStringArgs...); err != nil {
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
 
-		user, err := createdBy.PrivateID(o.DB)
+		// Receipt is stored in the same household as its location
+		locationIDQuery := sq.Select("id, household_id").From("locations").Where(sq.Eq{"public_id": receiptData.LocationPublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+		locationIDQueryString, locationIDQueryStringArgs, err := locationIDQuery.ToSql()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -195,6 +356,25 @@ func (o Options) PostReceipts() gin.HandlerFunc {
 			return
 		}
 
+		location := struct {
+			ID          int `db:"id"`
+			HouseholdID int `db:"household_id"`
+		}{}
+		if err := o.DB.Get(&location, locationIDQueryString, locationIDQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to add receipts to specified location",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
 		uuid, err := nanoid.Nanoid()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -222,7 +402,50 @@ func (o Options) PostReceipts() gin.HandlerFunc {
 			}
 		}
 
-		query := sq.Insert("receipts").Columns("public_id", "location_id", "created_by", "created_at", "updated_at").Values(uuid, location.ID, user.ID, createdAt, updatedAt)
+		// Receipts are in the default time zone of the user unless specified
+		timeZone := receiptData.TimeZone
+		if timeZone == "" {
+			if err := o.DB.Get(&timeZone, "SELECT time_zone FROM users WHERE id = ?", user.ID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		zone, err := loadTimeZone(timeZone)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		purchasedAt := createdAt
+		if receiptData.PurchasedAt != "" {
+			purchasedAt, err = parsePurchaseTime(receiptData.PurchasedAt, zone)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		// Receipts are in the default currency of the user unless specified
+		currency := normalizeCurrency(receiptData.Currency)
+		if currency == "" {
+			if err := o.DB.Get(&currency, "SELECT currency FROM users WHERE id = ?", user.ID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		discountType, discountValue := receiptData.Discount.columns()
+
+		query := sq.Insert("receipts").Columns("public_id", "location_id", "household_id", "created_by", "currency", "discount_type", "discount_value", "purchased_at", "time_zone", "notes", "fiscal_id", "created_at", "updated_at").Values(uuid, location.ID, location.HouseholdID, user.ID, currency, discountType, discountValue, purchasedAt.UTC(), timeZone, nullableText(receiptData.Notes), nullableText(receiptData.FiscalID), createdAt, updatedAt)
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -285,6 +508,13 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 			return
 		}
 
+		if err := receiptData.Discount.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
 		user, err := createdBy.PrivateID(o.DB)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -296,7 +526,8 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 		query := sq.Update("receipts")
 
 		if receiptData.LocationID != "" {
-			locationQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": receiptData.LocationID})
+			// Location has to be in the same household as the receipt
+			locationQuery := sq.Select("id").From("locations").Where(sq.Eq{"public_id": receiptData.LocationID, "deleted_at": nil}).Where("household_id = (SELECT household_id FROM receipts WHERE public_id = ?)", receiptData.PublicID)
 
 			locationQueryString, locationQueryStringArgs, err := locationQuery.ToSql()
 			if err != nil {
@@ -307,7 +538,12 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 			}
 
 			location := StructID{}
-			if err := o.DB.Get(&location, locationQueryString, locationQueryStringArgs...); err != nil {
+			if err := o.DB.Get(&location, locationQueryString, locationQueryStringArgs...); err == sql.ErrNoRows {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": "location not found in household of receipt",
+				})
+				return
+			} else if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{
 					"message": err.Error(),
 				})
@@ -316,8 +552,23 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 
 			query = query.Set("location_id", location.ID)
 		}
+		if receiptData.Currency != "" {
+			query = query.Set("currency", normalizeCurrency(receiptData.Currency))
+		}
+		if receiptData.Discount != nil {
+			discountType, discountValue := receiptData.Discount.columns()
+			query = query.Set("discount_type", discountType).Set("discount_value", discountValue)
+		}
+
+		query, err = receiptData.ReceiptDetails.set(o.DB, query, receiptData.PublicID)
+		if err != nil {
+			ctx.JSON(purchaseDetailsErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 
-		query = query.Set("updated_at", time.Now()).Where(sq.Eq{"public_id": receiptData.PublicID, "created_by": user.ID})
+		query = query.Set("updated_at", time.Now()).Where(sq.Eq{"public_id": receiptData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -335,13 +586,22 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 			return
 		}
 
-		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+		result, err := tx.Exec(queryString, queryStringArgs...)
+		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
 
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			tx.Rollback()
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to update specified receipt",
+			})
+			return
+		}
+
 		if err := tx.Commit(); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -349,6 +609,8 @@ func (o Options) PutReceipts() gin.HandlerFunc {
 			return
 		}
 
+		o.checkBudgets(receiptData.PublicID)
+
 		ctx.Status(http.StatusOK)
 	}
 }
@@ -388,7 +650,15 @@ func (o Options) DeleteReceipts() gin.HandlerFunc {
 			return
 		}
 
-		query := sq.Delete("receipts").Where(sq.Eq{"public_id": receiptData.PublicID, "created_by": user.ID})
+		batch, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("receipts").Set("deleted_at", sq.Expr("current_timestamp")).Set("delete_batch", batch).Where(sq.Eq{"public_id": receiptData.PublicID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
 
 		queryString, queryStringArgs, err := query.ToSql()
 		if err != nil {
@@ -406,13 +676,26 @@ func (o Options) DeleteReceipts() gin.HandlerFunc {
 			return
 		}
 
-		if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+		result, err := tx.Exec(queryString, queryStringArgs...)
+		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
 
+		// Refunds are moved to the trash in the same batch as their original
+		// receipt so they can be restored together
+		if deleted, err := result.RowsAffected(); err == nil && deleted != 0 {
+			if _, err := tx.Exec("UPDATE receipts SET deleted_at = (SELECT deleted_at FROM receipts WHERE public_id = ?), delete_batch = ? WHERE refund_of = (SELECT id FROM receipts WHERE public_id = ?) AND deleted_at IS NULL", receiptData.PublicID, batch, receiptData.PublicID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
 		if err := tx.Commit(); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"message": err.Error(),
@@ -423,3 +706,27 @@ func (o Options) DeleteReceipts() gin.HandlerFunc {
 		ctx.Status(http.StatusOK)
 	}
 }
+
+// PostReceiptActions is a Gin handler function for POST requests to paths
+// under a receipt. Gin doesn't route static paths next to receipt ids so
+// imports under /receipts/import are dispatched here as well.
+func (o Options) PostReceiptActions() gin.HandlerFunc {
+	fiscalImport := o.PostFiscalImport()
+	shares := o.PostShares()
+	refunds := o.PostRefunds()
+
+	return func(ctx *gin.Context) {
+		switch id, action := ctx.Param("id"), ctx.Param("action"); {
+		case id == "import" && action == "/fiscal":
+			fiscalImport(ctx)
+		case action == "/share":
+			shares(ctx)
+		case action == "/refunds":
+			refunds(ctx)
+		default:
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": "404 page not found",
+			})
+		}
+	}
+}
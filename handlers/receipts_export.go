@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+)
+
+// Layouts of receipt exports
+const (
+	// ExportReceipts has a row for each receipt
+	ExportReceipts = "receipts"
+	// ExportLines has a row for each line of a receipt with columns of its
+	// receipt
+	ExportLines = "lines"
+)
+
+// ErrExportCurrency is returned when an export is requested in a currency.
+// Totals are exported in the currency of each receipt since rates may be
+// missing in the middle of the export.
+var ErrExportCurrency = errors.New("exports can't be converted to another currency")
+
+// ReceiptsExportQuery : Structure that should be used for getting query data on get request for exports of receipts. Receipts are filtered like receipts of a get request for receipts.
+type ReceiptsExportQuery struct {
+	ReceiptsGetQuery
+	Format string `form:"format" validate:"omitempty,oneof=csv xlsx json"`
+	Layout string `form:"layout" validate:"omitempty,oneof=receipts lines"`
+}
+
+// exportKind is the kind of values of an exported column
+type exportKind int
+
+const (
+	exportText exportKind = iota
+	// exportHundredths are integers in hundredths like money and percentages
+	exportHundredths
+	exportNumber
+	// exportTime is a time that is exported in the time zone of the receipt
+	exportTime
+)
+
+// exportColumn is a column of an export of receipts
+type exportColumn struct {
+	name string
+	sql  string
+	kind exportKind
+}
+
+// exportReceiptColumns are columns of receipts in the receipts layout
+var exportReceiptColumns = []exportColumn{
+	{"id", "receipts.public_id", exportText},
+	{"householdId", "households.public_id", exportText},
+	{"createdBy", "users.public_id", exportText},
+	{"purchasedAt", "receipts.purchased_at", exportTime},
+	{"timeZone", "receipts.time_zone", exportText},
+	{"locationId", "locations.public_id", exportText},
+	{"location", "locations.name", exportText},
+	{"address", "locations.address", exportText},
+	{"taxId", "locations.tax_id", exportText},
+	{"currency", "receipts.currency", exportText},
+	{"lines", "COUNT(items.id)", exportNumber},
+	{"subtotal", ReceiptSubtotalSQL, exportHundredths},
+	{"saved", ReceiptSavedSQL, exportHundredths},
+	{"total", ReceiptTotalSQL, exportHundredths},
+	{"refundOf", "originals.public_id", exportText},
+	{"fiscalId", "receipts.fiscal_id", exportText},
+	{"notes", "receipts.notes", exportText},
+}
+
+// exportLineColumns are columns of lines in the lines layout
+var exportLineColumns = []exportColumn{
+	{"receiptId", "receipts.public_id", exportText},
+	{"purchasedAt", "receipts.purchased_at", exportTime},
+	{"timeZone", "receipts.time_zone", exportText},
+	{"location", "locations.name", exportText},
+	{"currency", "receipts.currency", exportText},
+	{"fiscalId", "receipts.fiscal_id", exportText},
+	{"refundOf", "originals.public_id", exportText},
+	{"lineId", "items_in_receipt.public_id", exportText},
+	{"itemId", "items.public_id", exportText},
+	{"item", "items.name", exportText},
+	{"unit", "items.unit", exportText},
+	{"price", linePriceSQL, exportHundredths},
+	{"amount", "items_in_receipt.amount", exportNumber},
+	{"taxLabel", "items_in_receipt.tax_label", exportText},
+	{"taxRate", "items_in_receipt.tax_rate", exportHundredths},
+	{"saved", LineDiscountSQL, exportHundredths},
+	{"total", LineTotalSQL, exportHundredths},
+}
+
+// exportQuery creates a query of receipts or lines of receipts of the user
+// with columns of the layout. Time zone of the receipt is always the last
+// column so times can be exported in it.
+func exportQuery(layout string, userID int) (sq.SelectBuilder, []exportColumn) {
+	columns := exportReceiptColumns
+	if layout == ExportLines {
+		columns = exportLineColumns
+	}
+
+	query := sq.Select()
+	for _, column := range columns {
+		query = query.Column(column.sql)
+	}
+	query = query.Column("receipts.time_zone")
+
+	if layout == ExportLines {
+		query = query.From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("items ON items.id = items_in_receipt.item_id").OrderBy("receipts.purchased_at", "receipts.id", "items_in_receipt.id")
+	} else {
+		query = query.From("receipts").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").OrderBy("receipts.purchased_at", "receipts.id")
+	}
+
+	query = query.Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("receipts originals ON originals.id = receipts.refund_of").Where(MemberOf("receipts.household_id", userID)).Where(NotDeleted("receipts"))
+
+	return query, columns
+}
+
+// exportValue converts a value from the database to a value of an exported
+// column. Text is a string, hundredths are money, numbers are float64 and
+// missing values are nil.
+func exportValue(value interface{}, kind exportKind, timeZone string) interface{} {
+	if v, ok := value.([]byte); ok {
+		value = string(v)
+	}
+	if value == nil {
+		return nil
+	}
+
+	switch kind {
+	case exportHundredths:
+		switch v := value.(type) {
+		case int64:
+			return Money(v)
+		case float64:
+			return Money(math.Round(v))
+		}
+	case exportNumber:
+		switch v := value.(type) {
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		}
+	case exportTime:
+		if v, ok := value.(time.Time); ok {
+			return inTimeZone(v, timeZone).Format(time.RFC3339)
+		}
+	}
+
+	return value
+}
+
+// exportString converts a value of an exported column to text
+func exportString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Money:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// exportWriter writes rows of an export in a format
+type exportWriter interface {
+	header(columns []string) error
+	row(values []interface{}) error
+	close() error
+}
+
+// csvExportWriter writes exports as csv
+type csvExportWriter struct {
+	writer *csv.Writer
+	line   []string
+}
+
+func (w *csvExportWriter) header(columns []string) error {
+	w.line = make([]string, len(columns))
+	return w.writer.Write(columns)
+}
+
+func (w *csvExportWriter) row(values []interface{}) error {
+	for i, value := range values {
+		w.line[i] = exportString(value)
+	}
+	return w.writer.Write(w.line)
+}
+
+func (w *csvExportWriter) close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonExportWriter writes exports as a json array of objects with columns as
+// keys
+type jsonExportWriter struct {
+	writer  io.Writer
+	columns [][]byte
+	rows    int
+}
+
+func (w *jsonExportWriter) header(columns []string) error {
+	for _, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		w.columns = append(w.columns, key)
+	}
+
+	_, err := io.WriteString(w.writer, "[")
+	return err
+}
+
+func (w *jsonExportWriter) row(values []interface{}) error {
+	object := []byte("{")
+	if w.rows > 0 {
+		object = []byte(",\n{")
+	}
+
+	for i, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			object = append(object, ',')
+		}
+		object = append(append(append(object, w.columns[i]...), ':'), data...)
+	}
+	w.rows++
+
+	_, err := w.writer.Write(append(object, '}'))
+	return err
+}
+
+func (w *jsonExportWriter) close() error {
+	_, err := io.WriteString(w.writer, "]\n")
+	return err
+}
+
+// Parts of an xlsx file except the worksheet
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Receipts" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// xlsxExportWriter writes exports as an xlsx workbook with one worksheet.
+// Worksheet is compressed while it's written so the workbook is never kept in
+// memory.
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+}
+
+func (w *xlsxExportWriter) header(columns []string) error {
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRelationships},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRelationships},
+	}
+	for _, part := range parts {
+		file, err := w.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := w.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = sheet
+
+	if _, err := io.WriteString(w.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = column
+	}
+	return w.row(values)
+}
+
+func (w *xlsxExportWriter) row(values []interface{}) error {
+	if _, err := io.WriteString(w.sheet, "<row>"); err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		var err error
+		switch value.(type) {
+		case nil:
+			_, err = io.WriteString(w.sheet, "<c/>")
+		case Money, float64:
+			_, err = io.WriteString(w.sheet, "<c><v>"+exportString(value)+"</v></c>")
+		default:
+			if _, err = io.WriteString(w.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err == nil {
+				if err = xml.EscapeText(w.sheet, []byte(exportString(value))); err == nil {
+					_, err = io.WriteString(w.sheet, "</t></is></c>")
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w.sheet, "</row>")
+	return err
+}
+
+func (w *xlsxExportWriter) close() error {
+	if _, err := io.WriteString(w.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// GetReceiptsExport is a Gin handler function for exporting receipts as csv,
+// xlsx or json. Rows are written while they are read from the database so
+// exports of large archives are not kept in memory.
+func (o Options) GetReceiptsExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var exportQueryData ReceiptsExportQuery
+		if err := ctx.ShouldBindQuery(&exportQueryData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(exportQueryData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if exportQueryData.Currency != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": ErrExportCurrency.Error(),
+			})
+			return
+		}
+
+		format, layout := exportQueryData.Format, exportQueryData.Layout
+		if format == "" {
+			format = "csv"
+		}
+		if layout == "" {
+			layout = ExportReceipts
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query, columns := exportQuery(layout, user.ID)
+		query = exportQueryData.filter(query)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		rows, err := o.DB.Queryx(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		defer rows.Close()
+
+		var writer exportWriter
+		contentType := ""
+		switch format {
+		case "xlsx":
+			writer = &xlsxExportWriter{archive: zip.NewWriter(ctx.Writer)}
+			contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		case "json":
+			writer = &jsonExportWriter{writer: ctx.Writer}
+			contentType = "application/json; charset=utf-8"
+		default:
+			writer = &csvExportWriter{writer: csv.NewWriter(ctx.Writer)}
+			contentType = "text/csv; charset=utf-8"
+		}
+
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = column.name
+		}
+
+		ctx.Header("Content-Type", contentType)
+		ctx.Header("Content-Disposition", "attachment; filename=\"receipts-"+layout+"."+format+"\"")
+		ctx.Status(http.StatusOK)
+
+		// Status is already sent so errors can only stop the export. Output
+		// is left incomplete so it's not mistaken for a whole export.
+		if err := writer.header(names); err != nil {
+			log.Println("export of receipts failed:", err)
+			return
+		}
+
+		values := make([]interface{}, len(columns))
+		for rows.Next() {
+			record, err := rows.SliceScan()
+			if err != nil {
+				log.Println("export of receipts failed:", err)
+				return
+			}
+
+			timeZone := exportString(exportValue(record[len(record)-1], exportText, ""))
+			for i, column := range columns {
+				values[i] = exportValue(record[i], column.kind, timeZone)
+			}
+
+			if err := writer.row(values); err != nil {
+				log.Println("export of receipts failed:", err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Println("export of receipts failed:", err)
+			return
+		}
+
+		if err := writer.close(); err != nil {
+			log.Println("export of receipts failed:", err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// exportNotes are notes of an exported receipt that have to be quoted in csv
+// and escaped in xlsx
+const exportNotes = `Milk, "fresh" & <cold>`
+
+// newExportTestDB creates a database with a receipt in the Belgrade time zone
+// and a receipt without a time zone
+func newExportTestDB(t *testing.T) *sqlx.DB {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	milk := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Mleko', 12999, 'kom')", household.UserID, household.HouseholdID)
+	bread := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'bread', 'Hleb', 6499, 'kom')", household.UserID, household.HouseholdID)
+
+	belgrade := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, notes) VALUES (?, ?, ?, 'belgrade', ?, 'Europe/Belgrade', ?)", household.LocationID, household.HouseholdID, household.UserID, time.Date(2023, 3, 14, 17, 42, 0, 0, time.UTC), exportNotes)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'belgrade-milk', 2)", belgrade, milk)
+	utc := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at) VALUES (?, ?, ?, 'utc', ?)", household.LocationID, household.HouseholdID, household.UserID, time.Date(2023, 3, 15, 9, 0, 0, 0, time.UTC))
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'utc-bread', 1)", utc, bread)
+
+	return db
+}
+
+// exportColumns picks columns of exported rows
+func exportColumns(rows []map[string]string, columns ...string) [][]string {
+	picked := [][]string{}
+	for _, row := range rows {
+		values := []string{}
+		for _, column := range columns {
+			values = append(values, row[column])
+		}
+		picked = append(picked, values)
+	}
+	return picked
+}
+
+func TestGetReceiptsExport(t *testing.T) {
+	options := Options{
+		DB: newExportTestDB(t),
+		V:  NewValidator(),
+	}
+
+	receiptColumns := []string{"id", "purchasedAt", "timeZone", "location", "lines", "subtotal", "total", "notes"}
+	receipts := [][]string{
+		{"belgrade", "2023-03-14T18:42:00+01:00", "Europe/Belgrade", "Maxi", "1", "259.98", "259.98", exportNotes},
+		{"utc", "2023-03-15T09:00:00Z", "", "Maxi", "1", "64.99", "64.99", ""},
+	}
+	lineColumns := []string{"receiptId", "purchasedAt", "lineId", "item", "unit", "price", "amount", "total"}
+	lines := [][]string{
+		{"belgrade", "2023-03-14T18:42:00+01:00", "belgrade-milk", "Mleko", "kom", "129.99", "2", "259.98"},
+		{"utc", "2023-03-15T09:00:00Z", "utc-bread", "Hleb", "kom", "64.99", "1", "64.99"},
+	}
+
+	tests := []struct {
+		format  string
+		layout  string
+		columns []string
+		want    [][]string
+	}{
+		{"csv", "", receiptColumns, receipts},
+		{"csv", "lines", lineColumns, lines},
+		{"json", "receipts", receiptColumns, receipts},
+		{"json", "lines", lineColumns, lines},
+	}
+	for _, test := range tests {
+		recorder := serve(options.GetReceiptsExport(), "/receipts/export", "user", http.MethodGet, "/receipts/export?format="+test.format+"&layout="+test.layout, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d %s", test.format, test.layout, recorder.Code, recorder.Body)
+		}
+
+		rows := []map[string]string{}
+		if test.format == "csv" {
+			records, err := csv.NewReader(recorder.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records[1:] {
+				row := map[string]string{}
+				for i, column := range records[0] {
+					row[column] = record[i]
+				}
+				rows = append(rows, row)
+			}
+		} else {
+			decoder := json.NewDecoder(recorder.Body)
+			decoder.UseNumber()
+			objects := []map[string]interface{}{}
+			if err := decoder.Decode(&objects); err != nil {
+				t.Fatal(err)
+			}
+			for _, object := range objects {
+				row := map[string]string{}
+				for column, value := range object {
+					switch v := value.(type) {
+					case string:
+						row[column] = v
+					case json.Number:
+						row[column] = v.String()
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+
+		if got := exportColumns(rows, test.columns...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s %s: got rows %q, want %q", test.format, test.layout, got, test.want)
+		}
+	}
+}
+
+func TestGetReceiptsExportXLSX(t *testing.T) {
+	options := Options{
+		DB: newExportTestDB(t),
+		V:  NewValidator(),
+	}
+
+	recorder := serve(options.GetReceiptsExport(), "/receipts/export", "user", http.MethodGet, "/receipts/export?format=xlsx", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+
+	body := recorder.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = content
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("workbook is missing %s", name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if !bytes.Contains(sheet, []byte("&amp; &lt;cold&gt;")) {
+		t.Errorf("notes are not escaped in %s", sheet)
+	}
+
+	var worksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(sheet, &worksheet); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]string{}
+	for _, row := range worksheet.Rows {
+		values := []string{}
+		for _, cell := range row.Cells {
+			if cell.Type == "inlineStr" {
+				values = append(values, cell.Inline)
+			} else {
+				values = append(values, cell.Value)
+			}
+		}
+		rows = append(rows, values)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 receipts", len(rows))
+	}
+
+	columns := map[string]int{}
+	for i, column := range rows[0] {
+		columns[column] = i
+	}
+	if got, want := strings.Join(rows[0], ","), "id,householdId,createdBy,purchasedAt,timeZone,locationId,location,address,taxId,currency,lines,subtotal,saved,total,refundOf,fiscalId,notes"; got != want {
+		t.Errorf("got header %s, want %s", got, want)
+	}
+	if got := rows[1][columns["notes"]]; got != exportNotes {
+		t.Errorf("got notes %q, want %q", got, exportNotes)
+	}
+	if got := rows[1][columns["purchasedAt"]]; got != "2023-03-14T18:42:00+01:00" {
+		t.Errorf("got purchase time %s in the time zone of the receipt, want 2023-03-14T18:42:00+01:00", got)
+	}
+	if got := rows[2][columns["total"]]; got != "64.99" {
+		t.Errorf("got total %s, want 64.99", got)
+	}
+	if cell := worksheet.Rows[2].Cells[columns["total"]]; cell.Type != "" {
+		t.Errorf("got total of type %q, want a number", cell.Type)
+	}
+}
+
+func TestGetReceiptsExportCurrency(t *testing.T) {
+	options := Options{
+		DB: newExportTestDB(t),
+		V:  NewValidator(),
+	}
+
+	recorder := serve(options.GetReceiptsExport(), "/receipts/export", "user", http.MethodGet, "/receipts/export?currency=EUR", "")
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), ErrExportCurrency.Error()) {
+		t.Errorf("got %d %s, want %d with %q", recorder.Code, recorder.Body, http.StatusBadRequest, ErrExportCurrency)
+	}
+}
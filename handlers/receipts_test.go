@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator"
+)
+
+func TestPostReceiptActions(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  validator.New(),
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		// Body isn't valid for imports or refunds so they are reached and fail
+		{"/receipts/import/fiscal", http.StatusBadRequest},
+		{"/receipts/receipt/refunds", http.StatusBadRequest},
+		{"/receipts/import/unknown", http.StatusNotFound},
+		{"/receipts/receipt/unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if recorder := serve(options.PostReceiptActions(), "/receipts/:id/*action", "user", http.MethodPost, test.path, `{"journal": "not a journal"}`); recorder.Code != test.status {
+			t.Errorf("%s: got %d %s, want %d", test.path, recorder.Code, recorder.Body, test.status)
+		}
+	}
+}
+
+func TestPutReceipts(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	newTestHousehold(t, db, "other")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'receipt')", household.LocationID, household.HouseholdID, household.UserID)
+
+	tests := []struct {
+		user   string
+		body   string
+		status int
+	}{
+		{"user", `{"id": "receipt", "locationId": "user-location", "currency": "EUR"}`, http.StatusOK},
+		// Locations of other households and unknown locations can't be set
+		{"user", `{"id": "receipt", "locationId": "other-location"}`, http.StatusBadRequest},
+		{"user", `{"id": "receipt", "locationId": "unknown"}`, http.StatusBadRequest},
+		{"user", `{"id": "unknown", "currency": "EUR"}`, http.StatusUnauthorized},
+		{"other", `{"id": "receipt", "currency": "USD"}`, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if recorder := serve(options.PutReceipts(), "/receipts", test.user, http.MethodPut, "/receipts", test.body); recorder.Code != test.status {
+			t.Errorf("%s %s: got %d %s, want %d", test.user, test.body, recorder.Code, recorder.Body, test.status)
+		}
+	}
+
+	var currency string
+	if err := db.Get(&currency, "SELECT currency FROM receipts WHERE public_id = 'receipt'"); err != nil {
+		t.Fatal(err)
+	}
+	if currency != "EUR" {
+		t.Errorf("got currency %s, want EUR", currency)
+	}
+}
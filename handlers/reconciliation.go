@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/handlers/statement"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Formats of bank statements
+const (
+	StatementCSV     = "csv"
+	StatementCAMT053 = "camt053"
+	StatementOFX     = "ofx"
+)
+
+// defaultReconciliationDays is the number of days a transaction can be booked
+// before or after the purchase if it's not specified
+const defaultReconciliationDays = 3
+
+// statementDateLayout is the layout of dates of statement transactions
+const statementDateLayout = "2006-01-02"
+
+// ErrInvalidStatementDate is returned when the date of a transaction is not in
+// YYYY-MM-DD format
+var ErrInvalidStatementDate = errors.New("date of a transaction must be in YYYY-MM-DD format")
+
+// ReconciliationPostBody : Structure that should be used for getting json from body of a post request for reconciliation of a bank statement. Mapping is used only for csv statements.
+type ReconciliationPostBody struct {
+	Format      string               `json:"format" validate:"required,oneof=csv camt053 ofx"`
+	Statement   string               `json:"statement" validate:"required"`
+	Mapping     statement.CSVMapping `json:"mapping"`
+	HouseholdID string               `json:"householdId"`
+	// Days is the number of days a transaction can be booked before or after
+	// the purchase
+	Days *int `json:"days" validate:"omitempty,min=0,max=31"`
+}
+
+// ReconciliationPutBody : Structure that should be used for getting json from body of a put request for confirmed matches of transactions and receipts. Confirming a transaction for a receipt overrides its match with another receipt.
+type ReconciliationPutBody struct {
+	Matches []ReconciliationMatchBody `json:"matches" validate:"required,min=1,dive"`
+}
+
+// ReconciliationMatchBody : Structure that should be used for getting a single confirmed match of a transaction and a receipt
+type ReconciliationMatchBody struct {
+	ReceiptID   string               `json:"receiptId" validate:"required"`
+	Transaction StatementTransaction `json:"transaction"`
+}
+
+// ReconciliationDeleteBody : Structure that should be used for getting json data from body of a delete request for a confirmed match of a receipt
+type ReconciliationDeleteBody struct {
+	ReceiptID string `json:"receiptId" validate:"required"`
+}
+
+// StatementTransaction : Structure that should be used for getting and sending transactions of bank statements. Amount is negative for money that left the account.
+type StatementTransaction struct {
+	Date        string `json:"date" validate:"required"`
+	Amount      Money  `json:"amount"`
+	Currency    string `json:"currency" validate:"omitempty,currency"`
+	Reference   string `json:"reference"`
+	Description string `json:"description"`
+}
+
+// ReconciliationReceipt : Structure that should be used for sending receipts in a reconciliation of a bank statement
+type ReconciliationReceipt struct {
+	PublicID    string    `db:"public_id" json:"id"`
+	HouseholdID string    `db:"household_id" json:"householdId"`
+	Location    string    `db:"location" json:"location"`
+	PurchasedAt time.Time `db:"purchased_at" json:"purchasedAt"`
+	TimeZone    string    `db:"time_zone" json:"timeZone"`
+	TotalPrice  Money     `db:"total_price" json:"totalPrice"`
+	Currency    string    `db:"currency" json:"currency"`
+}
+
+// ReconciliationMatch : Structure that should be used for sending a match of a transaction and a receipt. Days is the number of days from the purchase to the transaction.
+type ReconciliationMatch struct {
+	Transaction     StatementTransaction  `json:"transaction"`
+	Receipt         ReconciliationReceipt `json:"receipt"`
+	Days            int                   `json:"days"`
+	LocationMatched bool                  `json:"locationMatched"`
+}
+
+// Reconciliation : Structure that should be used for sending a reconciliation of a bank statement. Reconciled are transactions that were already confirmed for a receipt.
+type Reconciliation struct {
+	Matches               []ReconciliationMatch   `json:"matches"`
+	Reconciled            []ReconciliationMatch   `json:"reconciled"`
+	UnmatchedTransactions []StatementTransaction  `json:"unmatchedTransactions"`
+	UnmatchedReceipts     []ReconciliationReceipt `json:"unmatchedReceipts"`
+}
+
+// reconciliationReceipt is a receipt with its confirmed transaction
+type reconciliationReceipt struct {
+	ReconciliationReceipt
+	StatementDate      *string `db:"statement_date"`
+	StatementAmount    *Money  `db:"statement_amount"`
+	StatementReference *string `db:"statement_reference"`
+}
+
+// date gets the date of the purchase in the time zone of the receipt
+func (r ReconciliationReceipt) date() time.Time {
+	purchasedAt := inTimeZone(r.PurchasedAt, r.TimeZone)
+	return time.Date(purchasedAt.Year(), purchasedAt.Month(), purchasedAt.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// confirmed checks if the transaction was confirmed for the receipt
+func (r reconciliationReceipt) confirmed(transaction statement.Transaction) bool {
+	return r.StatementDate != nil && *r.StatementDate == transaction.Date.Format(statementDateLayout) &&
+		r.StatementAmount != nil && int64(*r.StatementAmount) == transaction.Amount &&
+		((r.StatementReference == nil && transaction.Reference == "") || (r.StatementReference != nil && *r.StatementReference == transaction.Reference))
+}
+
+// parseStatement parses transactions of a statement in the format
+func parseStatement(format string, text string, mapping statement.CSVMapping) ([]statement.Transaction, error) {
+	switch format {
+	case StatementCAMT053:
+		return statement.ParseCAMT053(strings.NewReader(text))
+	case StatementOFX:
+		return statement.ParseOFX(strings.NewReader(text))
+	default:
+		return statement.ParseCSV(strings.NewReader(text), mapping)
+	}
+}
+
+// newStatementTransaction converts a parsed transaction for a response
+func newStatementTransaction(transaction statement.Transaction) StatementTransaction {
+	return StatementTransaction{
+		Date:        transaction.Date.Format(statementDateLayout),
+		Amount:      Money(transaction.Amount),
+		Currency:    transaction.Currency,
+		Reference:   transaction.Reference,
+		Description: transaction.Description,
+	}
+}
+
+// nameWords splits a name into lower case words of letters and digits
+func nameWords(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// locationMatches checks if the description of a transaction mentions the
+// location. Card transactions often have shortened names so a single word of
+// the location is enough unless it's a short word of a longer name.
+func locationMatches(description string, location string) bool {
+	words := nameWords(description)
+	locationWords := nameWords(location)
+
+	joined := strings.Join(locationWords, "")
+	if len([]rune(joined)) >= 3 && strings.Contains(strings.Join(words, ""), joined) {
+		return true
+	}
+
+	for _, locationWord := range locationWords {
+		if len([]rune(locationWord)) < 3 && len(locationWords) > 1 {
+			continue
+		}
+		for _, word := range words {
+			if word == locationWord {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// reconcile matches transactions to receipts. Transactions match receipts
+// with the opposite total in the same currency that were bought at most days
+// before or after the transaction. Matches that mention the location are
+// preferred, then matches with fewer days between the purchase and the
+// transaction.
+func reconcile(transactions []statement.Transaction, receipts []reconciliationReceipt, days int) Reconciliation {
+	reconciliation := Reconciliation{
+		Matches:               []ReconciliationMatch{},
+		Reconciled:            []ReconciliationMatch{},
+		UnmatchedTransactions: []StatementTransaction{},
+		UnmatchedReceipts:     []ReconciliationReceipt{},
+	}
+
+	type candidate struct {
+		transaction int
+		receipt     int
+		days        int
+		location    bool
+	}
+
+	matchedTransactions := make([]bool, len(transactions))
+	matchedReceipts := make([]bool, len(receipts))
+	candidates := []candidate{}
+
+	for i, transaction := range transactions {
+		for j, receipt := range receipts {
+			if receipt.confirmed(transaction) {
+				reconciliation.Reconciled = append(reconciliation.Reconciled, ReconciliationMatch{
+					Transaction:     newStatementTransaction(transaction),
+					Receipt:         receipt.ReconciliationReceipt,
+					Days:            int(transaction.Date.Sub(receipt.date()).Hours() / 24),
+					LocationMatched: locationMatches(transaction.Description, receipt.Location),
+				})
+				matchedTransactions[i] = true
+				matchedReceipts[j] = true
+				break
+			}
+		}
+	}
+
+	for i, transaction := range transactions {
+		if matchedTransactions[i] || transaction.Amount == 0 {
+			continue
+		}
+
+		for j, receipt := range receipts {
+			if matchedReceipts[j] || receipt.StatementDate != nil {
+				continue
+			}
+			if int64(receipt.TotalPrice) != -transaction.Amount {
+				continue
+			}
+			if transaction.Currency != "" && transaction.Currency != receipt.Currency {
+				continue
+			}
+
+			difference := int(transaction.Date.Sub(receipt.date()).Hours() / 24)
+			if difference > days || difference < -days {
+				continue
+			}
+
+			candidates = append(candidates, candidate{i, j, difference, locationMatches(transaction.Description, receipt.Location)})
+		}
+	}
+
+	// Transactions are usually booked on the day of the purchase or after it
+	distance := func(days int) int {
+		if days < 0 {
+			return -2*days + 1
+		}
+		return 2 * days
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].location != candidates[j].location {
+			return candidates[i].location
+		}
+		return distance(candidates[i].days) < distance(candidates[j].days)
+	})
+
+	for _, c := range candidates {
+		if matchedTransactions[c.transaction] || matchedReceipts[c.receipt] {
+			continue
+		}
+		matchedTransactions[c.transaction] = true
+		matchedReceipts[c.receipt] = true
+
+		reconciliation.Matches = append(reconciliation.Matches, ReconciliationMatch{
+			Transaction:     newStatementTransaction(transactions[c.transaction]),
+			Receipt:         receipts[c.receipt].ReconciliationReceipt,
+			Days:            c.days,
+			LocationMatched: c.location,
+		})
+	}
+
+	for i, transaction := range transactions {
+		if !matchedTransactions[i] {
+			reconciliation.UnmatchedTransactions = append(reconciliation.UnmatchedTransactions, newStatementTransaction(transaction))
+		}
+	}
+	for j, receipt := range receipts {
+		if !matchedReceipts[j] && receipt.StatementDate == nil {
+			reconciliation.UnmatchedReceipts = append(reconciliation.UnmatchedReceipts, receipt.ReconciliationReceipt)
+		}
+	}
+
+	return reconciliation
+}
+
+// reconciliationReceipts gets receipts of the user bought in the period of
+// transactions with days before and after it
+func reconciliationReceipts(db *sqlx.DB, userID int, householdPublicID string, transactions []statement.Transaction, days int) ([]reconciliationReceipt, error) {
+	from, to := transactions[0].Date, transactions[0].Date
+	for _, transaction := range transactions {
+		if transaction.Date.Before(from) {
+			from = transaction.Date
+		}
+		if transaction.Date.After(to) {
+			to = transaction.Date
+		}
+	}
+
+	// Times of purchase are in UTC so a day is added to both ends for time
+	// zones and receipts are filtered by their local date afterwards
+	from = from.AddDate(0, 0, -days-1)
+	to = to.AddDate(0, 0, days+2)
+
+	query := sq.Select("receipts.public_id, households.public_id AS household_id, locations.name AS location, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, "+ReceiptTotalSQL+" AS total_price, receipts.currency, receipts.statement_date, receipts.statement_amount, receipts.statement_reference").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").Where(MemberOf("receipts.household_id", userID)).Where(NotDeleted("receipts")).Where("datetime(receipts.purchased_at) >= ?", from.Format(sqlTimeLayout)).Where("datetime(receipts.purchased_at) < ?", to.Format(sqlTimeLayout)).GroupBy("receipts.id").OrderBy("receipts.purchased_at", "receipts.id")
+
+	if householdPublicID != "" {
+		query = query.Where(sq.Eq{"households.public_id": householdPublicID})
+	}
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []reconciliationReceipt{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	receipts := []reconciliationReceipt{}
+	for _, receipt := range rows {
+		date := receipt.date()
+		if !date.Before(from.AddDate(0, 0, 1)) && date.Before(to.AddDate(0, 0, -1)) {
+			receipts = append(receipts, receipt)
+		}
+	}
+
+	return receipts, nil
+}
+
+// ReceiptStatementTransactions gets confirmed transactions of receipts with
+// specified ids
+func ReceiptStatementTransactions(db *sqlx.DB, receiptIDs []string) (map[string]*StatementTransaction, error) {
+	transactions := map[string]*StatementTransaction{}
+	if len(receiptIDs) == 0 {
+		return transactions, nil
+	}
+
+	query := sq.Select("public_id, statement_date, statement_amount, COALESCE(statement_currency, currency) AS statement_currency, COALESCE(statement_reference, '') AS statement_reference, COALESCE(statement_description, '') AS statement_description").From("receipts").Where(sq.Eq{"public_id": receiptIDs}).Where(sq.NotEq{"statement_date": nil})
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		PublicID string `db:"public_id"`
+		Date     string `db:"statement_date"`
+		Amount   Money  `db:"statement_amount"`
+		Currency string `db:"statement_currency"`
+		// Reference and Description are empty if the statement didn't have
+		// them
+		Reference   string `db:"statement_reference"`
+		Description string `db:"statement_description"`
+	}{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		transactions[row.PublicID] = &StatementTransaction{
+			Date:        row.Date,
+			Amount:      row.Amount,
+			Currency:    row.Currency,
+			Reference:   row.Reference,
+			Description: row.Description,
+		}
+	}
+
+	return transactions, nil
+}
+
+// PostReconciliation is a Gin handler function for matching transactions of a
+// bank statement to receipts. Nothing is stored until matches are confirmed.
+func (o Options) PostReconciliation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var reconciliationData ReconciliationPostBody
+		if err := ctx.ShouldBindJSON(&reconciliationData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(reconciliationData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		days := defaultReconciliationDays
+		if reconciliationData.Days != nil {
+			days = *reconciliationData.Days
+		}
+
+		transactions, err := parseStatement(reconciliationData.Format, reconciliationData.Statement, reconciliationData.Mapping)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receipts, err := reconciliationReceipts(o.DB, user.ID, reconciliationData.HouseholdID, transactions, days)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, reconcile(transactions, receipts, days))
+	}
+}
+
+// PutReconciliation is a Gin handler function for confirming matches of
+// transactions and receipts. Transactions are stored on receipts and a
+// transaction that was confirmed for another receipt of the household is
+// moved to the new receipt.
+func (o Options) PutReconciliation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var matchesData ReconciliationPutBody
+		if err := ctx.ShouldBindJSON(&matchesData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(matchesData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, match := range matchesData.Matches {
+			if _, err := time.Parse(statementDateLayout, match.Transaction.Date); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": ErrInvalidStatementDate.Error(),
+				})
+				return
+			}
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		defer tx.Rollback()
+
+		for _, match := range matchesData.Matches {
+			receiptQueryString, receiptQueryStringArgs, err := sq.Select("id, household_id, currency").From("receipts").Where(sq.Eq{"public_id": match.ReceiptID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...)).ToSql()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			receipt := struct {
+				ID          int    `db:"id"`
+				HouseholdID int    `db:"household_id"`
+				Currency    string `db:"currency"`
+			}{}
+			if err := tx.Get(&receipt, receiptQueryString, receiptQueryStringArgs...); err != nil {
+				switch err {
+				case sql.ErrNoRows:
+					ctx.JSON(http.StatusUnauthorized, gin.H{
+						"message": "not authorized to reconcile specified receipt",
+						"id":      match.ReceiptID,
+					})
+					break
+				default:
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+				}
+				return
+			}
+
+			transaction := match.Transaction
+			currency := receipt.Currency
+			if transaction.Currency != "" {
+				currency = normalizeCurrency(transaction.Currency)
+			}
+
+			// A transaction can only be confirmed for one receipt so its match
+			// with another receipt is overridden
+			if _, err := tx.Exec("UPDATE receipts SET statement_date = NULL, statement_amount = NULL, statement_currency = NULL, statement_reference = NULL, statement_description = NULL, reconciled_at = NULL WHERE household_id = ? AND id != ? AND statement_date = ? AND statement_amount = ? AND COALESCE(statement_reference, '') = ?", receipt.HouseholdID, receipt.ID, transaction.Date, transaction.Amount, transaction.Reference); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			query := sq.Update("receipts").Set("statement_date", transaction.Date).Set("statement_amount", transaction.Amount).Set("statement_currency", currency).Set("statement_reference", nullableText(transaction.Reference)).Set("statement_description", nullableText(transaction.Description)).Set("reconciled_at", time.Now().UTC()).Where(sq.Eq{"id": receipt.ID})
+
+			queryString, queryStringArgs, err := query.ToSql()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if _, err := tx.Exec(queryString, queryStringArgs...); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteReconciliation is a Gin handler function for removing the confirmed
+// transaction of a receipt.
+func (o Options) DeleteReconciliation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var deleteData ReconciliationDeleteBody
+		if err := ctx.ShouldBindJSON(&deleteData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(deleteData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("receipts").Set("statement_date", nil).Set("statement_amount", nil).Set("statement_currency", nil).Set("statement_reference", nil).Set("statement_description", nil).Set("reconciled_at", nil).Where(sq.Eq{"public_id": deleteData.ReceiptID, "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to reconcile specified receipt",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/handlers/statement"
+)
+
+// reconciliationTestReceipt creates a receipt bought in Belgrade on the day
+// of March 2023 at noon
+func reconciliationTestReceipt(publicID string, location string, d int, total Money, currency string) reconciliationReceipt {
+	return reconciliationReceipt{
+		ReconciliationReceipt: ReconciliationReceipt{
+			PublicID:    publicID,
+			Location:    location,
+			PurchasedAt: time.Date(2023, 3, d, 11, 0, 0, 0, time.UTC),
+			TimeZone:    "Europe/Belgrade",
+			TotalPrice:  total,
+			Currency:    currency,
+		},
+	}
+}
+
+// confirmedTestReceipt adds a confirmed transaction to a receipt
+func confirmedTestReceipt(receipt reconciliationReceipt, transaction statement.Transaction) reconciliationReceipt {
+	date := transaction.Date.Format(statementDateLayout)
+	amount := Money(transaction.Amount)
+	receipt.StatementDate = &date
+	receipt.StatementAmount = &amount
+	receipt.StatementReference = &transaction.Reference
+	return receipt
+}
+
+// reconciliationSummary is a reconciliation with transactions by reference
+// and receipts by id
+type reconciliationSummary struct {
+	Matches               []string
+	Reconciled            []string
+	UnmatchedTransactions []string
+	UnmatchedReceipts     []string
+}
+
+// summarize summarizes a reconciliation. Matches are written as a reference
+// and a receipt id.
+func summarize(reconciliation Reconciliation) reconciliationSummary {
+	summary := reconciliationSummary{
+		Matches:               []string{},
+		Reconciled:            []string{},
+		UnmatchedTransactions: []string{},
+		UnmatchedReceipts:     []string{},
+	}
+	for _, match := range reconciliation.Matches {
+		summary.Matches = append(summary.Matches, match.Transaction.Reference+" "+match.Receipt.PublicID)
+	}
+	for _, match := range reconciliation.Reconciled {
+		summary.Reconciled = append(summary.Reconciled, match.Transaction.Reference+" "+match.Receipt.PublicID)
+	}
+	for _, transaction := range reconciliation.UnmatchedTransactions {
+		summary.UnmatchedTransactions = append(summary.UnmatchedTransactions, transaction.Reference)
+	}
+	for _, receipt := range reconciliation.UnmatchedReceipts {
+		summary.UnmatchedReceipts = append(summary.UnmatchedReceipts, receipt.PublicID)
+	}
+	return summary
+}
+
+func TestReconcile(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+	maxi := reconciliationTestReceipt("maxi", "Maxi", 14, 142496, "RSD")
+	paid := statement.Transaction{Date: day(14), Amount: -142496, Currency: "RSD", Reference: "paid", Description: "MAXI 105 NOVI SAD"}
+
+	tests := []struct {
+		name         string
+		transactions []statement.Transaction
+		receipts     []reconciliationReceipt
+		days         int
+		want         reconciliationSummary
+	}{
+		{
+			"spending matches the total",
+			[]statement.Transaction{paid},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{"paid maxi"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{}},
+		},
+		{
+			"income doesn't match the total",
+			[]statement.Transaction{{Date: day(14), Amount: 142496, Currency: "RSD", Reference: "income"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{}, Reconciled: []string{}, UnmatchedTransactions: []string{"income"}, UnmatchedReceipts: []string{"maxi"}},
+		},
+		{
+			"currencies don't match",
+			[]statement.Transaction{{Date: day(14), Amount: -142496, Currency: "EUR", Reference: "euro"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{}, Reconciled: []string{}, UnmatchedTransactions: []string{"euro"}, UnmatchedReceipts: []string{"maxi"}},
+		},
+		{
+			"transaction without a currency",
+			[]statement.Transaction{{Date: day(14), Amount: -142496, Reference: "any"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{"any maxi"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{}},
+		},
+		{
+			"booked on the last day",
+			[]statement.Transaction{{Date: day(17), Amount: -142496, Currency: "RSD", Reference: "late"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{"late maxi"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{}},
+		},
+		{
+			"booked after the last day",
+			[]statement.Transaction{{Date: day(18), Amount: -142496, Currency: "RSD", Reference: "late"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{}, Reconciled: []string{}, UnmatchedTransactions: []string{"late"}, UnmatchedReceipts: []string{"maxi"}},
+		},
+		{
+			"booked before the purchase",
+			[]statement.Transaction{{Date: day(11), Amount: -142496, Currency: "RSD", Reference: "early"}, {Date: day(10), Amount: -142496, Currency: "RSD", Reference: "earlier"}},
+			[]reconciliationReceipt{maxi},
+			3,
+			reconciliationSummary{Matches: []string{"early maxi"}, Reconciled: []string{}, UnmatchedTransactions: []string{"earlier"}, UnmatchedReceipts: []string{}},
+		},
+		{
+			// Bought on March 15th in Belgrade
+			"purchase is dated in its time zone",
+			[]statement.Transaction{{Date: day(15), Amount: -99900, Currency: "RSD", Reference: "night"}},
+			[]reconciliationReceipt{
+				func() reconciliationReceipt {
+					receipt := reconciliationTestReceipt("night", "Maxi", 14, 99900, "RSD")
+					receipt.PurchasedAt = time.Date(2023, 3, 14, 23, 30, 0, 0, time.UTC)
+					return receipt
+				}(),
+			},
+			0,
+			reconciliationSummary{Matches: []string{"night night"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{}},
+		},
+		{
+			"location is preferred over days",
+			[]statement.Transaction{{Date: day(14), Amount: -50000, Currency: "RSD", Reference: "idea", Description: "IDEA 0412 BEOGRAD"}},
+			[]reconciliationReceipt{
+				reconciliationTestReceipt("maxi", "Maxi", 14, 50000, "RSD"),
+				reconciliationTestReceipt("idea", "Idea", 16, 50000, "RSD"),
+			},
+			3,
+			reconciliationSummary{Matches: []string{"idea idea"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{"maxi"}},
+		},
+		{
+			"purchase before the transaction is preferred",
+			[]statement.Transaction{{Date: day(15), Amount: -50000, Currency: "RSD", Reference: "card", Description: "CARD PAYMENT"}},
+			[]reconciliationReceipt{
+				reconciliationTestReceipt("after", "Maxi", 16, 50000, "RSD"),
+				reconciliationTestReceipt("before", "Maxi", 14, 50000, "RSD"),
+			},
+			3,
+			reconciliationSummary{Matches: []string{"card before"}, Reconciled: []string{}, UnmatchedTransactions: []string{}, UnmatchedReceipts: []string{"after"}},
+		},
+		{
+			"already confirmed",
+			[]statement.Transaction{paid, {Date: day(14), Amount: -142496, Currency: "RSD", Reference: "other"}, {Date: day(14), Amount: 0, Currency: "RSD", Reference: "zero"}},
+			[]reconciliationReceipt{
+				confirmedTestReceipt(maxi, paid),
+				confirmedTestReceipt(reconciliationTestReceipt("elsewhere", "Maxi", 14, 142496, "RSD"), statement.Transaction{Date: day(1), Amount: -142496, Reference: "march"}),
+			},
+			3,
+			reconciliationSummary{Matches: []string{}, Reconciled: []string{"paid maxi"}, UnmatchedTransactions: []string{"other", "zero"}, UnmatchedReceipts: []string{}},
+		},
+	}
+
+	for _, test := range tests {
+		if got := summarize(reconcile(test.transactions, test.receipts, test.days)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLocationMatches(t *testing.T) {
+	tests := []struct {
+		description string
+		location    string
+		matches     bool
+	}{
+		{"MAXI 105 NOVI SAD", "Maxi", true},
+		{"IDEA 0412 BEOGRAD", "Idea", true},
+		{"LIDLZEMUN 1155", "Lidl Zemun", true},
+		{"PAYPAL *DM DROGERIE", "dm drogerie markt", true},
+		{"МАКСИ 105", "Макси", true},
+		{"ME 12", "Me", true},
+		// Short words of longer names are too common
+		{"DM 12", "dm drogerie markt", false},
+		{"CARD PAYMENT", "Maxi", false},
+	}
+
+	for _, test := range tests {
+		if got := locationMatches(test.description, test.location); got != test.matches {
+			t.Errorf("%q and %q got %v, want %v", test.description, test.location, got, test.matches)
+		}
+	}
+}
+
+func TestReconciliationReceipts(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+
+	// Receipts are matched by the date of purchase in their own time zone
+	receipts := []struct {
+		publicID    string
+		purchasedAt string
+		timeZone    string
+	}{
+		{"belgrade-after-midnight", "2020-06-09 22:30:00", "Europe/Belgrade"},
+		{"belgrade-next-day", "2020-06-10 22:30:00", "Europe/Belgrade"},
+		{"new-york-evening", "2020-06-10 23:30:00", "America/New_York"},
+		{"new-york-day-before", "2020-06-09 23:30:00", "America/New_York"},
+	}
+	for _, receipt := range receipts {
+		db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, ?, ?, ?)", household.LocationID, household.HouseholdID, household.UserID, receipt.publicID, receipt.purchasedAt, receipt.timeZone)
+	}
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, deleted_at) VALUES (?, ?, ?, 'trashed', '2020-06-10 10:00:00', 'UTC', current_timestamp)", household.LocationID, household.HouseholdID, household.UserID)
+
+	transactions := []statement.Transaction{
+		{Date: time.Date(2020, 6, 10, 0, 0, 0, 0, time.UTC), Amount: -100},
+	}
+	got, err := reconciliationReceipts(db, household.UserID, "", transactions, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, receipt := range got {
+		ids = append(ids, receipt.PublicID)
+	}
+	if want := []string{"belgrade-after-midnight", "new-york-evening"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("receipts of 2020-06-10 are %v, want %v", ids, want)
+	}
+}
+
+func TestPutReconciliation(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	other := newTestHousehold(t, db, "other")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	db.MustExec("INSERT INTO household_members (household_id, user_id, role) VALUES (?, ?, 'viewer')", other.HouseholdID, household.UserID)
+	for _, publicID := range []string{"first", "second"} {
+		db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, ?, '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID, publicID)
+	}
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'others', '2020-06-01 10:00:00', 'UTC')", other.LocationID, other.HouseholdID, other.UserID)
+
+	match := func(receiptID string, date string) string {
+		return `{"matches": [{"receiptId": "` + receiptID + `", "transaction": {"date": "` + date + `", "amount": -1.5, "reference": "R1", "description": "MAXI 105"}}]}`
+	}
+	statementDate := func(receiptID string) *string {
+		var date *string
+		if err := db.Get(&date, "SELECT statement_date FROM receipts WHERE public_id = ?", receiptID); err != nil {
+			t.Fatal(err)
+		}
+		return date
+	}
+
+	invalid := map[string]string{
+		"date in another format":  match("first", "01.06.2020."),
+		"date that doesn't exist": match("first", "2020-02-30"),
+		"no date":                 match("first", ""),
+		"no matches":              `{"matches": []}`,
+	}
+	for name, body := range invalid {
+		if recorder := serve(options.PutReconciliation(), "/reconciliation", "user", http.MethodPut, "/reconciliation", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want %d", name, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+
+	if recorder := serve(options.PutReconciliation(), "/reconciliation", "user", http.MethodPut, "/reconciliation", match("first", "2020-06-02")); recorder.Code != http.StatusOK {
+		t.Fatalf("confirming a match: got %d %s", recorder.Code, recorder.Body)
+	}
+	var confirmed struct {
+		Date         string  `db:"statement_date"`
+		Amount       Money   `db:"statement_amount"`
+		Currency     string  `db:"statement_currency"`
+		Reference    string  `db:"statement_reference"`
+		Description  string  `db:"statement_description"`
+		ReconciledAt *string `db:"reconciled_at"`
+	}
+	if err := db.Get(&confirmed, "SELECT statement_date, statement_amount, statement_currency, statement_reference, statement_description, reconciled_at FROM receipts WHERE public_id = 'first'"); err != nil {
+		t.Fatal(err)
+	}
+	if confirmed.Date != "2020-06-02" || confirmed.Amount != -150 || confirmed.Currency != "RSD" || confirmed.Reference != "R1" || confirmed.Description != "MAXI 105" || confirmed.ReconciledAt == nil {
+		t.Errorf("confirmed transaction is %+v", confirmed)
+	}
+
+	// Confirming the same transaction for another receipt moves it
+	if recorder := serve(options.PutReconciliation(), "/reconciliation", "user", http.MethodPut, "/reconciliation", match("second", "2020-06-02")); recorder.Code != http.StatusOK {
+		t.Fatalf("confirming the transaction for another receipt: got %d %s", recorder.Code, recorder.Body)
+	}
+	if statementDate("first") != nil || statementDate("second") == nil {
+		t.Errorf("transaction is on first %v and second %v, want only on second", statementDate("first"), statementDate("second"))
+	}
+
+	// Receipts the user can only view and unknown receipts can't be
+	// reconciled and nothing of the request is stored
+	unauthorized := []string{
+		`{"matches": [{"receiptId": "first", "transaction": {"date": "2020-06-03", "amount": -1.5}}, {"receiptId": "others", "transaction": {"date": "2020-06-03", "amount": -1.5}}]}`,
+		match("unknown", "2020-06-03"),
+	}
+	for _, body := range unauthorized {
+		if recorder := serve(options.PutReconciliation(), "/reconciliation", "user", http.MethodPut, "/reconciliation", body); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d %s, want %d", body, recorder.Code, recorder.Body, http.StatusUnauthorized)
+		}
+	}
+	if statementDate("first") != nil || statementDate("others") != nil {
+		t.Error("transactions of a rejected request were stored")
+	}
+
+	deletes := []struct {
+		user      string
+		receiptID string
+		status    int
+	}{
+		{"other", "second", http.StatusUnauthorized},
+		{"user", "others", http.StatusUnauthorized},
+		{"user", "second", http.StatusOK},
+	}
+	for _, deletion := range deletes {
+		if recorder := serve(options.DeleteReconciliation(), "/reconciliation", deletion.user, http.MethodDelete, "/reconciliation", `{"receiptId": "`+deletion.receiptID+`"}`); recorder.Code != deletion.status {
+			t.Errorf("%s removing the transaction of %s: got %d %s, want %d", deletion.user, deletion.receiptID, recorder.Code, recorder.Body, deletion.status)
+		}
+	}
+	if statementDate("second") != nil {
+		t.Error("transaction of second wasn't removed")
+	}
+}
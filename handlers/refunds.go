@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// refundAmountTolerance is the largest difference between refunded and bought
+// amounts that is still treated as equal. Amounts are floating point numbers
+// so refunding a line in parts may not add up exactly.
+const refundAmountTolerance = 1e-9
+
+// lineRefundedSQL is an SQL expression for the amount of a line that was
+// refunded by refunds that are not in the trash. It's a positive amount.
+const lineRefundedSQL = "(SELECT COALESCE(-SUM(refunds.amount), 0) FROM items_in_receipt refunds JOIN receipts refund_receipts ON refund_receipts.id = refunds.receipt_id WHERE refunds.refund_of = items_in_receipt.id AND refund_receipts.deleted_at IS NULL)"
+
+// ErrRefundLine is returned when lines of a refund are changed directly
+// instead of with a new refund
+var ErrRefundLine = errors.New("lines of refunds can't be changed, refunds are made with POST /receipts/:id/refunds")
+
+// RefundsPostBody : Structure that should be used for getting json from body of a post request for refunds of a receipt
+type RefundsPostBody struct {
+	CreatedAt string            `json:"createdAt"`
+	Lines     []RefundsLineBody `json:"lines" validate:"required,min=1,dive"`
+}
+
+// RefundsLineBody : Structure that should be used for getting a refunded line of a receipt. Amount is the returned amount and it's stored as a negative amount on the refund.
+type RefundsLineBody struct {
+	LineID string  `json:"id" validate:"required"`
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+}
+
+// ReceiptRefunds gets sums of refunds of receipts with specified ids. Refunds
+// are in the currency of the original receipt and sums are positive.
+func ReceiptRefunds(db *sqlx.DB, receiptIDs []string) (map[string]Money, error) {
+	refunds := map[string]Money{}
+	if len(receiptIDs) == 0 {
+		return refunds, nil
+	}
+
+	query := sq.Select("originals.public_id AS receipt_id, " + ReceiptTotalSQL + " AS total_price").From("receipts").Join("receipts originals ON originals.id = receipts.refund_of").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").Where(sq.Eq{"originals.public_id": receiptIDs}).Where(NotDeleted("receipts")).GroupBy("receipts.id")
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		ReceiptID  string `db:"receipt_id"`
+		TotalPrice Money  `db:"total_price"`
+	}{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		refunds[row.ReceiptID] -= row.TotalPrice
+	}
+
+	return refunds, nil
+}
+
+// PostRefunds is a Gin handler function for adding a refund of lines of a
+// receipt. Refund is a new receipt at the same location with negative amounts
+// of the refunded lines. Percent discounts are kept and fixed discounts of
+// lines are split in proportion to the refunded amount. Fixed discounts of
+// the receipt are split in proportion to the refunded part of the subtotal.
+func (o Options) PostRefunds() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var refundData RefundsPostBody
+		if err := ctx.ShouldBindJSON(&refundData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(refundData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		createdAt := time.Now()
+		if refundData.CreatedAt != "" {
+			var err error
+			createdAt, err = time.Parse(time.RFC3339, refundData.CreatedAt)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		originalQuery := sq.Select("id, household_id, location_id, currency, time_zone, discount_type, discount_value, refund_of").From("receipts").Where(sq.Eq{"public_id": ctx.Param("id"), "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		originalQueryString, originalQueryStringArgs, err := originalQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		original := struct {
+			ID            int     `db:"id"`
+			HouseholdID   int     `db:"household_id"`
+			LocationID    int     `db:"location_id"`
+			Currency      string  `db:"currency"`
+			TimeZone      string  `db:"time_zone"`
+			DiscountType  *string `db:"discount_type"`
+			DiscountValue *int64  `db:"discount_value"`
+			RefundOf      *int    `db:"refund_of"`
+		}{}
+		if err := o.DB.Get(&original, originalQueryString, originalQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to refund specified receipt",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		if original.RefundOf != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "refunds can't be refunded",
+			})
+			return
+		}
+
+		// Percent discounts of the whole receipt apply to refunds as they are,
+		// fixed discounts are split after the lines are added
+		var discountType, discountValue interface{}
+		if original.DiscountType != nil && *original.DiscountType == DiscountPercent {
+			discountType, discountValue = *original.DiscountType, *original.DiscountValue
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		tx, err := o.DB.Beginx()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := tx.Exec("INSERT INTO receipts (public_id, location_id, household_id, created_by, currency, time_zone, discount_type, discount_value, refund_of, purchased_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, original.LocationID, original.HouseholdID, user.ID, original.Currency, original.TimeZone, discountType, discountValue, original.ID, createdAt.UTC(), createdAt, createdAt)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		refundID, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, lineData := range refundData.Lines {
+			line := struct {
+				ID            int         `db:"id"`
+				ItemID        int         `db:"item_id"`
+				Price         *Money      `db:"price"`
+				Amount        float64     `db:"amount"`
+				TaxLabel      *string     `db:"tax_label"`
+				TaxRate       *Percentage `db:"tax_rate"`
+				DiscountType  *string     `db:"discount_type"`
+				DiscountValue *int64      `db:"discount_value"`
+				Refunded      float64     `db:"refunded"`
+			}{}
+			// Refunds that are in the trash don't count
+			if err := tx.Get(&line, "SELECT id, item_id, price, amount, tax_label, tax_rate, discount_type, discount_value, "+lineRefundedSQL+" AS refunded FROM items_in_receipt WHERE public_id = ? AND receipt_id = ?", lineData.LineID, original.ID); err != nil {
+				tx.Rollback()
+				switch err {
+				case sql.ErrNoRows:
+					ctx.JSON(http.StatusBadRequest, gin.H{
+						"message": "line is not on the receipt",
+						"id":      lineData.LineID,
+					})
+					break
+				default:
+					ctx.JSON(http.StatusInternalServerError, gin.H{
+						"message": err.Error(),
+					})
+				}
+				return
+			}
+
+			if line.Refunded+lineData.Amount > line.Amount+refundAmountTolerance {
+				tx.Rollback()
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message":  "refunded amount is larger than the amount on the receipt",
+					"id":       lineData.LineID,
+					"amount":   line.Amount,
+					"refunded": line.Refunded,
+				})
+				return
+			}
+
+			lineDiscountValue := line.DiscountValue
+			if line.DiscountType != nil && *line.DiscountType == DiscountFixed {
+				prorated := int64(math.Round(float64(*line.DiscountValue) * lineData.Amount / line.Amount))
+				lineDiscountValue = &prorated
+			}
+
+			lineUUID, err := nanoid.Nanoid()
+			if err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if _, err := tx.Exec("INSERT INTO items_in_receipt (public_id, receipt_id, item_id, price, amount, tax_label, tax_rate, discount_type, discount_value, refund_of) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", lineUUID, refundID, line.ItemID, line.Price, -lineData.Amount, line.TaxLabel, line.TaxRate, line.DiscountType, lineDiscountValue, line.ID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if original.DiscountType != nil && *original.DiscountType == DiscountFixed {
+			if err := splitRefundDiscount(tx, original.ID, refundID, NewDiscount(original.DiscountType, original.DiscountValue)); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"id": uuid,
+		})
+	}
+}
+
+// splitRefundDiscount sets the share of the fixed discount of the original
+// receipt that belongs to the lines of the refund the same way as discounts
+// of receipts are split between tax rates, so a refund doesn't return more
+// than was paid for the lines.
+func splitRefundDiscount(tx *sqlx.Tx, originalID int, refundID int64, discount *Discount) error {
+	subtotalQuery := "(SELECT " + ReceiptSubtotalSQL + " FROM items_in_receipt JOIN items ON items.id = items_in_receipt.item_id WHERE items_in_receipt.receipt_id = ?)"
+
+	var subtotals struct {
+		Original Money `db:"original"`
+		Refund   Money `db:"refund"`
+	}
+	if err := tx.Get(&subtotals, "SELECT "+subtotalQuery+" AS original, "+subtotalQuery+" AS refund", originalID, refundID); err != nil {
+		return err
+	}
+
+	refunded := -subtotals.Refund
+	share := splitDiscount([]Money{refunded, subtotals.Original - refunded}, discount)[0]
+	if share == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE receipts SET discount_type = ?, discount_value = ? WHERE id = ?", DiscountFixed, share, refundID)
+	return err
+}
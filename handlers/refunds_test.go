@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPostRefunds(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	milk := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 1000, 'l')", household.UserID, household.HouseholdID)
+	bread := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'bread', 'Bread', 500, 'kom')", household.UserID, household.HouseholdID)
+	percent := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, discount_type, discount_value) VALUES (?, ?, ?, 'percent', '2020-06-01 10:00:00', 'UTC', 'percent', 1000)", household.LocationID, household.HouseholdID, household.UserID)
+	fixed := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, discount_type, discount_value) VALUES (?, ?, ?, 'fixed', '2020-06-01 11:00:00', 'UTC', 'fixed', 300)", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec(`INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES
+		(?, ?, 'percent-milk', 2),
+		(?, ?, 'fixed-milk', 2),
+		(?, ?, 'fixed-bread', 2)`, percent, milk, fixed, milk, fixed, bread)
+
+	refund := func(receiptID string, body string) string {
+		recorder := serve(options.PostRefunds(), "/receipts/:id/refunds", "user", http.MethodPost, "/receipts/"+receiptID+"/refunds", body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("refunding %s of %s: got %d %s", body, receiptID, recorder.Code, recorder.Body)
+		}
+		var response struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.ID
+	}
+
+	percentRefund := refund("percent", `{"lines": [{"id": "percent-milk", "amount": 1}]}`)
+	refund("fixed", `{"lines": [{"id": "fixed-bread", "amount": 1}]}`)
+
+	invalid := []struct {
+		name      string
+		receiptID string
+		body      string
+	}{
+		{"more than was bought", "percent", `{"lines": [{"id": "percent-milk", "amount": 1.5}]}`},
+		{"refund of a refund", percentRefund, `{"lines": [{"id": "percent-milk", "amount": 1}]}`},
+		{"line of another receipt", "percent", `{"lines": [{"id": "fixed-milk", "amount": 1}]}`},
+		{"no lines", "percent", `{"lines": []}`},
+		{"negative amount", "percent", `{"lines": [{"id": "percent-milk", "amount": -1}]}`},
+	}
+	for _, test := range invalid {
+		if recorder := serve(options.PostRefunds(), "/receipts/:id/refunds", "user", http.MethodPost, "/receipts/"+test.receiptID+"/refunds", test.body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want %d", test.name, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+
+	receipt := func(receiptID string) ReceiptWithData {
+		recorder := serve(options.GetReceipts(), "/receipts", "user", http.MethodGet, "/receipts?id="+receiptID, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("getting %s: got %d %s", receiptID, recorder.Code, recorder.Body)
+		}
+		receipts := []ReceiptWithData{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &receipts); err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != 1 {
+			t.Fatalf("got %d receipts with id %s", len(receipts), receiptID)
+		}
+		return receipts[0]
+	}
+
+	// Percent discounts apply to refunds so 10.00 at 10% off returns 9.00.
+	// 3.00 off 30.00 is split so returning 5.00 of it returns 4.50.
+	totals := []struct {
+		receiptID string
+		total     Money
+		refunded  Money
+		net       Money
+	}{
+		{"percent", 1800, 900, 900},
+		{"fixed", 2700, 450, 2250},
+	}
+	for _, want := range totals {
+		got := receipt(want.receiptID)
+		if got.TotalPrice != want.total || got.RefundedPrice != want.refunded || got.NetTotalPrice != want.net {
+			t.Errorf("%s: total %d, refunded %d, net %d, want %d, %d, %d", want.receiptID, got.TotalPrice, got.RefundedPrice, got.NetTotalPrice, want.total, want.refunded, want.net)
+		}
+	}
+
+	// Refunding the rest returns what is left of the discount
+	refund("fixed", `{"lines": [{"id": "fixed-milk", "amount": 2}, {"id": "fixed-bread", "amount": 1}]}`)
+	if got := receipt("fixed"); got.RefundedPrice != 2700 || got.NetTotalPrice != 0 {
+		t.Errorf("fixed after refunding everything: refunded %d, net %d, want 2700, 0", got.RefundedPrice, got.NetTotalPrice)
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+)
+
+// reportMonthLayout is the layout of months of reports
+const reportMonthLayout = "2006-01"
+
+// reportTopItems is the number of items in the item breakdown of reports
+const reportTopItems = 10
+
+// ReportGetQuery : Structure that should be used for getting query data on get request for monthly reports
+type ReportGetQuery struct {
+	HouseholdID string `form:"householdId"`
+	// Month of the report in YYYY-MM format. Current month in the time zone
+	// of the user is used if it's not specified.
+	Month string `form:"month"`
+	// Currency in which totals are calculated. Default currency of the user
+	// is used if it's not specified.
+	Currency string `form:"currency" validate:"omitempty,currency"`
+}
+
+// ItemStats : Structure that should be used for sending spending statistics of an item or a category of items
+type ItemStats struct {
+	Name  string `json:"name"`
+	Total Money  `json:"total"`
+}
+
+// lineTotal is the total of a line of a receipt with the date of the receipt
+type lineTotal struct {
+	ItemID      string    `db:"item_id"`
+	Name        string    `db:"item_name"`
+	Category    string    `db:"category"`
+	Currency    string    `db:"currency"`
+	PurchasedAt time.Time `db:"purchased_at"`
+	TimeZone    string    `db:"time_zone"`
+	Total       Money     `db:"total"`
+}
+
+// itemStats calculates totals of items and categories of items on lines of
+// receipts of the account with the most spent first. Items without a category
+// are totaled under an empty name. Totals of lines are before receipt
+// discounts.
+func (o Options) itemStats(account Account, searchQuery StatsGetQuery) ([]ItemStats, []ItemStats, error) {
+	currency := searchQuery.currency(account)
+	location := accountLocation(account)
+
+	query := sq.Select("items.public_id AS item_id, items.name AS item_name, COALESCE(items.category, '') AS category, receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, " + LineTotalSQL + " AS total").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("households ON households.id = receipts.household_id").Where(MemberOf("receipts.household_id", account.ID)).Where(NotDeleted("receipts"))
+	query = searchQuery.filter(query, location)
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := []lineTotal{}
+	if err := o.DB.Select(&lines, queryString, queryStringArgs...); err != nil {
+		return nil, nil, err
+	}
+
+	converter := NewCurrencyConverter(o.DB, o.RateProvider)
+	items := []ItemStats{}
+	itemIDs := map[string]int{}
+	categories := []ItemStats{}
+	categoryNames := map[string]int{}
+	for _, line := range lines {
+		total, err := converter.Convert(line.Total, line.Currency, currency, inTimeZone(line.PurchasedAt, line.TimeZone))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		i, ok := itemIDs[line.ItemID]
+		if !ok {
+			i = len(items)
+			itemIDs[line.ItemID] = i
+			items = append(items, ItemStats{Name: line.Name})
+		}
+		items[i].Total += total
+
+		c, ok := categoryNames[line.Category]
+		if !ok {
+			c = len(categories)
+			categoryNames[line.Category] = c
+			categories = append(categories, ItemStats{Name: line.Category})
+		}
+		categories[c].Total += total
+	}
+
+	for _, stats := range [][]ItemStats{items, categories} {
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].Total > stats[j].Total
+		})
+	}
+
+	return items, categories, nil
+}
+
+// GetMonthlyReportPDF is a Gin handler function for getting a printable PDF
+// report of spending in a month with totals, a chart of daily spending and
+// breakdowns by location, category, tax rate and item. Receipts in other currencies are
+// converted using the exchange rate on the date of the receipt.
+func (o Options) GetMonthlyReportPDF() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var reportQuery ReportGetQuery
+		if err := ctx.ShouldBindQuery(&reportQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(reportQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		searchQuery := StatsGetQuery{
+			HouseholdID: reportQuery.HouseholdID,
+			Currency:    reportQuery.Currency,
+			Interval:    "day",
+		}
+
+		month := time.Now().In(accountLocation(account))
+		month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if reportQuery.Month != "" {
+			if month, err = time.Parse(reportMonthLayout, reportQuery.Month); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": "month must be in YYYY-MM format",
+				})
+				return
+			}
+		}
+		searchQuery.From = month.Format(rateDateLayout)
+		searchQuery.To = month.AddDate(0, 1, -1).Format(rateDateLayout)
+
+		stats, err := o.spendingStats(account, searchQuery)
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		taxes, err := o.taxReport(account, searchQuery)
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		items, categories, err := o.itemStats(account, searchQuery)
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		document, err := printMonthlyReport(month, stats, categories, taxes, items)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.Header("Content-Disposition", "inline; filename=\"report-"+month.Format(reportMonthLayout)+pdfExtension+"\"")
+		ctx.Data(http.StatusOK, "application/pdf", document)
+	}
+}
+
+// printMonthlyReport writes a monthly report as a PDF document
+func printMonthlyReport(month time.Time, stats *Stats, categories []ItemStats, taxes *TaxReport, items []ItemStats) ([]byte, error) {
+	layout := newPDFLayout()
+
+	layout.y += 18
+	layout.page.Text(pdfMargin, layout.y, 18, true, "Monthly report")
+	layout.page.TextRight(pdfRight, layout.y, 14, true, month.Format("January 2006"))
+	layout.y += 6
+
+	spent := stats.Total + stats.Refunded
+	layout.label("Currency", stats.Currency)
+	layout.label("Receipts", strconv.Itoa(stats.Receipts))
+	layout.label("Spent", spent.String())
+	if stats.Refunds > 0 {
+		layout.label("Refunds", strconv.Itoa(stats.Refunds))
+		layout.label("Refunded", stats.Refunded.String())
+		layout.label("Total", stats.Total.String())
+	}
+	layout.label("Saved", stats.Saved.String())
+	if stats.Receipts > 0 {
+		layout.label("Average receipt", (spent / Money(stats.Receipts)).String())
+	}
+
+	// Every day of the month has a bar even if nothing was spent on it
+	days := month.AddDate(0, 1, -1).Day()
+	daily := make([]Money, days)
+	for _, period := range stats.Periods {
+		if day, err := time.Parse(rateDateLayout, period.Period); err == nil && day.Day() <= days {
+			daily[day.Day()-1] = period.Total
+		}
+	}
+
+	layout.heading("Daily spending")
+	printBarChart(layout, daily)
+
+	columns := []float64{pdfMargin, 330, 400, pdfRight}
+	layout.heading("Locations")
+	layout.row(true, columns, "Location", "Receipts", "Refunded", "Total")
+	for _, location := range stats.Locations {
+		layout.row(false, columns, location.Name, strconv.Itoa(location.Receipts), location.Refunded.String(), location.Total.String())
+		printBar(layout, location.Total, stats.Locations[0].Total)
+	}
+
+	categoryColumns := []float64{pdfMargin, pdfRight}
+	layout.heading("Categories")
+	for _, category := range categories {
+		name := category.Name
+		if name == "" {
+			name = "Uncategorized"
+		}
+		layout.row(false, categoryColumns, name, category.Total.String())
+		printBar(layout, category.Total, categories[0].Total)
+	}
+
+	taxColumns := []float64{pdfMargin, 300, 370, 440, pdfRight}
+	layout.heading("Tax rates")
+	layout.row(true, taxColumns, "Label", "Rate", "Net", "Tax", "Gross")
+	for _, tax := range taxes.Taxes {
+		label := tax.Label
+		if label == "" {
+			label = "Untaxed"
+		}
+		layout.row(false, taxColumns, label, formatPercentage(tax.Rate), tax.Net.String(), tax.Tax.String(), tax.Gross.String())
+	}
+	layout.row(true, taxColumns, "Total", "", taxes.Net.String(), taxes.Tax.String(), taxes.Gross.String())
+
+	if len(items) > reportTopItems {
+		items = items[:reportTopItems]
+	}
+	itemColumns := []float64{pdfMargin, pdfRight}
+	layout.heading("Top items")
+	for _, item := range items {
+		layout.row(false, itemColumns, item.Name, item.Total.String())
+		printBar(layout, item.Total, items[0].Total)
+	}
+
+	return layout.bytes()
+}
+
+// printBarChart draws a chart with a bar for each amount and the largest
+// amount on the axis
+func printBarChart(layout *pdfLayout, amounts []Money) {
+	const height = 140
+
+	largest := Money(0)
+	for _, amount := range amounts {
+		if amount > largest {
+			largest = amount
+		}
+	}
+
+	layout.space(height + 40)
+	top := layout.y + 20
+	bottom := top + height
+	width := (pdfRight - pdfMargin) / float64(len(amounts))
+
+	layout.page.TextRight(pdfRight, top-6, 8, false, largest.String())
+	for i, amount := range amounts {
+		if amount > 0 && largest > 0 {
+			barHeight := height * amount.Float64() / largest.Float64()
+			layout.page.Rect(pdfMargin+float64(i)*width+1, bottom-barHeight, width-2, barHeight, 0.4)
+		}
+		if day := i + 1; day == 1 || day%5 == 0 {
+			layout.page.Text(pdfMargin+float64(i)*width+1, bottom+10, 7, false, strconv.Itoa(day))
+		}
+	}
+	layout.page.Line(pdfMargin, bottom, pdfRight, bottom, 0.5)
+
+	layout.y = bottom + 14
+}
+
+// printBar draws a bar under the last row with a length relative to the
+// largest amount
+func printBar(layout *pdfLayout, amount Money, largest Money) {
+	if amount <= 0 || largest <= 0 {
+		return
+	}
+
+	layout.y += 3
+	layout.page.Rect(pdfMargin, layout.y, (pdfRight-pdfMargin)*amount.Float64()/largest.Float64(), 3, 0.6)
+	layout.y += 2
+}
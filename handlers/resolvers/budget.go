@@ -0,0 +1,338 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dusansimic/receipts-archive-backend/database"
+	"github.com/dusansimic/receipts-archive-backend/handlers"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jmoiron/sqlx"
+)
+
+// budgetHistoryPeriods is the number of periods in the history of a budget if
+// it's not specified
+const budgetHistoryPeriods = 6
+
+// ErrBudgetHistoryPeriods is returned when the number of periods in the
+// history of a budget is not positive
+var ErrBudgetHistoryPeriods = errors.New("number of periods must be between 1 and 120")
+
+// BudgetResolver is a struct for resolved budget
+type BudgetResolver struct {
+	db           *sqlx.DB
+	rateProvider database.ExchangeRateProvider
+	budget       handlers.Budget
+}
+
+// BudgetResolverArgs is a struct for budget resolver arguments
+type BudgetResolverArgs struct {
+	HouseholdID *string
+}
+
+// BudgetHistoryArgs is a struct for arguments of history of a budget
+type BudgetHistoryArgs struct {
+	Periods *int32
+}
+
+// BudgetPeriodResolver is a struct for resolved period of a budget
+type BudgetPeriodResolver struct {
+	period handlers.BudgetPeriod
+}
+
+// BudgetAlertResolver is a struct for resolved alert of a budget
+type BudgetAlertResolver struct {
+	alert handlers.BudgetAlert
+}
+
+// BudgetAlertResolverArgs is a struct for budget alert resolver arguments
+type BudgetAlertResolverArgs struct {
+	HouseholdID *string
+	Unread      *bool
+}
+
+// Budgets is a budgets resolver. It gets budgets of households the user is
+// a member of.
+func (r *Resolver) Budgets(ctx context.Context, args BudgetResolverArgs) (*[]*BudgetResolver, error) {
+	publicID := GetUserID(ctx)
+	user, err := publicID.PrivateID(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	householdID := ""
+	if args.HouseholdID != nil {
+		householdID = *args.HouseholdID
+	}
+
+	budgets, err := handlers.ListBudgets(r.db, user.ID, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := make([]*BudgetResolver, 0, len(budgets))
+	for _, budget := range budgets {
+		resolver = append(resolver, &BudgetResolver{
+			db:           r.db,
+			rateProvider: r.rateProvider,
+			budget:       budget,
+		})
+	}
+
+	return &resolver, nil
+}
+
+// BudgetAlerts is a budget alerts resolver. It gets alerts of budgets of
+// households the user is a member of, newest first.
+func (r *Resolver) BudgetAlerts(ctx context.Context, args BudgetAlertResolverArgs) (*[]*BudgetAlertResolver, error) {
+	publicID := GetUserID(ctx)
+	user, err := publicID.PrivateID(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	householdID := ""
+	if args.HouseholdID != nil {
+		householdID = *args.HouseholdID
+	}
+
+	alerts, err := handlers.ListBudgetAlerts(r.db, user.ID, householdID, args.Unread != nil && *args.Unread)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := make([]*BudgetAlertResolver, 0, len(alerts))
+	for _, alert := range alerts {
+		resolver = append(resolver, &BudgetAlertResolver{
+			alert: alert,
+		})
+	}
+
+	return &resolver, nil
+}
+
+// ID gets the id field from budget
+func (r *BudgetResolver) ID() string {
+	return r.budget.PublicID
+}
+
+// HouseholdID gets the householdId field from budget
+func (r *BudgetResolver) HouseholdID() string {
+	return r.budget.HouseholdID
+}
+
+// CreatedBy gets the createdBy field from budget
+func (r *BudgetResolver) CreatedBy() string {
+	return r.budget.CreatedBy
+}
+
+// Name gets the name field from budget
+func (r *BudgetResolver) Name() string {
+	return r.budget.Name
+}
+
+// Period gets the period field from budget
+func (r *BudgetResolver) Period() string {
+	return r.budget.Period
+}
+
+// Scope gets the scope field from budget
+func (r *BudgetResolver) Scope() string {
+	return r.budget.Scope
+}
+
+// LocationID gets the locationId field from budget
+func (r *BudgetResolver) LocationID() *string {
+	return r.budget.LocationID
+}
+
+// LocationName gets the locationName field from budget
+func (r *BudgetResolver) LocationName() *string {
+	return r.budget.LocationName
+}
+
+// ItemID gets the itemId field from budget
+func (r *BudgetResolver) ItemID() *string {
+	return r.budget.ItemID
+}
+
+// ItemName gets the itemName field from budget
+func (r *BudgetResolver) ItemName() *string {
+	return r.budget.ItemName
+}
+
+// Category gets the category field from budget
+func (r *BudgetResolver) Category() *string {
+	return r.budget.Category
+}
+
+// Tag gets the tag field from budget
+func (r *BudgetResolver) Tag() *string {
+	return r.budget.Tag
+}
+
+// Amount gets the amount field from budget
+func (r *BudgetResolver) Amount() float64 {
+	return r.budget.Amount.Float64()
+}
+
+// Currency gets the currency field from budget
+func (r *BudgetResolver) Currency() string {
+	return r.budget.Currency
+}
+
+// TimeZone gets the timeZone field from budget
+func (r *BudgetResolver) TimeZone() string {
+	return r.budget.TimeZone
+}
+
+// CreatedAt gets the createdAt field from budget
+func (r *BudgetResolver) CreatedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.budget.CreatedAt,
+	}
+}
+
+// UpdatedAt gets the updatedAt field from budget
+func (r *BudgetResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.budget.UpdatedAt,
+	}
+}
+
+// Current gets spending in the current period of the budget
+func (r *BudgetResolver) Current() (*BudgetPeriodResolver, error) {
+	periods, err := handlers.BudgetPeriods(r.db, r.rateProvider, r.budget, 1, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &BudgetPeriodResolver{
+		period: periods[0],
+	}, nil
+}
+
+// History gets spending in past periods of the budget up to the current one,
+// oldest first
+func (r *BudgetResolver) History(args BudgetHistoryArgs) ([]*BudgetPeriodResolver, error) {
+	periods := budgetHistoryPeriods
+	if args.Periods != nil {
+		periods = int(*args.Periods)
+	}
+	if periods < 1 || periods > 120 {
+		return nil, ErrBudgetHistoryPeriods
+	}
+
+	history, err := handlers.BudgetPeriods(r.db, r.rateProvider, r.budget, periods, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := make([]*BudgetPeriodResolver, 0, len(history))
+	for _, period := range history {
+		resolver = append(resolver, &BudgetPeriodResolver{
+			period: period,
+		})
+	}
+
+	return resolver, nil
+}
+
+// Start gets the start field from period
+func (r *BudgetPeriodResolver) Start() string {
+	return r.period.Start
+}
+
+// End gets the end field from period
+func (r *BudgetPeriodResolver) End() string {
+	return r.period.End
+}
+
+// Budget gets the budget field from period
+func (r *BudgetPeriodResolver) Budget() float64 {
+	return r.period.Budget.Float64()
+}
+
+// Spent gets the spent field from period
+func (r *BudgetPeriodResolver) Spent() float64 {
+	return r.period.Spent.Float64()
+}
+
+// Remaining gets the remaining field from period
+func (r *BudgetPeriodResolver) Remaining() float64 {
+	return r.period.Remaining.Float64()
+}
+
+// Percent gets the percent field from period
+func (r *BudgetPeriodResolver) Percent() float64 {
+	return r.period.Percent.Float64()
+}
+
+// Status gets the status field from period
+func (r *BudgetPeriodResolver) Status() string {
+	return r.period.Status
+}
+
+// ID gets the id field from alert
+func (r *BudgetAlertResolver) ID() string {
+	return r.alert.PublicID
+}
+
+// BudgetID gets the budgetId field from alert
+func (r *BudgetAlertResolver) BudgetID() string {
+	return r.alert.BudgetID
+}
+
+// BudgetName gets the budgetName field from alert
+func (r *BudgetAlertResolver) BudgetName() string {
+	return r.alert.BudgetName
+}
+
+// ReceiptID gets the receiptId field from alert
+func (r *BudgetAlertResolver) ReceiptID() *string {
+	return r.alert.ReceiptID
+}
+
+// Period gets the period field from alert
+func (r *BudgetAlertResolver) Period() string {
+	return r.alert.Period
+}
+
+// Threshold gets the threshold field from alert
+func (r *BudgetAlertResolver) Threshold() int32 {
+	return int32(r.alert.Threshold)
+}
+
+// Spent gets the spent field from alert
+func (r *BudgetAlertResolver) Spent() float64 {
+	return r.alert.Spent.Float64()
+}
+
+// Amount gets the amount field from alert
+func (r *BudgetAlertResolver) Amount() float64 {
+	return r.alert.Amount.Float64()
+}
+
+// Currency gets the currency field from alert
+func (r *BudgetAlertResolver) Currency() string {
+	return r.alert.Currency
+}
+
+// CreatedAt gets the createdAt field from alert
+func (r *BudgetAlertResolver) CreatedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.alert.CreatedAt,
+	}
+}
+
+// ReadAt gets the readAt field from alert
+func (r *BudgetAlertResolver) ReadAt() *graphql.Time {
+	if r.alert.ReadAt == nil {
+		return nil
+	}
+
+	return &graphql.Time{
+		Time: *r.alert.ReadAt,
+	}
+}
@@ -0,0 +1,28 @@
+package resolvers
+
+import "github.com/dusansimic/receipts-archive-backend/handlers"
+
+// DiscountResolver is a struct for resolved discount
+type DiscountResolver struct {
+	discount handlers.Discount
+}
+
+// Percent gets the percent field from discount
+func (r *DiscountResolver) Percent() *float64 {
+	if r.discount.Percent == nil {
+		return nil
+	}
+
+	percent := r.discount.Percent.Float64()
+	return &percent
+}
+
+// Fixed gets the fixed field from discount
+func (r *DiscountResolver) Fixed() *float64 {
+	if r.discount.Fixed == nil {
+		return nil
+	}
+
+	fixed := r.discount.Fixed.Float64()
+	return &fixed
+}
@@ -3,6 +3,7 @@ package resolvers
 import (
 	"context"
 
+	"github.com/dusansimic/receipts-archive-backend/database"
 	"github.com/dusansimic/receipts-archive-backend/handlers"
 	"github.com/gin-gonic/gin"
 	graphql "github.com/graph-gophers/graphql-go"
@@ -14,27 +15,78 @@ var schema = `
 scalar Time
 
 type Query {
-	locations(name: String): [Location!]
-	receipts(locationId: String): [Receipt!]
+	households: [Household!]
+	locations(name: String, householdId: String): [Location!]
+	receipts(id: String, locationId: String, householdId: String, currency: String, paymentMethodId: String, paymentType: String, refundOf: String): [Receipt!]
 	itemsInReceipt(receiptId: String): [ItemInReceipt!]
+	budgets(householdId: String): [Budget!]
+	budgetAlerts(householdId: String, unread: Boolean): [BudgetAlert!]
+}
+
+type Mutation {
+	updateReceipt(id: String!, purchasedAt: String, timeZone: String, notes: String, fiscalId: String): Receipt
+}
+
+type Household {
+	id: String!
+	name: String!
+	role: String!
+	createdBy: String!
+	createdAt: Time!
+	updatedAt: Time!
 }
 
 type Location {
 	id: String!
+	householdId: String!
+	createdBy: String!
 	name: String!
 	address: String!
+	taxId: String
 	createdAt: Time!
 	updatedAt: Time!
 }
 
 type Receipt {
 	id: String!
+	householdId: String!
 	createdBy: String!
 	location: Location!
+	subtotalPrice: Float!
+	discount: Discount
 	totalPrice: Float!
+	saved: Float!
+	currency: String!
+	convertedTotalPrice: Float
+	refundOf: String
+	refundedPrice: Float!
+	netTotalPrice: Float!
+	purchasedAt: Time!
+	timeZone: String!
+	notes: String
+	fiscalId: String
 	createdAt: Time!
 	updatedAt: Time!
 	itemsInReceipt: [ItemInReceipt]
+	taxes: [TaxBreakdown!]
+	payments: [Payment!]
+	paymentsMismatch: Boolean!
+	statementTransaction: StatementTransaction
+}
+
+type StatementTransaction {
+	date: String!
+	amount: Float!
+	currency: String!
+	reference: String!
+	description: String!
+}
+
+type Payment {
+	methodId: String!
+	name: String!
+	type: String!
+	amount: Float!
 }
 
 type ItemInReceipt {
@@ -43,30 +95,99 @@ type ItemInReceipt {
 	name: String!
 	price: Float!
 	unit: String!
+	normalizedPrice: Float
+	normalizedUnit: String
+	amount: Float!
+	taxLabel: String
+	taxRate: Float
+	discount: Discount
+	saved: Float!
+	total: Float!
+}
+
+type Discount {
+	percent: Float
+	fixed: Float
+}
+
+type Budget {
+	id: String!
+	householdId: String!
+	createdBy: String!
+	name: String!
+	period: String!
+	scope: String!
+	locationId: String
+	locationName: String
+	itemId: String
+	itemName: String
+	category: String
+	tag: String
+	amount: Float!
+	currency: String!
+	timeZone: String!
+	createdAt: Time!
+	updatedAt: Time!
+	current: BudgetPeriod!
+	history(periods: Int): [BudgetPeriod!]!
+}
+
+type BudgetPeriod {
+	start: String!
+	end: String!
+	budget: Float!
+	spent: Float!
+	remaining: Float!
+	percent: Float!
+	status: String!
+}
+
+type BudgetAlert {
+	id: String!
+	budgetId: String!
+	budgetName: String!
+	receiptId: String
+	period: String!
+	threshold: Int!
+	spent: Float!
 	amount: Float!
+	currency: String!
+	createdAt: Time!
+	readAt: Time
+}
+
+type TaxBreakdown {
+	label: String!
+	rate: Float!
+	net: Float!
+	tax: Float!
+	gross: Float!
 }
 `
 
 func GetUserID(ctx context.Context) handlers.StructPublicID {
 	return handlers.StructPublicID{
-		PublicID: ctx.Value("userID").(string),
+		PublicID: ctx.Value(handlers.UserIDContextKey).(string),
 	}
 }
 
 // Options stores options for GraphQL resolver
 type Options struct {
-	DB *sqlx.DB
+	DB           *sqlx.DB
+	RateProvider database.ExchangeRateProvider
 }
 
 // Resolver struct for storing required data
 type Resolver struct {
-	db *sqlx.DB
+	db           *sqlx.DB
+	rateProvider database.ExchangeRateProvider
 }
 
 // NewSchema creates a new schema based on schema type and query struct
-func NewSchema(db *sqlx.DB) *graphql.Schema {
+func NewSchema(db *sqlx.DB, rateProvider database.ExchangeRateProvider) *graphql.Schema {
 	resolver := Resolver{
-		db: db,
+		db:           db,
+		rateProvider: rateProvider,
 	}
 	return graphql.MustParseSchema(schema, &resolver)
 }
@@ -80,5 +201,5 @@ type GraphQLBody struct {
 
 // GraphQLHandler handles grpahql requests
 func (o Options) GraphQLHandler() gin.HandlerFunc {
-	return gin.WrapH(&relay.Handler{Schema: NewSchema(o.DB)})
+	return gin.WrapH(&relay.Handler{Schema: NewSchema(o.DB, o.RateProvider)})
 }
@@ -0,0 +1,79 @@
+package resolvers
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dusansimic/receipts-archive-backend/handlers"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// HouseholdResolver is a struct for resolved household
+type HouseholdResolver struct {
+	household handlers.Household
+}
+
+// Households is a households resolver. It gets households the user is a member
+// of.
+func (r *Resolver) Households(ctx context.Context) (*[]*HouseholdResolver, error) {
+	publicID := GetUserID(ctx)
+	user, err := publicID.PrivateID(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := sq.Select("households.public_id, households.name, household_members.role, users.public_id AS created_by, households.created_at, households.updated_at").From("households").Join("household_members ON household_members.household_id = households.id").Join("users ON users.id = households.created_by").Where(sq.Eq{"household_members.user_id": user.ID}).OrderBy("household_members.id")
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	households := []handlers.Household{}
+	if err := r.db.Select(&households, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	resolver := make([]*HouseholdResolver, 0, len(households))
+	for _, household := range households {
+		resolver = append(resolver, &HouseholdResolver{
+			household: household,
+		})
+	}
+
+	return &resolver, nil
+}
+
+// ID gets the id field from the household
+func (r *HouseholdResolver) ID() string {
+	return r.household.PublicID
+}
+
+// Name gets the name field from the household
+func (r *HouseholdResolver) Name() string {
+	return r.household.Name
+}
+
+// Role gets the role of the user in the household
+func (r *HouseholdResolver) Role() string {
+	return r.household.Role
+}
+
+// CreatedBy gets the createdBy field from the household
+func (r *HouseholdResolver) CreatedBy() string {
+	return r.household.CreatedBy
+}
+
+// CreatedAt gets the createdAt field from the household
+func (r *HouseholdResolver) CreatedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.household.CreatedAt,
+	}
+}
+
+// UpdatedAt gets the updatedAt field from the household
+func (r *HouseholdResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.household.UpdatedAt,
+	}
+}
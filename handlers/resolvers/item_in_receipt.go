@@ -29,7 +29,7 @@ func (r *Resolver) ItemsInReceipt(ctx context.Context, args ItemInReceiptResolve
 		return nil, err
 	}
 
-	query := sq.Select("items_in_receipt.public_id, items.public_id as item_public_id, items.name as item_name, items.price as item_price, items.unit as item_unit, items_in_receipt.amount").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"receipts.created_by": user.ID})
+	query := sq.Select(handlers.ItemsInReceiptColumns).From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(handlers.MemberOf("receipts.household_id", user.ID)).Where(handlers.NotDeleted("receipts"))
 
 	if receiptID != nil {
 		query = query.Where(sq.Eq{"receipts.public_id": receiptID})
@@ -73,7 +73,7 @@ func (r *ItemInReceiptResolver) Name() string {
 
 // Price gets the price field from itemInReceipt
 func (r *ItemInReceiptResolver) Price() float64 {
-	return float64(r.itemInReceipt.Price)
+	return r.itemInReceipt.Price.Float64()
 }
 
 // Unit gets the unit field from itemInReceipt
@@ -81,7 +81,61 @@ func (r *ItemInReceiptResolver) Unit() string {
 	return r.itemInReceipt.Unit
 }
 
+// NormalizedPrice gets the normalizedPrice field from itemInReceipt
+func (r *ItemInReceiptResolver) NormalizedPrice() *float64 {
+	price, _ := handlers.NormalizePrice(r.itemInReceipt.Price, r.itemInReceipt.Unit, r.itemInReceipt.PackageSize, r.itemInReceipt.PackageUnit)
+	if price == nil {
+		return nil
+	}
+
+	normalized := price.Float64()
+	return &normalized
+}
+
+// NormalizedUnit gets the normalizedUnit field from itemInReceipt
+func (r *ItemInReceiptResolver) NormalizedUnit() *string {
+	_, unit := handlers.NormalizePrice(r.itemInReceipt.Price, r.itemInReceipt.Unit, r.itemInReceipt.PackageSize, r.itemInReceipt.PackageUnit)
+	return unit
+}
+
 // Amount gets the amount field from itemInReceipt
 func (r *ItemInReceiptResolver) Amount() float64 {
-	return float64(r.itemInReceipt.Amount)
+	return r.itemInReceipt.Amount
+}
+
+// TaxLabel gets the taxLabel field from itemInReceipt
+func (r *ItemInReceiptResolver) TaxLabel() *string {
+	return r.itemInReceipt.TaxLabel
+}
+
+// TaxRate gets the taxRate field from itemInReceipt
+func (r *ItemInReceiptResolver) TaxRate() *float64 {
+	if r.itemInReceipt.TaxRate == nil {
+		return nil
+	}
+
+	rate := r.itemInReceipt.TaxRate.Float64()
+	return &rate
+}
+
+// Discount gets the discount field from itemInReceipt
+func (r *ItemInReceiptResolver) Discount() *DiscountResolver {
+	discount := handlers.NewDiscount(r.itemInReceipt.DiscountType, r.itemInReceipt.DiscountValue)
+	if discount == nil {
+		return nil
+	}
+
+	return &DiscountResolver{
+		discount: *discount,
+	}
+}
+
+// Saved gets the saved field from itemInReceipt
+func (r *ItemInReceiptResolver) Saved() float64 {
+	return r.itemInReceipt.Saved.Float64()
+}
+
+// Total gets the total field from itemInReceipt
+func (r *ItemInReceiptResolver) Total() float64 {
+	return r.itemInReceipt.Total.Float64()
 }
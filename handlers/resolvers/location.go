@@ -16,7 +16,8 @@ type LocationResolver struct {
 
 // LocationResolverArgs is a struct for location resolver arguments
 type LocationResolverArgs struct {
-	Name *string
+	Name        *string
+	HouseholdID *string
 }
 
 // Locations is a locations resolver. If name argument is specified, it searches
@@ -28,11 +29,16 @@ func (r *Resolver) Locations(ctx context.Context, args LocationResolverArgs) (*[
 		return nil, err
 	}
 
-	query := sq.Select("public_id, name, address, created_at, updated_at").From("locations").Where(sq.Eq{"created_by": user.ID})
+	query := sq.Select("locations.public_id, households.public_id AS household_id, users.public_id AS created_by, locations.name, locations.address, locations.tax_id, locations.created_at, locations.updated_at").From("locations").Join("households ON households.id = locations.household_id").Join("users ON users.id = locations.created_by").Where(handlers.MemberOf("locations.household_id", user.ID)).Where(handlers.NotDeleted("locations"))
 
 	name := args.Name
 	if name != nil {
-		query = query.Where(sq.Like{"name": fmt.Sprint("%", name, "%")})
+		query = query.Where(sq.Like{"locations.name": fmt.Sprint("%", *name, "%")})
+	}
+
+	householdID := args.HouseholdID
+	if householdID != nil {
+		query = query.Where(sq.Eq{"households.public_id": householdID})
 	}
 
 	queryString, queryStringArgs, err := query.ToSql()
@@ -60,6 +66,16 @@ func (r *LocationResolver) ID() string {
 	return r.location.PublicID
 }
 
+// HouseholdID gets the householdId field from the location
+func (r *LocationResolver) HouseholdID() string {
+	return r.location.HouseholdID
+}
+
+// CreatedBy gets the createdBy field from the location
+func (r *LocationResolver) CreatedBy() string {
+	return r.location.CreatedBy
+}
+
 // Name gets the name field from the location
 func (r *LocationResolver) Name() string {
 	return r.location.Name
@@ -70,6 +86,11 @@ func (r *LocationResolver) Address() string {
 	return r.location.Address
 }
 
+// TaxID gets the taxId field from the location
+func (r *LocationResolver) TaxID() *string {
+	return r.location.TaxID
+}
+
 // CreatedAt get the createdAt field from the location
 func (r *LocationResolver) CreatedAt() graphql.Time {
 	return graphql.Time{
@@ -0,0 +1,28 @@
+package resolvers
+
+import "github.com/dusansimic/receipts-archive-backend/handlers"
+
+// PaymentResolver is a struct for resolved payment
+type PaymentResolver struct {
+	payment handlers.Payment
+}
+
+// MethodID gets the methodId field from payment
+func (r *PaymentResolver) MethodID() string {
+	return r.payment.MethodID
+}
+
+// Name gets the name field from payment
+func (r *PaymentResolver) Name() string {
+	return r.payment.Name
+}
+
+// Type gets the type field from payment
+func (r *PaymentResolver) Type() string {
+	return r.payment.Type
+}
+
+// Amount gets the amount field from payment
+func (r *PaymentResolver) Amount() float64 {
+	return r.payment.Amount.Float64()
+}
@@ -2,7 +2,9 @@ package resolvers
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/dusansimic/receipts-archive-backend/handlers"
@@ -23,7 +25,13 @@ type ReceiptResolver struct {
 
 // ReceiptResolverArgs is a struct for receipt resolver arguments
 type ReceiptResolverArgs struct {
-	LocationID *string
+	ID              *string
+	LocationID      *string
+	HouseholdID     *string
+	Currency        *string
+	PaymentMethodID *string
+	PaymentType     *string
+	RefundOf        *string
 }
 
 func hasField(ctx context.Context, fieldname string) bool {
@@ -41,12 +49,33 @@ func hasField(ctx context.Context, fieldname string) bool {
 func (r *Resolver) Receipts(ctx context.Context, args ReceiptResolverArgs) (*[]*ReceiptResolver, error) {
 	publicID := GetUserID(ctx)
 	locationID := args.LocationID
+	householdID := args.HouseholdID
 
-	query := sq.Select("receipts.public_id, locations.public_id AS location_id, users.public_id AS created_by, locations.name AS name, locations.address AS address, receipts.created_at, receipts.updated_at, ROUND(SUM(items.price * items_in_receipt.amount), 2) AS total_price").From("receipts").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(sq.Eq{"users.public_id": publicID.PublicID})
+	user, err := publicID.PrivateID(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := sq.Select("receipts.public_id, households.public_id AS household_id, locations.public_id AS location_id, users.public_id AS created_by, locations.name AS name, locations.address AS address, locations.tax_id, receipts.created_at, receipts.updated_at, " + handlers.ReceiptSubtotalSQL + " AS subtotal_price, receipts.discount_type, receipts.discount_value, " + handlers.ReceiptTotalSQL + " AS total_price, " + handlers.ReceiptSavedSQL + " AS saved, receipts.currency, originals.public_id AS refund_of, receipts.purchased_at, receipts.time_zone, receipts.notes, receipts.fiscal_id").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").Join("users ON users.id = receipts.created_by").LeftJoin("receipts originals ON originals.id = receipts.refund_of").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(handlers.MemberOf("receipts.household_id", user.ID)).Where(handlers.NotDeleted("receipts"))
 
+	if args.ID != nil {
+		query = query.Where(sq.Eq{"receipts.public_id": *args.ID})
+	}
 	if locationID != nil {
 		query = query.Where(sq.Eq{"locations.public_id": locationID})
 	}
+	if householdID != nil {
+		query = query.Where(sq.Eq{"households.public_id": householdID})
+	}
+	if args.PaymentMethodID != nil {
+		query = query.Where(handlers.PaidWith("public_id", *args.PaymentMethodID))
+	}
+	if args.PaymentType != nil {
+		query = query.Where(handlers.PaidWith("type", *args.PaymentType))
+	}
+	if args.RefundOf != nil {
+		query = query.Where(sq.Eq{"originals.public_id": *args.RefundOf})
+	}
 
 	queryString, queryStringArgs, err := query.ToSql()
 	if err != nil {
@@ -60,30 +89,44 @@ func (r *Resolver) Receipts(ctx context.Context, args ReceiptResolverArgs) (*[]*
 		return nil, err
 	}
 
-	user := handlers.StructID{}
-
 	hasItemsField := hasField(ctx, "itemsInReceipt")
-	if hasItemsField {
-		user, err = publicID.PrivateID(r.db)
-		if err != nil {
-			return nil, err
-		}
+	hasTaxesField := hasField(ctx, "taxes")
+	hasPaymentsField := hasField(ctx, "payments") || hasField(ctx, "paymentsMismatch")
+	hasRefundsField := hasField(ctx, "refundedPrice") || hasField(ctx, "netTotalPrice")
+	hasStatementTransactionField := hasField(ctx, "statementTransaction")
+
+	var converter *handlers.CurrencyConverter
+	if args.Currency != nil {
+		converter = handlers.NewCurrencyConverter(r.db, r.rateProvider)
 	}
 
 	for rows.Next() {
 		receipt := ReceiptWithDataAndItems{}
-		var totalPrice sql.NullFloat64
+		var discountType *string
+		var discountValue *int64
 
-		err := rows.Scan(&receipt.PublicID, &receipt.Location.PublicID, &receipt.CreatedBy, &receipt.Location.Name, &receipt.Location.Address, &receipt.CreatedAt, &receipt.UpdatedAt, &totalPrice)
+		err := rows.Scan(&receipt.PublicID, &receipt.HouseholdID, &receipt.Location.PublicID, &receipt.CreatedBy, &receipt.Location.Name, &receipt.Location.Address, &receipt.Location.TaxID, &receipt.CreatedAt, &receipt.UpdatedAt, &receipt.SubtotalPrice, &discountType, &discountValue, &receipt.TotalPrice, &receipt.Saved, &receipt.Currency, &receipt.RefundOf, &receipt.PurchasedAt, &receipt.TimeZone, &receipt.Notes, &receipt.FiscalID)
 
-		receipt.TotalPrice = totalPrice.Float64
+		receipt.Location.HouseholdID = receipt.HouseholdID
+		if location, err := time.LoadLocation(receipt.TimeZone); err == nil {
+			receipt.PurchasedAt = receipt.PurchasedAt.In(location)
+		}
+		receipt.Discount = handlers.NewDiscount(discountType, discountValue)
 
 		if err != nil {
 			return nil, err
 		}
 
+		if converter != nil {
+			converted, err := converter.Convert(receipt.TotalPrice, receipt.Currency, strings.ToUpper(*args.Currency), receipt.PurchasedAt)
+			if err != nil {
+				return nil, err
+			}
+			receipt.ConvertedTotalPrice = &converted
+		}
+
 		if hasItemsField {
-			query := sq.Select("items_in_receipt.public_id, items.public_id as item_public_id, items.name as item_name, items.price as item_price, items.unit as item_unit, items_in_receipt.amount").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"receipts.created_by": user.ID, "receipts.public_id": receipt.PublicID})
+			query := sq.Select(handlers.ItemsInReceiptColumns).From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Where(sq.Eq{"receipts.public_id": receipt.PublicID}).Where(handlers.MemberOf("receipts.household_id", user.ID))
 
 			queryString, queryStringArgs, err := query.ToSql()
 			if err != nil {
@@ -95,6 +138,41 @@ func (r *Resolver) Receipts(ctx context.Context, args ReceiptResolverArgs) (*[]*
 			}
 		}
 
+		if hasTaxesField {
+			taxes, err := handlers.ReceiptTaxes(r.db, []string{receipt.PublicID})
+			if err != nil {
+				return nil, err
+			}
+			receipt.Taxes = taxes[receipt.PublicID]
+		}
+
+		if hasPaymentsField {
+			payments, err := handlers.ReceiptPayments(r.db, []string{receipt.PublicID})
+			if err != nil {
+				return nil, err
+			}
+			receipt.Payments = payments[receipt.PublicID]
+			receipt.PaymentsMismatch = handlers.PaymentsMismatch(receipt.Payments, receipt.TotalPrice)
+		}
+
+		if hasStatementTransactionField {
+			transactions, err := handlers.ReceiptStatementTransactions(r.db, []string{receipt.PublicID})
+			if err != nil {
+				return nil, err
+			}
+			receipt.StatementTransaction = transactions[receipt.PublicID]
+		}
+
+		receipt.NetTotalPrice = receipt.TotalPrice
+		if hasRefundsField {
+			refunds, err := handlers.ReceiptRefunds(r.db, []string{receipt.PublicID})
+			if err != nil {
+				return nil, err
+			}
+			receipt.RefundedPrice = refunds[receipt.PublicID]
+			receipt.NetTotalPrice -= receipt.RefundedPrice
+		}
+
 		resolver = append(resolver, &ReceiptResolver{
 			receipt: receipt,
 		})
@@ -103,11 +181,63 @@ func (r *Resolver) Receipts(ctx context.Context, args ReceiptResolverArgs) (*[]*
 	return &resolver, nil
 }
 
+// UpdateReceiptArgs is a struct for update receipt mutation arguments
+type UpdateReceiptArgs struct {
+	ID          string
+	PurchasedAt *string
+	TimeZone    *string
+	Notes       *string
+	FiscalID    *string
+}
+
+// UpdateReceipt is an update receipt mutation resolver. It updates purchase
+// details of the receipt and resolves the updated receipt.
+func (r *Resolver) UpdateReceipt(ctx context.Context, args UpdateReceiptArgs) (*ReceiptResolver, error) {
+	publicID := GetUserID(ctx)
+	user, err := publicID.PrivateID(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	details := handlers.ReceiptDetails{
+		Notes:    args.Notes,
+		FiscalID: args.FiscalID,
+	}
+	if args.PurchasedAt != nil {
+		details.PurchasedAt = *args.PurchasedAt
+	}
+	if args.TimeZone != nil {
+		details.TimeZone = *args.TimeZone
+	}
+
+	updated, err := handlers.UpdateReceiptDetails(r.db, user.ID, args.ID, details)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errors.New("not authorized to update specified receipt")
+	}
+
+	receipts, err := r.Receipts(ctx, ReceiptResolverArgs{
+		ID: &args.ID,
+	})
+	if err != nil || len(*receipts) == 0 {
+		return nil, err
+	}
+
+	return (*receipts)[0], nil
+}
+
 // ID gets the id field from receipt
 func (r *ReceiptResolver) ID() string {
 	return r.receipt.PublicID
 }
 
+// HouseholdID gets the householdId field from receipt
+func (r *ReceiptResolver) HouseholdID() string {
+	return r.receipt.HouseholdID
+}
+
 // CreatedBy get the createdBy field from receipt
 func (r *ReceiptResolver) CreatedBy() string {
 	return r.receipt.CreatedBy
@@ -122,7 +252,80 @@ func (r *ReceiptResolver) Location() *LocationResolver {
 
 // TotalPrice gets the totalPrice field from receipt
 func (r *ReceiptResolver) TotalPrice() float64 {
-	return r.receipt.TotalPrice
+	return r.receipt.TotalPrice.Float64()
+}
+
+// SubtotalPrice gets the subtotalPrice field from receipt
+func (r *ReceiptResolver) SubtotalPrice() float64 {
+	return r.receipt.SubtotalPrice.Float64()
+}
+
+// Discount gets the discount field from receipt
+func (r *ReceiptResolver) Discount() *DiscountResolver {
+	if r.receipt.Discount == nil {
+		return nil
+	}
+
+	return &DiscountResolver{
+		discount: *r.receipt.Discount,
+	}
+}
+
+// Saved gets the saved field from receipt
+func (r *ReceiptResolver) Saved() float64 {
+	return r.receipt.Saved.Float64()
+}
+
+// Currency gets the currency field from receipt
+func (r *ReceiptResolver) Currency() string {
+	return r.receipt.Currency
+}
+
+// ConvertedTotalPrice gets the convertedTotalPrice field from receipt
+func (r *ReceiptResolver) ConvertedTotalPrice() *float64 {
+	if r.receipt.ConvertedTotalPrice == nil {
+		return nil
+	}
+
+	converted := r.receipt.ConvertedTotalPrice.Float64()
+	return &converted
+}
+
+// RefundOf gets the refundOf field from receipt
+func (r *ReceiptResolver) RefundOf() *string {
+	return r.receipt.RefundOf
+}
+
+// RefundedPrice gets the refundedPrice field from receipt
+func (r *ReceiptResolver) RefundedPrice() float64 {
+	return r.receipt.RefundedPrice.Float64()
+}
+
+// NetTotalPrice gets the netTotalPrice field from receipt
+func (r *ReceiptResolver) NetTotalPrice() float64 {
+	return r.receipt.NetTotalPrice.Float64()
+}
+
+// PurchasedAt gets the purchasedAt field from receipt
+func (r *ReceiptResolver) PurchasedAt() graphql.Time {
+	return graphql.Time{
+		Time: r.receipt.PurchasedAt,
+	}
+}
+
+// TimeZone gets the timeZone field from receipt
+func (r *ReceiptResolver) TimeZone() string {
+	return r.receipt.TimeZone
+}
+
+// Notes gets the notes field from receipt
+func (r *ReceiptResolver) Notes() *string {
+	return r.receipt.Notes
+}
+
+// FiscalID gets the fiscalId field from receipt
+func (r *ReceiptResolver) FiscalID() *string {
+	return r.receipt.FiscalID
 }
 
 // CreatedAt gets the createdAt field from receipt
@@ -150,3 +353,46 @@ func (r *ReceiptResolver) ItemsInReceipt() *[]*ItemInReceiptResolver {
 
 	return &items
 }
+
+// Taxes gets the net, tax and gross subtotals grouped by rate for a taxes
+// field
+func (r *ReceiptResolver) Taxes() *[]*TaxBreakdownResolver {
+	taxes := []*TaxBreakdownResolver{}
+	for _, breakdown := range r.receipt.Taxes {
+		taxes = append(taxes, &TaxBreakdownResolver{
+			breakdown: breakdown,
+		})
+	}
+
+	return &taxes
+}
+
+// Payments gets the amounts paid with each payment method for a payments
+// field
+func (r *ReceiptResolver) Payments() *[]*PaymentResolver {
+	payments := []*PaymentResolver{}
+	for _, payment := range r.receipt.Payments {
+		payments = append(payments, &PaymentResolver{
+			payment: payment,
+		})
+	}
+
+	return &payments
+}
+
+// PaymentsMismatch gets the paymentsMismatch field from receipt
+func (r *ReceiptResolver) PaymentsMismatch() bool {
+	return r.receipt.PaymentsMismatch
+}
+
+// StatementTransaction gets the confirmed transaction of a bank statement for
+// a statementTransaction field
+func (r *ReceiptResolver) StatementTransaction() *StatementTransactionResolver {
+	if r.receipt.StatementTransaction == nil {
+		return nil
+	}
+
+	return &StatementTransactionResolver{
+		transaction: *r.receipt.StatementTransaction,
+	}
+}
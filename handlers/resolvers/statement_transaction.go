@@ -0,0 +1,34 @@
+package resolvers
+
+import "github.com/dusansimic/receipts-archive-backend/handlers"
+
+// StatementTransactionResolver is a struct for resolved transaction of a bank
+// statement
+type StatementTransactionResolver struct {
+	transaction handlers.StatementTransaction
+}
+
+// Date gets the date field from transaction
+func (r *StatementTransactionResolver) Date() string {
+	return r.transaction.Date
+}
+
+// Amount gets the amount field from transaction
+func (r *StatementTransactionResolver) Amount() float64 {
+	return r.transaction.Amount.Float64()
+}
+
+// Currency gets the currency field from transaction
+func (r *StatementTransactionResolver) Currency() string {
+	return r.transaction.Currency
+}
+
+// Reference gets the reference field from transaction
+func (r *StatementTransactionResolver) Reference() string {
+	return r.transaction.Reference
+}
+
+// Description gets the description field from transaction
+func (r *StatementTransactionResolver) Description() string {
+	return r.transaction.Description
+}
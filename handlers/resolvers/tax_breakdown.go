@@ -0,0 +1,33 @@
+package resolvers
+
+import "github.com/dusansimic/receipts-archive-backend/handlers"
+
+// TaxBreakdownResolver is a struct for resolved tax breakdown
+type TaxBreakdownResolver struct {
+	breakdown handlers.TaxBreakdown
+}
+
+// Label gets the label field from tax breakdown
+func (r *TaxBreakdownResolver) Label() string {
+	return r.breakdown.Label
+}
+
+// Rate gets the rate field from tax breakdown
+func (r *TaxBreakdownResolver) Rate() float64 {
+	return r.breakdown.Rate.Float64()
+}
+
+// Net gets the net field from tax breakdown
+func (r *TaxBreakdownResolver) Net() float64 {
+	return r.breakdown.Net.Float64()
+}
+
+// Tax gets the tax field from tax breakdown
+func (r *TaxBreakdownResolver) Tax() float64 {
+	return r.breakdown.Tax.Float64()
+}
+
+// Gross gets the gross field from tax breakdown
+func (r *TaxBreakdownResolver) Gross() float64 {
+	return r.breakdown.Gross.Float64()
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+)
+
+// SharesPostBody : Structure that should be used for getting json from body of a post request for receipt shares
+type SharesPostBody struct {
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// SharesDeleteBody : Structure that should be used for getting json data from body of a delete request for receipt shares
+type SharesDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// Share : Structure that should be used for getting receipt share information from database
+type Share struct {
+	PublicID  string     `db:"public_id" json:"id"`
+	URL       string     `db:"-" json:"url"`
+	CreatedBy string     `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revokedAt"`
+}
+
+// SharedReceiptItem : Structure that should be used for getting items of a shared receipt from database
+type SharedReceiptItem struct {
+	Name   string  `db:"item_name" json:"name"`
+	Price  Money   `db:"item_price" json:"price"`
+	Unit   string  `db:"item_unit" json:"unit"`
+	Amount float64 `db:"amount" json:"amount"`
+	// Discount is the amount of the discount and Total is the total of the
+	// line after it
+	Discount Money `db:"discount" json:"discount"`
+	Total    Money `db:"total" json:"total"`
+}
+
+// SharedReceipt : Structure that is sent to users viewing a shared receipt. It
+// doesn't contain any information about the owner of the receipt.
+type SharedReceipt struct {
+	LocationName    string    `db:"location_name" json:"locationName"`
+	LocationAddress string    `db:"location_address" json:"locationAddress"`
+	SubtotalPrice   Money     `db:"-" json:"subtotalPrice"`
+	Discount        Money     `db:"-" json:"discount"`
+	TotalPrice      Money     `db:"-" json:"totalPrice"`
+	Currency        string    `db:"currency" json:"currency"`
+	CreatedAt       time.Time `db:"created_at" json:"createdAt"`
+	// PurchasedAt is the time of purchase in the time zone of the receipt
+	PurchasedAt time.Time           `db:"purchased_at" json:"purchasedAt"`
+	Items       []SharedReceiptItem `db:"-" json:"items"`
+}
+
+var sharedReceiptTemplate = template.Must(template.New("receipt").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{.LocationName}} - {{.PurchasedAt.Format "02.01.2006. 15:04"}}</title>
+	<style>
+		body { font-family: monospace; max-width: 40em; margin: 2em auto; }
+		table { width: 100%; border-collapse: collapse; }
+		th, td { padding: 0.2em 0; text-align: right; }
+		th:first-child, td:first-child { text-align: left; }
+		tfoot td { border-top: 1px dashed black; font-weight: bold; }
+	</style>
+</head>
+<body>
+	<h1>{{.LocationName}}</h1>
+	<p>{{.LocationAddress}}<br>{{.PurchasedAt.Format "02.01.2006. 15:04"}}</p>
+	<table>
+		<thead>
+			<tr><th>Item</th><th>Amount</th><th>Price</th><th>Total</th></tr>
+		</thead>
+		<tbody>
+		{{range .Items}}
+			<tr><td>{{.Name}}</td><td>{{.Amount}} {{.Unit}}</td><td>{{.Price}}</td><td>{{.Total}}</td></tr>
+			{{if .Discount}}<tr><td colspan="3">Discount</td><td>-{{.Discount}}</td></tr>{{end}}
+		{{end}}
+		</tbody>
+		<tfoot>
+			{{if .Discount}}<tr><td colspan="3">Subtotal</td><td>{{.SubtotalPrice}} {{.Currency}}</td></tr>
+			<tr><td colspan="3">Discount</td><td>-{{.Discount}} {{.Currency}}</td></tr>{{end}}
+			<tr><td colspan="3">Total</td><td>{{.TotalPrice}} {{.Currency}}</td></tr>
+		</tfoot>
+	</table>
+</body>
+</html>
+`))
+
+// shareURL creates a relative url of the shared receipt
+func shareURL(publicID string) string {
+	return "/shared/" + publicID
+}
+
+// GetShares is a Gin handler function for getting share links of a receipt.
+func (o Options) GetShares() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Select("receipt_shares.public_id, users.public_id AS created_by, receipt_shares.created_at, receipt_shares.expires_at, receipt_shares.revoked_at").From("receipt_shares").Join("receipts ON receipts.id = receipt_shares.receipt_id").Join("users ON users.id = receipt_shares.created_by").Where(sq.Eq{"receipts.public_id": ctx.Param("id"), "receipts.deleted_at": nil}).Where(MemberOf("receipts.household_id", user.ID, WriteRoles...))
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		shares := []Share{}
+		if err := o.DB.Select(&shares, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for i := range shares {
+			shares[i].URL = shareURL(shares[i].PublicID)
+		}
+
+		ctx.JSON(http.StatusOK, shares)
+	}
+}
+
+// PostShares is a Gin handler function for creating a public share link for
+// a receipt. Link can optionally expire at a specified time.
+func (o Options) PostShares() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var shareData SharesPostBody
+		if err := ctx.ShouldBindJSON(&shareData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var expiresAt *time.Time
+		if shareData.ExpiresAt != "" {
+			t, err := time.Parse(time.RFC3339, shareData.ExpiresAt)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			// Times are stored as text so they have to be in UTC to be
+			// compared
+			t = t.UTC()
+			expiresAt = &t
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receiptIDQuery := sq.Select("id").From("receipts").Where(sq.Eq{"public_id": ctx.Param("id"), "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		receiptIDQueryString, receiptIDQueryStringArgs, err := receiptIDQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receipt := StructID{}
+		if err := o.DB.Get(&receipt, receiptIDQueryString, receiptIDQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to share specified receipt",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		createdAt := time.Now().UTC()
+
+		query := sq.Insert("receipt_shares").Columns("public_id", "receipt_id", "created_by", "created_at", "expires_at").Values(uuid, receipt.ID, user.ID, createdAt, expiresAt)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, Share{
+			PublicID:  uuid,
+			URL:       shareURL(uuid),
+			CreatedBy: createdBy.PublicID,
+			CreatedAt: createdAt,
+			ExpiresAt: expiresAt,
+		})
+	}
+}
+
+// DeleteShares is a Gin handler function for revoking a share link.
+func (o Options) DeleteShares() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var shareData SharesDeleteBody
+		if err := ctx.ShouldBindJSON(&shareData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err := o.V.Struct(shareData)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		receiptsQuery := sq.Select("id").From("receipts").Where(sq.Eq{"public_id": ctx.Param("id"), "deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		query := sq.Update("receipt_shares").Set("revoked_at", time.Now().UTC()).Where(sq.Eq{"public_id": shareData.PublicID, "revoked_at": nil}).Where(sq.Expr("receipt_id IN (?)", receiptsQuery))
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if revoked, err := result.RowsAffected(); err != nil || revoked == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to revoke specified share link",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// GetSharedReceipt is a Gin handler function for viewing a shared receipt. It
+// doesn't require authentication. Receipt is rendered as JSON or as a
+// printable HTML page depending on the Accept header or the format query
+// parameter.
+func (o Options) GetSharedReceipt() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		receiptQuery := sq.Select("receipts.id, locations.name AS location_name, locations.address AS location_address, receipts.currency, receipts.discount_type, receipts.discount_value, receipts.created_at, receipts.purchased_at, receipts.time_zone").From("receipt_shares").Join("receipts ON receipts.id = receipt_shares.receipt_id").Join("locations ON locations.id = receipts.location_id").Where(sq.Eq{"receipt_shares.public_id": ctx.Param("token"), "receipt_shares.revoked_at": nil, "receipts.deleted_at": nil}).Where(sq.Or{sq.Eq{"receipt_shares.expires_at": nil}, sq.Gt{"receipt_shares.expires_at": time.Now().UTC()}})
+
+		receiptQueryString, receiptQueryStringArgs, err := receiptQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var receipt struct {
+			ID            int     `db:"id"`
+			DiscountType  *string `db:"discount_type"`
+			DiscountValue *int64  `db:"discount_value"`
+			TimeZone      string  `db:"time_zone"`
+			SharedReceipt
+		}
+		if err := o.DB.Get(&receipt, receiptQueryString, receiptQueryStringArgs...); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"message": "shared receipt does not exist or the link has expired",
+				})
+				break
+			default:
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+
+		query := sq.Select("items.name as item_name, " + linePriceSQL + " as item_price, items.unit as item_unit, items_in_receipt.amount, " + LineDiscountSQL + " AS discount, " + LineTotalSQL + " AS total").From("items_in_receipt").Join("items ON items.id = items_in_receipt.item_id").Where(sq.Eq{"items_in_receipt.receipt_id": receipt.ID})
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		shared := receipt.SharedReceipt
+		shared.PurchasedAt = inTimeZone(shared.PurchasedAt, receipt.TimeZone)
+		shared.Items = []SharedReceiptItem{}
+		if err := o.DB.Select(&shared.Items, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		for _, item := range shared.Items {
+			shared.SubtotalPrice += item.Total
+		}
+		shared.Discount = NewDiscount(receipt.DiscountType, receipt.DiscountValue).Amount(shared.SubtotalPrice)
+		shared.TotalPrice = shared.SubtotalPrice - shared.Discount
+
+		format := ctx.Query("format")
+		if format == "" && ctx.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+			format = "html"
+		}
+
+		if format != "html" {
+			ctx.JSON(http.StatusOK, shared)
+			return
+		}
+
+		ctx.Header("Content-Type", "text/html; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		if err := sharedReceiptTemplate.Execute(ctx.Writer, shared); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSharedReceipt(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "owner")
+	newTestHousehold(t, db, "stranger")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	// Times have to be stored in UTC whatever the time zone of the server
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() {
+		time.Local = local
+	}()
+
+	receiptID := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'receipt', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	itemID := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 150, 'l')", household.UserID, household.HouseholdID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 2)", receiptID, itemID)
+
+	// Only members of the household of the receipt can share it
+	if recorder := serve(options.PostShares(), "/receipts/:id/share", "stranger", http.MethodPost, "/receipts/receipt/share", `{}`); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("sharing a receipt of another household: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+
+	recorder := serve(options.PostShares(), "/receipts/:id/share", "owner", http.MethodPost, "/receipts/receipt/share", `{}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("sharing a receipt: got %d %s", recorder.Code, recorder.Body)
+	}
+	var share Share
+	if err := json.Unmarshal(recorder.Body.Bytes(), &share); err != nil {
+		t.Fatal(err)
+	}
+	if share.URL != "/shared/"+share.PublicID {
+		t.Errorf("url of the share is %q, want %q", share.URL, "/shared/"+share.PublicID)
+	}
+	if share.CreatedAt.Location() != time.UTC {
+		t.Errorf("share was created at %v, want a time in UTC", share.CreatedAt)
+	}
+
+	recorder = serve(options.GetSharedReceipt(), "/shared/:token", "", http.MethodGet, share.URL, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("viewing a shared receipt: got %d %s", recorder.Code, recorder.Body)
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["totalPrice"] != float64(3) {
+		t.Errorf("total of the shared receipt is %v, want 3", payload["totalPrice"])
+	}
+	// Shared receipt doesn't reveal who owns it
+	for _, key := range []string{"id", "createdBy", "userId", "householdId"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("shared receipt contains %q", key)
+		}
+	}
+	if strings.Contains(recorder.Body.String(), "owner") {
+		t.Errorf("shared receipt contains the id of its owner: %s", recorder.Body)
+	}
+
+	recorder = serve(options.GetSharedReceipt(), "/shared/:token", "", http.MethodGet, share.URL+"?format=html", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("viewing a shared receipt as html: got %d %s", recorder.Code, recorder.Body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("content type of the html receipt is %q", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "<td>Milk</td>") {
+		t.Errorf("html receipt doesn't list its items: %s", recorder.Body)
+	}
+
+	// Only members of the household of the receipt can revoke its links
+	body := `{"id": "` + share.PublicID + `"}`
+	if recorder := serve(options.DeleteShares(), "/receipts/:id/share", "stranger", http.MethodDelete, "/receipts/receipt/share", body); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("revoking a link of another household: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+	if recorder := serve(options.DeleteShares(), "/receipts/:id/share", "owner", http.MethodDelete, "/receipts/receipt/share", body); recorder.Code != http.StatusOK {
+		t.Fatalf("revoking a link: got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(options.GetSharedReceipt(), "/shared/:token", "", http.MethodGet, share.URL, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("viewing a revoked link: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusNotFound)
+	}
+
+	recorder = serve(options.GetShares(), "/receipts/:id/shares", "owner", http.MethodGet, "/receipts/receipt/shares", "")
+	shares := []Share{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &shares); err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 || shares[0].RevokedAt == nil || shares[0].RevokedAt.Location() != time.UTC {
+		t.Errorf("shares of the receipt are %+v, want one revoked in UTC", shares)
+	}
+
+	expiresAt := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	recorder = serve(options.PostShares(), "/receipts/:id/share", "owner", http.MethodPost, "/receipts/receipt/share", `{"expiresAt": "`+expiresAt+`"}`)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &share); err != nil {
+		t.Fatal(err)
+	}
+	if recorder := serve(options.GetSharedReceipt(), "/shared/:token", "", http.MethodGet, share.URL, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("viewing an expired link: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,151 @@
+package statement
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCAMT is returned when a file is not a CAMT.053 statement
+var ErrInvalidCAMT = errors.New("file is not a camt.053 statement")
+
+// camtDocument is a CAMT.053 bank to customer statement. Elements are matched
+// without namespaces so all versions of the message are read.
+type camtDocument struct {
+	XMLName    xml.Name        `xml:"Document"`
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Currency string      `xml:"Acct>Ccy"`
+	Entries  []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Reference string `xml:"NtryRef"`
+	Amount    struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	// Status is the text of the element before version 8 and a code after
+	Status struct {
+		Value string `xml:",chardata"`
+		Code  string `xml:"Cd"`
+	} `xml:"Sts"`
+	BookingDate        camtDate `xml:"BookgDt"`
+	ValueDate          camtDate `xml:"ValDt"`
+	ServicerReference  string   `xml:"AcctSvcrRef"`
+	AdditionalInfo     string   `xml:"AddtlNtryInf"`
+	TransactionDetails []struct {
+		EndToEndID string `xml:"Refs>EndToEndId"`
+		Creditor   string `xml:"RltdPties>Cdtr>Nm"`
+		// Parties are nested in Pty since version 8
+		CreditorParty string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+		Debtor        string   `xml:"RltdPties>Dbtr>Nm"`
+		DebtorParty   string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+		Unstructured  []string `xml:"RmtInf>Ustrd"`
+		Additional    string   `xml:"AddtlTxInf"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// parse parses the date of a date or a date with time
+func (d camtDate) parse() (time.Time, bool) {
+	value := strings.TrimSpace(d.Date)
+	if value == "" {
+		value = strings.TrimSpace(d.DateTime)
+	}
+	if len(value) < 10 {
+		return time.Time{}, false
+	}
+
+	parsed, err := time.Parse("2006-01-02", value[:10])
+	return parsed, err == nil
+}
+
+// ParseCAMT053 parses booked transactions from a CAMT.053 statement. Date of
+// a transaction is its booking date or its value date if there is no booking
+// date. Description has names of the other party and remittance information.
+func ParseCAMT053(r io.Reader) ([]Transaction, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, ErrInvalidCAMT
+	}
+
+	transactions := []Transaction{}
+	number := 0
+	for _, stmt := range document.Statements {
+		for _, entry := range stmt.Entries {
+			number++
+
+			status := strings.TrimSpace(entry.Status.Value)
+			if entry.Status.Code != "" {
+				status = strings.TrimSpace(entry.Status.Code)
+			}
+			if status != "" && status != "BOOK" {
+				continue
+			}
+
+			amount, err := parseAmount(entry.Amount.Value)
+			if err != nil {
+				return nil, &Error{Row: number, Err: err}
+			}
+			if strings.TrimSpace(entry.CreditDebit) == "DBIT" {
+				amount = -amount
+			}
+
+			transactionDate, ok := entry.BookingDate.parse()
+			if !ok {
+				if transactionDate, ok = entry.ValueDate.parse(); !ok {
+					return nil, &Error{Row: number, Err: ErrInvalidCAMT}
+				}
+			}
+
+			transaction := Transaction{
+				Date:      transactionDate,
+				Amount:    amount,
+				Currency:  strings.ToUpper(strings.TrimSpace(entry.Amount.Currency)),
+				Reference: strings.TrimSpace(entry.ServicerReference),
+			}
+			if transaction.Currency == "" {
+				transaction.Currency = strings.ToUpper(strings.TrimSpace(stmt.Currency))
+			}
+			if transaction.Reference == "" {
+				transaction.Reference = strings.TrimSpace(entry.Reference)
+			}
+
+			parts := []string{}
+			for _, details := range entry.TransactionDetails {
+				// The other party is the creditor of debits and the debtor of
+				// credits
+				if amount < 0 {
+					parts = append(parts, details.Creditor, details.CreditorParty)
+				} else {
+					parts = append(parts, details.Debtor, details.DebtorParty)
+				}
+				parts = append(parts, details.Unstructured...)
+				parts = append(parts, details.Additional)
+				if transaction.Reference == "" && details.EndToEndID != "NOTPROVIDED" {
+					transaction.Reference = strings.TrimSpace(details.EndToEndID)
+				}
+			}
+			parts = append(parts, entry.AdditionalInfo)
+			transaction.Description = description(parts...)
+
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrNoTransactions
+	}
+
+	return transactions, nil
+}
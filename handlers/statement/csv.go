@@ -0,0 +1,210 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVMapping is the mapping of columns of a csv statement to fields of
+// transactions
+type CSVMapping struct {
+	// Columns are headers of columns with fields. Headers that are not
+	// specified are the same as names of fields, e.g. date.
+	Columns CSVColumns `json:"columns"`
+	// Delimiter is the delimiter of values, comma is used if it's not
+	// specified
+	Delimiter string `json:"delimiter"`
+	// DecimalComma is set for numbers like 1.234,56
+	DecimalComma bool `json:"decimalComma"`
+	// DateLayout is the layout of dates as a Go time layout, e.g. 02.01.2006.
+	// Dates in YYYY-MM-DD format are expected if it's not specified.
+	DateLayout string `json:"dateLayout"`
+	// Currency is the currency of transactions if there is no currency
+	// column
+	Currency string `json:"currency"`
+	// SpendingPositive is set for statements with spending as positive
+	// amounts, like statements of credit cards
+	SpendingPositive bool `json:"spendingPositive"`
+}
+
+// CSVColumns are headers of columns of a csv statement. Amounts are either in
+// an amount column with a sign or in debit and credit columns.
+type CSVColumns struct {
+	Date        string `json:"date"`
+	Amount      string `json:"amount"`
+	Debit       string `json:"debit"`
+	Credit      string `json:"credit"`
+	Currency    string `json:"currency"`
+	Reference   string `json:"reference"`
+	Description string `json:"description"`
+}
+
+// ErrMissingColumn is returned when a required column is not in the header
+var ErrMissingColumn = errors.New("csv statement must have a date column and an amount column or debit and credit columns")
+
+// ErrInvalidDelimiter is returned when the delimiter is not a single
+// character
+var ErrInvalidDelimiter = errors.New("delimiter must be a single character")
+
+// ErrInvalidDate is returned when a date doesn't match the layout
+var ErrInvalidDate = errors.New("date doesn't match the date layout")
+
+// fields gets headers of columns by field. Headers default to names of fields.
+func (c CSVColumns) fields() map[string]string {
+	columns := map[string]string{
+		"date":        c.Date,
+		"amount":      c.Amount,
+		"debit":       c.Debit,
+		"credit":      c.Credit,
+		"currency":    c.Currency,
+		"reference":   c.Reference,
+		"description": c.Description,
+	}
+
+	for field, header := range columns {
+		if header == "" {
+			columns[field] = field
+		}
+	}
+
+	return columns
+}
+
+// ParseCSV parses transactions from a csv statement with a header row. Rows
+// are numbered like in spreadsheets, the header is the first row.
+func ParseCSV(r io.Reader, mapping CSVMapping) ([]Transaction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	if mapping.Delimiter != "" {
+		delimiter, size := utf8.DecodeRuneInString(mapping.Delimiter)
+		if size != len(mapping.Delimiter) {
+			return nil, ErrInvalidDelimiter
+		}
+		reader.Comma = delimiter
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrNoTransactions
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheet programs often start files with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	positions := map[string]int{}
+	for i, name := range header {
+		positions[strings.TrimSpace(name)] = i
+	}
+
+	columns := map[string]int{}
+	for field, name := range mapping.Columns.fields() {
+		if i, ok := positions[name]; ok {
+			columns[field] = i
+		}
+	}
+
+	_, hasDate := columns["date"]
+	_, hasAmount := columns["amount"]
+	_, hasDebit := columns["debit"]
+	_, hasCredit := columns["credit"]
+	if !hasDate || (!hasAmount && !(hasDebit && hasCredit)) {
+		return nil, ErrMissingColumn
+	}
+
+	layout := mapping.DateLayout
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	transactions := []Transaction{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		// Empty rows and rows without amounts like balances are skipped
+		if value("amount") == "" && value("debit") == "" && value("credit") == "" {
+			continue
+		}
+
+		transaction := Transaction{
+			Currency:    strings.ToUpper(value("currency")),
+			Reference:   value("reference"),
+			Description: description(value("description")),
+		}
+		if transaction.Currency == "" {
+			transaction.Currency = strings.ToUpper(mapping.Currency)
+		}
+
+		transactionDate, err := time.Parse(layout, value("date"))
+		if err != nil {
+			return nil, &Error{Row: row, Err: ErrInvalidDate}
+		}
+		transaction.Date = date(transactionDate)
+
+		if hasAmount {
+			transaction.Amount, err = parseCSVAmount(value("amount"), mapping.DecimalComma)
+		} else {
+			var debit, credit int64
+			if debit, err = parseCSVAmount(value("debit"), mapping.DecimalComma); err == nil {
+				credit, err = parseCSVAmount(value("credit"), mapping.DecimalComma)
+			}
+			// Debits are written as positive or negative amounts
+			if debit > 0 {
+				debit = -debit
+			}
+			transaction.Amount = credit + debit
+		}
+		if err != nil {
+			return nil, &Error{Row: row, Err: err}
+		}
+
+		if mapping.SpendingPositive {
+			transaction.Amount = -transaction.Amount
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrNoTransactions
+	}
+
+	return transactions, nil
+}
+
+// parseCSVAmount parses an amount with optional thousands separators. Empty
+// amounts are zero.
+func parseCSVAmount(s string, decimalComma bool) (int64, error) {
+	s = strings.Replace(s, " ", "", -1)
+	if s == "" {
+		return 0, nil
+	}
+
+	if decimalComma {
+		s = strings.Replace(strings.Replace(s, ".", "", -1), ",", ".", 1)
+	} else {
+		s = strings.Replace(s, ",", "", -1)
+	}
+
+	return parseAmount(s)
+}
@@ -0,0 +1,116 @@
+package statement
+
+import (
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOFX is returned when a file is not an OFX statement
+var ErrInvalidOFX = errors.New("file is not an ofx statement")
+
+// ofxTransaction is an STMTTRN aggregate with values of its elements
+type ofxTransaction struct {
+	values   map[string]string
+	currency string
+}
+
+// ParseOFX parses transactions from an OFX bank or credit card statement.
+// Both SGML files of version 1 and XML files of version 2 are read since
+// elements are read the same way. Date of a transaction is the date the user
+// made it or the date it was posted.
+func ParseOFX(r io.Reader) ([]Transaction, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return nil, ErrInvalidOFX
+	}
+
+	entries := []ofxTransaction{}
+	var current *ofxTransaction
+	currency := ""
+
+	// Elements of version 1 files are not closed so the value of an element
+	// is the text until the next tag
+	for {
+		start := strings.IndexByte(text, '<')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '>')
+		if end == -1 {
+			break
+		}
+		tag := strings.ToUpper(strings.TrimSpace(text[start+1 : start+end]))
+		text = text[start+end+1:]
+
+		value := text
+		if next := strings.IndexByte(text, '<'); next != -1 {
+			value = text[:next]
+		}
+		value = html.UnescapeString(strings.TrimSpace(value))
+
+		switch {
+		case strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!"):
+		case tag == "STMTTRN":
+			entries = append(entries, ofxTransaction{values: map[string]string{}, currency: currency})
+			current = &entries[len(entries)-1]
+		case tag == "/STMTTRN":
+			current = nil
+		case tag == "CURDEF":
+			currency = value
+		case current != nil && !strings.HasPrefix(tag, "/") && value != "":
+			// The first value of an element is kept, names are either in the
+			// transaction or in its payee aggregate
+			if _, ok := current.values[tag]; !ok {
+				current.values[tag] = value
+			}
+		}
+	}
+
+	transactions := []Transaction{}
+	for i, entry := range entries {
+		amount := entry.values["TRNAMT"]
+		// Some banks write amounts with a decimal comma
+		if !strings.Contains(amount, ".") {
+			amount = strings.Replace(amount, ",", ".", 1)
+		}
+		parsedAmount, err := parseAmount(amount)
+		if err != nil {
+			return nil, &Error{Row: i + 1, Err: err}
+		}
+
+		dateValue := entry.values["DTUSER"]
+		if dateValue == "" {
+			dateValue = entry.values["DTPOSTED"]
+		}
+		if len(dateValue) < 8 {
+			return nil, &Error{Row: i + 1, Err: ErrInvalidOFX}
+		}
+		transactionDate, err := time.Parse("20060102", dateValue[:8])
+		if err != nil {
+			return nil, &Error{Row: i + 1, Err: ErrInvalidOFX}
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:        transactionDate,
+			Amount:      parsedAmount,
+			Currency:    strings.ToUpper(entry.currency),
+			Reference:   entry.values["FITID"],
+			Description: description(entry.values["NAME"], entry.values["MEMO"]),
+		})
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrNoTransactions
+	}
+
+	return transactions, nil
+}
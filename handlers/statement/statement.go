@@ -0,0 +1,100 @@
+// Package statement parses transactions from bank and card statements. CSV
+// files with a mapping of columns, ISO 20022 CAMT.053 XML files and OFX files
+// are supported.
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction is a booked transaction of a statement. Amount is in hundredths
+// of the currency and it's negative for money that left the account.
+type Transaction struct {
+	// Date is the date of the transaction at midnight UTC
+	Date        time.Time
+	Amount      int64
+	Currency    string
+	Reference   string
+	Description string
+}
+
+// ErrInvalidAmount is returned when an amount can't be parsed
+var ErrInvalidAmount = errors.New("amount must be a decimal number")
+
+// ErrNoTransactions is returned when a statement has no transactions
+var ErrNoTransactions = errors.New("statement has no transactions")
+
+// Error is an error of a transaction of a statement. Row is the row of a csv
+// file or the number of the transaction in other formats.
+type Error struct {
+	Row int
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("transaction %d: %v", e.Row, e.Err)
+}
+
+// parseAmount parses a decimal number with a decimal point like "-1234.5"
+// into hundredths. More decimal places are allowed only if they are zeros.
+func parseAmount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, ErrInvalidAmount
+		}
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	if whole == "" {
+		return 0, ErrInvalidAmount
+	}
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidAmount
+		}
+	}
+
+	value, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// description joins parts of a description that are not empty or repeated
+func description(parts ...string) string {
+	joined := []string{}
+	for _, part := range parts {
+		part = strings.Join(strings.Fields(part), " ")
+		repeated := false
+		for _, other := range joined {
+			repeated = repeated || other == part
+		}
+		if part != "" && !repeated {
+			joined = append(joined, part)
+		}
+	}
+	return strings.Join(joined, " ")
+}
+
+// date converts a time to its date at midnight UTC
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,223 @@
+package statement
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestdata opens a file from the testdata directory
+func openTestdata(t *testing.T, name string) io.Reader {
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		file.Close()
+	})
+	return file
+}
+
+// day gets the date of a day in March 2023 at midnight UTC
+func day(d int) time.Time {
+	return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+// cause gets the error of a transaction if the error is of a transaction
+func cause(err error) error {
+	var transactionErr *Error
+	if errors.As(err, &transactionErr) {
+		return transactionErr.Err
+	}
+	return err
+}
+
+// compareTransactions reports differences between parsed and expected
+// transactions
+func compareTransactions(t *testing.T, got []Transaction, want []Transaction) {
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("transaction %d is\n%+v\nwant\n%+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		file    string
+		mapping CSVMapping
+		want    []Transaction
+	}{
+		{"bank.csv", CSVMapping{
+			Columns: CSVColumns{Date: "Date", Amount: "Amount", Currency: "Currency", Reference: "Reference", Description: "Description"},
+		}, []Transaction{
+			{Date: day(14), Amount: -142496, Currency: "RSD", Reference: "TX-1001", Description: "MAXI 105 NOVI SAD"},
+			{Date: day(15), Amount: 12999, Currency: "RSD", Reference: "TX-1002", Description: "Refund Maxi"},
+			{Date: day(16), Amount: -125000, Currency: "EUR", Reference: "TX-1003", Description: "SPAR WIEN"},
+		}},
+		// Card statements have spending as positive amounts
+		{"card.csv", CSVMapping{
+			Columns:          CSVColumns{Date: "Datum", Amount: "Iznos", Description: "Opis"},
+			Delimiter:        ";",
+			DecimalComma:     true,
+			DateLayout:       "02.01.2006",
+			Currency:         "rsd",
+			SpendingPositive: true,
+		}, []Transaction{
+			{Date: day(14), Amount: -142496, Currency: "RSD", Description: "MAXI 105 NOVI SAD"},
+			{Date: day(15), Amount: 12999, Currency: "RSD", Description: "POVRACAJ MAXI"},
+			{Date: day(20), Amount: -249900, Currency: "RSD", Description: "LIDL ZEMUN"},
+		}},
+		// Debits are spending whether they are written with a sign or not
+		{"debit-credit.csv", CSVMapping{
+			Columns:      CSVColumns{Date: "Datum", Debit: "Zaduženje", Credit: "Odobrenje", Reference: "Poziv na broj", Description: "Opis"},
+			Delimiter:    ";",
+			DecimalComma: true,
+			DateLayout:   "02.01.2006",
+			Currency:     "RSD",
+		}, []Transaction{
+			{Date: day(14), Amount: -142496, Currency: "RSD", Reference: "97-1001", Description: "Maxi 105"},
+			{Date: day(15), Amount: 12999, Currency: "RSD", Reference: "97-1002", Description: "Maxi povraćaj"},
+			{Date: day(16), Amount: -45000, Currency: "RSD", Reference: "97-1003", Description: "Idea 0412"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := ParseCSV(openTestdata(t, filepath.Join("csv", test.file)), test.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareTransactions(t, got, test.want)
+		})
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		mapping CSVMapping
+		err     error
+		row     int
+	}{
+		{"empty", "", CSVMapping{}, ErrNoTransactions, 0},
+		{"only balances", "date,amount\n2023-03-14,\n", CSVMapping{}, ErrNoTransactions, 0},
+		{"missing amount", "date,description\n2023-03-14,Maxi\n", CSVMapping{}, ErrMissingColumn, 0},
+		{"missing credit", "date,debit\n2023-03-14,10.00\n", CSVMapping{}, ErrMissingColumn, 0},
+		{"invalid delimiter", "date;amount\n", CSVMapping{Delimiter: ";;"}, ErrInvalidDelimiter, 0},
+		{"invalid date", "date,amount\n2023-03-14,1.00\n14.03.2023,1.00\n", CSVMapping{}, ErrInvalidDate, 3},
+		{"invalid amount", "date,amount\n2023-03-14,1.2.3\n", CSVMapping{}, ErrInvalidAmount, 2},
+		{"fraction of hundredths", "date,amount\n2023-03-14,1.005\n", CSVMapping{}, ErrInvalidAmount, 2},
+		{"decimal point with decimal comma", "date;amount\n2023-03-14;1,2,3\n", CSVMapping{Delimiter: ";", DecimalComma: true}, ErrInvalidAmount, 2},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCSV(strings.NewReader(test.text), test.mapping)
+		if cause(err) != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+
+		var transactionErr *Error
+		if errors.As(err, &transactionErr) != (test.row != 0) || (transactionErr != nil && transactionErr.Row != test.row) {
+			t.Errorf("%s: got error %v, want an error of row %d", test.name, err, test.row)
+		}
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Transaction
+	}{
+		// Pending entries are skipped, entries without a booking date are
+		// dated by their value date
+		{"statement-v2.xml", []Transaction{
+			{Date: day(14), Amount: -142496, Currency: "RSD", Reference: "SVC-1001", Description: "MAXI 105 NOVI SAD"},
+			{Date: day(15), Amount: 12999, Currency: "RSD", Reference: "E2E-1002", Description: "MAXI 105 Povraćaj"},
+		}},
+		// Statuses are codes and parties are nested since version 8
+		{"statement-v8.xml", []Transaction{
+			{Date: day(20), Amount: -1250, Currency: "EUR", Reference: "E-1", Description: "SPAR WIEN Kartenzahlung"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := ParseCAMT053(openTestdata(t, filepath.Join("camt", test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareTransactions(t, got, test.want)
+		})
+	}
+
+	errorTests := []struct {
+		name string
+		text string
+		err  error
+	}{
+		{"not xml", "Date,Amount\n", ErrInvalidCAMT},
+		{"other document", "<Invoice></Invoice>", ErrInvalidCAMT},
+		{"only pending", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1.00</Amt><Sts>PDNG</Sts></Ntry></Stmt></BkToCstmrStmt></Document>`, ErrNoTransactions},
+		{"invalid amount", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1,00</Amt><BookgDt><Dt>2023-03-14</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>`, ErrInvalidAmount},
+		{"without dates", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1.00</Amt></Ntry></Stmt></BkToCstmrStmt></Document>`, ErrInvalidCAMT},
+	}
+	for _, test := range errorTests {
+		if _, err := ParseCAMT053(strings.NewReader(test.text)); cause(err) != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Transaction
+	}{
+		// Elements of version 1 are not closed, amounts can have a decimal
+		// comma and names can be in the payee aggregate
+		{"statement-v1.ofx", []Transaction{
+			{Date: day(14), Amount: -142496, Currency: "RSD", Reference: "OFX-1001", Description: "MAXI 105 NOVI SAD"},
+			{Date: day(15), Amount: 12999, Currency: "RSD", Reference: "OFX-1002", Description: "Maxi & Co"},
+		}},
+		{"statement-v2.ofx", []Transaction{
+			{Date: day(20), Amount: -1250, Currency: "EUR", Reference: "CC-1", Description: "SPAR WIEN"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			got, err := ParseOFX(openTestdata(t, filepath.Join("ofx", test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareTransactions(t, got, test.want)
+		})
+	}
+
+	errorTests := []struct {
+		name string
+		text string
+		err  error
+	}{
+		{"not ofx", "<Document></Document>", ErrInvalidOFX},
+		{"without transactions", "<OFX><CURDEF>RSD</OFX>", ErrNoTransactions},
+		{"invalid amount", "<OFX><STMTTRN><DTPOSTED>20230314<TRNAMT>1.2.3</STMTTRN></OFX>", ErrInvalidAmount},
+		{"invalid date", "<OFX><STMTTRN><DTPOSTED>2023-03<TRNAMT>1.00</STMTTRN></OFX>", ErrInvalidOFX},
+	}
+	for _, test := range errorTests {
+		if _, err := ParseOFX(strings.NewReader(test.text)); cause(err) != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
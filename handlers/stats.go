@@ -0,0 +1,585 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+)
+
+// StatsGetQuery : Structure that should be used for getting query data on get request for statistics
+type StatsGetQuery struct {
+	HouseholdID string `form:"householdId"`
+	// Currency in which totals are calculated. Default currency of the user
+	// is used if it's not specified.
+	Currency string `form:"currency" validate:"omitempty,currency"`
+	// From and To limit receipts to dates of purchase in YYYY-MM-DD format.
+	// Dates are in the time zone of the user.
+	From string `form:"from"`
+	To   string `form:"to"`
+	// Interval groups statistics into periods by the date of purchase
+	Interval string `form:"interval" validate:"omitempty,oneof=day week month year"`
+}
+
+// LocationStats : Structure that should be used for sending spending statistics of a location
+type LocationStats struct {
+	PublicID string `json:"id"`
+	Name     string `json:"name"`
+	Receipts int    `json:"receipts"`
+	Refunds  int    `json:"refunds"`
+	Total    Money  `json:"total"`
+	Refunded Money  `json:"refunded"`
+	Saved    Money  `json:"saved"`
+}
+
+// Stats : Structure that should be used for sending spending statistics
+type Stats struct {
+	Currency string `json:"currency"`
+	Receipts int    `json:"receipts"`
+	// Refunds are counted in the period they happened in and Total is the
+	// total after refunds
+	Refunds  int   `json:"refunds"`
+	Total    Money `json:"total"`
+	Refunded Money `json:"refunded"`
+	// Saved is the sum of line and receipt discounts
+	Saved     Money           `json:"saved"`
+	Locations []LocationStats `json:"locations"`
+	// Periods are only grouped if an interval is specified
+	Periods []PeriodStats `json:"periods,omitempty"`
+}
+
+// PeriodStats : Structure that should be used for sending spending statistics of a day, week, month or year
+type PeriodStats struct {
+	// Period is a date, an ISO week like 2024-W09, a month like 2024-03 or a
+	// year
+	Period   string `json:"period"`
+	Receipts int    `json:"receipts"`
+	Refunds  int    `json:"refunds"`
+	Total    Money  `json:"total"`
+	Refunded Money  `json:"refunded"`
+	Saved    Money  `json:"saved"`
+}
+
+// TaxReport : Structure that should be used for sending net, tax and gross amounts of receipts in a period grouped by tax rate
+type TaxReport struct {
+	Currency string         `json:"currency"`
+	From     string         `json:"from,omitempty"`
+	To       string         `json:"to,omitempty"`
+	Taxes    []TaxBreakdown `json:"taxes"`
+	Net      Money          `json:"net"`
+	Tax      Money          `json:"tax"`
+	Gross    Money          `json:"gross"`
+}
+
+// PaymentMethodStats : Structure that should be used for sending spending statistics of a payment method
+type PaymentMethodStats struct {
+	PublicID string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Receipts int    `json:"receipts"`
+	Total    Money  `json:"total"`
+}
+
+// PaymentStats : Structure that should be used for sending spending statistics grouped by payment method
+type PaymentStats struct {
+	Currency string               `json:"currency"`
+	Methods  []PaymentMethodStats `json:"methods"`
+	// Unassigned is the total of receipts without payments
+	Unassigned Money `json:"unassigned"`
+}
+
+// receiptTotal : Structure that should be used for getting totals of receipts from database
+type receiptTotal struct {
+	LocationID   string    `db:"location_id"`
+	LocationName string    `db:"location_name"`
+	Currency     string    `db:"currency"`
+	PurchasedAt  time.Time `db:"purchased_at"`
+	TimeZone     string    `db:"time_zone"`
+	TotalPrice   Money     `db:"total_price"`
+	Saved        Money     `db:"saved"`
+	RefundOf     *int      `db:"refund_of"`
+}
+
+// validDates checks if from and to dates are in YYYY-MM-DD format
+func (q StatsGetQuery) validDates() bool {
+	for _, date := range []string{q.From, q.To} {
+		if _, err := time.Parse(rateDateLayout, date); date != "" && err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// currency gets the currency of statistics. Default currency of the account is
+// used if it's not specified.
+func (q StatsGetQuery) currency(account Account) string {
+	if currency := normalizeCurrency(q.Currency); currency != "" {
+		return currency
+	}
+	return account.Currency
+}
+
+// accountLocation gets the time zone of dates of statistics. Time zone of
+// the account is used and UTC if it can't be loaded.
+func accountLocation(account Account) *time.Location {
+	location, err := loadTimeZone(account.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// filter limits a query of receipts to the household and the period of the
+// search query. Days of the period start at midnight in the time zone.
+func (q StatsGetQuery) filter(query sq.SelectBuilder, location *time.Location) sq.SelectBuilder {
+	if q.HouseholdID != "" {
+		query = query.Where(sq.Eq{"households.public_id": q.HouseholdID})
+	}
+	if from, err := time.ParseInLocation(rateDateLayout, q.From, location); err == nil {
+		query = query.Where("datetime(receipts.purchased_at) >= ?", from.UTC().Format(sqlTimeLayout))
+	}
+	if to, err := time.ParseInLocation(rateDateLayout, q.To, location); err == nil {
+		query = query.Where("datetime(receipts.purchased_at) < ?", to.AddDate(0, 0, 1).UTC().Format(sqlTimeLayout))
+	}
+	return query
+}
+
+// period gets the period of the interval that the time is in
+func (q StatsGetQuery) period(t time.Time) string {
+	switch q.Interval {
+	case "day":
+		return t.Format(rateDateLayout)
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006")
+	}
+}
+
+// spendingStats calculates spending statistics of receipts of the account.
+// Totals of receipts in other currencies are converted using the exchange
+// rate on the date of the receipt.
+func (o Options) spendingStats(account Account, searchQuery StatsGetQuery) (*Stats, error) {
+	currency := searchQuery.currency(account)
+	location := accountLocation(account)
+
+	query := sq.Select("locations.public_id AS location_id, locations.name AS location_name, receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, " + ReceiptTotalSQL + " AS total_price, " + ReceiptSavedSQL + " AS saved, receipts.refund_of").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(MemberOf("receipts.household_id", account.ID)).Where(NotDeleted("receipts"))
+	query = searchQuery.filter(query, location)
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := []receiptTotal{}
+	if err := o.DB.Select(&totals, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	converter := NewCurrencyConverter(o.DB, o.RateProvider)
+	stats := Stats{
+		Currency:  currency,
+		Locations: []LocationStats{},
+	}
+	locations := map[string]int{}
+	periods := map[string]int{}
+
+	for _, receipt := range totals {
+		total, err := converter.Convert(receipt.TotalPrice, receipt.Currency, currency, inTimeZone(receipt.PurchasedAt, receipt.TimeZone))
+		if err != nil {
+			return nil, err
+		}
+
+		saved, err := converter.Convert(receipt.Saved, receipt.Currency, currency, inTimeZone(receipt.PurchasedAt, receipt.TimeZone))
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Total += total
+		stats.Saved += saved
+
+		i, ok := locations[receipt.LocationID]
+		if !ok {
+			i = len(stats.Locations)
+			locations[receipt.LocationID] = i
+			stats.Locations = append(stats.Locations, LocationStats{
+				PublicID: receipt.LocationID,
+				Name:     receipt.LocationName,
+			})
+		}
+		stats.Locations[i].Total += total
+		stats.Locations[i].Saved += saved
+
+		if receipt.RefundOf != nil {
+			stats.Refunds++
+			stats.Refunded -= total
+			stats.Locations[i].Refunds++
+			stats.Locations[i].Refunded -= total
+		} else {
+			stats.Receipts++
+			stats.Locations[i].Receipts++
+		}
+
+		if searchQuery.Interval == "" {
+			continue
+		}
+
+		period := searchQuery.period(receipt.PurchasedAt.In(location))
+		p, ok := periods[period]
+		if !ok {
+			p = len(stats.Periods)
+			periods[period] = p
+			stats.Periods = append(stats.Periods, PeriodStats{
+				Period: period,
+			})
+		}
+		stats.Periods[p].Total += total
+		stats.Periods[p].Saved += saved
+		if receipt.RefundOf != nil {
+			stats.Periods[p].Refunds++
+			stats.Periods[p].Refunded -= total
+		} else {
+			stats.Periods[p].Receipts++
+		}
+	}
+
+	// Locations with the most spent first
+	sort.SliceStable(stats.Locations, func(i, j int) bool {
+		return stats.Locations[i].Total > stats.Locations[j].Total
+	})
+
+	// Periods in chronological order
+	sort.Slice(stats.Periods, func(i, j int) bool {
+		return stats.Periods[i].Period < stats.Periods[j].Period
+	})
+
+	return &stats, nil
+}
+
+// taxReport calculates net, tax and gross amounts of receipts of the account
+// grouped by tax rate. Tax is calculated for each receipt and converted using
+// the exchange rate on the date of the receipt.
+func (o Options) taxReport(account Account, searchQuery StatsGetQuery) (*TaxReport, error) {
+	currency := searchQuery.currency(account)
+	location := accountLocation(account)
+
+	query := receiptTaxesQuery().Join("households ON households.id = receipts.household_id").Where(MemberOf("receipts.household_id", account.ID)).Where(NotDeleted("receipts"))
+	query = searchQuery.filter(query, location)
+
+	queryString, queryStringArgs, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []receiptTaxRow{}
+	if err := o.DB.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	receipts := map[string]receiptTaxRow{}
+	for _, row := range rows {
+		receipts[row.ReceiptID] = row
+	}
+
+	converter := NewCurrencyConverter(o.DB, o.RateProvider)
+	report := TaxReport{
+		Currency: currency,
+		From:     searchQuery.From,
+		To:       searchQuery.To,
+		Taxes:    []TaxBreakdown{},
+	}
+	rates := map[TaxBreakdown]int{}
+
+	for receiptID, breakdowns := range groupReceiptTaxes(rows) {
+		receipt := receipts[receiptID]
+
+		for _, breakdown := range breakdowns {
+			gross, err := converter.Convert(breakdown.Gross, receipt.Currency, currency, inTimeZone(receipt.PurchasedAt, receipt.TimeZone))
+			if err != nil {
+				return nil, err
+			}
+			tax, err := converter.Convert(breakdown.Tax, receipt.Currency, currency, inTimeZone(receipt.PurchasedAt, receipt.TimeZone))
+			if err != nil {
+				return nil, err
+			}
+
+			key := TaxBreakdown{Label: breakdown.Label, Rate: breakdown.Rate}
+			i, ok := rates[key]
+			if !ok {
+				i = len(report.Taxes)
+				rates[key] = i
+				report.Taxes = append(report.Taxes, key)
+			}
+			report.Taxes[i].Gross += gross
+			report.Taxes[i].Tax += tax
+			report.Taxes[i].Net += gross - tax
+
+			report.Gross += gross
+			report.Tax += tax
+			report.Net += gross - tax
+		}
+	}
+
+	sortTaxBreakdowns(report.Taxes)
+
+	return &report, nil
+}
+
+// GetStats is a Gin handler function for getting spending statistics of
+// receipts. Totals of receipts in other currencies are converted using the
+// exchange rate on the date of the receipt.
+func (o Options) GetStats() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery StatsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if !searchQuery.validDates() {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "dates must be in YYYY-MM-DD format",
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		stats, err := o.spendingStats(account, searchQuery)
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, stats)
+	}
+}
+
+// GetTaxReport is a Gin handler function for getting net, tax and gross
+// amounts of receipts in a period grouped by tax rate. Tax is calculated for
+// each receipt and converted to the currency of the report using the
+// exchange rate on the date of the receipt.
+func (o Options) GetTaxReport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery StatsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if !searchQuery.validDates() {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "dates must be in YYYY-MM-DD format",
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		report, err := o.taxReport(account, searchQuery)
+		if err != nil {
+			ctx.JSON(conversionErrorStatus(err), gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, report)
+	}
+}
+
+// GetPaymentStats is a Gin handler function for getting spending statistics
+// grouped by payment method. Payments in other currencies are converted using
+// the exchange rate on the date of the receipt.
+func (o Options) GetPaymentStats() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery StatsGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if !searchQuery.validDates() {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "dates must be in YYYY-MM-DD format",
+			})
+			return
+		}
+
+		account, err := GetAccount(o.DB, createdBy.PublicID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		currency := searchQuery.currency(account)
+		location := accountLocation(account)
+
+		query := sq.Select("payment_methods.public_id AS method_id, payment_methods.name, payment_methods.type, receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, receipt_payments.amount").From("receipt_payments").Join("payment_methods ON payment_methods.id = receipt_payments.payment_method_id").Join("receipts ON receipts.id = receipt_payments.receipt_id").Join("households ON households.id = receipts.household_id").Where(MemberOf("receipts.household_id", account.ID)).Where(NotDeleted("receipts"))
+		query = searchQuery.filter(query, location)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		payments := []struct {
+			MethodID    string    `db:"method_id"`
+			Name        string    `db:"name"`
+			Type        string    `db:"type"`
+			Currency    string    `db:"currency"`
+			PurchasedAt time.Time `db:"purchased_at"`
+			TimeZone    string    `db:"time_zone"`
+			Amount      Money     `db:"amount"`
+		}{}
+		if err := o.DB.Select(&payments, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		unassignedQuery := sq.Select("receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, " + ReceiptTotalSQL + " AS total_price").From("receipts").Join("households ON households.id = receipts.household_id").LeftJoin("items_in_receipt ON items_in_receipt.receipt_id = receipts.id").LeftJoin("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id").Where(MemberOf("receipts.household_id", account.ID)).Where(NotDeleted("receipts")).Where("receipts.id NOT IN (SELECT receipt_id FROM receipt_payments)")
+		unassignedQuery = searchQuery.filter(unassignedQuery, location)
+
+		unassignedQueryString, unassignedQueryStringArgs, err := unassignedQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		unassigned := []receiptTotal{}
+		if err := o.DB.Select(&unassigned, unassignedQueryString, unassignedQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		converter := NewCurrencyConverter(o.DB, o.RateProvider)
+		stats := PaymentStats{
+			Currency: currency,
+			Methods:  []PaymentMethodStats{},
+		}
+		methods := map[string]int{}
+
+		for _, payment := range payments {
+			amount, err := converter.Convert(payment.Amount, payment.Currency, currency, inTimeZone(payment.PurchasedAt, payment.TimeZone))
+			if err != nil {
+				ctx.JSON(conversionErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			i, ok := methods[payment.MethodID]
+			if !ok {
+				i = len(stats.Methods)
+				methods[payment.MethodID] = i
+				stats.Methods = append(stats.Methods, PaymentMethodStats{
+					PublicID: payment.MethodID,
+					Name:     payment.Name,
+					Type:     payment.Type,
+				})
+			}
+			stats.Methods[i].Receipts++
+			stats.Methods[i].Total += amount
+		}
+
+		for _, receipt := range unassigned {
+			total, err := converter.Convert(receipt.TotalPrice, receipt.Currency, currency, inTimeZone(receipt.PurchasedAt, receipt.TimeZone))
+			if err != nil {
+				ctx.JSON(conversionErrorStatus(err), gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			stats.Unassigned += total
+		}
+
+		// Payment methods with the most spent first
+		sort.SliceStable(stats.Methods, func(i, j int) bool {
+			return stats.Methods[i].Total > stats.Methods[j].Total
+		})
+
+		ctx.JSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsPeriod(t *testing.T) {
+	// 2021-01-03 is a Sunday in the last ISO week of 2020
+	date := time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]string{
+		"day":   "2021-01-03",
+		"week":  "2020-W53",
+		"month": "2021-01",
+		"year":  "2021",
+	}
+	for interval, want := range tests {
+		if got := (StatsGetQuery{Interval: interval}).period(date); got != want {
+			t.Errorf("%s: got %s, want %s", interval, got, want)
+		}
+	}
+}
+
+func TestStatsPeriodsInTimeZone(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 100, 'l')", household.UserID, household.HouseholdID)
+
+	// Summer time in Belgrade starts on 2020-03-29 at 02:00 so days before
+	// and after the change start at 23:00 and 22:00 UTC
+	purchases := []string{
+		"2020-03-28 22:59:59",
+		"2020-03-28 23:00:00",
+		"2020-03-29 21:59:59",
+		"2020-03-29 22:00:00",
+	}
+	for i, purchasedAt := range purchases {
+		receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, ?, ?, 'UTC')", household.LocationID, household.HouseholdID, household.UserID, purchasedAt, purchasedAt)
+		db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, ?, ?)", receipt, item, purchasedAt, i+1)
+	}
+
+	stats := func(query string) Stats {
+		recorder := serve(options.GetStats(), "/stats", "user", http.MethodGet, "/stats"+query, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", query, recorder.Code, recorder.Body)
+		}
+		stats := Stats{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	want := []PeriodStats{
+		{Period: "2020-03-28", Receipts: 1, Total: 100},
+		{Period: "2020-03-29", Receipts: 2, Total: 500},
+		{Period: "2020-03-30", Receipts: 1, Total: 400},
+	}
+	if got := stats("?interval=day").Periods; !reflect.DeepEqual(got, want) {
+		t.Errorf("days are %+v, want %+v", got, want)
+	}
+
+	// Dates of the period are in the time zone of the user too
+	if got := stats("?from=2020-03-29&to=2020-03-29"); got.Receipts != 2 || got.Total != 500 {
+		t.Errorf("2020-03-29 has %d receipts with total %d, want 2 with total 500", got.Receipts, got.Total)
+	}
+
+	db.MustExec("UPDATE users SET time_zone = 'UTC' WHERE id = ?", household.UserID)
+	want = []PeriodStats{
+		{Period: "2020-03-28", Receipts: 2, Total: 300},
+		{Period: "2020-03-29", Receipts: 2, Total: 700},
+	}
+	if got := stats("?interval=day").Periods; !reflect.DeepEqual(got, want) {
+		t.Errorf("days in UTC are %+v, want %+v", got, want)
+	}
+}
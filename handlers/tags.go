@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxItemTags is the number of tags an item can have
+const maxItemTags = 20
+
+// ErrTooManyTags is returned when an item would have more than maxItemTags
+// tags
+var ErrTooManyTags = fmt.Errorf("item can't have more than %d tags", maxItemTags)
+
+// normalizeLabel trims a category or a tag. Empty labels are stored as none.
+func normalizeLabel(label string) *string {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return nil
+	}
+	return &label
+}
+
+// normalizeTags trims tags and removes empty tags and duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > maxItemTags {
+		return nil, ErrTooManyTags
+	}
+
+	return normalized, nil
+}
+
+// ItemTags gets tags of items by public ids of items
+func ItemTags(db *sqlx.DB, itemIDs []string) (map[string][]string, error) {
+	tags := map[string][]string{}
+	if len(itemIDs) == 0 {
+		return tags, nil
+	}
+
+	queryString, queryStringArgs, err := sq.Select("items.public_id AS item_id, item_tags.tag").From("item_tags").Join("items ON items.id = item_tags.item_id").Where(sq.Eq{"items.public_id": itemIDs}).OrderBy("item_tags.id").ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		ItemID string `db:"item_id"`
+		Tag    string `db:"tag"`
+	}{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		tags[row.ItemID] = append(tags[row.ItemID], row.Tag)
+	}
+
+	return tags, nil
+}
+
+// insertTags adds tags to an item in the transaction
+func insertTags(tx *sql.Tx, itemID int64, householdID int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO item_tags (item_id, household_id, tag) VALUES (?, ?, ?)", itemID, householdID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Percentage is a percentage in hundredths of a percent. It's written in JSON
+// as a decimal number with two decimal places, e.g. 20.00 for 20%.
+type Percentage int64
+
+// ErrInvalidPercentage is returned when a percentage can't be parsed
+var ErrInvalidPercentage = errors.New("percentage must be a decimal number with at most 2 decimal places")
+
+// ErrUnknownTaxLabel is returned when there is no tax rate with the label
+var ErrUnknownTaxLabel = errors.New("tax rate with specified label does not exist")
+
+// MarshalJSON writes percentage as a JSON number
+func (p Percentage) MarshalJSON() ([]byte, error) {
+	return []byte(formatHundredths(int64(p))), nil
+}
+
+// UnmarshalJSON reads percentage from a JSON number or a string with a number
+func (p *Percentage) UnmarshalJSON(data []byte) error {
+	value, ok := parseHundredths(strings.Trim(string(data), `"`))
+	if !ok {
+		return ErrInvalidPercentage
+	}
+
+	*p = Percentage(value)
+	return nil
+}
+
+// Float64 converts percentage to a number of percents. It should only be used
+// for presenting percentages.
+func (p Percentage) Float64() float64 {
+	return float64(p) / 100
+}
+
+// TaxRatesGetQuery : Structure that should be used for getting query parameters of a get request for tax rates
+type TaxRatesGetQuery struct {
+	HouseholdID string `form:"householdId"`
+}
+
+// TaxRatesPostBody : Structure that should be used for getting json from body of a post request for tax rates
+type TaxRatesPostBody struct {
+	Label string      `json:"label" validate:"required"`
+	Name  string      `json:"name"`
+	Rate  *Percentage `json:"rate" validate:"required,min=0"`
+}
+
+// TaxRatesPutBody : Structure that should be used for getting json from body of a put request for tax rates
+type TaxRatesPutBody struct {
+	PublicID string      `json:"id" validate:"required"`
+	Label    string      `json:"label"`
+	Name     string      `json:"name"`
+	Rate     *Percentage `json:"rate" validate:"omitempty,min=0"`
+}
+
+// TaxRatesDeleteBody : Structure that should be used for getting json data from body of a delete request for tax rates
+type TaxRatesDeleteBody struct {
+	PublicID string `json:"id" validate:"required"`
+}
+
+// TaxRate : Structure that should be used for getting tax rate information from database
+type TaxRate struct {
+	PublicID string `db:"public_id" json:"id"`
+	// Country is set for rates that are defined for a country instead of by
+	// the user
+	Country *string    `db:"country" json:"country"`
+	Label   string     `db:"label" json:"label"`
+	Name    string     `db:"name" json:"name"`
+	Rate    Percentage `db:"rate" json:"rate"`
+}
+
+// TaxBreakdown : Structure that should be used for sending net, tax and gross amounts of lines with the same tax rate. Lines without a tax label are sent with an empty label and no tax.
+type TaxBreakdown struct {
+	Label string     `db:"tax_label" json:"label"`
+	Rate  Percentage `db:"tax_rate" json:"rate"`
+	Net   Money      `db:"-" json:"net"`
+	Tax   Money      `db:"-" json:"tax"`
+	Gross Money      `db:"gross" json:"gross"`
+}
+
+// calculate calculates net and tax amounts from the gross amount. Prices on
+// receipts include tax so tax is the part of the gross amount that matches
+// the rate, rounded half away from zero.
+func (b *TaxBreakdown) calculate() {
+	b.Tax = Money(math.Round(float64(b.Gross) * float64(b.Rate) / float64(10000+b.Rate)))
+	b.Net = b.Gross - b.Tax
+}
+
+// sortTaxBreakdowns sorts breakdowns from the highest rate to the lowest
+func sortTaxBreakdowns(breakdowns []TaxBreakdown) {
+	sort.SliceStable(breakdowns, func(i, j int) bool {
+		if breakdowns[i].Rate != breakdowns[j].Rate {
+			return breakdowns[i].Rate > breakdowns[j].Rate
+		}
+		return breakdowns[i].Label < breakdowns[j].Label
+	})
+}
+
+// userTaxRates creates a condition that matches tax rates available to the
+// user. Rates defined by the user replace rates of the user's country with
+// the same label.
+func userTaxRates(userID int) sq.Sqlizer {
+	return sq.Or{
+		sq.Eq{"tax_rates.user_id": userID},
+		sq.Expr("tax_rates.country = (SELECT country FROM users WHERE id = ?) AND tax_rates.label NOT IN (SELECT label FROM tax_rates WHERE user_id = ?)", userID, userID),
+	}
+}
+
+// householdTaxRates creates a condition that matches tax rates used for
+// receipts of the household. Households use the rates of the user who created
+// them so lines get the same rate no matter which member adds them.
+func householdTaxRates(householdID int) sq.Sqlizer {
+	return sq.Or{
+		sq.Expr("tax_rates.user_id = (SELECT created_by FROM households WHERE id = ?)", householdID),
+		sq.Expr("tax_rates.country = (SELECT users.country FROM households JOIN users ON users.id = households.created_by WHERE households.id = ?) AND tax_rates.label NOT IN (SELECT label FROM tax_rates WHERE user_id = (SELECT created_by FROM households WHERE id = ?))", householdID, householdID),
+	}
+}
+
+// resolveTaxRate gets the rate of the tax with the label that is used for
+// receipts of the household
+func resolveTaxRate(db *sqlx.DB, householdID int, label string) (Percentage, error) {
+	queryString, queryStringArgs, err := sq.Select("rate").From("tax_rates").Where(sq.Eq{"label": label}).Where(householdTaxRates(householdID)).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var rate Percentage
+	if err := db.Get(&rate, queryString, queryStringArgs...); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrUnknownTaxLabel
+		}
+		return 0, err
+	}
+
+	return rate, nil
+}
+
+// receiptTaxRow : Structure that should be used for getting gross amounts of receipt lines grouped by tax rate from database
+type receiptTaxRow struct {
+	ReceiptID     string    `db:"receipt_id"`
+	Currency      string    `db:"currency"`
+	PurchasedAt   time.Time `db:"purchased_at"`
+	TimeZone      string    `db:"time_zone"`
+	DiscountType  *string   `db:"discount_type"`
+	DiscountValue *int64    `db:"discount_value"`
+	TaxBreakdown
+}
+
+// receiptTaxesQuery creates a query of gross amounts of receipt lines grouped
+// by receipt and tax rate
+func receiptTaxesQuery() sq.SelectBuilder {
+	return sq.Select("receipts.public_id AS receipt_id, receipts.currency, receipts.purchased_at, COALESCE(receipts.time_zone, '') AS time_zone, receipts.discount_type, receipts.discount_value, COALESCE(items_in_receipt.tax_label, '') AS tax_label, COALESCE(items_in_receipt.tax_rate, 0) AS tax_rate, SUM("+LineTotalSQL+") AS gross").From("items_in_receipt").Join("receipts ON receipts.id = items_in_receipt.receipt_id").Join("items ON items.id = items_in_receipt.item_id").GroupBy("receipts.id", "tax_label", "tax_rate")
+}
+
+// groupReceiptTaxes groups rows by receipt, subtracts discounts of receipts
+// and calculates tax
+func groupReceiptTaxes(rows []receiptTaxRow) map[string][]TaxBreakdown {
+	taxes := map[string][]TaxBreakdown{}
+	discounts := map[string]*Discount{}
+
+	for _, row := range rows {
+		taxes[row.ReceiptID] = append(taxes[row.ReceiptID], row.TaxBreakdown)
+		discounts[row.ReceiptID] = NewDiscount(row.DiscountType, row.DiscountValue)
+	}
+
+	for receiptID, breakdowns := range taxes {
+		sortTaxBreakdowns(breakdowns)
+		applyReceiptDiscount(breakdowns, discounts[receiptID])
+		for i := range breakdowns {
+			breakdowns[i].calculate()
+		}
+	}
+
+	return taxes
+}
+
+// applyReceiptDiscount subtracts the discount of a receipt from gross amounts
+// of its breakdowns so gross amounts add up to the total of the receipt.
+func applyReceiptDiscount(breakdowns []TaxBreakdown, discount *Discount) {
+	amounts := make([]Money, len(breakdowns))
+	for i, breakdown := range breakdowns {
+		amounts[i] = breakdown.Gross
+	}
+
+	for i, share := range splitDiscount(amounts, discount) {
+		breakdowns[i].Gross -= share
+	}
+}
+
+// ReceiptTaxes gets tax breakdowns of receipts with specified ids
+func ReceiptTaxes(db *sqlx.DB, receiptIDs []string) (map[string][]TaxBreakdown, error) {
+	if len(receiptIDs) == 0 {
+		return map[string][]TaxBreakdown{}, nil
+	}
+
+	queryString, queryStringArgs, err := receiptTaxesQuery().Where(sq.Eq{"receipts.public_id": receiptIDs}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []receiptTaxRow{}
+	if err := db.Select(&rows, queryString, queryStringArgs...); err != nil {
+		return nil, err
+	}
+
+	return groupReceiptTaxes(rows), nil
+}
+
+// GetTaxRates is a Gin handler function for getting tax rates available to
+// the user. If a household is specified, rates used for its receipts are sent
+// instead.
+func (o Options) GetTaxRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery TaxRatesGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		rates := userTaxRates(user.ID)
+		if searchQuery.HouseholdID != "" {
+			householdID, _, err := householdRole(o.DB, user.ID, searchQuery.HouseholdID)
+			if err != nil {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "not authorized to get tax rates of specified household",
+				})
+				return
+			}
+			rates = householdTaxRates(householdID)
+		}
+
+		query := sq.Select("public_id, country, label, name, rate").From("tax_rates").Where(rates).OrderBy("rate DESC", "label")
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		taxRates := []TaxRate{}
+		if err := o.DB.Select(&taxRates, queryString, queryStringArgs...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, taxRates)
+	}
+}
+
+// PostTaxRates is a Gin handler function for adding a tax rate of the user.
+func (o Options) PostTaxRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var rateData TaxRatesPostBody
+		if err := ctx.ShouldBindJSON(&rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		uuid, err := nanoid.Nanoid()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Insert("tax_rates").Columns("public_id", "user_id", "label", "name", "rate").Values(uuid, user.ID, strings.TrimSpace(rateData.Label), rateData.Name, *rateData.Rate)
+
+		queryString, queryStringArgs, err := query.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if _, err := o.DB.Exec(queryString, queryStringArgs...); err != nil {
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "tax rate with the same label already exists",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"id": uuid,
+		})
+	}
+}
+
+// PutTaxRates is a Gin handler function for updating a tax rate of the user.
+// Rates of receipt lines that were already added don't change.
+func (o Options) PutTaxRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var rateData TaxRatesPutBody
+		if err := ctx.ShouldBindJSON(&rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		query := sq.Update("tax_rates").Set("updated_at", sq.Expr("current_timestamp"))
+
+		if rateData.Label != "" {
+			query = query.Set("label", strings.TrimSpace(rateData.Label))
+		}
+		if rateData.Name != "" {
+			query = query.Set("name", rateData.Name)
+		}
+		if rateData.Rate != nil {
+			query = query.Set("rate", *rateData.Rate)
+		}
+
+		// Only rates defined by the user can be changed
+		queryString, queryStringArgs, err := query.Where(sq.Eq{"public_id": rateData.PublicID, "user_id": user.ID}).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			if isUniqueConstraintError(err) {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "tax rate with the same label already exists",
+				})
+				return
+			}
+
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to update specified tax rate",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteTaxRates is a Gin handler function for deleting a tax rate of the
+// user. Receipt lines keep their labels and rates.
+func (o Options) DeleteTaxRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var rateData TaxRatesDeleteBody
+		if err := ctx.ShouldBindJSON(&rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(rateData); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		queryString, queryStringArgs, err := sq.Delete("tax_rates").Where(sq.Eq{"public_id": rateData.PublicID, "user_id": user.ID}).ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result, err := o.DB.Exec(queryString, queryStringArgs...)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to delete specified tax rate",
+			})
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// taxRateErrorStatus gets the response status for errors of resolving tax
+// rates
+func taxRateErrorStatus(err error) int {
+	if err == ErrUnknownTaxLabel {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestTaxRates(t *testing.T) {
+	db := newTestDB(t)
+	newTestHousehold(t, db, "user")
+	newTestHousehold(t, db, "other")
+	db.MustExec("INSERT INTO tax_rates (public_id, user_id, label, rate) VALUES ('others-rate', (SELECT id FROM users WHERE public_id = 'other'), 'O', 500)")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	invalid := map[string]string{
+		"missing label":            `{"rate": 20}`,
+		"missing rate":             `{"label": "X"}`,
+		"negative rate":            `{"label": "X", "rate": -1}`,
+		"too many decimals":        `{"label": "X", "rate": 1.234}`,
+		"rate that isn't a number": `{"label": "X", "rate": "twenty"}`,
+	}
+	for name, body := range invalid {
+		if recorder := serve(options.PostTaxRates(), "/tax-rates", "user", http.MethodPost, "/tax-rates", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want %d", name, recorder.Code, recorder.Body, http.StatusBadRequest)
+		}
+	}
+
+	post := func(body string) string {
+		recorder := serve(options.PostTaxRates(), "/tax-rates", "user", http.MethodPost, "/tax-rates", body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("adding %s: got %d %s", body, recorder.Code, recorder.Body)
+		}
+		var response struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.ID
+	}
+
+	// Rates of the user replace rates of the country with the same label
+	general := post(`{"label": "Ђ", "name": "General", "rate": "19.5"}`)
+	reduced := post(`{"label": "R", "rate": 8}`)
+
+	if recorder := serve(options.PostTaxRates(), "/tax-rates", "user", http.MethodPost, "/tax-rates", `{"label": " R ", "rate": 9}`); recorder.Code != http.StatusConflict {
+		t.Errorf("adding a rate with an existing label: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusConflict)
+	}
+
+	rates := func() map[string]Percentage {
+		recorder := serve(options.GetTaxRates(), "/tax-rates", "user", http.MethodGet, "/tax-rates", "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("getting rates: got %d %s", recorder.Code, recorder.Body)
+		}
+		response := []TaxRate{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		rates := map[string]Percentage{}
+		for _, rate := range response {
+			rates[rate.Label] = rate.Rate
+		}
+		return rates
+	}
+	if got, want := rates(), map[string]Percentage{"Ђ": 1950, "Е": 1000, "А": 0, "R": 800}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rates are %v, want %v", got, want)
+	}
+
+	updates := []struct {
+		body string
+		want int
+	}{
+		{`{"id": "` + reduced + `", "rate": 7}`, http.StatusOK},
+		{`{"id": "` + reduced + `", "rate": -7}`, http.StatusBadRequest},
+		{`{"id": "` + reduced + `", "label": "Ђ"}`, http.StatusConflict},
+		{`{"id": "others-rate", "rate": 7}`, http.StatusUnauthorized},
+		{`{"id": "rs-vat-special", "rate": 7}`, http.StatusUnauthorized},
+		{`{"rate": 7}`, http.StatusBadRequest},
+	}
+	for _, update := range updates {
+		if recorder := serve(options.PutTaxRates(), "/tax-rates", "user", http.MethodPut, "/tax-rates", update.body); recorder.Code != update.want {
+			t.Errorf("updating %s: got %d %s, want %d", update.body, recorder.Code, recorder.Body, update.want)
+		}
+	}
+
+	deletes := []struct {
+		body string
+		want int
+	}{
+		{`{"id": "others-rate"}`, http.StatusUnauthorized},
+		{`{"id": "rs-vat-general"}`, http.StatusUnauthorized},
+		{`{}`, http.StatusBadRequest},
+		{`{"id": "` + general + `"}`, http.StatusOK},
+	}
+	for _, deletion := range deletes {
+		if recorder := serve(options.DeleteTaxRates(), "/tax-rates", "user", http.MethodDelete, "/tax-rates", deletion.body); recorder.Code != deletion.want {
+			t.Errorf("deleting %s: got %d %s, want %d", deletion.body, recorder.Code, recorder.Body, deletion.want)
+		}
+	}
+
+	// Rate of the country is used again after deleting the user's rate
+	if got, want := rates(), map[string]Percentage{"Ђ": 2000, "Е": 1000, "А": 0, "R": 700}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rates after updating and deleting are %v, want %v", got, want)
+	}
+}
+
+func TestResolveTaxRate(t *testing.T) {
+	db := newTestDB(t)
+	owner := newTestHousehold(t, db, "owner")
+	member := newTestHousehold(t, db, "member")
+	db.MustExec("UPDATE households SET public_id = 'shared' WHERE id = ?", owner.HouseholdID)
+	db.MustExec("INSERT INTO household_members (household_id, user_id, role) VALUES (?, ?, 'member')", owner.HouseholdID, member.UserID)
+	db.MustExec("UPDATE users SET country = 'DE' WHERE id = ?", member.UserID)
+	db.MustExec("INSERT INTO tax_rates (public_id, user_id, label, rate) VALUES ('owners-rate', ?, 'Ђ', 1900), ('members-rate', ?, 'Ђ', 500)", owner.UserID, member.UserID)
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	// Households use rates of the user who created them and of the user's
+	// country no matter who adds the line
+	resolved := []struct {
+		householdID int
+		label       string
+		want        Percentage
+		err         error
+	}{
+		{owner.HouseholdID, "Ђ", 1900, nil},
+		{owner.HouseholdID, "Е", 1000, nil},
+		{member.HouseholdID, "Ђ", 500, nil},
+		{member.HouseholdID, "Е", 0, ErrUnknownTaxLabel},
+		{owner.HouseholdID, "X", 0, ErrUnknownTaxLabel},
+	}
+	for _, r := range resolved {
+		rate, err := resolveTaxRate(db, r.householdID, r.label)
+		if rate != r.want || err != r.err {
+			t.Errorf("rate %s of household %d is %v, %v, want %v, %v", r.label, r.householdID, rate, err, r.want, r.err)
+		}
+	}
+
+	item := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'milk', 'Milk', 150, 'l')", owner.UserID, owner.HouseholdID)
+	receipt := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'receipt', '2020-06-01 10:00:00', 'UTC')", owner.LocationID, owner.HouseholdID, owner.UserID)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'line', 1)", receipt, item)
+
+	if recorder := serve(options.PostItemsInReceipt(), "/items/inreceipt", "member", http.MethodPost, "/items/inreceipt", `{"receiptId": "receipt", "itemId": "milk", "amount": 1, "taxLabel": "Ђ"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("adding a line: got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(options.PutItemsInReceipt(), "/items/inreceipt", "member", http.MethodPut, "/items/inreceipt", `{"id": "line", "taxLabel": "Е"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("updating a line: got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(options.PutItemsInReceipt(), "/items/inreceipt", "member", http.MethodPut, "/items/inreceipt", `{"id": "line", "taxLabel": "X"}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("updating a line with an unknown label: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusBadRequest)
+	}
+
+	// Lines keep the label and the rate they were added with
+	lines := []struct {
+		PublicID string     `db:"public_id"`
+		Label    string     `db:"tax_label"`
+		Rate     Percentage `db:"tax_rate"`
+	}{}
+	if err := db.Select(&lines, "SELECT public_id, tax_label, tax_rate FROM items_in_receipt WHERE receipt_id = ? ORDER BY public_id = 'line' DESC", receipt); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Label != "Е" || lines[0].Rate != 1000 || lines[1].Label != "Ђ" || lines[1].Rate != 1900 {
+		t.Errorf("lines are %+v, want Е 10%% and Ђ 19%%", lines)
+	}
+
+	recorder := serve(options.GetTaxRates(), "/tax-rates", "member", http.MethodGet, "/tax-rates?householdId=shared", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("getting rates of the household: got %d %s", recorder.Code, recorder.Body)
+	}
+	rates := []TaxRate{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &rates); err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 3 || rates[0].PublicID != "owners-rate" {
+		t.Errorf("rates of the household are %+v, want rates of the owner", rates)
+	}
+
+	outsider := newTestHousehold(t, db, "outsider")
+	db.MustExec("UPDATE households SET public_id = 'outsiders' WHERE id = ?", outsider.HouseholdID)
+	if recorder := serve(options.GetTaxRates(), "/tax-rates", "member", http.MethodGet, "/tax-rates?householdId=outsiders", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("getting rates of another household: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestPutAccountCountry(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	if recorder := serve(options.PutAccount(), "/me", "user", http.MethodPut, "/me", `{"country": "123"}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid country: got %d %s, want %d", recorder.Code, recorder.Body, http.StatusBadRequest)
+	}
+	if recorder := serve(options.PutAccount(), "/me", "user", http.MethodPut, "/me", `{"country": "de"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// Other settings don't change
+	var account struct {
+		Country  string `db:"country"`
+		Currency string `db:"currency"`
+		TimeZone string `db:"time_zone"`
+	}
+	if err := db.Get(&account, "SELECT country, currency, time_zone FROM users WHERE id = ?", household.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Country != "DE" || account.Currency != "RSD" || account.TimeZone != "Europe/Belgrade" {
+		t.Errorf("account is %+v, want country DE with default currency and time zone", account)
+	}
+
+	if _, err := resolveTaxRate(db, household.HouseholdID, "Ђ"); err != ErrUnknownTaxLabel {
+		t.Errorf("got error %v for a rate of the previous country, want %v", err, ErrUnknownTaxLabel)
+	}
+}
+
+func TestTaxReport(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	general := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'general', 'General', 12000, 'kom')", household.UserID, household.HouseholdID)
+	special := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'special', 'Special', 5500, 'kom')", household.UserID, household.HouseholdID)
+	untaxed := insertID(t, db, "INSERT INTO items (created_by, household_id, public_id, name, price, unit) VALUES (?, ?, 'untaxed', 'Untaxed', 5000, 'kom')", household.UserID, household.HouseholdID)
+	first := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'first', '2020-06-01 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	second := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone) VALUES (?, ?, ?, 'second', '2020-06-02 10:00:00', 'UTC')", household.LocationID, household.HouseholdID, household.UserID)
+	trashed := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id, purchased_at, time_zone, deleted_at) VALUES (?, ?, ?, 'trashed', '2020-06-02 10:00:00', 'UTC', current_timestamp)", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec(`INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount, tax_label, tax_rate) VALUES
+		(?, ?, 'first-general', 1, 'Ђ', 2000),
+		(?, ?, 'first-special', 2, 'Е', 1000),
+		(?, ?, 'second-general', 1, 'Ђ', 2000),
+		(?, ?, 'trashed-general', 1, 'Ђ', 2000)`, first, general, first, special, second, general, trashed, general)
+	db.MustExec("INSERT INTO items_in_receipt (receipt_id, item_id, public_id, amount) VALUES (?, ?, 'second-untaxed', 1)", second, untaxed)
+
+	recorder := serve(options.GetTaxReport(), "/stats/taxes", "user", http.MethodGet, "/stats/taxes?from=2020-06-01&to=2020-06-30", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+	}
+	report := TaxReport{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prices include tax so 240.00 at 20% is 200.00 net and 40.00 tax
+	want := []TaxBreakdown{
+		{Label: "Ђ", Rate: 2000, Net: 20000, Tax: 4000, Gross: 24000},
+		{Label: "Е", Rate: 1000, Net: 10000, Tax: 1000, Gross: 11000},
+		{Label: "", Rate: 0, Net: 5000, Tax: 0, Gross: 5000},
+	}
+	if !reflect.DeepEqual(report.Taxes, want) {
+		t.Errorf("taxes are %+v, want %+v", report.Taxes, want)
+	}
+	if report.Net != 35000 || report.Tax != 5000 || report.Gross != 40000 {
+		t.Errorf("totals are net %d, tax %d, gross %d, want 35000, 5000, 40000", report.Net, report.Tax, report.Gross)
+	}
+}
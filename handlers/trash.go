@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/gin-gonic/gin"
+)
+
+// Types of records that can be in the trash
+const (
+	TrashLocations = "locations"
+	TrashItems     = "items"
+	TrashReceipts  = "receipts"
+)
+
+// TrashGetQuery : Structure that should be used for getting query data of a get request for trash
+type TrashGetQuery struct {
+	Type        string `form:"type" validate:"omitempty,oneof=locations items receipts"`
+	HouseholdID string `form:"householdId"`
+}
+
+// TrashEntry : Structure that should be used for getting information about deleted records from database
+type TrashEntry struct {
+	Type        string    `db:"-" json:"type"`
+	PublicID    string    `db:"public_id" json:"id"`
+	HouseholdID string    `db:"household_id" json:"householdId"`
+	Name        string    `db:"name" json:"name"`
+	DeletedAt   time.Time `db:"deleted_at" json:"deletedAt"`
+}
+
+// NotDeleted creates a condition that matches records of the table that are
+// not in the trash.
+func NotDeleted(table string) sq.Sqlizer {
+	return sq.Eq{table + ".deleted_at": nil}
+}
+
+// trashQueries creates queries for getting deleted records of each type. Name
+// of a receipt is the name of its location.
+var trashQueries = map[string]func() sq.SelectBuilder{
+	TrashLocations: func() sq.SelectBuilder {
+		return sq.Select("locations.public_id, households.public_id AS household_id, locations.name, locations.deleted_at").From("locations").Join("households ON households.id = locations.household_id").Where(sq.NotEq{"locations.deleted_at": nil})
+	},
+	TrashItems: func() sq.SelectBuilder {
+		return sq.Select("items.public_id, households.public_id AS household_id, items.name, items.deleted_at").From("items").Join("households ON households.id = items.household_id").Where(sq.NotEq{"items.deleted_at": nil})
+	},
+	TrashReceipts: func() sq.SelectBuilder {
+		return sq.Select("receipts.public_id, households.public_id AS household_id, locations.name, receipts.deleted_at").From("receipts").Join("households ON households.id = receipts.household_id").Join("locations ON locations.id = receipts.location_id").Where(sq.NotEq{"receipts.deleted_at": nil})
+	},
+}
+
+// GetTrash is a Gin handler function for getting deleted locations, items and
+// receipts that haven't been purged yet.
+func (o Options) GetTrash() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		var searchQuery TrashGetQuery
+		if err := ctx.ShouldBindQuery(&searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := o.V.Struct(searchQuery); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		types := []string{TrashLocations, TrashItems, TrashReceipts}
+		if searchQuery.Type != "" {
+			types = []string{searchQuery.Type}
+		}
+
+		trash := []TrashEntry{}
+		for _, recordType := range types {
+			query := trashQueries[recordType]().Where(MemberOf(recordType+".household_id", user.ID))
+
+			if searchQuery.HouseholdID != "" {
+				query = query.Where(sq.Eq{"households.public_id": searchQuery.HouseholdID})
+			}
+
+			queryString, queryStringArgs, err := query.ToSql()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			entries := []TrashEntry{}
+			if err := o.DB.Select(&entries, queryString, queryStringArgs...); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			for i := range entries {
+				entries[i].Type = recordType
+			}
+			trash = append(trash, entries...)
+		}
+
+		// Most recently deleted records first
+		sort.SliceStable(trash, func(i, j int) bool {
+			return trash[i].DeletedAt.After(trash[j].DeletedAt)
+		})
+
+		ctx.JSON(http.StatusOK, trash)
+	}
+}
+
+// RestoreTrash is a Gin handler function for restoring a deleted location,
+// item or receipt. Receipts that were deleted together with a location and
+// refunds that were deleted together with their original receipt are
+// restored with it. Receipt can't be restored while its location is deleted.
+func (o Options) RestoreTrash() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		createdBy, createdByExists := GetUserID(ctx)
+		if !createdByExists {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "user id not found in authorization token",
+			})
+			return
+		}
+
+		recordType := ctx.Param("type")
+		if _, ok := trashQueries[recordType]; !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": "type must be one of locations, items or receipts",
+			})
+			return
+		}
+
+		user, err := createdBy.PrivateID(o.DB)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		userOwnsQuery := sq.Select("id").From(recordType).Where(sq.Eq{"public_id": ctx.Param("id")}).Where(sq.NotEq{"deleted_at": nil}).Where(MemberOf("household_id", user.ID, WriteRoles...))
+
+		userOwnsQueryString, userOwnsQueryStringArgs, err := userOwnsQuery.ToSql()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var record StructID
+		if err := o.DB.Get(&record, userOwnsQueryString, userOwnsQueryStringArgs...); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": "not authorized to restore specified record",
+			})
+			return
+		}
+
+		if recordType == TrashReceipts {
+			var deletedLocations int
+			if err := o.DB.Get(&deletedLocations, "SELECT COUNT(*) FROM locations WHERE id = (SELECT location_id FROM receipts WHERE id = ?) AND deleted_at IS NOT NULL", record.ID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if deletedLocations != 0 {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "location of the receipt is deleted and has to be restored first",
+				})
+				return
+			}
+
+			var deletedOriginals int
+			if err := o.DB.Get(&deletedOriginals, "SELECT COUNT(*) FROM receipts WHERE id = (SELECT refund_of FROM receipts WHERE id = ?) AND deleted_at IS NOT NULL", record.ID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if deletedOriginals != 0 {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"message": "original receipt of the refund is deleted and has to be restored first",
+				})
+				return
+			}
+		}
+
+		tx, err := o.DB.Begin()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if recordType == TrashLocations {
+			if _, err := tx.Exec("UPDATE receipts SET deleted_at = NULL, delete_batch = NULL WHERE location_id = ? AND delete_batch = (SELECT delete_batch FROM locations WHERE id = ?)", record.ID, record.ID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if recordType == TrashReceipts {
+			if _, err := tx.Exec("UPDATE receipts SET deleted_at = NULL, delete_batch = NULL WHERE refund_of = ? AND delete_batch = (SELECT delete_batch FROM receipts WHERE id = ?)", record.ID, record.ID); err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE "+recordType+" SET deleted_at = NULL, delete_batch = NULL WHERE id = ?", record.ID); err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if recordType == TrashReceipts {
+			o.checkBudgets(ctx.Param("id"))
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
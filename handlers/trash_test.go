@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRestoreTrashBatches(t *testing.T) {
+	db := newTestDB(t)
+	household := newTestHousehold(t, db, "user")
+	options := Options{
+		DB: db,
+		V:  NewValidator(),
+	}
+
+	original := insertID(t, db, "INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'original')", household.LocationID, household.HouseholdID, household.UserID)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id, refund_of) VALUES (?, ?, ?, 'refund', ?)", household.LocationID, household.HouseholdID, household.UserID, original)
+	db.MustExec("INSERT INTO receipts (location_id, household_id, created_by, public_id) VALUES (?, ?, ?, 'deleted-alone'), (?, ?, ?, 'deleted-with-location')", household.LocationID, household.HouseholdID, household.UserID, household.LocationID, household.HouseholdID, household.UserID)
+
+	trashed := func() []string {
+		receipts := []string{}
+		if err := db.Select(&receipts, "SELECT public_id FROM receipts WHERE deleted_at IS NOT NULL ORDER BY id"); err != nil {
+			t.Fatal(err)
+		}
+		return receipts
+	}
+
+	// Receipts are deleted within the same second so restoring by the time of
+	// deletion would restore all of them
+	requests := []struct {
+		handler gin.HandlerFunc
+		route   string
+		method  string
+		path    string
+		body    string
+		trashed []string
+	}{
+		{options.DeleteReceipts(), "/receipts", http.MethodDelete, "/receipts", `{"id": "deleted-alone"}`, []string{"deleted-alone"}},
+		{options.DeleteReceipts(), "/receipts", http.MethodDelete, "/receipts", `{"id": "original"}`, []string{"original", "refund", "deleted-alone"}},
+		{options.RestoreTrash(), "/trash/:type/:id/restore", http.MethodPost, "/trash/receipts/original/restore", "", []string{"deleted-alone"}},
+		{options.DeleteLocations(), "/locations", http.MethodDelete, "/locations?cascade=true", `{"id": "user-location"}`, []string{"original", "refund", "deleted-alone", "deleted-with-location"}},
+		{options.RestoreTrash(), "/trash/:type/:id/restore", http.MethodPost, "/trash/locations/user-location/restore", "", []string{"deleted-alone"}},
+	}
+	for _, request := range requests {
+		if recorder := serve(request.handler, request.route, "user", request.method, request.path, request.body); recorder.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d %s", request.method, request.path, recorder.Code, recorder.Body)
+		}
+		if got := trashed(); !reflect.DeepEqual(got, request.trashed) {
+			t.Errorf("%s %s: got trashed receipts %v, want %v", request.method, request.path, got, request.trashed)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Dimensions of units
+const (
+	DimensionMass   = "mass"
+	DimensionVolume = "volume"
+	DimensionCount  = "count"
+)
+
+// ErrUnknownUnit is returned when a unit is not in the unit registry
+var ErrUnknownUnit = errors.New("unit is not one of the units listed at /units")
+
+// ErrInvalidPackage is returned when a package size is set on an item that is
+// not counted in pieces or its unit is not a unit of mass or volume
+var ErrInvalidPackage = errors.New("package size needs a positive size and a unit of mass or volume and only items counted in pieces have packages")
+
+// Unit : Structure that should be used for sending a unit of measure from the unit registry
+type Unit struct {
+	Name      string `json:"name"`
+	Dimension string `json:"dimension"`
+	// Factor converts an amount in the unit to the base unit of the dimension
+	Factor float64 `json:"factor"`
+	// Base is the unit that normalized prices of the dimension are per
+	Base string `json:"base"`
+}
+
+// units is the unit registry. Base units of dimensions are kg, l and kom.
+var units = []Unit{
+	{Name: "mg", Dimension: DimensionMass, Factor: 0.000001, Base: "kg"},
+	{Name: "g", Dimension: DimensionMass, Factor: 0.001, Base: "kg"},
+	{Name: "dag", Dimension: DimensionMass, Factor: 0.01, Base: "kg"},
+	{Name: "kg", Dimension: DimensionMass, Factor: 1, Base: "kg"},
+	{Name: "t", Dimension: DimensionMass, Factor: 1000, Base: "kg"},
+	{Name: "ml", Dimension: DimensionVolume, Factor: 0.001, Base: "l"},
+	{Name: "cl", Dimension: DimensionVolume, Factor: 0.01, Base: "l"},
+	{Name: "dl", Dimension: DimensionVolume, Factor: 0.1, Base: "l"},
+	{Name: "l", Dimension: DimensionVolume, Factor: 1, Base: "l"},
+	{Name: defaultItemUnit, Dimension: DimensionCount, Factor: 1, Base: defaultItemUnit},
+	{Name: "pcs", Dimension: DimensionCount, Factor: 1, Base: defaultItemUnit},
+}
+
+// LookupUnit finds a unit in the unit registry. Case of the name and spaces
+// around it are ignored.
+func LookupUnit(name string) (Unit, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, unit := range units {
+		if unit.Name == name {
+			return unit, true
+		}
+	}
+	return Unit{}, false
+}
+
+// validPackage checks a package size of an item with the unit. Items without
+// a package size are always valid.
+func validPackage(unit string, packageSize *float64, packageUnit *string) error {
+	if packageSize == nil && packageUnit == nil {
+		return nil
+	}
+	if packageSize == nil || packageUnit == nil || *packageSize <= 0 {
+		return ErrInvalidPackage
+	}
+
+	itemUnit, ok := LookupUnit(unit)
+	if !ok || itemUnit.Dimension != DimensionCount {
+		return ErrInvalidPackage
+	}
+
+	sizeUnit, ok := LookupUnit(*packageUnit)
+	if !ok || sizeUnit.Dimension == DimensionCount {
+		return ErrInvalidPackage
+	}
+
+	return nil
+}
+
+// NormalizePrice converts a price per unit to a price per base unit of its
+// dimension, like a price of 500 g to a price per kg. Prices of items counted
+// in pieces with a package size are per base unit of the package. Prices in
+// units that are not in the registry can't be normalized and nil is returned.
+// Units are looked up ignoring case, so free-text units of items added before
+// the registry like "KG" are normalized and ones like "PAK" return nil.
+func NormalizePrice(price Money, unit string, packageSize *float64, packageUnit *string) (*Money, *string) {
+	registered, ok := LookupUnit(unit)
+	if !ok {
+		return nil, nil
+	}
+
+	quantity := registered.Factor
+	base := registered.Base
+	if registered.Dimension == DimensionCount && packageSize != nil && packageUnit != nil && *packageSize > 0 {
+		if sizeUnit, ok := LookupUnit(*packageUnit); ok {
+			quantity = *packageSize * sizeUnit.Factor
+			base = sizeUnit.Base
+		}
+	}
+
+	normalized := Money(math.Round(float64(price) / quantity))
+	return &normalized, &base
+}
+
+// GetUnits is a Gin handler function for getting the unit registry.
+func (o Options) GetUnits() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, units)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestLookupUnit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"kg", "kg", true},
+		{" G ", "g", true},
+		{"KOM", "kom", true},
+		{"pcs", "pcs", true},
+		{"kilo", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		got, ok := LookupUnit(test.in)
+		if ok != test.ok || got.Name != test.want {
+			t.Errorf("LookupUnit(%q) = %q, %t, want %q, %t", test.in, got.Name, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestValidPackage(t *testing.T) {
+	size := func(size float64) *float64 { return &size }
+	unit := func(unit string) *string { return &unit }
+
+	tests := []struct {
+		unit        string
+		packageSize *float64
+		packageUnit *string
+		want        error
+	}{
+		{"kg", nil, nil, nil},
+		{"kom", size(500), unit("g"), nil},
+		{"pcs", size(1.5), unit("L"), nil},
+		{"kom", size(500), nil, ErrInvalidPackage},
+		{"kom", nil, unit("g"), ErrInvalidPackage},
+		{"kom", size(0), unit("g"), ErrInvalidPackage},
+		{"kom", size(6), unit("kom"), ErrInvalidPackage},
+		{"kom", size(500), unit("grams"), ErrInvalidPackage},
+		{"kg", size(500), unit("g"), ErrInvalidPackage},
+		{"l", size(1), unit("l"), ErrInvalidPackage},
+		{"box", size(500), unit("g"), ErrInvalidPackage},
+	}
+	for _, test := range tests {
+		if got := validPackage(test.unit, test.packageSize, test.packageUnit); got != test.want {
+			t.Errorf("validPackage(%q, %v, %v) = %v, want %v", test.unit, test.packageSize, test.packageUnit, got, test.want)
+		}
+	}
+}
+
+func TestNormalizePrice(t *testing.T) {
+	size := func(size float64) *float64 { return &size }
+	unit := func(unit string) *string { return &unit }
+
+	tests := []struct {
+		price       Money
+		unit        string
+		packageSize *float64
+		packageUnit *string
+		want        Money
+		base        string
+	}{
+		{14999, "kg", nil, nil, 14999, "kg"},
+		{1500, "g", nil, nil, 1500000, "kg"},
+		{1500, "dag", nil, nil, 150000, "kg"},
+		{4999, "dl", nil, nil, 49990, "l"},
+		{12999, "kom", nil, nil, 12999, "kom"},
+		{12999, "pcs", nil, nil, 12999, "kom"},
+		{12999, "kom", size(500), unit("g"), 25998, "kg"},
+		{14999, "kom", size(1.5), unit("l"), 9999, "l"},
+		{12999, "kom", size(500), unit("grams"), 12999, "kom"},
+	}
+	for _, test := range tests {
+		got, base := NormalizePrice(test.price, test.unit, test.packageSize, test.packageUnit)
+		if got == nil || base == nil {
+			t.Errorf("NormalizePrice(%d, %q, %v, %v) = nil, want %d per %s", test.price, test.unit, test.packageSize, test.packageUnit, test.want, test.base)
+			continue
+		}
+		if *got != test.want || *base != test.base {
+			t.Errorf("NormalizePrice(%d, %q, %v, %v) = %d per %s, want %d per %s", test.price, test.unit, test.packageSize, test.packageUnit, *got, *base, test.want, test.base)
+		}
+	}
+
+	if got, base := NormalizePrice(12999, "box", nil, nil); got != nil || base != nil {
+		t.Errorf("NormalizePrice of an unknown unit = %v per %v, want nil", got, base)
+	}
+}
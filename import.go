@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dusansimic/receipts-archive-backend/handlers"
+	"github.com/jmoiron/sqlx"
+)
+
+// importUsage is the usage of the import command
+const importUsage = `Usage: receipts-archive-backend import -user ID [options] FILE
+
+Imports receipts from a csv or a json file. Nothing is imported if any row is
+invalid. Json files contain an array of receipts like the receipts of
+POST /import/receipts and csv files have a line of a receipt in each row.
+
+Options:
+`
+
+// runImport runs the import command with its arguments
+func runImport(db *sqlx.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), importUsage)
+		flags.PrintDefaults()
+	}
+
+	userPublicID := flags.String("user", "", "public id of the user that imports receipts")
+	householdPublicID := flags.String("household", "", "public id of the household, the first household of the user if it's not specified")
+	format := flags.String("format", "", "format of the file, csv or json (default is the file extension)")
+	mappingPath := flags.String("mapping", "", "json file with the mapping of csv columns")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without importing")
+	flags.Parse(args)
+
+	if *userPublicID == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("user and file must be specified")
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	var userID int
+	if err := db.Get(&userID, "SELECT id FROM users WHERE public_id = ?", *userPublicID); err != nil {
+		return fmt.Errorf("user %s not found: %v", *userPublicID, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var report *handlers.BulkImportReport
+	switch *format {
+	case "csv":
+		mapping := handlers.CSVMapping{}
+		if *mappingPath != "" {
+			data, err := ioutil.ReadFile(*mappingPath)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &mapping); err != nil {
+				return fmt.Errorf("invalid mapping: %v", err)
+			}
+		}
+
+		report, err = handlers.ImportReceiptsCSV(db, userID, *householdPublicID, file, mapping, *dryRun)
+	case "json":
+		var receipts []handlers.BulkImportReceipt
+		if err := json.NewDecoder(file).Decode(&receipts); err != nil {
+			return fmt.Errorf("invalid json: %v", err)
+		}
+
+		report, err = handlers.BulkImport(db, userID, *householdPublicID, receipts, *dryRun)
+	default:
+		return fmt.Errorf("unknown format %q, use csv or json", *format)
+	}
+	if err != nil {
+		return importError(err)
+	}
+
+	// Only exchange rates in the database are used for budgets since the
+	// rate provider is not configured for the command
+	if !*dryRun {
+		if err := handlers.CheckBudgets(db, nil, report.ReceiptIDs()); err != nil {
+			fmt.Fprintln(os.Stderr, "checking budgets failed:", err)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// importError writes invalid rows of an import to standard error
+func importError(err error) error {
+	errs, ok := err.(handlers.BulkImportErrors)
+	if !ok {
+		return err
+	}
+
+	for _, e := range errs {
+		location := fmt.Sprintf("row %d", e.Row)
+		if e.Line != 0 {
+			location += fmt.Sprintf(", line %d", e.Line)
+		}
+		if e.Field != "" {
+			location += ", " + e.Field
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", location, e.Message)
+	}
+
+	return err
+}
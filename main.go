@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	// Server related stuff
 	"github.com/dusansimic/receipts-archive-backend/database"
@@ -25,18 +26,74 @@ func main() {
 		panic(err)
 	}
 
-	sessionStore := database.MemcachedOptions{
-		Addr: os.Getenv("SESSION_STORE_DATABASE_ADDRESS"),
+	// Receipts can be imported from the command line without the server
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(db, os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
-	sessionStoreConnection := sessionStore.NewConnection()
+
+	sessionStoreOptions := database.SessionStoreOptions{
+		Type:     os.Getenv("SESSION_STORE"),
+		Addr:     os.Getenv("SESSION_STORE_DATABASE_ADDRESS"),
+		Password: os.Getenv("SESSION_STORE_DATABASE_PASSWORD"),
+	}
+	sessionStore, err := sessionStoreOptions.NewSessionStore()
+	if err != nil {
+		fmt.Println("Failed to create the session store!")
+		fmt.Println(err)
+		panic(err)
+	}
+
+	rateProviderOptions := database.ExchangeRateProviderOptions{
+		Type: os.Getenv("EXCHANGE_RATE_PROVIDER"),
+		URL:  os.Getenv("EXCHANGE_RATE_PROVIDER_URL"),
+	}
+	rateProvider, err := rateProviderOptions.NewExchangeRateProvider()
+	if err != nil {
+		fmt.Println("Failed to create the exchange rate provider!")
+		fmt.Println(err)
+		panic(err)
+	}
+
+	productLookupOptions := database.ProductLookupOptions{
+		Type: os.Getenv("PRODUCT_LOOKUP"),
+		URL:  os.Getenv("PRODUCT_LOOKUP_URL"),
+	}
+	productLookup, err := productLookupOptions.NewProductLookup()
+	if err != nil {
+		fmt.Println("Failed to create the product lookup!")
+		fmt.Println(err)
+		panic(err)
+	}
+
+	// Deleted records are kept for 30 days unless configured otherwise
+	trashOptions := database.TrashOptions{
+		Retention: 30 * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		trashOptions.Retention, err = time.ParseDuration(retention)
+		if err != nil {
+			fmt.Println("Failed to parse the trash retention period!")
+			fmt.Println(err)
+			panic(err)
+		}
+	}
+	go trashOptions.StartPurging(db)
 
 	// engn because engine is used
 	engn := engine.Options{
 		AllowOrigins:       strings.Split(os.Getenv("ALLOW_ORIGINS"), ","),
 		Database:           db,
-		SessionStore:       sessionStoreConnection,
+		SessionStore:       sessionStore,
 		SessionStoreSecret: []byte(os.Getenv("SESSION_COOKIE_SECRET")),
 		GothicCookieSecret: []byte(os.Getenv("GOTHIC_COOKIE_SECRET")),
+		AdminUsers:         strings.Split(os.Getenv("ADMIN_USERS"), ","),
+		RateProvider:       rateProvider,
+		ProductLookup:      productLookup,
 		GoogleOAuthOptions: engine.GoogleOAuthOptions{
 			ClientKey:    os.Getenv("GOOGLE_OAUTH_CLIENT_KEY"),
 			ClientSecret: os.Getenv("GOOGLE_OAUTH_CLIENT_SECRET"),